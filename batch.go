@@ -0,0 +1,132 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/combined"
+)
+
+const (
+	// batchWorkers is the maximum amount of packages
+	// from a single batch request that are searched at once.
+	batchWorkers = 4
+	// maxBatchPackages is the maximum amount of
+	// packages that a batch request can contain.
+	maxBatchPackages = 1000
+)
+
+// batchResult is a single line of the response to a batch equivalence request
+type batchResult struct {
+	Package string            `json:"package"`
+	Results []store.TagResult `json:"results"`
+	// Partial is true if the search timed out, so
+	// the results may not contain every match
+	Partial bool   `json:"partial,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// streamEquivalents searches in for the equivalents of each of the given packages
+// from the from store, using up to [batchWorkers] workers. Each search acquires its
+// own slot from slots. The results for each package are written to w as a line of
+// JSON as soon as they're found, so the lines are in the order the searches finished
+// rather than the order of pkgNames. Errors for individual packages are reported in
+// their lines instead of stopping the batch.
+func streamEquivalents(ctx context.Context, w http.ResponseWriter, from, in store.ReadOnly, pkgNames []string, query url.Values, sc searchConfig, slots *searchSlots) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	mtx := &sync.Mutex{}
+	enc := json.NewEncoder(w)
+	write := func(res batchResult) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		enc.Encode(res)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	jobs := make(chan string)
+	wg := &sync.WaitGroup{}
+	for range min(batchWorkers, len(pkgNames)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pkgName := range jobs {
+				write(equivalents(ctx, from, in, pkgName, query, sc, slots))
+			}
+		}()
+	}
+
+	for _, pkgName := range pkgNames {
+		select {
+		case jobs <- pkgName:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// equivalents searches in for the equivalents of the given package from the from store,
+// holding a slot from slots while it runs
+func equivalents(ctx context.Context, from, in store.ReadOnly, pkgName string, query url.Values, sc searchConfig, slots *searchSlots) batchResult {
+	out := batchResult{Package: pkgName, Results: []store.TagResult{}}
+
+	release, err := slots.acquire(ctx)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer release()
+
+	pkg, err := from.GetPkg(pkgName)
+	if errors.Is(err, pebble.ErrNotFound) || errors.Is(err, combined.ErrNotFound) {
+		out.Error = "no such package"
+		return out
+	} else if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+
+	results, _, err := searchQuery(in, pkg.Tags, query, sc)
+	out.Partial = errors.Is(err, store.ErrPartial)
+	if err != nil && !out.Partial {
+		out.Error = err.Error()
+	} else if results != nil {
+		out.Results = roundConfidences(results, sc.Precision)
+	}
+	return out
+}
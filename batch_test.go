@@ -0,0 +1,141 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+// countingStore records the maximum number of searches that ran at once
+type countingStore struct {
+	*mem.Store
+	running, max atomic.Int32
+}
+
+func (cs *countingStore) Search(tags []string) ([]store.TagResult, time.Duration, error) {
+	n := cs.running.Add(1)
+	defer cs.running.Add(-1)
+	for {
+		cur := cs.max.Load()
+		if n <= cur || cs.max.CompareAndSwap(cur, n) {
+			break
+		}
+	}
+	// Give the other workers a chance to overlap with this search
+	time.Sleep(5 * time.Millisecond)
+	return cs.Store.Search(tags)
+}
+
+func TestStreamEquivalents(t *testing.T) {
+	from := mem.New()
+	from.Add("vim", "bin=vim")
+	from.Add("nano", "bin=nano")
+	from.Add("emacs", "bin=emacs")
+
+	tests := []struct {
+		name      string
+		pkgs      []string
+		slots     int
+		fillSlots bool
+		wantErr   map[string]string
+	}{
+		{
+			name:    "every package gets a line",
+			pkgs:    []string{"vim", "nano", "emacs", "missing"},
+			slots:   4,
+			wantErr: map[string]string{"missing": "no such package"},
+		},
+		{
+			name:  "one slot",
+			pkgs:  []string{"vim", "nano", "emacs", "vim"},
+			slots: 1,
+		},
+		{
+			name:      "busy",
+			pkgs:      []string{"vim", "nano"},
+			slots:     1,
+			fillSlots: true,
+			wantErr:   map[string]string{"vim": errBusy.Error(), "nano": errBusy.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &countingStore{Store: mem.New()}
+			in.Add("vim", "bin=vim")
+			in.Add("nano", "bin=nano")
+			in.Add("emacs", "bin=emacs")
+
+			slots := &searchSlots{sem: make(chan struct{}, tt.slots), timeout: 50 * time.Millisecond}
+			if tt.fillSlots {
+				for range tt.slots {
+					slots.sem <- struct{}{}
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			streamEquivalents(context.Background(), rec, from, in, tt.pkgs, url.Values{}, searchConfig{Precision: -1}, slots)
+
+			lines := map[string]int{}
+			sc := bufio.NewScanner(rec.Body)
+			for sc.Scan() {
+				var res batchResult
+				if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				lines[res.Package]++
+				if res.Error != tt.wantErr[res.Package] {
+					t.Errorf("%s: got error %q, want %q", res.Package, res.Error, tt.wantErr[res.Package])
+				}
+				if res.Error == "" && (len(res.Results) == 0 || res.Results[0].Package.Name != res.Package) {
+					t.Errorf("%s: got results %+v", res.Package, res.Results)
+				}
+			}
+
+			want := map[string]int{}
+			for _, pkg := range tt.pkgs {
+				want[pkg]++
+			}
+			for pkg, n := range want {
+				if lines[pkg] != n {
+					t.Errorf("%s: got %d lines, want %d", pkg, lines[pkg], n)
+				}
+			}
+
+			if max := int(in.max.Load()); max > tt.slots {
+				t.Errorf("%d searches ran at once with %d slots", max, tt.slots)
+			} else if max == 0 && !tt.fillSlots {
+				t.Error("no searches ran")
+			}
+		})
+	}
+}
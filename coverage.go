@@ -0,0 +1,150 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// coverageMiss is a line of a coverage report for a
+// package that doesn't have a good equivalent
+type coverageMiss struct {
+	Package string `json:"package"`
+	// Best is the package's best equivalent, if it has any
+	Best  *store.TagResult `json:"best,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+// coverageSummary contains the totals of a coverage report
+type coverageSummary struct {
+	// Total is the amount of packages that were compared
+	Total int `json:"total"`
+	// Categories contains the amount of packages whose best
+	// equivalent is in each result category
+	Categories map[store.Category]int `json:"categories"`
+	// NoMatch is the amount of packages without any equivalents
+	NoMatch int `json:"noMatch"`
+	// Errors is the amount of packages that couldn't be compared
+	Errors int `json:"errors"`
+}
+
+// coverageEnd is the last line of a coverage report
+type coverageEnd struct {
+	Summary coverageSummary `json:"summary"`
+	// Error is set if the report was cut short
+	Error string `json:"error,omitempty"`
+}
+
+// goodMatch reports whether a result in the given category counts
+// as a good equivalent in a coverage report
+func goodMatch(category store.Category) bool {
+	return category == store.CategoryExact || category == store.CategoryStrong
+}
+
+// streamCoverage compares every package in the from store with the in store, using up
+// to [batchWorkers] workers. Each search acquires its own slot from slots. Each package
+// without an exact or strong equivalent is written to w as a line of JSON as soon as it's
+// found, and the last line contains a summary of the whole report. If from doesn't
+// implement [store.Lister], an error is returned before anything is written.
+func streamCoverage(ctx context.Context, w http.ResponseWriter, from, in store.ReadOnly, query url.Values, sc searchConfig, slots *searchSlots) error {
+	lister, ok := from.(store.Lister)
+	if !ok {
+		return httpError{store.ErrListUnsupported, http.StatusNotImplemented}
+	}
+
+	// Every result has to be counted, so the
+	// category filter doesn't apply to reports.
+	query = maps.Clone(query)
+	delete(query, "category")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	mtx := &sync.Mutex{}
+	enc := json.NewEncoder(w)
+	write := func(line any) {
+		enc.Encode(line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	summary := coverageSummary{Categories: map[store.Category]int{}}
+	record := func(res batchResult) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		summary.Total++
+		miss := coverageMiss{Package: res.Package, Error: res.Error}
+		switch {
+		case res.Error != "":
+			summary.Errors++
+		case len(res.Results) == 0:
+			summary.NoMatch++
+		default:
+			summary.Categories[res.Results[0].Category]++
+			if goodMatch(res.Results[0].Category) {
+				return
+			}
+			miss.Best = &res.Results[0]
+		}
+		write(miss)
+	}
+
+	jobs := make(chan string)
+	wg := &sync.WaitGroup{}
+	for range batchWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pkgName := range jobs {
+				record(equivalents(ctx, from, in, pkgName, query, sc, slots))
+			}
+		}()
+	}
+
+	err := lister.ListPkgNames(ctx, func(name string) error {
+		select {
+		case jobs <- name:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	end := coverageEnd{Summary: summary}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	write(end)
+	return nil
+}
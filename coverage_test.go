@@ -0,0 +1,95 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestStreamCoverage(t *testing.T) {
+	from := mem.New()
+	from.Add("vim", "bin=vim")
+	from.Add("nano", "bin=nano")
+	from.Add("ed", "bin=ed")
+
+	tests := []struct {
+		name        string
+		slots       int
+		fillSlots   bool
+		wantMatched int
+		wantNoMatch int
+		wantErrors  int
+	}{
+		{name: "four slots", slots: 4, wantMatched: 2, wantNoMatch: 1},
+		{name: "one slot", slots: 1, wantMatched: 2, wantNoMatch: 1},
+		{name: "busy", slots: 1, fillSlots: true, wantErrors: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &countingStore{Store: mem.New()}
+			in.Add("vim", "bin=vim")
+			in.Add("nano", "bin=nano")
+
+			slots := &searchSlots{sem: make(chan struct{}, tt.slots), timeout: 50 * time.Millisecond}
+			if tt.fillSlots {
+				for range tt.slots {
+					slots.sem <- struct{}{}
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			err := streamCoverage(context.Background(), rec, from, in, url.Values{}, searchConfig{Precision: -1}, slots)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var end coverageEnd
+			sc := bufio.NewScanner(rec.Body)
+			for sc.Scan() {
+				if err := json.Unmarshal(sc.Bytes(), &end); err != nil {
+					t.Fatal(err)
+				}
+			}
+			summary := end.Summary
+
+			matched := 0
+			for _, n := range summary.Categories {
+				matched += n
+			}
+			if summary.Total != 3 || matched != tt.wantMatched || summary.NoMatch != tt.wantNoMatch || summary.Errors != tt.wantErrors {
+				t.Errorf("got summary %+v", summary)
+			}
+			if max := int(in.max.Load()); max > tt.slots {
+				t.Errorf("%d searches ran at once with %d slots", max, tt.slots)
+			}
+		})
+	}
+}
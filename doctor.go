@@ -0,0 +1,176 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/pull"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// doctorTimeout is the maximum amount of time that
+// checking whether an index is reachable can take.
+const doctorTimeout = 30 * time.Second
+
+// doctorReport writes the results of diagnostic checks to w
+type doctorReport struct {
+	w      io.Writer
+	failed bool
+}
+
+// check writes the result of a single check. The check passed if err is nil.
+func (dr *doctorReport) check(name, result string, err error) {
+	if err != nil {
+		dr.failed = true
+		fmt.Fprintf(dr.w, "[FAIL] %s: %v\n", name, err)
+	} else {
+		fmt.Fprintf(dr.w, "[PASS] %s: %s\n", name, result)
+	}
+}
+
+// doctor implements the doctor command, which checks for common problems with
+// distrohop's configuration, data directory, indices, and repos, and writes a
+// report to w. It returns the exit code, which is 1 if any of the checks failed.
+// The server shouldn't be running at the same time, since it keeps the databases open.
+func doctor(w io.Writer) int {
+	dr := &doctorReport{w: w}
+
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	dr.check("Configuration", fmt.Sprintf("%d repos configured", len(cfg.Repos)), err)
+	if err != nil {
+		return 1
+	}
+	dr.checkAll(cfg, newFetcher(cfg))
+	if dr.failed {
+		return 1
+	}
+	return 0
+}
+
+// checkAll checks the data directory, indices, and repos configured in cfg,
+// downloading from the repos using fetcher. Nothing is logged while checking,
+// since all the problems are in the report.
+func (dr *doctorReport) checkAll(cfg *config.Config, fetcher index.Fetcher) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	dataDir, err := dataDirectory(cfg)
+	if err == nil {
+		err = checkWritable(dataDir)
+	}
+	dr.check("Data directory", dataDir+" is writable", err)
+
+	for _, repo := range cfg.Repos {
+		importer, err := repoImporter(repo)
+		dr.check(repo.Name, "using the "+repo.Type+" importer", err)
+		if err != nil {
+			continue
+		}
+
+		for _, repoName := range repo.Repos {
+			for _, arch := range repo.Architectures {
+				name := strings.Trim(repo.Name+" "+repoName+"/"+arch, " /")
+
+				result, err := checkStore(indexDBPath(dataDir, repo, repoName, arch))
+				dr.check(name+" database", result, err)
+
+				ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+				indexURL, err := pull.CheckReachable(ctx, pullOptions(log, fetcher, repo, repoName, arch, cfg.TempDir), importer)
+				cancel()
+				dr.check(name+" index", "reachable at "+indexURL, err)
+			}
+		}
+	}
+}
+
+// checkWritable checks whether files can be created in dir,
+// creating it if it doesn't exist.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	fl, err := os.CreateTemp(dir, "distrohop-doctor.*")
+	if err != nil {
+		return err
+	}
+	fl.Close()
+	return os.Remove(fl.Name())
+}
+
+// checkStore checks whether the database at dbPath can be opened and
+// whether it has a bloom filter for every package name starting character.
+// The database isn't created if it doesn't exist.
+func checkStore(dbPath string) (string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return "", errors.New("database doesn't exist; the index hasn't been pulled yet")
+	} else if err != nil {
+		return "", err
+	}
+
+	s, err := store.Open(dbPath)
+	if err != nil {
+		return "", fmt.Errorf("%w (is distrohop already running?)", err)
+	}
+	defer s.Close()
+
+	counts, err := s.Count()
+	if err != nil {
+		return "", err
+	} else if counts.PackageCount == 0 {
+		return "", errors.New("database doesn't contain any packages")
+	}
+
+	var missing, corrupt []string
+	for char := range counts.CharTagCounts {
+		_, err := s.GetFilter(char)
+		if errors.Is(err, pebble.ErrNotFound) {
+			missing = append(missing, string(char))
+		} else if errors.Is(err, store.ErrCorruptFilter) {
+			corrupt = append(corrupt, string(char))
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	if len(missing) != 0 || len(corrupt) != 0 {
+		return "", fmt.Errorf(
+			"%d bloom filters are missing and %d are corrupted; run distrohop rebuild to fix them",
+			len(missing), len(corrupt),
+		)
+	}
+
+	return fmt.Sprintf("%d packages, %d bloom filters", counts.PackageCount, len(counts.CharTagCounts)), nil
+}
@@ -0,0 +1,161 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+func TestDoctorCheckAll(t *testing.T) {
+	const contents = "usr/bin/vim editors/vim\n"
+
+	tests := []struct {
+		name       string
+		contents   string
+		repoType   string
+		setup      func(t *testing.T, dataDir, dbPath string) string
+		wantFailed bool
+		want       []string
+	}{
+		{
+			name:     "healthy",
+			contents: contents,
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				writeTestDB(t, dbPath, "vim", "bin=vim")
+				return dataDir
+			},
+			want: []string{
+				"[PASS] Data directory",
+				"[PASS] debian: using the apt importer",
+				"[PASS] debian main/amd64 database: 1 packages, 1 bloom filters",
+				"[PASS] debian main/amd64 index: reachable at ",
+			},
+		},
+		{
+			name:     "not pulled",
+			contents: contents,
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				return dataDir
+			},
+			wantFailed: true,
+			want: []string{
+				"[FAIL] debian main/amd64 database: database doesn't exist",
+				"[PASS] debian main/amd64 index",
+			},
+		},
+		{
+			name: "unreachable",
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				writeTestDB(t, dbPath, "vim", "bin=vim")
+				return dataDir
+			},
+			wantFailed: true,
+			want: []string{
+				"[PASS] debian main/amd64 database",
+				"[FAIL] debian main/amd64 index",
+			},
+		},
+		{
+			name:     "missing filters",
+			contents: contents,
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				s, err := store.Open(dbPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer s.Close()
+				err = s.WriteBatch(map[string]index.Record{"vim": {Name: "vim", Tags: []string{"bin=vim"}}}, store.NewFilters(nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return dataDir
+			},
+			wantFailed: true,
+			want:       []string{"[FAIL] debian main/amd64 database: 1 bloom filters are missing"},
+		},
+		{
+			name:     "unknown importer",
+			contents: contents,
+			repoType: "foo",
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				return dataDir
+			},
+			wantFailed: true,
+			want:       []string{"[FAIL] debian: "},
+		},
+		{
+			name:     "unwritable data directory",
+			contents: contents,
+			setup: func(t *testing.T, dataDir, dbPath string) string {
+				// Permissions don't stop root from writing to a directory,
+				// so use a regular file as the data directory.
+				notDir := filepath.Join(dataDir, "file")
+				if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return notDir
+			},
+			wantFailed: true,
+			want:       []string{"[FAIL] Data directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newContentsServer(t, tt.contents)
+			repo := config.Repo{
+				Name:          "debian",
+				Type:          "apt",
+				BaseURL:       srv.URL,
+				Version:       "stable",
+				Repos:         []string{"main"},
+				Architectures: []string{"amd64"},
+			}
+			if tt.repoType != "" {
+				repo.Type = tt.repoType
+			}
+			dataDir := t.TempDir()
+			dataDir = tt.setup(t, dataDir, indexDBPath(dataDir, repo, "main", "amd64"))
+
+			out := &strings.Builder{}
+			dr := &doctorReport{w: out}
+			dr.checkAll(&config.Config{DataDir: dataDir, Repos: []config.Repo{repo}}, http.DefaultClient)
+
+			if dr.failed != tt.wantFailed {
+				t.Errorf("got failed = %t, want %t", dr.failed, tt.wantFailed)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report doesn't contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
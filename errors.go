@@ -26,6 +26,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"go.elara.ws/salix"
 )
 
@@ -44,7 +45,8 @@ func handleErrJSON(fn func(w http.ResponseWriter, r *http.Request) error) http.H
 				w.WriteHeader(http.StatusInternalServerError)
 			}
 			json.NewEncoder(w).Encode(map[string]any{
-				"error": err.Error(),
+				"error":     err.Error(),
+				"requestID": middleware.GetReqID(r.Context()),
 			})
 		}
 	})
@@ -59,10 +61,20 @@ func handleErrGUI(ns *salix.Namespace, fn func(w http.ResponseWriter, r *http.Re
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
 			}
-			ns.ExecuteTemplate(w, "error.html", map[string]any{
-				"page": "Error",
-				"err":  err.Error(),
+			executeTemplate(ns, w, r, "error.html", map[string]any{
+				"page":      "Error",
+				"err":       err.Error(),
+				"requestID": middleware.GetReqID(r.Context()),
 			})
 		}
 	})
 }
+
+// guiErrHandler returns a function that works like [handleErrJSON],
+// but renders errors using the error page from ns, for middleware
+// that can protect both API and HTML routes, such as [requireAdmin].
+func guiErrHandler(ns *salix.Namespace) func(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+		return handleErrGUI(ns, fn)
+	}
+}
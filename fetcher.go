@@ -0,0 +1,100 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/s3"
+)
+
+// newFetcher returns the client that's used to download indices. Besides HTTP,
+// it supports file:// URLs, so that repos can be read from local mirrors, and
+// s3:// URLs, so that they can be downloaded from S3-compatible object storage.
+// The protocols are registered with a copy of the default transport, so other
+// HTTP clients aren't affected.
+func newFetcher(cfg *config.Config) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", newLocalFileTransport(localRepoDirs(cfg)))
+	t.RegisterProtocol("s3", &s3.Transport{
+		Endpoint:  cfg.S3.Endpoint,
+		Region:    cfg.S3.Region,
+		AccessKey: cfg.S3.AccessKey,
+		SecretKey: cfg.S3.SecretKey,
+	})
+	return &http.Client{Transport: t}
+}
+
+// localRepoDirs returns the directories of the repos in cfg that have a file://
+// base URL. If a base URL contains variables, the directory that contains the
+// first one is used, since the variables may be expanded to any name in it.
+func localRepoDirs(cfg *config.Config) []string {
+	var dirs []string
+	for _, repo := range cfg.Repos {
+		u, err := url.Parse(repo.BaseURL)
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		dir := u.Path
+		if i := strings.IndexByte(dir, '$'); i >= 0 {
+			dir = dir[:strings.LastIndexByte(dir[:i], '/')+1]
+		}
+		dirs = append(dirs, path.Clean("/"+dir))
+	}
+	return dirs
+}
+
+// localFileTransport is an [http.RoundTripper] that reads file:// URLs from the
+// local filesystem. Only files inside its directories can be read, so that index
+// URLs can't be used to read any other files on the host.
+type localFileTransport struct {
+	dirs  []string
+	files http.RoundTripper
+}
+
+// newLocalFileTransport returns a transport that can read files inside dirs
+func newLocalFileTransport(dirs []string) localFileTransport {
+	return localFileTransport{
+		dirs:  dirs,
+		files: http.NewFileTransport(http.Dir("/")),
+	}
+}
+
+// RoundTrip reads the file at the request's URL, if it's inside one of t's directories
+func (t localFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	filePath := path.Clean("/" + req.URL.Path)
+	for _, dir := range t.dirs {
+		if filePath == dir || strings.HasPrefix(filePath, strings.TrimSuffix(dir, "/")+"/") {
+			return t.files.RoundTrip(req)
+		}
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, fmt.Errorf("file: %s isn't inside the directory of a local repo", filePath)
+}
@@ -0,0 +1,94 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+)
+
+func TestLocalRepoDirs(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{
+		{BaseURL: "https://deb.debian.org/debian"},
+		{BaseURL: "file:///srv/mirror/debian"},
+		{BaseURL: "file:///srv/mirror/arch/$repo/os/$arch"},
+		{BaseURL: "file:///srv/mirror/fedora-$version"},
+		{BaseURL: "s3://bucket/alpine"},
+	}}
+	want := []string{"/srv/mirror/debian", "/srv/mirror/arch", "/srv/mirror"}
+	if got := localRepoDirs(cfg); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLocalFileTransport(t *testing.T) {
+	dir := t.TempDir()
+	repoDir := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(repoDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(repoDir, "index"), filepath.Join(dir, "secret")} {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &http.Client{Transport: newLocalFileTransport([]string{filepath.ToSlash(repoDir)})}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"inside", "/repo/index", false},
+		{"outside", "/secret", true},
+		{"traversal", "/repo/../secret", true},
+		{"sibling prefix", "/repository/index", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Get("file://" + filepath.ToSlash(dir) + tt.path)
+			if tt.wantErr {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != http.StatusOK || string(data) != "data" {
+				t.Errorf("got status %d and body %q", res.StatusCode, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"go.elara.ws/distrohop/internal/store/cached"
+)
+
+// flushCaches flushes the search cache of the given repo, or of every repo
+// if it's empty, and writes the names of the flushed repos to w as JSON.
+func flushCaches(w io.Writer, caches map[string]cached.Store, repo string) error {
+	flushed := []string{}
+	if repo != "" {
+		cache, ok := caches[repo]
+		if !ok {
+			return httpError{fmt.Errorf("no such repo: %q", repo), http.StatusNotFound}
+		}
+		cache.Flush()
+		flushed = append(flushed, repo)
+	} else {
+		for name, cache := range caches {
+			cache.Flush()
+			flushed = append(flushed, name)
+		}
+		slices.Sort(flushed)
+	}
+
+	return json.NewEncoder(w).Encode(map[string]any{
+		"flushed": flushed,
+	})
+}
@@ -0,0 +1,107 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/cached"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+// searchCounter counts the searches that reach the underlying store
+type searchCounter struct {
+	*mem.Store
+	searches int
+}
+
+func (sc *searchCounter) Search(tags []string) ([]store.TagResult, time.Duration, error) {
+	sc.searches++
+	return sc.Store.Search(tags)
+}
+
+func TestFlushCaches(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        string
+		repo        string
+		wantStatus  int
+		wantBody    string
+		wantFlushed []string
+	}{
+		{"all", "Bearer secret", "", http.StatusOK, `{"flushed":["arch","debian"]}`, []string{"arch", "debian"}},
+		{"one repo", "Bearer secret", "debian", http.StatusOK, `{"flushed":["debian"]}`, []string{"debian"}},
+		{"unknown repo", "Bearer secret", "fedora", http.StatusNotFound, `"error":"no such repo: \"fedora\""`, nil},
+		{"wrong token", "Bearer wrong", "", http.StatusUnauthorized, `"error":"invalid admin token"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := map[string]*searchCounter{}
+			caches := map[string]cached.Store{}
+			for _, name := range []string{"arch", "debian"} {
+				sc := &searchCounter{Store: mem.New()}
+				sc.Add("vim", "bin=vim")
+				stores[name] = sc
+				caches[name] = cached.New(sc, time.Hour, time.Hour)
+				// Populate the cache
+				if _, _, err := caches[name].Search([]string{"bin=vim"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := requireAdmin("secret", handleErrJSON)(handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+				return flushCaches(w, caches, r.URL.Query().Get("repo"))
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/api/cache/flush?repo="+tt.repo, nil)
+			req.Header.Set("Authorization", tt.auth)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, body)
+			}
+
+			// Only the searches of flushed repos should re-hit the underlying store
+			for name, sc := range stores {
+				if _, _, err := caches[name].Search([]string{"bin=vim"}); err != nil {
+					t.Fatal(err)
+				}
+				wantSearches := 1
+				if slices.Contains(tt.wantFlushed, name) {
+					wantSearches = 2
+				}
+				if sc.searches != wantSearches {
+					t.Errorf("%s: got %d searches of the underlying store, want %d", name, sc.searches, wantSearches)
+				}
+			}
+		})
+	}
+}
@@ -23,50 +23,137 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/pelletier/go-toml/v2"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
 )
 
 type Config struct {
-	SearchThreads int    `toml:"searchThreads" env:"SEARCH_THREADS"`
-	Repos         []Repo `toml:"repo" envPrefix:"REPO"`
+	SearchThreads       int      `toml:"searchThreads" env:"SEARCH_THREADS"`
+	MaxSearches         int      `toml:"max_searches" env:"MAX_SEARCHES"`
+	SearchQueueTimeout  Duration `toml:"search_queue_timeout" env:"SEARCH_QUEUE_TIMEOUT"`
+	SearchTimeout       Duration `toml:"search_timeout" env:"SEARCH_TIMEOUT"`
+	CacheMinConfidence  float32  `toml:"cache_min_confidence" env:"CACHE_MIN_CONFIDENCE"`
+	AdminToken          string   `toml:"admin_token" env:"ADMIN_TOKEN"`
+	NormalizeConfidence bool     `toml:"normalize_confidence" env:"NORMALIZE_CONFIDENCE"`
+	PullRateLimit       int64    `toml:"pull_rate_limit" env:"PULL_RATE_LIMIT"`
+	RefreshJitter       Duration `toml:"refresh_jitter" env:"REFRESH_JITTER"`
+	CORSOrigins         []string `toml:"cors_origins" env:"CORS_ORIGINS"`
+	CORSMethods         []string `toml:"cors_methods" env:"CORS_METHODS"`
+	DataDir             string   `toml:"data_dir" env:"DATA_DIR"`
+	TempDir             string   `toml:"temp_dir" env:"TEMP_DIR"`
+	LockTimeout         Duration `toml:"lock_timeout" env:"LOCK_TIMEOUT"`
+	MaxPulls            int      `toml:"max_pulls" env:"MAX_PULLS"`
+	BasePath            string   `toml:"base_path" env:"BASE_PATH"`
+	StrongConfidence    float32  `toml:"strong_confidence" env:"STRONG_CONFIDENCE"`
+	PartialConfidence   float32  `toml:"partial_confidence" env:"PARTIAL_CONFIDENCE"`
+	IDFWeighting        bool     `toml:"idf_weighting" env:"IDF_WEIGHTING"`
+	CrossTypeMatching   bool     `toml:"cross_type_matching" env:"CROSS_TYPE_MATCHING"`
+	Tiebreak            string   `toml:"tiebreak" env:"TIEBREAK"`
+	TiebreakPriority    []string `toml:"tiebreak_priority" env:"TIEBREAK_PRIORITY"`
+	ConfidencePrecision int      `toml:"confidence_precision" env:"CONFIDENCE_PRECISION"`
+	MaxSearchTags       int      `toml:"max_search_tags" env:"MAX_SEARCH_TAGS"`
+	MaxResults          int      `toml:"max_results" env:"MAX_RESULTS"`
+	S3                  S3       `toml:"s3" envPrefix:"S3_"`
+	Repos               []Repo   `toml:"repo" envPrefix:"REPO"`
 }
 
-type Repo struct {
-	Name            string   `toml:"name" env:"NAME"`
-	Type            string   `toml:"type" env:"TYPE"`
-	BaseURL         string   `toml:"base_url" env:"BASE_URL"`
-	Version         string   `toml:"version" env:"VERSION"`
-	Repos           []string `toml:"repos" env:"REPOS"`
-	Architectures   []string `toml:"arch" env:"ARCHES"`
-	RefreshSchedule string   `toml:"refresh_schedule" env:"REFRESH_SCHEDULE"`
+// S3 contains the settings for downloading indices from
+// S3-compatible object storage using s3:// URLs.
+type S3 struct {
+	Endpoint  string `toml:"endpoint" env:"ENDPOINT"`
+	Region    string `toml:"region" env:"REGION"`
+	AccessKey string `toml:"access_key" env:"ACCESS_KEY"`
+	SecretKey string `toml:"secret_key" env:"SECRET_KEY"`
 }
 
-func Load() (cfg *Config, err error) {
-	cfg = &Config{
-		SearchThreads: 4,
-	}
+// Duration is a [time.Duration] that can be decoded from
+// a duration string, such as "1h30m".
+type Duration time.Duration
 
-	if fl, err := os.Open("/etc/distrohop.toml"); err == nil {
-		err = toml.NewDecoder(fl).Decode(cfg)
-		if err != nil {
-			return nil, err
-		}
+func (d *Duration) UnmarshalText(b []byte) error {
+	dur, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
 	}
+	*d = Duration(dur)
+	return nil
+}
 
+type Repo struct {
+	Name              string   `toml:"name" env:"NAME"`
+	DisplayName       string   `toml:"display_name" env:"DISPLAY_NAME"`
+	Group             string   `toml:"group" env:"GROUP"`
+	Type              string   `toml:"type" env:"TYPE"`
+	BaseURL           string   `toml:"base_url" env:"BASE_URL"`
+	Version           string   `toml:"version" env:"VERSION"`
+	Repos             []string `toml:"repos" env:"REPOS"`
+	Architectures     []string `toml:"arch" env:"ARCHES"`
+	RefreshSchedule   string   `toml:"refresh_schedule" env:"REFRESH_SCHEDULE"`
+	WarmupQueries     []string `toml:"warmup_queries" env:"WARMUP_QUERIES"`
+	TwoPassImport     bool     `toml:"two_pass_import" env:"TWO_PASS_IMPORT"`
+	PullRateLimit     int64    `toml:"pull_rate_limit" env:"PULL_RATE_LIMIT"`
+	RefreshJitter     Duration `toml:"refresh_jitter" env:"REFRESH_JITTER"`
+	MergePackages     bool     `toml:"merge_packages" env:"MERGE_PACKAGES"`
+	PullTimeout       Duration `toml:"pull_timeout" env:"PULL_TIMEOUT"`
+	PDiffs            bool     `toml:"pdiffs" env:"PDIFFS"`
+	IndexPathTemplate string   `toml:"index_path_template" env:"INDEX_PATH_TEMPLATE"`
+	Branch            string   `toml:"branch" env:"BRANCH"`
+	Token             string   `toml:"token" env:"TOKEN"`
+	LatestOnly        bool     `toml:"latest_only" env:"LATEST_ONLY"`
+	Keyring           string   `toml:"keyring" env:"KEYRING"`
+	TrackChanges      bool     `toml:"track_changes" env:"TRACK_CHANGES"`
+	WatchIndex        bool     `toml:"watch_index" env:"WATCH_INDEX"`
+	Descriptions      bool     `toml:"descriptions" env:"DESCRIPTIONS"`
+}
+
+// Load loads the configuration from /etc and the user's config directory,
+// and then from environment variables. See [load].
+func Load() (*Config, error) {
 	cfgDir := "/distrohop.toml"
 	if os.Getenv("RUNNING_IN_DOCKER") != "true" {
+		var err error
 		cfgDir, err = os.UserConfigDir()
 		if err != nil {
 			return nil, err
 		}
 	}
+	return load("/etc", cfgDir)
+}
+
+// load loads the configuration from the distrohop.toml file and the distrohop.d
+// directory in each of dirs, in order, so that later ones override earlier ones.
+// Environment variables override all of them.
+func load(dirs ...string) (cfg *Config, err error) {
+	cfg = &Config{
+		SearchThreads:       4,
+		MaxSearches:         32,
+		SearchQueueTimeout:  Duration(10 * time.Second),
+		LockTimeout:         Duration(5 * time.Second),
+		CORSMethods:         []string{"GET", "POST"},
+		StrongConfidence:    0.75,
+		PartialConfidence:   0.4,
+		ConfidencePrecision: 3,
+		MaxSearchTags:       64,
+	}
 
-	if fl, err := os.Open(filepath.Join(cfgDir, "distrohop.toml")); err == nil {
-		err = toml.NewDecoder(fl).Decode(cfg)
+	for _, dir := range dirs {
+		err = loadFile(cfg, filepath.Join(dir, "distrohop.toml"))
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadDir(cfg, filepath.Join(dir, "distrohop.d"))
 		if err != nil {
 			return nil, err
 		}
@@ -77,18 +164,295 @@ func Load() (cfg *Config, err error) {
 		return nil, err
 	}
 
+	err = checkDuplicateRepos(cfg.Repos)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.BasePath = normalizeBasePath(cfg.BasePath)
+	cfg.CORSOrigins = cleanList(cfg.CORSOrigins)
+	cfg.CORSMethods = cleanList(cfg.CORSMethods)
+	cfg.TiebreakPriority = cleanList(cfg.TiebreakPriority)
+
+	if cfg.PartialConfidence < 0 || cfg.PartialConfidence > cfg.StrongConfidence || cfg.StrongConfidence > 1 {
+		return nil, errors.New("confidence thresholds must be between 0 and 1, and partial_confidence can't be higher than strong_confidence")
+	}
+
+	if _, err := store.ParseTiebreakMode(cfg.Tiebreak); err != nil {
+		return nil, err
+	}
+
 	for i, repo := range cfg.Repos {
+		repo.Architectures = cleanList(repo.Architectures)
+		repo.Repos = cleanList(repo.Repos)
+		repo.WarmupQueries = cleanList(repo.WarmupQueries)
+		repo.Group = strings.TrimSpace(repo.Group)
 		if len(repo.Architectures) == 0 {
 			repo.Architectures = []string{""}
 		}
 		if len(repo.Repos) == 0 {
 			repo.Repos = []string{""}
 		}
+		if repo.DisplayName == "" {
+			repo.DisplayName = repo.Name
+		}
 		if repo.RefreshSchedule == "" {
 			repo.RefreshSchedule = "0 0 * * *"
 		}
+		if repo.PullRateLimit == 0 {
+			repo.PullRateLimit = cfg.PullRateLimit
+		}
+		if repo.RefreshJitter == 0 {
+			repo.RefreshJitter = cfg.RefreshJitter
+		}
+		repo.BaseURL, err = normalizeBaseURL(repo.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("repo %q: invalid base_url: %w", repo.Name, err)
+		}
+		if repo.WatchIndex && !strings.HasPrefix(repo.BaseURL, "file://") {
+			return nil, fmt.Errorf("repo %q: watch_index requires a file:// base_url", repo.Name)
+		}
+		if err := checkPathTemplate(repo); err != nil {
+			return nil, fmt.Errorf("repo %q: %w", repo.Name, err)
+		}
+		if err := checkBranch(repo); err != nil {
+			return nil, fmt.Errorf("repo %q: %w", repo.Name, err)
+		}
 		cfg.Repos[i] = repo
 	}
 
+	err = checkDisplayNames(cfg.Repos)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkGroups(cfg.Repos)
+	if err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+// checkPathTemplate makes sure that the index path template of repo, if it
+// has one, is supported by its importer, so that mistakes are reported
+// at startup instead of when the repo is first pulled.
+func checkPathTemplate(repo Repo) error {
+	if repo.IndexPathTemplate == "" {
+		return nil
+	}
+	importer, err := index.GetImporter(repo.Type)
+	if err != nil {
+		return err
+	}
+	return index.ValidatePathTemplate(importer, repo.IndexPathTemplate)
+}
+
+// checkBranch checks that the importer of repo supports
+// branches if repo has a branch setting
+func checkBranch(repo Repo) error {
+	if repo.Branch == "" {
+		return nil
+	}
+	importer, err := index.GetImporter(repo.Type)
+	if err != nil {
+		return err
+	}
+	_, err = index.WithBranch(importer, repo.Branch)
+	return err
+}
+
+// RepoName returns the name of the repo whose name or display name is name.
+// If there's no such repo, name is returned as-is.
+func (cfg *Config) RepoName(name string) string {
+	for _, repo := range cfg.Repos {
+		if repo.Name == name || repo.DisplayName == name {
+			return repo.Name
+		}
+	}
+	return name
+}
+
+// DisplayName returns the display name of the repo with the given name.
+// If there's no such repo, name is returned as-is.
+func (cfg *Config) DisplayName(name string) string {
+	for _, repo := range cfg.Repos {
+		if repo.Name == name {
+			return repo.DisplayName
+		}
+	}
+	return name
+}
+
+// Groups returns the names of all the repo groups,
+// in the order they first appear in the config.
+func (cfg *Config) Groups() []string {
+	var out []string
+	for _, repo := range cfg.Repos {
+		if repo.Group != "" && !slices.Contains(out, repo.Group) {
+			out = append(out, repo.Group)
+		}
+	}
+	return out
+}
+
+// GroupRepos returns the names of the repos in the given group
+func (cfg *Config) GroupRepos(group string) []string {
+	var out []string
+	for _, repo := range cfg.Repos {
+		if repo.Group == group {
+			out = append(out, repo.Name)
+		}
+	}
+	return out
+}
+
+// loadFile decodes the config file at path into cfg, if it exists.
+// Top-level settings in the file override the ones in cfg, and
+// repos are merged using [mergeRepos].
+func loadFile(cfg *Config, path string) error {
+	fl, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer fl.Close()
+
+	fileCfg := *cfg
+	fileCfg.Repos = nil
+	err = toml.NewDecoder(fl).Decode(&fileCfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Repos with the same name in different files are merged,
+	// but within a single file, they're always a mistake.
+	if err := checkDuplicateRepos(fileCfg.Repos); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	fileCfg.Repos = mergeRepos(cfg.Repos, fileCfg.Repos)
+	*cfg = fileCfg
+	return nil
+}
+
+// loadDir loads all the *.toml files in dir into cfg in lexical order,
+// so that files later in the order take precedence.
+func loadDir(cfg *Config, dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := loadFile(cfg, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeRepos merges src into dst, keyed by repo name. Repos in src replace
+// the repos in dst that have the same name, and the rest are appended.
+func mergeRepos(dst, src []Repo) []Repo {
+	for _, repo := range src {
+		idx := slices.IndexFunc(dst, func(r Repo) bool {
+			return r.Name == repo.Name
+		})
+		if idx == -1 {
+			dst = append(dst, repo)
+		} else {
+			dst[idx] = repo
+		}
+	}
+	return dst
+}
+
+// checkDuplicateRepos returns an error if more than one repo has the same name.
+// Repo names are used as keys and in URLs, so they must be unique.
+func checkDuplicateRepos(repos []Repo) error {
+	seen := make(map[string]struct{}, len(repos))
+	for _, repo := range repos {
+		if _, ok := seen[repo.Name]; ok {
+			return fmt.Errorf("duplicate repo name: %q", repo.Name)
+		}
+		seen[repo.Name] = struct{}{}
+	}
+	return nil
+}
+
+// checkDisplayNames returns an error if a repo's display name is the same as
+// the name or display name of another repo. Display names can be used in place
+// of repo names when searching, so they have to be unambiguous.
+func checkDisplayNames(repos []Repo) error {
+	owners := make(map[string]string, len(repos)*2)
+	for _, repo := range repos {
+		owners[repo.Name] = repo.Name
+	}
+	for _, repo := range repos {
+		if owner, ok := owners[repo.DisplayName]; ok && owner != repo.Name {
+			return fmt.Errorf("repo %q: display name %q is already used by repo %q", repo.Name, repo.DisplayName, owner)
+		}
+		owners[repo.DisplayName] = repo.Name
+	}
+	return nil
+}
+
+// checkGroups returns an error if any repo group has the same name as a repo
+// or a repo's display name, since groups can be searched in place of repos.
+func checkGroups(repos []Repo) error {
+	for _, repo := range repos {
+		if repo.Group == "" {
+			continue
+		}
+		for _, other := range repos {
+			if other.Name == repo.Group || other.DisplayName == repo.Group {
+				return fmt.Errorf("repo %q: group %q has the same name as repo %q", repo.Name, repo.Group, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// cleanList trims the whitespace around each item in list and removes
+// empty items, which can end up in lists set through environment
+// variables, such as "main, updates,".
+func cleanList(list []string) []string {
+	out := list[:0]
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// normalizeBasePath makes sure that a base path starts with a slash and
+// doesn't end with one, so that it can be prepended to absolute paths.
+// The root path is normalized to an empty string.
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
+// normalizeBaseURL validates a repo base URL and removes any trailing slashes
+// from it. Variables such as $repo and $arch are expanded to placeholder values
+// before validation, since they're only replaced by the importers.
+func normalizeBaseURL(baseURL string) (string, error) {
+	expanded := os.Expand(baseURL, func(string) string { return "x" })
+	u, err := url.ParseRequestURI(expanded)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme == "" {
+		return "", errors.New("missing scheme")
+	} else if u.Host == "" && u.Scheme != "file" {
+		return "", errors.New("missing host")
+	}
+
+	return strings.TrimRight(baseURL, "/"), nil
+}
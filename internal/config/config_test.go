@@ -0,0 +1,331 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckPathTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repo
+		wantErr string
+	}{
+		{"none", Repo{Type: "apt"}, ""},
+		{"dnf", Repo{Type: "dnf", IndexPathTemplate: "pub/epel/{version}/Everything/{arch}"}, ""},
+		{"zypper", Repo{Type: "zypper", IndexPathTemplate: "{version}/{repo}"}, ""},
+		{"unsupported importer", Repo{Type: "apt", IndexPathTemplate: "{version}"}, "doesn't support index path templates"},
+		{"unknown importer", Repo{Type: "foo", IndexPathTemplate: "{version}"}, "no such importer"},
+		{"unknown placeholder", Repo{Type: "dnf", IndexPathTemplate: "{version}/{release}/{arch}"}, `unknown placeholder "{release}"`},
+		{"absolute", Repo{Type: "dnf", IndexPathTemplate: "/{version}/{arch}"}, "must be relative"},
+		{"url", Repo{Type: "dnf", IndexPathTemplate: "https://example.com/{version}"}, "must be relative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPathTemplate(tt.repo)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckBranch(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    Repo
+		wantErr string
+	}{
+		{"none", Repo{Type: "apt"}, ""},
+		{"pkg", Repo{Type: "pkg", Branch: "latest"}, ""},
+		{"unsupported importer", Repo{Type: "apt", Branch: "latest"}, "doesn't support branches"},
+		{"unknown importer", Repo{Type: "foo", Branch: "latest"}, "no such importer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBranch(tt.repo)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTiebreak(t *testing.T) {
+	tests := []struct {
+		name     string
+		tiebreak string
+		wantErr  string
+	}{
+		{"default", "", ""},
+		{"name", "name", ""},
+		{"overlap", "overlap", ""},
+		{"repo", "repo", ""},
+		{"invalid", "random", `invalid tiebreak mode: "random"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, "distrohop.toml", fmt.Sprintf("tiebreak = %q\n", tt.tiebreak))
+			// Setenv restores the variable when the test ends
+			t.Setenv("DISTROHOP_TIEBREAK", "")
+			os.Unsetenv("DISTROHOP_TIEBREAK")
+			cfg, err := load(dir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cfg.Tiebreak != tt.tiebreak {
+					t.Errorf("got tiebreak %q, want %q", cfg.Tiebreak, tt.tiebreak)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeConfigFiles writes the given files, which are alternating
+// names and contents, to dir.
+func writeConfigFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for i := 0; i < len(files); i += 2 {
+		if err := os.WriteFile(filepath.Join(dir, files[i]), []byte(files[i+1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	const base = `
+searchThreads = 2
+max_searches = 16
+
+[[repo]]
+name = "debian"
+type = "apt"
+base_url = "https://deb.debian.org/debian"
+
+[[repo]]
+name = "arch"
+type = "pacman"
+base_url = "https://geo.mirror.pkgbuild.com/$repo/os/$arch"
+`
+
+	tests := []struct {
+		name        string
+		files       []string
+		wantRepos   []string
+		wantURLs    []string
+		wantThreads int
+	}{
+		{
+			name:        "single file",
+			files:       []string{"00-base.toml", base},
+			wantRepos:   []string{"debian", "arch"},
+			wantURLs:    []string{"https://deb.debian.org/debian", "https://geo.mirror.pkgbuild.com/$repo/os/$arch"},
+			wantThreads: 2,
+		},
+		{
+			name: "append",
+			files: []string{
+				"00-base.toml", base,
+				"10-fedora.toml", "[[repo]]\nname = \"fedora\"\ntype = \"dnf\"\nbase_url = \"https://dl.fedoraproject.org/pub/fedora\"\n",
+			},
+			wantRepos:   []string{"debian", "arch", "fedora"},
+			wantURLs:    []string{"https://deb.debian.org/debian", "https://geo.mirror.pkgbuild.com/$repo/os/$arch", "https://dl.fedoraproject.org/pub/fedora"},
+			wantThreads: 2,
+		},
+		{
+			name: "override",
+			files: []string{
+				"00-base.toml", base,
+				"10-mirror.toml", "searchThreads = 8\n\n[[repo]]\nname = \"debian\"\ntype = \"apt\"\nbase_url = \"https://mirror.example.com/debian\"\n",
+			},
+			wantRepos:   []string{"debian", "arch"},
+			wantURLs:    []string{"https://mirror.example.com/debian", "https://geo.mirror.pkgbuild.com/$repo/os/$arch"},
+			wantThreads: 8,
+		},
+		{
+			name: "lexical order",
+			files: []string{
+				"20-mirror.toml", "[[repo]]\nname = \"debian\"\ntype = \"apt\"\nbase_url = \"https://late.example.com/debian\"\n",
+				"10-mirror.toml", "[[repo]]\nname = \"debian\"\ntype = \"apt\"\nbase_url = \"https://early.example.com/debian\"\n",
+				"00-base.toml", base,
+				"notes.txt", "not a config file",
+			},
+			wantRepos:   []string{"debian", "arch"},
+			wantURLs:    []string{"https://late.example.com/debian", "https://geo.mirror.pkgbuild.com/$repo/os/$arch"},
+			wantThreads: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, tt.files...)
+
+			cfg := &Config{SearchThreads: 4, MaxSearches: 32}
+			if err := loadDir(cfg, dir); err != nil {
+				t.Fatal(err)
+			}
+
+			var names, urls []string
+			for _, repo := range cfg.Repos {
+				names = append(names, repo.Name)
+				urls = append(urls, repo.BaseURL)
+			}
+			if !slices.Equal(names, tt.wantRepos) || !slices.Equal(urls, tt.wantURLs) {
+				t.Errorf("got repos %v with URLs %v, want %v with %v", names, urls, tt.wantRepos, tt.wantURLs)
+			}
+			if cfg.SearchThreads != tt.wantThreads {
+				t.Errorf("got %d search threads, want %d", cfg.SearchThreads, tt.wantThreads)
+			}
+			// Settings that aren't in any of the files keep their previous values
+			if cfg.MaxSearches != 16 {
+				t.Errorf("got max_searches %d, want 16", cfg.MaxSearches)
+			}
+		})
+	}
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+		wantErr string
+	}{
+		{"valid", "https://deb.debian.org/debian", "https://deb.debian.org/debian", ""},
+		{"trailing slashes", "https://deb.debian.org/debian//", "https://deb.debian.org/debian", ""},
+		{"placeholders", "https://geo.mirror.pkgbuild.com/$repo/os/$arch/", "https://geo.mirror.pkgbuild.com/$repo/os/$arch", ""},
+		{"braced placeholders", "https://${token}@example.com/${version}", "https://${token}@example.com/${version}", ""},
+		{"file", "file:///srv/mirror/", "file:///srv/mirror", ""},
+		{"missing scheme", "deb.debian.org/debian", "", "invalid URI"},
+		{"missing host", "https:///debian", "", "missing host"},
+		{"empty", "", "", "empty url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeBaseURL(tt.baseURL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDuplicateRepos(t *testing.T) {
+	tests := []struct {
+		name    string
+		repos   []string
+		wantErr string
+	}{
+		{"unique", []string{"debian", "arch", "fedora"}, ""},
+		{"empty", nil, ""},
+		{"duplicate", []string{"debian", "arch", "debian"}, `duplicate repo name: "debian"`},
+		{"adjacent duplicate", []string{"arch", "arch"}, `duplicate repo name: "arch"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repos []Repo
+			for _, name := range tt.repos {
+				repos = append(repos, Repo{Name: name})
+			}
+			err := checkDuplicateRepos(repos)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadCleanLists(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, "distrohop.toml", `
+[[repo]]
+name = "fedora"
+type = "dnf"
+base_url = "https://dl.fedoraproject.org/pub/fedora/linux/releases/$version/$repo/$arch/os"
+repos = [" Everything ", ""]
+arch = ["x86_64", "  ", "aarch64 "]
+warmup_queries = ["bin=vim", " "]
+
+[[repo]]
+name = "arch"
+type = "pacman"
+base_url = "https://geo.mirror.pkgbuild.com/$repo/os/$arch"
+repos = ["", " "]
+`)
+	t.Setenv("DISTROHOP_CORS_ORIGINS", " https://a.example , ,https://b.example,")
+	t.Setenv("DISTROHOP_REPO_0_REPOS", "Everything, updates,")
+
+	cfg, err := load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"cors_origins", cfg.CORSOrigins, []string{"https://a.example", "https://b.example"}},
+		{"fedora repos", cfg.Repos[0].Repos, []string{"Everything", "updates"}},
+		{"fedora arch", cfg.Repos[0].Architectures, []string{"x86_64", "aarch64"}},
+		{"fedora warmup_queries", cfg.Repos[0].WarmupQueries, []string{"bin=vim"}},
+		// Lists that are empty after cleaning get the default
+		{"arch repos", cfg.Repos[1].Repos, []string{""}},
+		{"arch arch", cfg.Repos[1].Architectures, []string{""}},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package i18n
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DefaultLocale is the locale used when no other locale matches a request
+const DefaultLocale = "en"
+
+//go:embed locales
+var localesFS embed.FS
+
+// Catalog maps message keys to translated strings for a single locale
+type Catalog map[string]string
+
+// catalogs contains the message catalogs for every supported locale
+var catalogs = map[string]Catalog{}
+
+func init() {
+	entries, err := fs.ReadDir(localesFS, "locales")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		if path.Ext(entry.Name()) != ".toml" {
+			continue
+		}
+
+		data, err := localesFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		var catalog Catalog
+		if err := toml.Unmarshal(data, &catalog); err != nil {
+			panic(err)
+		}
+
+		catalogs[strings.TrimSuffix(entry.Name(), ".toml")] = catalog
+	}
+}
+
+// Register adds a message catalog for the given locale, replacing
+// any existing catalog for that locale.
+func Register(locale string, catalog Catalog) {
+	catalogs[normalize(locale)] = catalog
+}
+
+// Locales returns a sorted list of all the supported locales
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		out = append(out, locale)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Translate returns the message for key in the given locale. If the locale
+// doesn't contain the key, the message from [DefaultLocale] is returned instead.
+// If that doesn't exist either, the key itself is returned.
+func Translate(locale, key string) string {
+	if msg, ok := catalogs[locale][key]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[DefaultLocale][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// FromRequest selects the best supported locale for a request. The "lang" query
+// parameter takes precedence over the Accept-Language header.
+func FromRequest(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if locale, ok := match(lang); ok {
+			return locale
+		}
+	}
+	return MatchAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// MatchAcceptLanguage returns the supported locale that best matches the given
+// Accept-Language header value, or [DefaultLocale] if none of them match.
+func MatchAcceptLanguage(header string) string {
+	type langQ struct {
+		lang string
+		q    float64
+	}
+
+	var langs []langQ
+	for _, item := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		if qStr, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if pq, err := strconv.ParseFloat(qStr, 64); err == nil {
+				q = pq
+			}
+		}
+
+		langs = append(langs, langQ{lang, q})
+	}
+
+	// Stable sort so that languages with equal weights
+	// keep the order they were listed in.
+	slices.SortStableFunc(langs, func(a, b langQ) int {
+		if a.q > b.q {
+			return -1
+		} else if a.q < b.q {
+			return 1
+		}
+		return 0
+	})
+
+	for _, lq := range langs {
+		if lq.q <= 0 {
+			continue
+		}
+		if locale, ok := match(lq.lang); ok {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
+
+// match finds a supported locale for the given language tag, falling back
+// to the base language if there's no catalog for the full tag.
+func match(lang string) (string, bool) {
+	lang = normalize(lang)
+	if _, ok := catalogs[lang]; ok {
+		return lang, true
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if _, ok := catalogs[base]; ok {
+		return base, true
+	}
+	return "", false
+}
+
+// normalize converts a language tag to the form used for catalog names
+func normalize(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+}
@@ -0,0 +1,88 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package i18n
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func init() {
+	Register("de", Catalog{"nav_search": "Suche"})
+	Register("pt_BR", Catalog{"nav_search": "Pesquisar"})
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "default", want: DefaultLocale},
+		{name: "lang param", query: "?lang=de", want: "de"},
+		{name: "lang param with region", query: "?lang=de-AT", want: "de"},
+		{name: "normalized lang param", query: "?lang=PT_br", want: "pt-br"},
+		{name: "lang param overrides header", query: "?lang=de", acceptLanguage: "pt-BR", want: "de"},
+		{name: "unsupported lang param", query: "?lang=fr", acceptLanguage: "de", want: "de"},
+		{name: "header", acceptLanguage: "pt-BR,de;q=0.8", want: "pt-br"},
+		{name: "header weights", acceptLanguage: "fr;q=0.9, de;q=0.5, pt-BR;q=0.7", want: "pt-br"},
+		{name: "header region fallback", acceptLanguage: "de-CH", want: "de"},
+		{name: "excluded language", acceptLanguage: "de;q=0, fr", want: DefaultLocale},
+		{name: "unsupported header", acceptLanguage: "fr, *", want: DefaultLocale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tt.query, nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			if got := FromRequest(req); got != tt.want {
+				t.Errorf("got locale %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		want   string
+	}{
+		{"translated", "de", "nav_search", "Suche"},
+		{"default locale", DefaultLocale, "nav_search", "Search"},
+		{"missing from locale", "de", "nav_about", "About"},
+		{"unknown locale", "fr", "nav_search", "Search"},
+		{"unknown key", "de", "no_such_key", "no_such_key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.locale, tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
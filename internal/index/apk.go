@@ -0,0 +1,169 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+type Alpine struct{}
+
+func (Alpine) Name() string {
+	return "apk"
+}
+
+func (Alpine) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	indexURL, err := url.JoinPath(baseURL, version, repo, arch, "APKINDEX.tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	return []string{indexURL}, nil
+}
+
+func (Alpine) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	// The index is preceded by a signature, which is stored in a separate
+	// gzip stream but reads as part of the same tar archive.
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Err: errors.New("missing APKINDEX file")}}
+			return
+		} else if err != nil {
+			out <- Record{Error: &ParseError{Err: err}}
+			return
+		}
+
+		if hdr.Name == "APKINDEX" {
+			if readAPKIndex(hdr.Name, tr, out) {
+				close(out)
+			}
+			return
+		}
+	}
+}
+
+// readAPKIndex reads the packages in an APKINDEX file and sends a record
+// for each one on out. Packages are separated by blank lines. Repository
+// indices don't list the files in each package, so tags are generated from
+// the package's p: line (see [apkProvidesTags]). Files are only listed in
+// the installed database, as F: lines containing a directory, each followed
+// by R: lines containing the names of the files in it, which are read as
+// well. It returns false if an error was sent on out.
+func readAPKIndex(entry string, r io.Reader, out chan Record) bool {
+	br := bufio.NewReader(r)
+	var rec Record
+	var dir string
+	lineNum, pkgLine := 0, 0
+
+	// flush sends the current package if it has any tags.
+	// Packages without a name are skipped with a warning.
+	flush := func() {
+		if len(rec.Tags) != 0 {
+			if rec.Name == "" {
+				out <- Record{Warning: &ParseError{Entry: entry, Line: pkgLine, Err: errors.New("missing package name")}}
+			} else {
+				out <- rec
+			}
+		}
+		rec, dir = Record{}, ""
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		lineNum++
+		if errors.Is(err, io.EOF) && line == "" {
+			flush()
+			return true
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Entry: entry, Line: lineNum, Snippet: snippet(line), Err: err}}
+			return false
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			flush()
+			pkgLine = 0
+			continue
+		} else if pkgLine == 0 {
+			pkgLine = lineNum
+		}
+
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			out <- Record{Warning: &ParseError{Entry: entry, Line: lineNum, Snippet: snippet(line), Err: errors.New("missing field separator")}}
+			continue
+		}
+
+		switch key {
+		case "P":
+			rec.Name = val
+		case "p":
+			rec.Tags = append(rec.Tags, apkProvidesTags(val)...)
+		case "F":
+			dir = val
+		case "R":
+			rec.Tags = append(rec.Tags, tags.Generate(path.Join("/", dir, val))...)
+		}
+	}
+}
+
+// apkProvidesTags generates tags from the provides listed on the p: line of a
+// package in an APKINDEX file. abuild automatically adds cmd: provides for the
+// commands a package installs and so: provides for its shared libraries, which
+// are enough to generate its bin and lib tags, the same way xbps importers use
+// shlib-provides. Provides that are absolute paths are files, and provides
+// without a prefix are virtual packages. Other prefixed provides, such as pc:
+// for pkg-config modules, don't have a matching tag type, so they're skipped.
+func apkProvidesTags(provides string) (out []string) {
+	for _, provided := range strings.Fields(provides) {
+		name, _, _ := strings.Cut(provided, "=")
+		prefix, val, hasPrefix := strings.Cut(name, ":")
+		switch {
+		case strings.HasPrefix(name, "/"):
+			out = append(out, tags.Generate(name)...)
+		case !hasPrefix:
+			out = append(out, tags.KeyProvides+"="+name)
+		case prefix == "cmd":
+			out = append(out, tags.Generate(path.Join("/usr/bin", val))...)
+		case prefix == "so":
+			out = append(out, tags.Generate(path.Join("/usr/lib", val))...)
+		}
+	}
+	return out
+}
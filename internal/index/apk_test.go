@@ -0,0 +1,108 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"slices"
+	"testing"
+)
+
+// apkIndex is an excerpt from the APKINDEX of Alpine's main repo. Repository
+// indices don't contain F: and R: lines, only the installed database does.
+const apkIndex = `C:Q1WvGFFLnVSyHg9Ik0nUSN2g9jpSg=
+P:busybox-binsh
+V:1.36.1-r29
+A:x86_64
+T:busybox ash /bin/sh
+D:busybox=1.36.1-r29
+p:cmd:sh=1.36.1-r29 /bin/sh
+
+C:Q1OcN82FSbRXiIh8LzCS3wQsJaFqQ=
+P:ncurses-libs
+V:6.4_p20240420-r2
+A:x86_64
+T:Ncurses libraries
+p:so:libformw.so.6=6.4_p20240420 so:libncursesw.so.6=6.4_p20240420
+
+C:Q1Y5iwc8U+y9sb8ac3rbqk0mWFPno=
+P:vim
+V:9.1.0414-r0
+A:x86_64
+T:Improved vi-style text editor
+p:cmd:ex=9.1.0414-r0 cmd:vim=9.1.0414-r0 pc:vim editor
+
+C:Q1HE2Il6sZzG7WVRAsH6Vw2tn2QEM=
+P:vim-doc
+V:9.1.0414-r0
+A:x86_64
+T:Improved vi-style text editor (documentation)
+`
+
+// apkInstalledDB is an excerpt from an installed
+// database, which lists the files of each package
+const apkInstalledDB = `P:vim
+V:9.1.0414-r0
+F:usr/bin
+R:vim
+R:xxd
+`
+
+func TestAlpineReadPkgData(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string][]string
+	}{
+		{
+			name:  "repository index",
+			input: apkIndex,
+			want: map[string][]string{
+				"busybox-binsh": {"bin=sh", "bin=sh"},
+				"ncurses-libs": {
+					"lib=libformw.so.6", "lib=libformw.so", "lib=formw",
+					"lib=libncursesw.so.6", "lib=libncursesw.so", "lib=ncursesw",
+				},
+				"vim": {"bin=ex", "bin=vim", "provides=editor"},
+			},
+		},
+		{
+			name:  "installed database",
+			input: apkInstalledDB,
+			want:  map[string][]string{"vim": {"bin=vim", "bin=xxd"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs := readRecords(t, Alpine{}.ReadPkgData, tarArchive(t, ".SIGN.RSA.alpine-devel.rsa.pub", "signature", "DESCRIPTION", "v3.20", "APKINDEX", tt.input))
+			got := pkgTags(recs)
+			if len(got) != len(tt.want) {
+				t.Errorf("got packages %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if !slices.Equal(got[name], want) {
+					t.Errorf("%s: got tags %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
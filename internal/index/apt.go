@@ -24,16 +24,19 @@ package index
 
 import (
 	"bufio"
-	"context"
 	"errors"
 	"io"
 	"net/url"
+	"path"
 	"strings"
 
-	"github.com/mholt/archives"
 	"go.elara.ws/distrohop/internal/tags"
 )
 
+// aptContentsExts contains the file extensions of the compression
+// formats that APT Contents indices may use, in order of preference.
+var aptContentsExts = []string{".gz", ".bz2", ".lzma"}
+
 type APT struct{}
 
 func (APT) Name() string {
@@ -41,74 +44,387 @@ func (APT) Name() string {
 }
 
 func (APT) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
-	indexURL, err := url.JoinPath(baseURL, "dists", version, repo, "Contents-"+arch+".gz")
-	if err != nil {
-		return nil, err
-	}
 	// Before Debian Wheezy, the path to Contents indices didn't include $COMP/repo, so we need to try
 	// both the new and old URL formats. Ubuntu also still uses the pre-Debian-Wheezy convention.
-	deprecatedURL, err := url.JoinPath(baseURL, "dists", version, "Contents-"+arch+".gz")
-	if err != nil {
-		return nil, err
+	// Some older mirrors only provide bzip2 or LZMA-compressed indices, so try those as well.
+	var out []string
+	for _, dir := range []string{path.Join("dists", version, repo), path.Join("dists", version)} {
+		for _, ext := range aptContentsExts {
+			indexURL, err := url.JoinPath(baseURL, dir, "Contents-"+arch+ext)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, indexURL)
+		}
 	}
-	return []string{indexURL, deprecatedURL}, nil
+	return out, nil
 }
 
 func (APT) ReadPkgData(r io.Reader, out chan Record) {
-	ctx := context.Background()
-	format, r, err := archives.Identify(ctx, "", r)
-	if err != nil {
-		out <- Record{Error: err}
-		return
-	}
-
-	decomp, ok := format.(archives.Decompressor)
-	if !ok {
-		out <- Record{Error: errors.New("downloaded index is not a valid compressed file")}
-		return
-	}
-
-	dr, err := decomp.OpenReader(r)
+	dr, err := Decompress(r)
 	if err != nil {
 		out <- Record{Error: err}
 		return
 	}
 	defer dr.Close()
 
+	// Older Contents files start with a free-form preamble, which ends with
+	// a "FILE LOCATION" header line. Since most files don't have one, the
+	// first lines are buffered until either the header is found, in which
+	// case they're discarded, or the limit is reached, in which case
+	// they're parsed as entries.
+	var preamble []string
+	inPreamble := true
+
 	br := bufio.NewReader(dr)
+	lineNum := 0
 	for {
 		line, err := br.ReadString('\n')
+		lineNum++
 		if errors.Is(err, io.EOF) {
-			close(out)
 			break
 		} else if err != nil {
-			out <- Record{Error: err}
+			out <- Record{Error: &ParseError{Line: lineNum, Snippet: snippet(line), Err: err}}
 			return
 		}
 
-		lastSpaceIdx := strings.LastIndexByte(line, ' ')
-		if lastSpaceIdx == -1 {
+		if !inPreamble {
+			readContentsLine(line, lineNum, out)
 			continue
 		}
 
-		fpath := "/" + strings.TrimSpace(line[:lastSpaceIdx])
-		names := strings.Split(strings.TrimSpace(line[lastSpaceIdx+1:]), ",")
-		for _, name := range names {
-			slashIdx := strings.LastIndexByte(name, '/')
-			if slashIdx != -1 {
-				name = name[slashIdx+1:]
+		if isContentsHeader(line) {
+			preamble = nil
+			inPreamble = false
+			// Some files have a separator line under the header
+			if next, err := br.Peek(2); err == nil && (string(next) == "--" || string(next) == "==") {
+				br.ReadString('\n')
+				lineNum++
 			}
+			continue
+		}
 
-			if strings.Contains(fpath, "changelog.Debian") ||
-				strings.Contains(fpath, "README.Debian") ||
-				strings.Contains(fpath, "NEWS.Debian.gz") {
-				continue
+		preamble = append(preamble, line)
+		if len(preamble) == contentsPreambleMaxLines {
+			for i, line := range preamble {
+				readContentsLine(line, lineNum-len(preamble)+i+1, out)
 			}
+			preamble = nil
+			inPreamble = false
+		}
+	}
+
+	// If the file was shorter than the limit and there was no header,
+	// the buffered lines are entries. They start at the first line,
+	// since a header would have cleared them.
+	for i, line := range preamble {
+		readContentsLine(line, i+1, out)
+	}
+	close(out)
+}
+
+// contentsPreambleMaxLines is the maximum amount of lines that are
+// checked for the "FILE LOCATION" header at the start of a Contents file.
+// Debian's preambles were about 30 lines long.
+const contentsPreambleMaxLines = 100
+
+// isContentsHeader checks whether line is the "FILE LOCATION" header
+// that separates the preamble of a Contents file from its entries.
+func isContentsHeader(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) == 2 && fields[0] == "FILE" && fields[1] == "LOCATION"
+}
+
+// contentsPackageName extracts the binary package name from an entry in the location
+// column of a Contents file. Entries are in the "[[area/]section/]name" format, such as
+// "universe/editors/vim", "editors/vim", or "vim". Some mirrors also add an architecture
+// qualifier ("vim:amd64") or a version ("vim=2:9.1.0-1" or "vim_2:9.1.0-1") to the name.
+// Everything other than the name is removed. If the entry doesn't contain a valid
+// name, an empty string is returned.
+func contentsPackageName(location string) string {
+	name := strings.TrimSpace(location)
+	if slashIdx := strings.LastIndexByte(name, '/'); slashIdx != -1 {
+		name = name[slashIdx+1:]
+	}
+
+	// Package names can only contain lowercase letters, digits, and the
+	// "+", "-", and "." characters, so anything else starts a qualifier.
+	end := strings.IndexFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')
+	})
+	if end != -1 {
+		name = name[:end]
+	}
+	return name
+}
+
+// readContentsLine parses a line from a Contents file and sends a record for each
+// of the packages listed in it on out. Malformed lines are skipped with a warning,
+// using lineNum as their location.
+func readContentsLine(line string, lineNum int, out chan Record) {
+	lastSpaceIdx := strings.LastIndexByte(line, ' ')
+	if lastSpaceIdx == -1 {
+		if strings.TrimSpace(line) != "" {
+			out <- Record{Warning: &ParseError{Line: lineNum, Snippet: snippet(line), Err: errors.New("missing package location")}}
+		}
+		return
+	}
+
+	fpath := "/" + strings.TrimSpace(line[:lastSpaceIdx])
+	locations := strings.Split(strings.TrimSpace(line[lastSpaceIdx+1:]), ",")
+	for _, location := range locations {
+		name := contentsPackageName(location)
+		if name == "" {
+			continue
+		}
+
+		if strings.Contains(fpath, "changelog.Debian") ||
+			strings.Contains(fpath, "README.Debian") ||
+			strings.Contains(fpath, "NEWS.Debian.gz") {
+			continue
+		}
+
+		out <- Record{
+			Name: name,
+			Tags: tags.Generate(fpath),
+		}
+	}
+}
+
+func (APT) MetadataURL(baseURL, version, repo, arch string) ([]string, error) {
+	var out []string
+	for _, ext := range [...]string{".xz", ".gz"} {
+		indexURL, err := url.JoinPath(baseURL, "dists", version, repo, "binary-"+arch, "Packages"+ext)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, indexURL)
+	}
+	return out, nil
+}
+
+func (APT) ReadMetadata(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	err = readStanzas(dr, func(stanza map[string]string) {
+		name := stanza["Package"]
+		if name == "" {
+			return
+		}
+
+		// The Source field is omitted if the source package has
+		// the same name as the binary package. It may also contain
+		// the source version in parentheses, which we don't need.
+		// A source tag that's the same as the package name doesn't
+		// say anything that the name doesn't, so it's only added
+		// for packages built from a differently named source.
+		var pkgTags []string
+		if src, _, _ := strings.Cut(stanza["Source"], " "); src != "" && src != name {
+			pkgTags = append(pkgTags, tags.KeySrc+"="+src)
+		}
+		// Virtual packages provided by this package are strong
+		// signals of equivalence.
+		for _, provided := range relationNames(stanza["Provides"]) {
+			pkgTags = append(pkgTags, tags.KeyProvides+"="+provided)
+		}
 
-			out <- Record{
-				Name: name,
-				Tags: tags.Generate(fpath),
+		out <- Record{
+			Name:        name,
+			Tags:        pkgTags,
+			Version:     stanza["Version"],
+			Description: aptDescription(stanza["Description"]),
+		}
+	})
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	close(out)
+}
+
+// aptDescription converts the value of a deb822 Description field to plain text.
+// The first line is a synopsis, and the following ones are the extended description,
+// in which lines containing only a dot represent blank lines.
+func aptDescription(field string) string {
+	synopsis, extended, ok := strings.Cut(field, "\n")
+	if !ok {
+		return synopsis
+	}
+
+	lines := strings.Split(extended, "\n")
+	for i, line := range lines {
+		if line == "." {
+			lines[i] = ""
+		}
+	}
+	return synopsis + "\n\n" + strings.Join(lines, "\n")
+}
+
+// relationNames extracts package names from a deb822 relationship field,
+// such as "foo (= 1.0), bar:any | baz", ignoring version constraints
+// and architecture qualifiers.
+func relationNames(field string) []string {
+	var out []string
+	for _, rel := range strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == '|' }) {
+		name, _, _ := strings.Cut(strings.TrimSpace(rel), " ")
+		name, _, _ = strings.Cut(name, "(")
+		name, _, _ = strings.Cut(name, ":")
+		if name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// DiffIndexURL returns the URLs of the PDiff index for the Contents index
+func (APT) DiffIndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	var out []string
+	for _, dir := range []string{path.Join("dists", version, repo), path.Join("dists", version)} {
+		indexURL, err := url.JoinPath(baseURL, dir, "Contents-"+arch+".diff", "Index")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, indexURL)
+	}
+	return out, nil
+}
+
+// ReadDiffIndex reads a PDiff index. Both merged PDiffs, where each diff
+// updates an old version of the index straight to the current one, and
+// incremental PDiffs, where each diff only updates it to the next version,
+// are supported.
+func (APT) ReadDiffIndex(r io.Reader) (DiffIndex, error) {
+	var stanza map[string]string
+	err := readStanzas(r, func(s map[string]string) {
+		if stanza == nil {
+			stanza = s
+		}
+	})
+	if err != nil {
+		return DiffIndex{}, err
+	}
+
+	current, _, _ := strings.Cut(stanza["SHA256-Current"], " ")
+	if current == "" {
+		return DiffIndex{}, errors.New("pdiff index: missing SHA256-Current field")
+	}
+
+	// The download entries contain the names of the compressed diff files
+	downloads := map[string]string{}
+	for _, entry := range pdiffEntries(stanza["SHA256-Download"]) {
+		downloads[strings.TrimSuffix(entry.name, ".gz")] = entry.name
+	}
+
+	// Each history entry contains the hash of the index that the diff
+	// applies to, so the result of each diff is the index that the
+	// next one applies to, and the last one results in the current index.
+	history := pdiffEntries(stanza["SHA256-History"])
+	diffs := make([]Diff, len(history))
+	for i, entry := range history {
+		diffs[i] = Diff{Path: entry.name + ".gz", Result: current}
+		if name, ok := downloads[entry.name]; ok {
+			diffs[i].Path = name
+		}
+		if i+1 < len(history) {
+			diffs[i].Result = history[i+1].hash
+		}
+	}
+
+	out := DiffIndex{Current: current, Diffs: map[string][]Diff{}}
+	merged := stanza["X-Patch-Precedence"] == "merged"
+	for i, entry := range history {
+		if merged {
+			// Merged diffs go straight from each version to the current one
+			out.Diffs[entry.hash] = []Diff{{Path: diffs[i].Path, Result: current}}
+		} else {
+			out.Diffs[entry.hash] = diffs[i:]
+		}
+	}
+	return out, nil
+}
+
+// ApplyDiff decompresses a PDiff and applies it to old
+func (APT) ApplyDiff(w io.Writer, old, diff io.Reader) error {
+	dr, err := Decompress(diff)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	return applyEdDiff(w, old, dr)
+}
+
+// CompareVersions compares two Debian package versions. Contents
+// indices don't contain versions, so this only applies to metadata.
+func (APT) CompareVersions(a, b string) int {
+	return CompareDebianVersions(a, b)
+}
+
+// pdiffEntry represents an entry in one of the lists in a PDiff index
+type pdiffEntry struct {
+	hash string
+	name string
+}
+
+// pdiffEntries parses the entries in a PDiff index list field.
+// Each entry is on its own line, and contains a hash, a size, and a name.
+func pdiffEntries(field string) []pdiffEntry {
+	var out []pdiffEntry
+	for _, line := range strings.Split(field, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		out = append(out, pdiffEntry{hash: fields[0], name: fields[2]})
+	}
+	return out
+}
+
+// readStanzas reads deb822-style stanzas (such as the ones in an APT Packages index)
+// from r and calls fn with the fields of each one. Continuation lines are joined
+// to the field they belong to with newlines.
+func readStanzas(r io.Reader, fn func(stanza map[string]string)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	stanza := map[string]string{}
+	var lastKey string
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := sc.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) != 0 {
+				fn(stanza)
+				stanza = map[string]string{}
+			}
+			lastKey = ""
+		case line[0] == ' ' || line[0] == '\t':
+			if lastKey != "" {
+				stanza[lastKey] += "\n" + strings.TrimSpace(line)
 			}
+		default:
+			key, val, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			lastKey = key
+			stanza[key] = strings.TrimSpace(val)
 		}
 	}
+
+	if err := sc.Err(); err != nil {
+		return &ParseError{Line: lineNum + 1, Err: err}
+	}
+
+	if len(stanza) != 0 {
+		fn(stanza)
+	}
+
+	return nil
 }
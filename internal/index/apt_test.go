@@ -0,0 +1,263 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mholt/archives"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestAPTReadMetadata(t *testing.T) {
+	const input = `Package: vim
+Version: 2:9.1.0016-1
+Description: Vi IMproved - enhanced vi editor
+
+Package: vim-runtime
+Source: vim (2:9.1.0016-1)
+Version: 2:9.1.0016-1
+
+Package: exim4-daemon-light
+Source: exim4
+Provides: mail-transport-agent, default-mta (= 4.97)
+`
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		// The source tag is only added if it's different from the name
+		{"vim", nil},
+		{"vim-runtime", []string{"src=vim"}},
+		{"exim4-daemon-light", []string{"src=exim4", "provides=mail-transport-agent", "provides=default-mta"}},
+	}
+
+	got := pkgTags(readRecords(t, APT{}.ReadMetadata, strings.NewReader(input)))
+	for _, tt := range tests {
+		if !slices.Equal(got[tt.name], tt.want) {
+			t.Errorf("%s: got tags %q, want %q", tt.name, got[tt.name], tt.want)
+		}
+	}
+}
+
+func TestAptDescription(t *testing.T) {
+	got := aptDescription("synopsis\nfirst paragraph\n.\nsecond paragraph")
+	want := "synopsis\n\nfirst paragraph\n\nsecond paragraph"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAPTReadMetadataProvides(t *testing.T) {
+	const input = `Package: libjpeg-turbo8
+Architecture: amd64
+Provides: libjpeg8 (= 8c-2ubuntu8),
+ libjpeg.so.8
+Depends: libc6 (>= 2.14)
+
+Package: python3-yaml
+Architecture: amd64
+Provides: python3.12-yaml, python3-yaml:any
+Depends: python3 (<< 3.13), python3 (>= 3.12~), libyaml-0-2
+
+Package: libc6
+Architecture: amd64
+`
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		// Version constraints and continuation lines are handled
+		{"libjpeg-turbo8", []string{"provides=libjpeg8", "provides=libjpeg.so.8"}},
+		// Architecture qualifiers are removed
+		{"python3-yaml", []string{"provides=python3.12-yaml", "provides=python3-yaml"}},
+		{"libc6", nil},
+	}
+
+	got := pkgTags(readRecords(t, APT{}.ReadMetadata, strings.NewReader(input)))
+	for _, tt := range tests {
+		if !slices.Equal(got[tt.name], tt.want) {
+			t.Errorf("%s: got tags %q, want %q", tt.name, got[tt.name], tt.want)
+		}
+	}
+}
+
+func TestRelationNames(t *testing.T) {
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"", nil},
+		{"foo", []string{"foo"}},
+		{"foo (= 1.0), bar", []string{"foo", "bar"}},
+		{"foo:any | baz (>= 2)", []string{"foo", "baz"}},
+		{"foo(>=1.0),\nbar:amd64", []string{"foo", "bar"}},
+	}
+
+	for _, tt := range tests {
+		if got := relationNames(tt.field); !slices.Equal(got, tt.want) {
+			t.Errorf("relationNames(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestAPTIndexURL(t *testing.T) {
+	got, err := APT{}.IndexURL("https://archive.example", "etch", "main", "i386")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://archive.example/dists/etch/main/Contents-i386.gz",
+		"https://archive.example/dists/etch/main/Contents-i386.bz2",
+		"https://archive.example/dists/etch/main/Contents-i386.lzma",
+		"https://archive.example/dists/etch/Contents-i386.gz",
+		"https://archive.example/dists/etch/Contents-i386.bz2",
+		"https://archive.example/dists/etch/Contents-i386.lzma",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAPTReadPkgDataCompressed(t *testing.T) {
+	const contents = "usr/bin/vim                 editors/vim\nusr/share/man/man1/nano.1.gz editors/nano\n"
+
+	lzmaContents := &bytes.Buffer{}
+	lw, err := lzma.NewWriter(lzmaContents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(lw, contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := lw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"plain", contents},
+		{"gzip", compress(t, archives.Gz{}, strings.NewReader(contents))},
+		{"bzip2", compress(t, archives.Bz2{}, strings.NewReader(contents))},
+		{"lzma", lzmaContents.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pkgTags(readRecords(t, APT{}.ReadPkgData, strings.NewReader(tt.input)))
+			if want := []string{"bin=vim"}; !slices.Equal(got["vim"], want) {
+				t.Errorf("vim: got tags %q, want %q", got["vim"], want)
+			}
+			if want := []string{"man=nano.1"}; !slices.Equal(got["nano"], want) {
+				t.Errorf("nano: got tags %q, want %q", got["nano"], want)
+			}
+		})
+	}
+}
+
+func TestAPTReadPkgDataHeader(t *testing.T) {
+	const entries = "usr/bin/vim                 editors/vim\nusr/share/man/man1/nano.1.gz editors/nano\n"
+	const preamble = "This file maps each file available in the Debian GNU/Linux system to\n" +
+		"the package from which it originates.  It includes packages from the\n" +
+		"DIST distribution for the ARCH architecture.\n" +
+		"\n" +
+		"The first part of the file contains garbage, while the package names\n" +
+		"start on the line after the header.\n" +
+		"\n"
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"none", entries},
+		{"header", preamble + "FILE                                                    LOCATION\n" + entries},
+		{"separator", preamble + "FILE                    LOCATION\n-------------------------------\n" + entries},
+		{"header only", "FILE LOCATION\n" + entries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, warnings, err := tryReadRecords(APT{}.ReadPkgData, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != 0 {
+				t.Errorf("unexpected warnings: %v", warnings)
+			}
+
+			got := pkgTags(recs)
+			if len(got) != 2 {
+				t.Errorf("expected only vim and nano, got %q", got)
+			}
+			if want := []string{"bin=vim"}; !slices.Equal(got["vim"], want) {
+				t.Errorf("vim: got tags %q, want %q", got["vim"], want)
+			}
+			if want := []string{"man=nano.1"}; !slices.Equal(got["nano"], want) {
+				t.Errorf("nano: got tags %q, want %q", got["nano"], want)
+			}
+		})
+	}
+}
+
+func TestContentsPackageName(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"universe/editors/vim", "vim"},
+		{"main/vim", "vim"},
+		{"editors/vim", "vim"},
+		{"vim", "vim"},
+		{"libs/libstdc++6", "libstdc++6"},
+		{"devel/g++-13", "g++-13"},
+		{"editors/vim:amd64", "vim"},
+		{"editors/vim=2:9.1.0-1", "vim"},
+		{"editors/vim_2:9.1.0-1", "vim"},
+		{" editors/vim\n", "vim"},
+		{"editors/", ""},
+		{"editors/Vim", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := contentsPackageName(tt.location); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.location, got, tt.want)
+		}
+	}
+
+	// The names in the records must match the ones that GetPkg is called with
+	const contents = "usr/bin/vim universe/editors/vim:amd64,editors/vim-tiny=2:9.1.0-1\n"
+	got := pkgTags(readRecords(t, APT{}.ReadPkgData, strings.NewReader(contents)))
+	for _, name := range []string{"vim", "vim-tiny"} {
+		if want := []string{"bin=vim"}; !slices.Equal(got[name], want) {
+			t.Errorf("%s: got tags %q, want %q", name, got[name], want)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("expected only vim and vim-tiny, got %q", got)
+	}
+}
@@ -1,6 +1,21 @@
 package index
 
-import "strings"
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mholt/archives"
+	"github.com/ulikunitz/xz/lzma"
+)
 
 type repomd struct {
 	Locations []location `xml:"data>location"`
@@ -17,4 +32,200 @@ func (r repomd) getFilelists() string {
 		}
 	}
 	return ""
-}
\ No newline at end of file
+}
+
+func (r repomd) getPrimary() string {
+	for _, loc := range r.Locations {
+		if strings.Contains(loc.Href, "primary.xml") {
+			return loc.Href
+		}
+	}
+	return ""
+}
+
+// readRepomd downloads the repomd.xml file of the RPM repo at repoPath relative
+// to baseURL using f, or [http.DefaultClient] if f is nil. It returns the URL
+// of the repo along with the contents of the file.
+func readRepomd(f Fetcher, baseURL, repoPath string) (*url.URL, repomd, error) {
+	u, err := url.ParseRequestURI(baseURL)
+	if err != nil {
+		return nil, repomd{}, err
+	}
+	repoURL := u.JoinPath(repoPath)
+
+	req, err := http.NewRequest(http.MethodGet, repoURL.JoinPath("repodata/repomd.xml").String(), nil)
+	if err != nil {
+		return nil, repomd{}, err
+	}
+	if f == nil {
+		f = http.DefaultClient
+	}
+	res, err := f.Do(req)
+	if err != nil {
+		return nil, repomd{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, repomd{}, fmt.Errorf("can't download repomd.xml: %s", res.Status)
+	}
+
+	var data repomd
+	err = xml.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return nil, repomd{}, err
+	}
+	return repoURL, data, nil
+}
+
+// repomdURL returns the URL of the repomd.xml file of
+// the RPM repo at repoPath relative to baseURL
+func repomdURL(baseURL, repoPath string) ([]string, error) {
+	u, err := url.ParseRequestURI(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return []string{u.JoinPath(repoPath, "repodata/repomd.xml").String()}, nil
+}
+
+// primaryURL downloads the repomd.xml file of the RPM repo at repoPath relative
+// to baseURL using f, and returns the URL of its primary metadata index.
+func primaryURL(f Fetcher, baseURL, repoPath string) ([]string, error) {
+	repoURL, data, err := readRepomd(f, baseURL, repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := data.getPrimary()
+	if primary == "" {
+		return nil, errors.New("no primary metadata found in repomd.xml")
+	}
+	return []string{repoURL.JoinPath(primary).String()}, nil
+}
+
+// primaryPackage contains the fields of a package in
+// an RPM primary metadata index that are used for descriptions
+type primaryPackage struct {
+	Name    string `xml:"name"`
+	Version struct {
+		Epoch string `xml:"epoch,attr"`
+		Ver   string `xml:"ver,attr"`
+		Rel   string `xml:"rel,attr"`
+	} `xml:"version"`
+	Description string `xml:"description"`
+}
+
+// readPrimary reads the package descriptions from an RPM
+// primary metadata index and sends them on out
+func readPrimary(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	dec := xml.NewDecoder(dr)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			close(out)
+			return
+		} else if err != nil {
+			// XML syntax errors already contain the line number
+			out <- Record{Error: &ParseError{Err: err}}
+			return
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "package" {
+			continue
+		}
+
+		var pkg primaryPackage
+		if err := dec.DecodeElement(&pkg, &start); err != nil {
+			out <- Record{Error: &ParseError{Err: err}}
+			return
+		}
+
+		desc := strings.TrimSpace(pkg.Description)
+		if pkg.Name == "" || desc == "" {
+			continue
+		}
+
+		out <- Record{
+			Name:        pkg.Name,
+			Version:     rpmVersion(pkg.Version.Epoch, pkg.Version.Ver, pkg.Version.Rel),
+			Description: desc,
+		}
+	}
+}
+
+// Decompress identifies the compression format of r and returns a reader
+// that decompresses it. Some mirrors serve indices without compressing them,
+// so if r isn't compressed in a recognized format, it's read as-is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	format, r, err := archives.Identify(context.Background(), "", r)
+	if errors.Is(err, archives.NoMatch) {
+		// Raw LZMA streams don't have a magic number, so archives
+		// can't identify them. Check their header separately instead.
+		br := bufio.NewReader(r)
+		if header, _ := br.Peek(lzmaHeaderLen); isLZMA(header) {
+			lr, err := lzma.NewReader(br)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(lr), nil
+		}
+		return io.NopCloser(br), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Formats that aren't compression formats, such as
+	// uncompressed tar archives, are read as-is as well.
+	decomp, ok := format.(archives.Decompressor)
+	if !ok {
+		return io.NopCloser(r), nil
+	}
+
+	return decomp.OpenReader(r)
+}
+
+// lzmaHeaderLen is the length of the header of a raw LZMA stream
+const lzmaHeaderLen = 13
+
+// isLZMA checks whether header looks like the header of a raw LZMA stream.
+// It uses the same heuristics as xz-utils, which only accepts valid
+// properties, dictionary sizes that are 2^n or 2^n + 2^(n-1), and
+// uncompressed sizes that are either unknown or smaller than 256 GiB.
+func isLZMA(header []byte) bool {
+	if len(header) < lzmaHeaderLen {
+		return false
+	}
+
+	// The properties byte encodes lc, lp, and pb as ((pb * 5 + lp) * 9 + lc),
+	// where lc < 9, lp < 5, and pb < 5.
+	if header[0] >= 9*5*5 {
+		return false
+	}
+
+	dictSize := binary.LittleEndian.Uint32(header[1:5])
+	if dictSize != math.MaxUint32 {
+		// Round the dictionary size up to the next 2^n or 2^n + 2^(n-1)
+		// and make sure it didn't change.
+		d := dictSize - 1
+		d |= d >> 2
+		d |= d >> 3
+		d |= d >> 4
+		d |= d >> 8
+		d |= d >> 16
+		d++
+		if d != dictSize {
+			return false
+		}
+	}
+
+	size := binary.LittleEndian.Uint64(header[5:13])
+	return size == math.MaxUint64 || size < 1<<38
+}
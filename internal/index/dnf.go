@@ -24,39 +24,46 @@ package index
 
 import (
 	"bufio"
-	"context"
-	"encoding/xml"
+	"cmp"
 	"errors"
 	"io"
-	"net/http"
-	"net/url"
 	"strings"
 
-	"github.com/mholt/archives"
 	"go.elara.ws/distrohop/internal/tags"
 )
 
-type DNF struct{}
+// dnfPathTemplate is the default path of DNF repos, which is the layout used by Fedora
+const dnfPathTemplate = "linux/releases/{version}/{repo}/{arch}/os"
+
+type DNF struct {
+	// PathTemplate is the path of the directory containing the repodata
+	// directory, relative to the base URL. If it's empty, dnfPathTemplate
+	// is used. See [ExpandPathTemplate] for the supported placeholders.
+	PathTemplate string
+	// Fetcher is used to download the repomd.xml file.
+	// If it's nil, [http.DefaultClient] is used.
+	Fetcher Fetcher
+}
 
 func (DNF) Name() string {
 	return "dnf"
 }
 
-func (DNF) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
-	u, err := url.ParseRequestURI(baseURL)
-	if err != nil {
-		return nil, err
-	}
-	
-	repomdURL := u.JoinPath("linux/releases", version, repo, arch, "os/repodata/repomd.xml")
-	res, err := http.Get(repomdURL.String())
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+// WithPathTemplate returns a copy of the importer that uses tmpl as its path template
+func (d DNF) WithPathTemplate(tmpl string) Importer {
+	d.PathTemplate = tmpl
+	return d
+}
 
-	var data repomd
-	err = xml.NewDecoder(res.Body).Decode(&data)
+// WithFetcher returns a copy of the importer that downloads repomd.xml using f
+func (d DNF) WithFetcher(f Fetcher) Importer {
+	d.Fetcher = f
+	return d
+}
+
+func (d DNF) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	repoPath := ExpandPathTemplate(cmp.Or(d.PathTemplate, dnfPathTemplate), version, repo, arch)
+	repoURL, data, err := readRepomd(d.Fetcher, baseURL, repoPath)
 	if err != nil {
 		return nil, err
 	}
@@ -65,26 +72,18 @@ func (DNF) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
 	if filelists == "" {
 		return nil, errors.New("no filelists found in repomd.xml")
 	}
-	
-	filelistsURL := u.JoinPath("linux/releases", version, repo, arch, "os", filelists)
+
+	filelistsURL := repoURL.JoinPath(filelists)
 	return []string{filelistsURL.String()}, nil
 }
 
-func (DNF) ReadPkgData(r io.Reader, out chan Record) {
-	ctx := context.Background()
-	format, r, err := archives.Identify(ctx, "", r)
-	if err != nil {
-		out <- Record{Error: err}
-		return
-	}
-
-	decomp, ok := format.(archives.Decompressor)
-	if !ok {
-		out <- Record{Error: errors.New("downloaded index is not a valid compressed file")}
-		return
-	}
+// ManifestURL returns the URL of the repo's repomd.xml file
+func (d DNF) ManifestURL(baseURL, version, repo, arch string) ([]string, error) {
+	return repomdURL(baseURL, ExpandPathTemplate(cmp.Or(d.PathTemplate, dnfPathTemplate), version, repo, arch))
+}
 
-	dr, err := decomp.OpenReader(r)
+func (DNF) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
 	if err != nil {
 		out <- Record{Error: err}
 		return
@@ -92,44 +91,103 @@ func (DNF) ReadPkgData(r io.Reader, out chan Record) {
 	defer dr.Close()
 
 	br := bufio.NewReader(dr)
-	var currentPkg string
+	var currentPkg, currentVersion string
+	lineNum := 0
 
 	for {
 		line, err := br.ReadString('\n')
+		lineNum++
 		if errors.Is(err, io.EOF) {
 			close(out)
 			break
 		} else if err != nil {
-			out <- Record{Error: err}
+			out <- Record{Error: &ParseError{Line: lineNum, Snippet: snippet(line), Err: err}}
 			return
 		}
 		line = strings.TrimSpace(line)
 
 		switch {
-		case strings.HasPrefix(line, "<file"):
-			// Skip directories and symlinks
-			if strings.HasPrefix(line[5:], `type="dir"`) || line[5] == 'l' {
+		case strings.HasPrefix(line, "<file>"), strings.HasPrefix(line, "<file "):
+			// The prefixes include the end of the tag name,
+			// so that the <filelists> element isn't matched.
+			// Skip directories. Filelists don't mark symlinks, so like in
+			// the other index formats, they're treated as regular files.
+			if strings.HasPrefix(line[5:], ` type="dir"`) {
 				continue
 			}
 
 			start := strings.IndexByte(line, '>') + 1
 			end := strings.LastIndexByte(line, '<')
+			if start == 0 || end < start {
+				out <- Record{Warning: &ParseError{Line: lineNum, Snippet: snippet(line), Err: errors.New("malformed file element")}}
+				continue
+			}
 			fpath := line[start:end]
 
+			// Files of packages without a name are skipped along with the package
+			if currentPkg == "" {
+				continue
+			}
+
 			if strings.Contains(fpath, ".build-id") {
 				continue
 			}
 
 			out <- Record{
-				Name: currentPkg,
-				Tags: tags.Generate(fpath),
+				Name:    currentPkg,
+				Tags:    tags.Generate(fpath),
+				Version: currentVersion,
 			}
 		case strings.HasPrefix(line, "<package"):
-			start := strings.LastIndex(line, `name="`) + 6
-			end := start + strings.IndexByte(line[start:], '"')
-			currentPkg = line[start:end]
+			currentPkg = xmlAttr(line, "name")
+			currentVersion = ""
+			if currentPkg == "" {
+				out <- Record{Warning: &ParseError{Line: lineNum, Snippet: snippet(line), Err: errors.New("package element without a name")}}
+			}
+		case strings.HasPrefix(line, "<version"):
+			currentVersion = rpmVersion(xmlAttr(line, "epoch"), xmlAttr(line, "ver"), xmlAttr(line, "rel"))
 		default:
 			continue
 		}
 	}
 }
+
+// DescriptionURL returns the URL of the repo's primary metadata index
+func (d DNF) DescriptionURL(baseURL, version, repo, arch string) ([]string, error) {
+	return primaryURL(d.Fetcher, baseURL, ExpandPathTemplate(cmp.Or(d.PathTemplate, dnfPathTemplate), version, repo, arch))
+}
+
+func (DNF) ReadDescriptions(r io.Reader, out chan Record) {
+	readPrimary(r, out)
+}
+
+func (DNF) CompareVersions(a, b string) int {
+	return CompareRPMVersions(a, b)
+}
+
+// xmlAttr returns the value of the attribute with the given name from
+// a single-line XML tag, or an empty string if it doesn't have one.
+func xmlAttr(line, name string) string {
+	_, val, ok := strings.Cut(line, " "+name+`="`)
+	if !ok {
+		return ""
+	}
+	val, _, _ = strings.Cut(val, `"`)
+	return val
+}
+
+// rpmVersion joins the parts of an RPM version into the
+// "[epoch:]version[-release]" format, leaving out a zero epoch.
+func rpmVersion(epoch, ver, rel string) string {
+	if ver == "" {
+		return ""
+	}
+	out := ver
+	if rel != "" {
+		out += "-" + rel
+	}
+	if epoch != "" && epoch != "0" {
+		out = epoch + ":" + out
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// primaryXML is an excerpt from the primary metadata index of a Fedora repo
+const primaryXML = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="3">
+<package type="rpm">
+  <name>vim-enhanced</name>
+  <arch>x86_64</arch>
+  <version epoch="2" ver="9.1.825" rel="1.fc41"/>
+  <summary>A version of the VIM editor which includes recent enhancements</summary>
+  <description>VIM (VIsual editor iMproved) is an updated and improved version of the
+vi editor.</description>
+</package>
+<package type="rpm">
+  <name>nano</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="8.1" rel="1.fc41"/>
+  <description>
+    GNU nano is a small and friendly text editor.
+  </description>
+</package>
+<package type="rpm">
+  <name>empty</name>
+  <arch>noarch</arch>
+  <version epoch="0" ver="1" rel="1"/>
+  <description></description>
+</package>
+</metadata>
+`
+
+func TestDNFReadDescriptions(t *testing.T) {
+	recs := readRecords(t, DNF{}.ReadDescriptions, strings.NewReader(primaryXML))
+
+	tests := []struct {
+		name    string
+		version string
+		desc    string
+	}{
+		{"vim-enhanced", "2:9.1.825-1.fc41", "VIM (VIsual editor iMproved) is an updated and improved version of the\nvi editor."},
+		{"nano", "8.1-1.fc41", "GNU nano is a small and friendly text editor."},
+	}
+
+	if len(recs) != len(tests) {
+		t.Fatalf("got %d records, want %d (packages without descriptions are skipped)", len(recs), len(tests))
+	}
+	for i, tt := range tests {
+		rec := recs[i]
+		if rec.Name != tt.name || rec.Version != tt.version || rec.Description != tt.desc || len(rec.Tags) != 0 {
+			t.Errorf("got record %+v, want %s %s %q without tags", rec, tt.name, tt.version, tt.desc)
+		}
+	}
+}
+
+// filelistsXML is an excerpt from the filelists index of a Fedora repo
+const filelistsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="2">
+<package pkgid="0123" name="vim-enhanced" arch="x86_64">
+  <version epoch="2" ver="9.1.825" rel="1.fc41"/>
+  <file>/usr/bin/vim</file>
+  <file>/usr/bin/rvim</file>
+  <file type="dir">/usr/share/vim/vimfiles</file>
+  <file>/usr/lib/.build-id/ab/cdef</file>
+</package>
+<package pkgid="4567" name="nano" arch="x86_64">
+  <version epoch="0" ver="8.1" rel="1.fc41"/>
+  <file type="dir">/usr/bin</file>
+  <file>/usr/bin/nano</file>
+</package>
+</filelists>
+`
+
+func TestDNFReadPkgData(t *testing.T) {
+	recs := readRecords(t, DNF{}.ReadPkgData, strings.NewReader(filelistsXML))
+
+	want := []Record{
+		{Name: "vim-enhanced", Version: "2:9.1.825-1.fc41", Tags: []string{"bin=vim"}},
+		// rvim is a symlink to vim, but filelists don't
+		// mark symlinks, so it's indexed like a regular file.
+		{Name: "vim-enhanced", Version: "2:9.1.825-1.fc41", Tags: []string{"bin=rvim"}},
+		// Directories don't produce any records
+		{Name: "nano", Version: "8.1-1.fc41", Tags: []string{"bin=nano"}},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(recs), len(want), recs)
+	}
+	for i, rec := range recs {
+		if rec.Name != want[i].Name || rec.Version != want[i].Version || !slices.Equal(rec.Tags, want[i].Tags) {
+			t.Errorf("got record %+v, want %+v", rec, want[i])
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+// freebsdDefaultBranch is the package branch that's used if none is
+// configured. It's the default branch of FreeBSD releases.
+const freebsdDefaultBranch = "quarterly"
+
+type FreeBSDPkg struct {
+	// Branch is the package branch to read, such as "latest" or
+	// "quarterly". If it's empty, freebsdDefaultBranch is used.
+	Branch string
+}
+
+func (FreeBSDPkg) Name() string {
+	return "pkg"
+}
+
+// WithBranch returns a copy of the importer that reads the given package branch
+func (f FreeBSDPkg) WithBranch(branch string) Importer {
+	f.Branch = branch
+	return f
+}
+
+// IndexURL returns the URL of the packagesite archive for the given version
+// and arch. FreeBSD mirrors are laid out as <abi>/<branch>, such as
+// FreeBSD:14:amd64/latest, where the ABI string is made up of the major
+// version and the arch. repo isn't used.
+func (f FreeBSDPkg) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	abi := "FreeBSD:" + version + ":" + arch
+	indexURL, err := url.JoinPath(baseURL, abi, cmp.Or(f.Branch, freebsdDefaultBranch), "packagesite.txz")
+	if err != nil {
+		return nil, err
+	}
+	return []string{indexURL}, nil
+}
+
+func (FreeBSDPkg) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Err: errors.New("missing packagesite.yaml file")}}
+			return
+		} else if err != nil {
+			out <- Record{Error: &ParseError{Err: err}}
+			return
+		}
+
+		if path.Clean(hdr.Name) == "packagesite.yaml" {
+			if readPkgManifests(hdr.Name, tr, out) {
+				close(out)
+			}
+			return
+		}
+	}
+}
+
+// pkgManifest contains the fields of a FreeBSD package manifest that are
+// used by distrohop. Files maps the path of each file to its checksum.
+type pkgManifest struct {
+	Name  string            `json:"name"`
+	Files map[string]string `json:"files"`
+}
+
+// readPkgManifests reads a packagesite.yaml file, which despite its name
+// contains one JSON package manifest per line, and sends a record for each
+// package on out. It returns false if an error was sent on out.
+func readPkgManifests(entry string, r io.Reader, out chan Record) bool {
+	br := bufio.NewReader(r)
+	lineNum := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		lineNum++
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return true
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Entry: entry, Line: lineNum, Snippet: snippet(string(line)), Err: err}}
+			return false
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		// Malformed manifests are skipped with a warning
+		var manifest pkgManifest
+		if err := json.Unmarshal(line, &manifest); err != nil {
+			out <- Record{Warning: &ParseError{Entry: entry, Line: lineNum, Snippet: snippet(string(line)), Err: err}}
+			continue
+		} else if manifest.Name == "" {
+			out <- Record{Warning: &ParseError{Entry: entry, Line: lineNum, Snippet: snippet(string(line)), Err: errors.New("missing package name")}}
+			continue
+		}
+
+		var pkgTags []string
+		for _, file := range slices.Sorted(maps.Keys(manifest.Files)) {
+			pkgTags = append(pkgTags, tags.Generate(path.Join("/", file))...)
+		}
+
+		if len(pkgTags) != 0 {
+			out <- Record{Name: manifest.Name, Tags: pkgTags}
+		}
+	}
+}
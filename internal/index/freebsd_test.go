@@ -0,0 +1,104 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// packagesite is an excerpt from the packagesite.yaml of a FreeBSD package
+// repo, which contains one JSON manifest per line despite its name
+const packagesite = `{"name":"vim","origin":"editors/vim","version":"9.1.0707","arch":"freebsd:14:x86:64","files":{"/usr/local/bin/vim":"1$abc","/usr/local/share/man/man1/vim.1.gz":"1$def"}}
+{"name":"curl","origin":"ftp/curl","version":"8.10.1","arch":"freebsd:14:x86:64","files":{"/usr/local/lib/libcurl.so.4":"1$abc","/usr/local/bin/curl":"1$def"}}
+{"name":"freebsd-meta","origin":"misc/freebsd-meta","version":"1.0"}
+`
+
+func TestFreeBSDIndexURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		importer Importer
+		want     string
+	}{
+		{"default branch", FreeBSDPkg{}, "https://pkg.freebsd.org/FreeBSD:14:amd64/quarterly/packagesite.txz"},
+		{"latest", FreeBSDPkg{}.WithBranch("latest"), "https://pkg.freebsd.org/FreeBSD:14:amd64/latest/packagesite.txz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.importer.IndexURL("https://pkg.freebsd.org", "14", "", "amd64")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, []string{tt.want}) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeBSDReadPkgData(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    map[string][]string
+		wantErr string
+	}{
+		{
+			name:  "packagesite",
+			files: []string{"packagesite.yaml", packagesite},
+			want: map[string][]string{
+				"vim":  {"bin=vim", "man=vim.1"},
+				"curl": {"bin=curl", "lib=libcurl.so.4", "lib=libcurl.so", "lib=curl"},
+			},
+		},
+		{
+			name:    "missing packagesite",
+			files:   []string{"meta", "version = 2;"},
+			wantErr: "missing packagesite.yaml file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, _, err := tryReadRecords(FreeBSDPkg{}.ReadPkgData, tarArchive(t, tt.files...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got := pkgTags(recs)
+			if len(got) != len(tt.want) {
+				t.Errorf("got packages %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if !slices.Equal(got[name], want) {
+					t.Errorf("%s: got tags %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
@@ -25,13 +25,76 @@ package index
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"strings"
 )
 
 // Record represents a data record for a single package
 type Record struct {
-	Name  string
-	Tags  []string
-	Error error
+	Name string
+	Tags []string
+	// Arch is the architecture of the index the record came from.
+	// Importers may leave it empty, in which case the architecture
+	// that was pulled is used.
+	Arch string
+	// Version is the version of the package the record came from,
+	// for importers that implement [VersionComparer]. It's empty
+	// if the index doesn't contain version information.
+	Version string
+	// Description is a description of the package, for importers that
+	// read it from the index. Records may contain only a description,
+	// in which case they don't add any tags to the package.
+	Description string
+	// Warning is set instead of the other fields when a malformed part of
+	// the index was skipped. Unlike Error, it doesn't stop the import.
+	Warning error
+	Error   error
+}
+
+// ParseError describes a problem with the contents of an index along
+// with its location, so that broken indices are easier to debug.
+type ParseError struct {
+	// Entry is the name of the file within the index that the
+	// problem is in, for indices that are archives.
+	Entry string
+	// Line is the number of the line that the problem is on, starting
+	// at 1. It's zero if the problem isn't on a specific line.
+	Line int
+	// Snippet is the start of the line or record with the problem
+	Snippet string
+	Err     error
+}
+
+func (pe *ParseError) Error() string {
+	var sb strings.Builder
+	if pe.Entry != "" {
+		sb.WriteString(pe.Entry + ": ")
+	}
+	if pe.Line != 0 {
+		fmt.Fprintf(&sb, "line %d: ", pe.Line)
+	}
+	sb.WriteString(pe.Err.Error())
+	if pe.Snippet != "" {
+		fmt.Fprintf(&sb, " (near %q)", pe.Snippet)
+	}
+	return sb.String()
+}
+
+func (pe *ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// maxSnippetLen is the maximum length of the snippet in a [ParseError]
+const maxSnippetLen = 80
+
+// snippet returns the start of s for use in a [ParseError]
+func snippet(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxSnippetLen {
+		s = s[:maxSnippetLen] + "..."
+	}
+	return s
 }
 
 type Importer interface {
@@ -43,10 +106,205 @@ type Importer interface {
 	ReadPkgData(r io.Reader, out chan Record)
 }
 
+// MetadataImporter is implemented by importers that can read additional
+// package metadata, such as source package names, from a separate index.
+// The records it produces are merged with the ones from the main index.
+type MetadataImporter interface {
+	Importer
+	// MetadataURL generates a list of possible metadata index URLs to try
+	MetadataURL(baseURL, version, repo, arch string) ([]string, error)
+	// ReadMetadata reads data from a metadata index file and sends it on out
+	ReadMetadata(r io.Reader, out chan Record)
+}
+
+// DescriptionImporter is implemented by importers for repos that publish package
+// descriptions in a separate index, which is only downloaded if descriptions are
+// enabled, since it's usually large. Importers that read descriptions from an
+// index they already use, such as APT's package metadata, don't implement it.
+type DescriptionImporter interface {
+	Importer
+	// DescriptionURL generates a list of possible description index URLs to try
+	DescriptionURL(baseURL, version, repo, arch string) ([]string, error)
+	// ReadDescriptions reads the descriptions from a description
+	// index file and sends them on out
+	ReadDescriptions(r io.Reader, out chan Record)
+}
+
+// DiffImporter is implemented by importers for repos that publish diffs between
+// versions of their indices, such as APT's PDiffs. Applying the diffs to a copy of
+// the previous version of an index produces the current version without having to
+// download all of it again.
+type DiffImporter interface {
+	Importer
+	// DiffIndexURL generates a list of possible diff index URLs to try
+	DiffIndexURL(baseURL, version, repo, arch string) ([]string, error)
+	// ReadDiffIndex reads a diff index file
+	ReadDiffIndex(r io.Reader) (DiffIndex, error)
+	// ApplyDiff applies a compressed diff file to the decompressed index
+	// read from old, and writes the decompressed result to w.
+	ApplyDiff(w io.Writer, old, diff io.Reader) error
+}
+
+// DiffIndex describes the diffs available for an index
+type DiffIndex struct {
+	// Current is the hex-encoded SHA256 hash of the
+	// current version of the decompressed index.
+	Current string
+	// Diffs maps the hex-encoded SHA256 hashes of previous versions of the
+	// decompressed index to the diffs that have to be applied to them
+	// in order to get the current version.
+	Diffs map[string][]Diff
+}
+
+// Diff represents a diff file listed in a [DiffIndex]
+type Diff struct {
+	// Path is the path to the diff file, relative to the diff index
+	Path string
+	// Result is the hex-encoded SHA256 hash of the decompressed
+	// index after the diff has been applied to it
+	Result string
+}
+
+// ManifestImporter is implemented by importers whose index URLs are read from a
+// manifest file in the repo, such as repomd.xml in RPM repos. The index file names
+// can change whenever the manifest does, so the URLs have to be resolved again
+// after it changes.
+type ManifestImporter interface {
+	Importer
+	// ManifestURL generates a list of possible manifest URLs
+	ManifestURL(baseURL, version, repo, arch string) ([]string, error)
+}
+
+// SignedImporter is implemented by importers for repos that publish detached
+// OpenPGP signatures of their indices, which can be verified before importing them.
+type SignedImporter interface {
+	Importer
+	// SignatureURL returns the URL of the signature of the index at indexURL
+	SignatureURL(indexURL string) string
+}
+
+// PathTemplater is implemented by importers for repos whose layout varies between
+// distros and mirrors, so that the path of the repo can be configured.
+type PathTemplater interface {
+	Importer
+	// WithPathTemplate returns a copy of the importer that finds the repo using
+	// the given path template instead of its default layout. The template
+	// is expanded using [ExpandPathTemplate].
+	WithPathTemplate(tmpl string) Importer
+}
+
+// WithPathTemplate returns a copy of importer that uses the given path template
+// if it implements [PathTemplater]. Otherwise, it returns an error.
+func WithPathTemplate(importer Importer, tmpl string) (Importer, error) {
+	pt, ok := importer.(PathTemplater)
+	if !ok {
+		return nil, fmt.Errorf("%s importer doesn't support index path templates", importer.Name())
+	}
+	return pt.WithPathTemplate(tmpl), nil
+}
+
+// BranchImporter is implemented by importers for repos that publish several
+// branches of their packages for the same version and architecture, such as
+// FreeBSD's latest and quarterly branches.
+type BranchImporter interface {
+	Importer
+	// WithBranch returns a copy of the importer that reads the given branch
+	WithBranch(branch string) Importer
+}
+
+// WithBranch returns a copy of importer that reads the given branch if it
+// implements [BranchImporter]. Otherwise, it returns an error.
+func WithBranch(importer Importer, branch string) (Importer, error) {
+	bi, ok := importer.(BranchImporter)
+	if !ok {
+		return nil, fmt.Errorf("%s importer doesn't support branches", importer.Name())
+	}
+	return bi.WithBranch(branch), nil
+}
+
+// Fetcher sends the requests that importers use to download the files they need
+// to find their indices, such as the repomd.xml file of RPM repos. [*http.Client]
+// implements it, so a client with a custom transport can be used to download
+// from URL schemes other than HTTP.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// FetchingImporter is implemented by importers that download files in IndexURL
+// or in the URL methods of the other importer interfaces.
+type FetchingImporter interface {
+	Importer
+	// WithFetcher returns a copy of the importer that downloads files using f
+	WithFetcher(f Fetcher) Importer
+}
+
+// LocatedImporter is implemented by importers that download files relative to
+// the index while reading it, such as the binary packages listed in a Gentoo
+// binhost's Packages index.
+type LocatedImporter interface {
+	Importer
+	// WithIndexURL returns a copy of the importer that reads
+	// the index that was downloaded from indexURL
+	WithIndexURL(indexURL string) Importer
+}
+
+// WithFetcher returns a copy of importer that downloads files using f if it
+// implements [FetchingImporter]. Otherwise, importer is returned as-is, since
+// it doesn't download anything.
+func WithFetcher(importer Importer, f Fetcher) Importer {
+	if fi, ok := importer.(FetchingImporter); ok {
+		return fi.WithFetcher(f)
+	}
+	return importer
+}
+
+// ValidatePathTemplate checks that tmpl can be used with [WithPathTemplate]. It
+// returns an error if importer doesn't implement [PathTemplater], or if tmpl
+// contains placeholders that [ExpandPathTemplate] doesn't support.
+func ValidatePathTemplate(importer Importer, tmpl string) error {
+	if _, err := WithPathTemplate(importer, tmpl); err != nil {
+		return err
+	}
+	if strings.HasPrefix(tmpl, "/") || strings.Contains(tmpl, "://") {
+		return fmt.Errorf("index path template %q must be relative to the base URL", tmpl)
+	}
+	expanded := ExpandPathTemplate(tmpl, "", "", "")
+	if start := strings.IndexByte(expanded, '{'); start != -1 {
+		placeholder, _, _ := strings.Cut(expanded[start:], "}")
+		return fmt.Errorf("index path template %q contains unknown placeholder %q", tmpl, placeholder+"}")
+	}
+	return nil
+}
+
+// ExpandPathTemplate replaces the {version}, {repo}, and {arch}
+// placeholders in a path template with the given values.
+func ExpandPathTemplate(tmpl, version, repo, arch string) string {
+	return strings.NewReplacer(
+		"{version}", version,
+		"{repo}", repo,
+		"{arch}", arch,
+	).Replace(tmpl)
+}
+
+// ExpandVars replaces $name and ${name} variables in s with their values
+// from vars. Variables that aren't in vars are left as they are.
+func ExpandVars(s string, vars map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if val, ok := vars[name]; ok {
+			return val
+		}
+		return "$" + name
+	})
+}
+
 var importers = []Importer{
+	Alpine{},
 	APT{},
 	DNF{},
+	FreeBSDPkg{},
 	Pacman{},
+	Portage{},
+	XBPS{},
 	Zypper{},
 }
 
@@ -0,0 +1,410 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mholt/archives"
+)
+
+// readRecords runs a ReadPkgData-style function on input
+// and returns the records it sends, failing on errors.
+func readRecords(t *testing.T, readFn func(io.Reader, chan Record), input io.Reader) []Record {
+	t.Helper()
+	recs, _, err := tryReadRecords(readFn, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+// tryReadRecords runs a ReadPkgData-style function on input and returns the
+// records and warnings it sends, stopping at the first error.
+func tryReadRecords(readFn func(io.Reader, chan Record), input io.Reader) (recs []Record, warnings []error, err error) {
+	out := make(chan Record)
+	go readFn(input, out)
+
+	for rec := range out {
+		if rec.Error != nil {
+			// The reader stops after sending an error without closing
+			// the channel, so there's nothing left to drain.
+			return recs, warnings, rec.Error
+		} else if rec.Warning != nil {
+			warnings = append(warnings, rec.Warning)
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, warnings, nil
+}
+
+// tarArchive returns an uncompressed tar archive containing
+// the given files, which are alternating names and contents.
+func tarArchive(t *testing.T, files ...string) io.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for i := 0; i < len(files); i += 2 {
+		name, content := files[i], files[i+1]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// pkgTags merges the tags of recs by package name
+func pkgTags(recs []Record) map[string][]string {
+	out := map[string][]string{}
+	for _, rec := range recs {
+		out[rec.Name] = append(out[rec.Name], rec.Tags...)
+	}
+	return out
+}
+
+func TestParseErrorString(t *testing.T) {
+	tests := []struct {
+		pe   ParseError
+		want string
+	}{
+		{ParseError{Err: io.ErrUnexpectedEOF}, "unexpected EOF"},
+		{ParseError{Entry: "desc", Line: 3, Err: io.ErrUnexpectedEOF}, "desc: line 3: unexpected EOF"},
+		{ParseError{Line: 1, Snippet: "foo", Err: io.ErrUnexpectedEOF}, `line 1: unexpected EOF (near "foo")`},
+	}
+	for _, tt := range tests {
+		if got := tt.pe.Error(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", maxSnippetLen+10)
+	if got := snippet(long); got != long[:maxSnippetLen]+"..." {
+		t.Errorf("long snippet wasn't truncated: %q", got)
+	}
+	if got := snippet("  short \n"); got != "short" {
+		t.Errorf("got %q, want %q", got, "short")
+	}
+}
+
+func TestWithPathTemplate(t *testing.T) {
+	const repomd = `<repomd><data type="filelists"><location href="repodata/abc-filelists.xml.gz"/></data></repomd>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/repodata/repomd.xml") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(repomd))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		importer Importer
+		tmpl     string
+		want     string
+	}{
+		{"dnf default", DNF{}, "", "/linux/releases/41/Everything/x86_64/os/repodata/abc-filelists.xml.gz"},
+		{"dnf epel", DNF{}, "pub/epel/{version}/{repo}/{arch}", "/pub/epel/41/Everything/x86_64/repodata/abc-filelists.xml.gz"},
+		{"zypper default", Zypper{}, "", "/41/repo/Everything/repodata/abc-filelists.xml.gz"},
+		{"zypper custom", Zypper{}, "distribution/{version}/repo/{repo}/{arch}", "/distribution/41/repo/Everything/x86_64/repodata/abc-filelists.xml.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := tt.importer
+			if tt.tmpl != "" {
+				var err error
+				importer, err = WithPathTemplate(importer, tt.tmpl)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			urls, err := importer.IndexURL(srv.URL, "41", "Everything", "x86_64")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(urls) != 1 || urls[0] != srv.URL+tt.want {
+				t.Errorf("got %q, want %q", urls, srv.URL+tt.want)
+			}
+		})
+	}
+
+	if _, err := WithPathTemplate(APT{}, "{version}"); err == nil {
+		t.Error("expected an error for an importer without path template support")
+	}
+}
+
+func TestMalformedEntriesSkipped(t *testing.T) {
+	tests := []struct {
+		name         string
+		readFn       func(io.Reader, chan Record)
+		input        func(t *testing.T) io.Reader
+		wantPkgs     []string
+		wantWarnings []string
+	}{
+		{
+			name:   "apt",
+			readFn: APT{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return strings.NewReader("usr/bin/vim editors/vim\ngarbage\nusr/bin/nano editors/nano\n")
+			},
+			wantPkgs:     []string{"nano", "vim"},
+			wantWarnings: []string{`line 2: missing package location (near "garbage")`},
+		},
+		{
+			name:   "dnf",
+			readFn: DNF{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="2">
+<package pkgid="abc" name="" arch="x86_64">
+  <file>/usr/bin/unnamed</file>
+</package>
+<package pkgid="def" name="vim" arch="x86_64">
+  <version epoch="0" ver="9.1" rel="1"/>
+  <file>/usr/bin/vim</file>
+  <file>broken
+</package>
+</filelists>
+`)
+			},
+			wantPkgs: []string{"vim"},
+			wantWarnings: []string{
+				"line 3: package element without a name",
+				"line 9: malformed file element",
+			},
+		},
+		{
+			name:   "pacman",
+			readFn: Pacman{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return tarArchive(t,
+					"unnamed-1.0-1/desc", "%VERSION%\n1.0-1\n",
+					"unnamed-1.0-1/files", "%FILES%\nusr/bin/unnamed\n",
+					"vim-9.1-1/desc", "%NAME%\nvim\n\n%VERSION%\n9.1-1\n",
+					"vim-9.1-1/files", "%FILES%\nusr/bin/vim\n",
+				)
+			},
+			wantPkgs:     []string{"vim"},
+			wantWarnings: []string{"unnamed-1.0-1/desc: missing package name"},
+		},
+		{
+			name:   "apk",
+			readFn: Alpine{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return tarArchive(t, "APKINDEX", "V:1.0\nF:usr/bin\nR:unnamed\n\nP:vim\nF:usr/bin\nR:vim\ngarbage\n\n")
+			},
+			wantPkgs: []string{"vim"},
+			wantWarnings: []string{
+				"APKINDEX: line 1: missing package name",
+				`APKINDEX: line 8: missing field separator (near "garbage")`,
+			},
+		},
+		{
+			name:   "freebsd",
+			readFn: FreeBSDPkg{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return tarArchive(t, "packagesite.yaml", `{"files":{"/usr/local/bin/unnamed":"1"}}
+{"name":"broken",
+{"name":"vim","files":{"/usr/local/bin/vim":"1"}}
+`)
+			},
+			wantPkgs: []string{"vim"},
+			wantWarnings: []string{
+				"packagesite.yaml: line 1: missing package name",
+				"packagesite.yaml: line 2: ",
+			},
+		},
+		{
+			name:   "xbps",
+			readFn: XBPS{}.ReadPkgData,
+			input: func(t *testing.T) io.Reader {
+				return tarArchive(t, "index.plist", "<plist><dict><key>broken</key><string>x</string><key>vim</key><dict><key>shlib-provides</key><array><string>libvim.so.1</string></array></dict></dict></plist>")
+			},
+			wantPkgs:     []string{"vim"},
+			wantWarnings: []string{"index.plist: package broken: metadata isn't a dictionary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, warnings, err := tryReadRecords(tt.readFn, tt.input(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotPkgs := slices.Sorted(maps.Keys(pkgTags(recs)))
+			if !slices.Equal(gotPkgs, tt.wantPkgs) {
+				t.Errorf("got packages %v, want %v", gotPkgs, tt.wantPkgs)
+			}
+
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Fatalf("got warnings %v, want %v", warnings, tt.wantWarnings)
+			}
+			for i, want := range tt.wantWarnings {
+				var pe *ParseError
+				if !errors.As(warnings[i], &pe) {
+					t.Errorf("warning %q isn't a parse error", warnings[i])
+				} else if !strings.HasPrefix(pe.Error(), want) {
+					t.Errorf("got warning %q, want %q", pe, want)
+				}
+			}
+		})
+	}
+}
+
+// fetcherFunc is an adapter to allow the use of ordinary functions as fetchers
+type fetcherFunc func(req *http.Request) (*http.Response, error)
+
+func (f fetcherFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGetImporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"apt", false},
+		{"apk", false},
+		{"dnf", false},
+		{"pacman", false},
+		{"pkg", false},
+		{"portage", false},
+		{"xbps", false},
+		{"zypper", false},
+		{"foo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer, err := GetImporter(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got importer %T, want error", importer)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if importer.Name() != tt.name {
+				t.Errorf("got importer %q, want %q", importer.Name(), tt.name)
+			}
+		})
+	}
+}
+
+func TestWithFetcher(t *testing.T) {
+	const repomd = `<repomd><data type="filelists"><location href="repodata/abc-filelists.xml.gz"/></data></repomd>`
+	fetcher := fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != "s3://mirror/41/repo/oss/repodata/repomd.xml" {
+			return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(repomd))}, nil
+	})
+
+	tests := []struct {
+		name    string
+		repo    string
+		want    string
+		wantErr string
+	}{
+		{"found", "oss", "s3://mirror/41/repo/oss/repodata/abc-filelists.xml.gz", ""},
+		{"not found", "non-oss", "", "can't download repomd.xml: 404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := WithFetcher(Zypper{}, fetcher)
+			urls, err := importer.IndexURL("s3://mirror", "41", tt.repo, "x86_64")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(urls) != 1 || urls[0] != tt.want {
+				t.Errorf("got %v, want %s", urls, tt.want)
+			}
+		})
+	}
+
+	// Importers that don't download anything are returned as-is
+	if got := WithFetcher(APT{}, fetcher); got != (APT{}) {
+		t.Errorf("got %#v, want APT{}", got)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	const contents = "usr/bin/vim                 editors/vim\nusr/share/man/man1/nano.1.gz editors/nano\n"
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"plain", contents},
+		{"empty", ""},
+		{"gzip", compress(t, archives.Gz{}, strings.NewReader(contents))},
+		{"bzip2", compress(t, archives.Bz2{}, strings.NewReader(contents))},
+		{"xz", compress(t, archives.Xz{}, strings.NewReader(contents))},
+		{"zstd", compress(t, archives.Zstd{}, strings.NewReader(contents))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := contents
+			if tt.input == "" {
+				want = ""
+			}
+
+			dr, err := Decompress(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dr.Close()
+			got, err := io.ReadAll(dr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -26,15 +26,13 @@ import (
 	"archive/tar"
 	"bufio"
 	"bytes"
-	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
-	"os"
 	"path"
 	"strings"
 
-	"github.com/mholt/archives"
 	"go.elara.ws/distrohop/internal/tags"
 )
 
@@ -45,14 +43,9 @@ func (Pacman) Name() string {
 }
 
 func (Pacman) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
-	baseURL = os.Expand(baseURL, func(s string) string {
-		switch s {
-		case "repo":
-			return repo
-		case "arch":
-			return arch
-		}
-		return "$" + s
+	baseURL = ExpandVars(baseURL, map[string]string{
+		"repo": repo,
+		"arch": arch,
 	})
 
 	u, err := url.ParseRequestURI(baseURL)
@@ -67,21 +60,14 @@ func (Pacman) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
 	return []string{u.String()}, nil
 }
 
-func (Pacman) ReadPkgData(r io.Reader, out chan Record) {
-	ctx := context.Background()
-	format, r, err := archives.Identify(ctx, "", r)
-	if err != nil {
-		out <- Record{Error: err}
-		return
-	}
-
-	decomp, ok := format.(archives.Decompressor)
-	if !ok {
-		out <- Record{Error: errors.New("downloaded index is not a valid compressed file")}
-		return
-	}
+// SignatureURL returns the URL of the signature of a .files
+// database, which is stored next to it with a .sig extension.
+func (Pacman) SignatureURL(indexURL string) string {
+	return indexURL + ".sig"
+}
 
-	dr, err := decomp.OpenReader(r)
+func (Pacman) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
 	if err != nil {
 		out <- Record{Error: err}
 		return
@@ -89,7 +75,7 @@ func (Pacman) ReadPkgData(r io.Reader, out chan Record) {
 	defer dr.Close()
 
 	tr := tar.NewReader(dr)
-	var currentPkg string
+	var currentPkg, currentVersion, prevEntry string
 
 	for {
 		hdr, err := tr.Next()
@@ -97,34 +83,43 @@ func (Pacman) ReadPkgData(r io.Reader, out chan Record) {
 			close(out)
 			break
 		} else if err != nil {
-			out <- Record{Error: err}
+			if prevEntry != "" {
+				err = fmt.Errorf("reading the entry after %s: %w", prevEntry, err)
+			}
+			out <- Record{Error: &ParseError{Err: err}}
 			return
 		}
+		prevEntry = hdr.Name
 
 		switch path.Base(hdr.Name) {
 		case "desc":
 			data, err := io.ReadAll(tr)
 			if err != nil {
-				out <- Record{Error: err}
+				out <- Record{Error: &ParseError{Entry: hdr.Name, Err: err}}
 				return
 			}
 
-			labelIdx := bytes.Index(data, []byte("%NAME%\n"))
-			if labelIdx == -1 {
+			currentPkg = descField(data, "NAME")
+			currentVersion = descField(data, "VERSION")
+			if currentPkg == "" {
+				firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+				out <- Record{Warning: &ParseError{Entry: hdr.Name, Snippet: snippet(string(firstLine)), Err: errors.New("missing package name")}}
+			}
+		case "files":
+			// Files of packages without a name are skipped along with the package
+			if currentPkg == "" {
 				continue
 			}
 
-			start := labelIdx + 7
-			end := start + bytes.IndexByte(data[start:], '\n')
-			currentPkg = string(data[start:end])
-		case "files":
 			br := bufio.NewReader(tr)
+			lineNum := 0
 			for {
 				fpath, err := br.ReadString('\n')
+				lineNum++
 				if errors.Is(err, io.EOF) {
 					break
 				} else if err != nil {
-					out <- Record{Error: err}
+					out <- Record{Error: &ParseError{Entry: hdr.Name, Line: lineNum, Snippet: snippet(fpath), Err: err}}
 					return
 				}
 
@@ -136,10 +131,26 @@ func (Pacman) ReadPkgData(r io.Reader, out chan Record) {
 				fpath = "/" + fpath
 
 				out <- Record{
-					Name: currentPkg,
-					Tags: tags.Generate(fpath),
+					Name:    currentPkg,
+					Tags:    tags.Generate(fpath),
+					Version: currentVersion,
 				}
 			}
 		}
 	}
 }
+
+func (Pacman) CompareVersions(a, b string) int {
+	return ComparePacmanVersions(a, b)
+}
+
+// descField returns the first line of the value of the given
+// field in a pacman desc file, or an empty string if it's missing.
+func descField(data []byte, name string) string {
+	_, val, ok := bytes.Cut(data, []byte("%"+name+"%\n"))
+	if !ok {
+		return ""
+	}
+	val, _, _ = bytes.Cut(val, []byte("\n"))
+	return string(val)
+}
@@ -0,0 +1,188 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// edCommand represents a single command from an ed script
+type edCommand struct {
+	// start and end are the first and last lines that the command
+	// operates on. For append commands, text is added after start,
+	// and end is the same as start.
+	start, end int
+	op         byte
+	text       []string
+}
+
+// applyEdDiff applies a diff in the format produced by "diff --ed" to the
+// lines read from old, and writes the result to w. This is the format used
+// by APT's PDiffs. The diff's commands are applied in a single pass over
+// old, so it doesn't need to fit in memory.
+func applyEdDiff(w io.Writer, old, diff io.Reader) error {
+	cmds, err := readEdCommands(diff)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	br := bufio.NewReader(old)
+	line := 0
+
+	// copyTo copies lines from old to w until the given line has been copied
+	copyTo := func(n int) error {
+		for line < n {
+			text, err := br.ReadString('\n')
+			if errors.Is(err, io.EOF) && text == "" {
+				return fmt.Errorf("ed diff: line %d is past the end of the file", n)
+			} else if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			if _, err := bw.WriteString(text); err != nil {
+				return err
+			}
+			line++
+		}
+		return nil
+	}
+
+	for _, cmd := range cmds {
+		switch cmd.op {
+		case 'a':
+			if err := copyTo(cmd.start); err != nil {
+				return err
+			}
+		case 'c', 'd':
+			if err := copyTo(cmd.start - 1); err != nil {
+				return err
+			}
+			// Skip the lines that are being changed or deleted
+			for line < cmd.end {
+				if _, err := br.ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+					return err
+				}
+				line++
+			}
+		}
+
+		for _, text := range cmd.text {
+			if _, err := bw.WriteString(text + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Copy the rest of the file
+	if _, err := io.Copy(bw, br); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readEdCommands reads the commands from an ed script and returns
+// them in the order of the lines they apply to. Diffs produced by
+// "diff --ed" list their commands from the end of the file to the
+// start, so that earlier commands don't affect the line numbers
+// of later ones.
+func readEdCommands(r io.Reader) ([]edCommand, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var cmds []edCommand
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+
+		cmd, err := parseEdCommand(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if cmd.op == 'a' || cmd.op == 'c' {
+			// Read the text until the line containing only a dot
+			terminated := false
+			for sc.Scan() {
+				if sc.Text() == "." {
+					terminated = true
+					break
+				}
+				cmd.text = append(cmd.text, sc.Text())
+			}
+			if !terminated {
+				return nil, errors.New("ed diff: unterminated text block")
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(cmds)
+	for i := 1; i < len(cmds); i++ {
+		if cmds[i].start <= cmds[i-1].end {
+			return nil, errors.New("ed diff: commands are out of order")
+		}
+	}
+
+	return cmds, nil
+}
+
+// parseEdCommand parses an ed command line, such as "12a" or "3,5c"
+func parseEdCommand(line string) (edCommand, error) {
+	op := line[len(line)-1]
+	if op != 'a' && op != 'c' && op != 'd' {
+		return edCommand{}, fmt.Errorf("ed diff: unsupported command: %q", line)
+	}
+
+	startStr, endStr, hasEnd := strings.Cut(line[:len(line)-1], ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return edCommand{}, fmt.Errorf("ed diff: invalid command: %q", line)
+	}
+
+	end := start
+	if hasEnd {
+		end, err = strconv.Atoi(endStr)
+		if err != nil || end < start {
+			return edCommand{}, fmt.Errorf("ed diff: invalid command: %q", line)
+		}
+	}
+
+	if start < 0 || (op != 'a' && start == 0) || (op == 'a' && hasEnd) {
+		return edCommand{}, fmt.Errorf("ed diff: invalid command: %q", line)
+	}
+
+	return edCommand{start: start, end: end, op: op}, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyEdDiff(t *testing.T) {
+	const old = "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name    string
+		diff    string
+		want    string
+		wantErr bool
+	}{
+		{"append", "2a\nb2\n.\n", "a\nb\nb2\nc\nd\ne\n", false},
+		{"prepend", "0a\nz\n.\n", "z\na\nb\nc\nd\ne\n", false},
+		{"change", "2,3c\nB\nC\n.\n", "a\nB\nC\nd\ne\n", false},
+		{"delete", "4,5d\n", "a\nb\nc\n", false},
+		// Commands are listed from the end of the file to the start
+		{"multiple", "5d\n3c\nC\n.\n1a\na2\n.\n", "a\na2\nb\nC\nd\n", false},
+		{"out of order", "1d\n3d\n", "", true},
+		{"past end", "9d\n", "", true},
+		{"unterminated", "1a\nfoo\n", "", true},
+		{"unsupported", "1,2s/a/b/\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := applyEdDiff(&out, strings.NewReader(old), strings.NewReader(tt.diff))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPTReadDiffIndex(t *testing.T) {
+	const index = `SHA256-Current: cccc 300
+SHA256-History:
+ aaaa 100 2024-01-01-0000.00
+ bbbb 200 2024-01-02-0000.00
+SHA256-Download:
+ 1111 10 2024-01-01-0000.00.gz
+ 2222 20 2024-01-02-0000.00.gz
+`
+
+	tests := []struct {
+		name  string
+		input string
+		from  string
+		want  []Diff
+	}{
+		{
+			name:  "oldest",
+			input: index,
+			from:  "aaaa",
+			want: []Diff{
+				{Path: "2024-01-01-0000.00.gz", Result: "bbbb"},
+				{Path: "2024-01-02-0000.00.gz", Result: "cccc"},
+			},
+		},
+		{
+			name:  "newest",
+			input: index,
+			from:  "bbbb",
+			want:  []Diff{{Path: "2024-01-02-0000.00.gz", Result: "cccc"}},
+		},
+		{
+			name:  "merged",
+			input: index + "X-Patch-Precedence: merged\n",
+			from:  "aaaa",
+			want:  []Diff{{Path: "2024-01-01-0000.00.gz", Result: "cccc"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			di, err := APT{}.ReadDiffIndex(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if di.Current != "cccc" {
+				t.Errorf("got current hash %q, want %q", di.Current, "cccc")
+			}
+			got := di.Diffs[tt.from]
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("diff %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
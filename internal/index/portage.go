@@ -0,0 +1,400 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+type Portage struct {
+	// Fetcher is used to download binary packages.
+	// If it's nil, [http.DefaultClient] is used.
+	Fetcher Fetcher
+	// PackagesURL is the URL that the Packages index was downloaded from.
+	// The paths of the binary packages it lists are relative to its
+	// directory, unless the index sets a different URI.
+	PackagesURL string
+}
+
+// portagePkg is a binary package listed in a binhost's Packages index
+type portagePkg struct {
+	name string
+	path string
+	line int
+}
+
+func (Portage) Name() string {
+	return "portage"
+}
+
+// WithFetcher returns a copy of the importer that downloads binary packages using f
+func (p Portage) WithFetcher(f Fetcher) Importer {
+	p.Fetcher = f
+	return p
+}
+
+// WithIndexURL returns a copy of the importer that downloads the binary
+// packages listed in the Packages index downloaded from indexURL
+func (p Portage) WithIndexURL(indexURL string) Importer {
+	p.PackagesURL = indexURL
+	return p
+}
+
+// IndexURL returns the URL of the binhost's Packages index for arch.
+// Gentoo binhosts aren't split into repos, so version and repo aren't used.
+func (Portage) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	indexURL, err := url.JoinPath(baseURL, arch, "Packages")
+	if err != nil {
+		return nil, err
+	}
+	return []string{indexURL}, nil
+}
+
+// ReadPkgData reads a binhost Packages index, and then downloads each of the
+// binary packages it lists to find their files, since the index itself only
+// contains package metadata. Packages that can't be downloaded or read are
+// skipped with a warning, but errors sending the requests stop the import.
+func (p Portage) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	pkgs, uri, ok := readPortageIndex(dr, out)
+	if !ok {
+		return
+	}
+
+	baseURL, err := p.binpkgBaseURL(uri)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+
+	fetcher := p.Fetcher
+	if fetcher == nil {
+		fetcher = http.DefaultClient
+	}
+
+	for _, pkg := range pkgs {
+		req, err := http.NewRequest(http.MethodGet, baseURL.JoinPath(pkg.path).String(), nil)
+		if err != nil {
+			out <- Record{Error: err}
+			return
+		}
+
+		res, err := fetcher.Do(req)
+		if err != nil {
+			out <- Record{Error: err}
+			return
+		} else if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			out <- Record{Warning: &ParseError{Line: pkg.line, Err: fmt.Errorf("%s: http: %s", pkg.path, res.Status)}}
+			continue
+		}
+
+		files, err := readBinpkg(res.Body, pkg.path)
+		res.Body.Close()
+		if err != nil {
+			out <- Record{Warning: &ParseError{Line: pkg.line, Err: fmt.Errorf("%s: %w", pkg.path, err)}}
+			continue
+		}
+
+		rec := Record{Name: pkg.name}
+		for _, fpath := range files {
+			rec.Tags = append(rec.Tags, tags.Generate(fpath)...)
+		}
+		if len(rec.Tags) != 0 {
+			out <- rec
+		}
+	}
+	close(out)
+}
+
+// readPortageIndex reads the packages listed in a binhost Packages index, along
+// with the URI set in its header, if any. The index consists of a header followed
+// by a block for each package, separated by blank lines. Malformed blocks are skipped
+// with a warning. If reading the index fails, the error is sent on out and ok is false.
+func readPortageIndex(r io.Reader, out chan Record) (pkgs []portagePkg, uri string, ok bool) {
+	br := bufio.NewReader(r)
+	var pkg portagePkg
+	var cpv string
+	header, valid := true, true
+	lineNum := 0
+
+	// flush adds the current package to pkgs if it's valid
+	flush := func() {
+		switch {
+		case pkg.line == 0:
+			// There's no current block
+		case header:
+			header = false
+		case !valid:
+		case cpv == "":
+			out <- Record{Warning: &ParseError{Line: pkg.line, Err: errors.New("missing CPV field")}}
+		default:
+			pkg.name = portageName(cpv)
+			if pkg.path == "" {
+				// Binhosts that don't store multiple builds of each package
+				// don't set PATH, and name their packages after the CPV.
+				pkg.path = cpv + ".tbz2"
+			}
+			pkgs = append(pkgs, pkg)
+		}
+		pkg, cpv, valid = portagePkg{}, "", true
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		lineNum++
+		if errors.Is(err, io.EOF) && line == "" {
+			flush()
+			return pkgs, uri, true
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Line: lineNum, Snippet: snippet(line), Err: err}}
+			return nil, "", false
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		} else if pkg.line == 0 {
+			pkg.line = lineNum
+		}
+
+		key, val, found := strings.Cut(line, ":")
+		if !found {
+			if valid && !header {
+				out <- Record{Warning: &ParseError{Line: lineNum, Snippet: snippet(line), Err: errors.New("missing field separator")}}
+			}
+			valid = false
+			continue
+		}
+		val = strings.TrimSpace(val)
+
+		switch {
+		case header && key == "URI":
+			uri = val
+		case !header && key == "CPV":
+			cpv = val
+		case !header && key == "PATH":
+			pkg.path = val
+		}
+	}
+}
+
+// binpkgBaseURL returns the URL that the paths of binary packages are relative to.
+// It's uri if the index sets one, and the directory containing the index otherwise.
+func (p Portage) binpkgBaseURL(uri string) (*url.URL, error) {
+	if uri != "" {
+		return url.Parse(uri)
+	} else if p.PackagesURL == "" {
+		return nil, errors.New("the URL of the Packages index is unknown, so its binary packages can't be downloaded")
+	}
+
+	u, err := url.Parse(p.PackagesURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Dir(u.Path)
+	u.RawPath = ""
+	return u, nil
+}
+
+// readBinpkg returns the paths of the files in the binary package read from r.
+// GPKG packages (.gpkg.tar) use the CONTENTS file in their metadata if it's
+// included, and the list of files in their image otherwise. XPAK packages
+// (.tbz2 or .xpak) are a compressed image archive with the metadata appended
+// to the end, so only the list of files in the image is used, which avoids
+// having to download the whole package just to reach the metadata.
+func readBinpkg(r io.Reader, binpkgPath string) ([]string, error) {
+	if !strings.HasSuffix(binpkgPath, ".gpkg.tar") {
+		return imageFiles(r, "")
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing image archive")
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := path.Base(hdr.Name)
+		if strings.HasSuffix(name, ".sig") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(name, "metadata.tar"):
+			files, err := metadataContents(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			} else if files != nil {
+				return files, nil
+			}
+		case strings.HasPrefix(name, "image.tar"):
+			files, err := imageFiles(tr, "image/")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return files, nil
+		}
+	}
+}
+
+// metadataContents returns the paths of the files listed in the CONTENTS file
+// in the GPKG metadata archive read from r. If it doesn't contain a CONTENTS
+// file, it returns nil.
+func metadataContents(r io.Reader) ([]string, error) {
+	dr, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if path.Base(hdr.Name) != "CONTENTS" {
+			continue
+		}
+
+		files := []string{}
+		scanner := bufio.NewScanner(tr)
+		for scanner.Scan() {
+			if fpath := contentsPath(scanner.Text()); fpath != "" {
+				files = append(files, fpath)
+			}
+		}
+		return files, scanner.Err()
+	}
+}
+
+// imageFiles returns the paths of the regular files and symlinks in the
+// compressed image archive read from r, with prefix removed from their names.
+func imageFiles(r io.Reader, prefix string) ([]string, error) {
+	dr, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close()
+
+	var files []string
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+			name := strings.TrimPrefix(strings.TrimPrefix(hdr.Name, "./"), prefix)
+			files = append(files, path.Clean("/"+name))
+		}
+	}
+}
+
+// contentsPath returns the path of the file in a CONTENTS entry, or an empty string
+// if the entry isn't a file or is invalid. Regular files are listed as
+// "obj <path> <md5> <mtime>" and symlinks as "sym <path> -> <target> <mtime>".
+// Paths may contain spaces, so the fields after the path of a regular file are
+// removed from the end.
+func contentsPath(line string) string {
+	if rest, ok := strings.CutPrefix(line, "obj /"); ok {
+		for range 2 {
+			i := strings.LastIndexByte(rest, ' ')
+			if i == -1 {
+				return ""
+			}
+			rest = rest[:i]
+		}
+		return "/" + rest
+	} else if rest, ok := strings.CutPrefix(line, "sym /"); ok {
+		if fpath, _, ok := strings.Cut(rest, " -> "); ok {
+			return "/" + fpath
+		}
+	}
+	return ""
+}
+
+// portageName returns the package name from a Gentoo CPV, such as
+// app-editors/vim-9.1.0-r1, by removing the category, the version,
+// and the revision if there is one.
+func portageName(cpv string) string {
+	if _, pv, ok := strings.Cut(cpv, "/"); ok {
+		cpv = pv
+	}
+
+	// Versions always start with a digit, and package names can't
+	// end with a hyphen followed by one, so they can't be confused.
+	name, rev, ok := cutLast(cpv, "-")
+	if ok && len(rev) > 1 && rev[0] == 'r' && isNumeric(rev[1:]) {
+		cpv = name
+	}
+	if name, ver, ok := cutLast(cpv, "-"); ok && ver != "" && isDigit(ver[0]) {
+		return name
+	}
+	return cpv
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i != -1 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// isNumeric reports whether s only contains ASCII digits
+func isNumeric(s string) bool {
+	for i := range len(s) {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mholt/archives"
+)
+
+// compress compresses the contents of r using c
+func compress(t *testing.T, c archives.Compressor, r io.Reader) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := c.OpenWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// gpkg returns a GPKG binary package with the given metadata and image files,
+// which are alternating names and contents like in tarArchive.
+func gpkg(t *testing.T, name string, metadata, image []string) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	_, err := io.Copy(buf, tarArchive(t,
+		name+"/gpkg-1", "gpkg-1",
+		name+"/metadata.tar.zst", compress(t, archives.Zstd{}, tarArchive(t, metadata...)),
+		name+"/image.tar.xz", compress(t, archives.Xz{}, tarArchive(t, image...)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestPortageReadPkgData(t *testing.T) {
+	const packages = `ARCH: amd64
+VERSION: 0
+
+BUILD_ID: 1
+CPV: app-editors/vim-9.1.0
+PATH: app-editors/vim/vim-9.1.0-1.gpkg.tar
+
+CPV: net-misc/curl-8.9.1-r2
+PATH: net-misc/curl/curl-8.9.1-r2-1.gpkg.tar
+
+CPV: app-editors/nano-8.0
+
+PATH: app-misc/unnamed/unnamed-1.gpkg.tar
+
+CPV: app-misc/broken-1
+PATH: app-misc/broken/broken-1-1.gpkg.tar
+garbage
+
+CPV: app-misc/gone-1
+PATH: app-misc/gone/gone-1-1.gpkg.tar
+`
+
+	// XPAK packages have their metadata appended to the compressed image
+	nano := compress(t, archives.Bz2{}, tarArchive(t, "./usr/bin/nano", "")) + "XPAKPACK\x00\x00\x00\x00\x00\x00\x00\x00XPAKSTOP\x00\x00\x00\x18STOP"
+
+	files := map[string]string{
+		// The image is ignored, since the metadata contains a CONTENTS file
+		"https://binhost.example/amd64/app-editors/vim/vim-9.1.0-1.gpkg.tar": gpkg(t, "vim-9.1.0-1",
+			[]string{"metadata/CATEGORY", "app-editors\n", "metadata/CONTENTS", "dir /usr/bin\nobj /usr/bin/vim 0123456789abcdef 1700000000\nsym /usr/bin/vi -> vim 1700000000\n"},
+			[]string{"image/usr/bin/ignored", ""},
+		),
+		"https://binhost.example/amd64/net-misc/curl/curl-8.9.1-r2-1.gpkg.tar": gpkg(t, "curl-8.9.1-r2-1",
+			[]string{"metadata/CATEGORY", "net-misc\n"},
+			[]string{"image/usr/bin/curl", "", "image/usr/share/man/man1/curl.1.bz2", ""},
+		),
+		"https://binhost.example/amd64/app-editors/nano-8.0.tbz2":  nano,
+		"https://mirror.example/binpkgs/app-editors/nano-8.0.tbz2": nano,
+	}
+
+	fetcher := fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		content, ok := files[req.URL.String()]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(content))}, nil
+	})
+	errFetch := errors.New("connection refused")
+	failing := fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errFetch
+	})
+
+	tests := []struct {
+		name         string
+		importer     Portage
+		packages     string
+		want         map[string][]string
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:     "binhost",
+			importer: Portage{Fetcher: fetcher, PackagesURL: "https://binhost.example/amd64/Packages"},
+			packages: packages,
+			want: map[string][]string{
+				"vim":  {"bin=vim", "bin=vi"},
+				"curl": {"bin=curl", "man=curl.1"},
+				"nano": {"bin=nano"},
+			},
+			wantWarnings: []string{
+				"line 13: missing CPV field",
+				`line 17: missing field separator (near "garbage")`,
+				"line 19: app-misc/gone/gone-1-1.gpkg.tar: http: 404 Not Found",
+			},
+		},
+		{
+			name:     "uri",
+			importer: Portage{Fetcher: fetcher, PackagesURL: "https://binhost.example/amd64/Packages"},
+			packages: "URI: https://mirror.example/binpkgs\n\nCPV: app-editors/nano-8.0\n",
+			want:     map[string][]string{"nano": {"bin=nano"}},
+		},
+		{
+			name:     "unknown index url",
+			importer: Portage{Fetcher: fetcher},
+			packages: packages,
+			wantErr:  "URL of the Packages index is unknown",
+		},
+		{
+			name:     "fetch error",
+			importer: Portage{Fetcher: failing, PackagesURL: "https://binhost.example/amd64/Packages"},
+			packages: packages,
+			wantErr:  errFetch.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, warnings, err := tryReadRecords(tt.importer.ReadPkgData, strings.NewReader(tt.packages))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got := pkgTags(recs)
+			if len(got) != len(tt.want) {
+				t.Errorf("got packages %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if !slices.Equal(got[name], want) {
+					t.Errorf("%s: got tags %q, want %q", name, got[name], want)
+				}
+			}
+
+			gotWarnings := make([]string, len(warnings))
+			for i, w := range warnings {
+				gotWarnings[i] = w.Error()
+			}
+			if !slices.Equal(gotWarnings, tt.wantWarnings) {
+				t.Errorf("got warnings %q, want %q", gotWarnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestPortageName(t *testing.T) {
+	tests := []struct {
+		cpv  string
+		want string
+	}{
+		{"app-editors/vim-9.1.0", "vim"},
+		{"app-editors/vim-9.1.0-r1", "vim"},
+		{"dev-lang/python-3.12.4_p1", "python"},
+		{"media-libs/libsdl2-2.30.3", "libsdl2"},
+		{"x11-libs/gtk+-3.24.41-r1", "gtk+"},
+		{"dev-util/meson-format-array-0", "meson-format-array"},
+		{"app-misc/foo", "foo"},
+		{"vim-9.1.0", "vim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cpv, func(t *testing.T) {
+			if got := portageName(tt.cpv); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VersionComparer is implemented by importers that set [Record.Version],
+// so that older versions of packages can be left out of the index.
+type VersionComparer interface {
+	Importer
+	// CompareVersions returns -1 if version a is older than b, 1 if
+	// it's newer, and 0 if they're equal, using the distro's semantics.
+	CompareVersions(a, b string) int
+}
+
+// splitEVR splits a version in the "[epoch:]version[-release]" format into its parts.
+// The epoch defaults to 0, and the release is empty if the version doesn't have one.
+func splitEVR(evr string) (epoch int, version, release string) {
+	if before, after, ok := strings.Cut(evr, ":"); ok {
+		epoch, _ = strconv.Atoi(before)
+		evr = after
+	}
+	if i := strings.LastIndexByte(evr, '-'); i != -1 {
+		return epoch, evr[:i], evr[i+1:]
+	}
+	return epoch, evr, ""
+}
+
+// compareEVR compares two versions in the "[epoch:]version[-release]" format. The
+// epochs are compared first, then the versions using cmpFn, and then the releases
+// using cmpFn if both versions have one.
+func compareEVR(a, b string, cmpFn func(a, b string) int) int {
+	aEpoch, aVer, aRel := splitEVR(a)
+	bEpoch, bVer, bRel := splitEVR(b)
+	if aEpoch != bEpoch {
+		return sign(aEpoch - bEpoch)
+	}
+	if c := cmpFn(aVer, bVer); c != 0 {
+		return c
+	}
+	if aRel == "" || bRel == "" {
+		return 0
+	}
+	return cmpFn(aRel, bRel)
+}
+
+// CompareRPMVersions compares two RPM versions in the "[epoch:]version[-release]" format.
+// Versions are split into alternating numeric and alphabetic segments, which are compared
+// one by one. Numeric segments are newer than alphabetic ones, a tilde sorts before
+// anything (even the end of the version), and a caret sorts after the end of the version,
+// but before anything else.
+func CompareRPMVersions(a, b string) int {
+	return compareEVR(a, b, rpmvercmp)
+}
+
+// ComparePacmanVersions compares two pacman versions in the "[epoch:]version[-pkgrel]"
+// format. Pacman compares the segments of versions in the same way as RPM.
+func ComparePacmanVersions(a, b string) int {
+	return compareEVR(a, b, rpmvercmp)
+}
+
+// rpmvercmp compares two version strings without epochs
+// or releases using RPM's segment comparison algorithm.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		a = strings.TrimLeftFunc(a, isRPMSeparator)
+		b = strings.TrimLeftFunc(b, isRPMSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			} else if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			} else if b == "" {
+				return 1
+			} else if !strings.HasPrefix(a, "^") {
+				return 1
+			} else if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		var aSeg, bSeg string
+		aSeg, a = cutSegment(a, numeric)
+		bSeg, b = cutSegment(b, numeric)
+
+		// If the segments have different types,
+		// the numeric one is considered newer.
+		if bSeg == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			aSeg = strings.TrimLeft(aSeg, "0")
+			bSeg = strings.TrimLeft(bSeg, "0")
+			// Without leading zeros, longer numbers are always larger
+			if len(aSeg) != len(bSeg) {
+				return sign(len(aSeg) - len(bSeg))
+			}
+		}
+
+		if c := strings.Compare(aSeg, bSeg); c != 0 {
+			return c
+		}
+	}
+
+	// Whichever version has segments left is newer
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// cutSegment cuts the leading numeric or alphabetic segment from s
+func cutSegment(s string, numeric bool) (segment, rest string) {
+	i := 0
+	for i < len(s) && (numeric && isDigit(s[i]) || !numeric && isAlpha(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// isRPMSeparator reports whether r separates the segments of an RPM version
+func isRPMSeparator(r rune) bool {
+	isAlnum := r < 0x80 && (isDigit(byte(r)) || isAlpha(byte(r)))
+	return !isAlnum && r != '~' && r != '^'
+}
+
+// CompareDebianVersions compares two Debian versions in the
+// "[epoch:]upstream_version[-debian_revision]" format using dpkg's algorithm.
+// Non-digit parts are compared character by character, with letters sorting
+// before other characters and a tilde sorting before anything, even the end
+// of the version. Digit parts are compared numerically.
+func CompareDebianVersions(a, b string) int {
+	aEpoch, aVer, aRev := splitEVR(a)
+	bEpoch, bVer, bRev := splitEVR(b)
+	if aEpoch != bEpoch {
+		return sign(aEpoch - bEpoch)
+	}
+	if c := dpkgVerCmp(aVer, bVer); c != 0 {
+		return c
+	}
+	// A missing revision is equivalent to a revision of "0"
+	return dpkgVerCmp(aRev, bRev)
+}
+
+// dpkgVerCmp compares two version strings without epochs
+// or revisions using dpkg's comparison algorithm.
+func dpkgVerCmp(a, b string) int {
+	for len(a) > 0 || len(b) > 0 {
+		for (len(a) > 0 && !isDigit(a[0])) || (len(b) > 0 && !isDigit(b[0])) {
+			aOrder, bOrder := dpkgOrder(a), dpkgOrder(b)
+			if aOrder != bOrder {
+				return sign(aOrder - bOrder)
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		a = strings.TrimLeft(a, "0")
+		b = strings.TrimLeft(b, "0")
+
+		firstDiff := 0
+		for len(a) > 0 && isDigit(a[0]) && len(b) > 0 && isDigit(b[0]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[0]) - int(b[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		if len(a) > 0 && isDigit(a[0]) {
+			return 1
+		} else if len(b) > 0 && isDigit(b[0]) {
+			return -1
+		} else if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// dpkgOrder returns the sort weight of the first character of s in a non-digit
+// part of a Debian version. The end of the string sorts after a tilde but
+// before anything else, and letters sort before other characters.
+func dpkgOrder(s string) int {
+	switch {
+	case len(s) == 0 || isDigit(s[0]):
+		return 0
+	case isAlpha(s[0]):
+		return int(s[0])
+	case s[0] == '~':
+		return -1
+	default:
+		return int(s[0]) + 256
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
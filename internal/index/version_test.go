@@ -0,0 +1,98 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import "testing"
+
+type versionTest struct {
+	a, b string
+	want int
+}
+
+// testCompareVersions checks cmpFn against tests in both directions
+func testCompareVersions(t *testing.T, cmpFn func(a, b string) int, tests []versionTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := cmpFn(tt.a, tt.b); got != tt.want {
+				t.Errorf("compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := cmpFn(tt.b, tt.a); got != -tt.want {
+				t.Errorf("compare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDebianVersions(t *testing.T) {
+	testCompareVersions(t, CompareDebianVersions, []versionTest{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.10", "1.9", 1},
+		{"1.01", "1.1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0+", -1},
+		{"1.0+dfsg-1", "1.0-1", 1},
+		{"1:0.9", "1.0", 1},
+		{"2:1.0", "10:0.1", -1},
+		{"9.4.0-1ubuntu1", "9.4.0-1", 1},
+		{"2.36-9+deb12u4", "2.36-9+deb12u10", -1},
+	})
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	testCompareVersions(t, CompareRPMVersions, []versionTest{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1.fc40", "1.0-1.fc41", -1},
+		{"1.0", "1.0-5", 0},
+		{"1.10", "1.9", 1},
+		{"1.01", "1.1", 0},
+		{"1.0", "1.0.1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0.1", -1},
+		{"1a", "1b", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0~rc1", 1},
+		{"1.0_1", "1.0.1", 0},
+		{"1:1.0", "2.0", 1},
+		{"0:2.0", "2.0", 0},
+	})
+}
+
+func TestComparePacmanVersions(t *testing.T) {
+	testCompareVersions(t, ComparePacmanVersions, []versionTest{
+		{"1.0-1", "1.0-1", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1", "1.0.1-1", -1},
+		{"1.0.r12.gabcdef-1", "1.0-1", 1},
+		{"1:1.0-1", "2.0-1", 1},
+		{"6.11.2.arch1-1", "6.11.10.arch1-1", -1},
+	})
+}
@@ -0,0 +1,235 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"archive/tar"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+type XBPS struct{}
+
+func (XBPS) Name() string {
+	return "xbps"
+}
+
+// IndexURL returns the URL of the repodata file for arch. Void repos
+// aren't versioned, so version and repo aren't used.
+func (XBPS) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	indexURL, err := url.JoinPath(baseURL, arch+"-repodata")
+	if err != nil {
+		return nil, err
+	}
+	return []string{indexURL}, nil
+}
+
+func (XBPS) ReadPkgData(r io.Reader, out chan Record) {
+	dr, err := Decompress(r)
+	if err != nil {
+		out <- Record{Error: err}
+		return
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			out <- Record{Error: &ParseError{Err: errors.New("missing index.plist file")}}
+			return
+		} else if err != nil {
+			out <- Record{Error: &ParseError{Err: err}}
+			return
+		}
+
+		if path.Clean(hdr.Name) == "index.plist" {
+			if err := readXBPSIndex(tr, out); err != nil {
+				out <- Record{Error: &ParseError{Entry: hdr.Name, Err: err}}
+				return
+			}
+			close(out)
+			return
+		}
+	}
+}
+
+// readXBPSIndex reads an index.plist file, which contains a dictionary mapping
+// package names to dictionaries of their metadata, and sends a record for each
+// package on out. The packages are decoded one at a time, since the index can
+// be large.
+func readXBPSIndex(r io.Reader, out chan Record) error {
+	dec := xml.NewDecoder(r)
+
+	// Find the top-level dictionary
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "dict" {
+			break
+		}
+	}
+
+	for {
+		key, done, err := plistKey(dec)
+		if err != nil {
+			return err
+		} else if done {
+			return nil
+		}
+
+		val, err := plistValue(dec)
+		if err != nil {
+			return fmt.Errorf("package %s: %w", key, err)
+		}
+		pkg, ok := val.(map[string]any)
+		if !ok {
+			out <- Record{Warning: &ParseError{Entry: "index.plist", Err: fmt.Errorf("package %s: metadata isn't a dictionary", key)}}
+			continue
+		}
+
+		name, _ := pkg["pkgname"].(string)
+		if name == "" {
+			name = key
+		}
+
+		var pkgTags []string
+		for _, file := range plistStrings(pkg["files"], "file") {
+			pkgTags = append(pkgTags, tags.Generate(path.Join("/", file))...)
+		}
+		// Repodata doesn't usually contain file lists, but it does list
+		// the shared libraries each package provides, which are enough to
+		// generate their library tags.
+		for _, lib := range plistStrings(pkg["shlib-provides"], "") {
+			pkgTags = append(pkgTags, tags.Generate(path.Join("/usr/lib", lib))...)
+		}
+
+		if len(pkgTags) != 0 {
+			out <- Record{Name: name, Tags: pkgTags}
+		}
+	}
+}
+
+// plistKey reads the next key in a plist dictionary. It returns
+// true if the end of the dictionary was reached instead.
+func plistKey(dec *xml.Decoder) (string, bool, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local != "key" {
+				return "", false, fmt.Errorf("expected a dictionary key, got <%s>", tok.Name.Local)
+			}
+			var key string
+			err := dec.DecodeElement(&key, &tok)
+			return key, false, err
+		case xml.EndElement:
+			return "", true, nil
+		}
+	}
+}
+
+// errPlistEnd is returned by [plistValue] if the element
+// containing the value ends before the value starts
+var errPlistEnd = errors.New("unexpected end of element")
+
+// plistValue reads the next value in a plist. Dictionaries are returned as
+// map[string]any, arrays as []any, and all other values as their text.
+func plistValue(dec *xml.Decoder) (any, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			if _, ok := tok.(xml.EndElement); ok {
+				return nil, errPlistEnd
+			}
+			continue
+		}
+
+		switch start.Name.Local {
+		case "dict":
+			out := map[string]any{}
+			for {
+				key, done, err := plistKey(dec)
+				if err != nil {
+					return nil, err
+				} else if done {
+					return out, nil
+				}
+
+				out[key], err = plistValue(dec)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "array":
+			var out []any
+			for {
+				val, err := plistValue(dec)
+				if errors.Is(err, errPlistEnd) {
+					return out, nil
+				} else if err != nil {
+					return nil, err
+				}
+				out = append(out, val)
+			}
+		default:
+			var text string
+			err := dec.DecodeElement(&text, &start)
+			return strings.TrimSpace(text), err
+		}
+	}
+}
+
+// plistStrings returns the strings in a plist array. If the array contains
+// dictionaries, the value of the given key in each of them is used instead.
+func plistStrings(val any, key string) []string {
+	arr, _ := val.([]any)
+	out := make([]string, 0, len(arr))
+	for _, item := range arr {
+		if dict, ok := item.(map[string]any); ok {
+			item = dict[key]
+		}
+		if str, ok := item.(string); ok && str != "" {
+			out = append(out, str)
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package index
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// xbpsIndex is an excerpt from the index.plist of Void's x86_64 repodata
+const xbpsIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>ncurses-libs</key>
+	<dict>
+		<key>architecture</key>
+		<string>x86_64</string>
+		<key>pkgver</key>
+		<string>ncurses-libs-6.5_1</string>
+		<key>run_depends</key>
+		<array>
+			<string>glibc>=2.39_1</string>
+		</array>
+		<key>shlib-provides</key>
+		<array>
+			<string>libncursesw.so.6</string>
+		</array>
+	</dict>
+	<key>vim</key>
+	<dict>
+		<key>pkgname</key>
+		<string>vim</string>
+		<key>files</key>
+		<array>
+			<dict>
+				<key>file</key>
+				<string>/usr/bin/vim</string>
+				<key>sha256</key>
+				<string>0000</string>
+			</dict>
+		</array>
+		<key>installed_size</key>
+		<integer>4194304</integer>
+	</dict>
+	<key>void-docs</key>
+	<dict>
+		<key>pkgver</key>
+		<string>void-docs-2024.10.08_1</string>
+	</dict>
+</dict>
+</plist>
+`
+
+func TestXBPSReadPkgData(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    map[string][]string
+		wantErr string
+	}{
+		{
+			name:  "repodata",
+			files: []string{"index-meta.plist", "<plist/>", "index.plist", xbpsIndex},
+			want: map[string][]string{
+				"ncurses-libs": {"lib=libncursesw.so.6", "lib=libncursesw.so", "lib=ncursesw"},
+				"vim":          {"bin=vim"},
+			},
+		},
+		{
+			name:    "missing index",
+			files:   []string{"index-meta.plist", "<plist/>"},
+			wantErr: "missing index.plist file",
+		},
+		{
+			name:    "invalid XML",
+			files:   []string{"index.plist", "<plist><dict><key>vim</key><dict></plist>"},
+			wantErr: "index.plist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, _, err := tryReadRecords(XBPS{}.ReadPkgData, tarArchive(t, tt.files...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got := pkgTags(recs)
+			if len(got) != len(tt.want) {
+				t.Errorf("got packages %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if !slices.Equal(got[name], want) {
+					t.Errorf("%s: got tags %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
@@ -23,47 +23,74 @@
 package index
 
 import (
-	"encoding/xml"
+	"cmp"
 	"errors"
 	"io"
-	"net/http"
-	"net/url"
 )
 
- type Zypper struct{}
- 
- func (Zypper) Name() string {
+// zypperPathTemplate is the default path of Zypper repos, which is the layout used by openSUSE
+const zypperPathTemplate = "{version}/repo/{repo}"
+
+type Zypper struct {
+	// PathTemplate is the path of the directory containing the repodata
+	// directory, relative to the base URL. If it's empty, zypperPathTemplate
+	// is used. See [ExpandPathTemplate] for the supported placeholders.
+	PathTemplate string
+	// Fetcher is used to download the repomd.xml file.
+	// If it's nil, [http.DefaultClient] is used.
+	Fetcher Fetcher
+}
+
+func (Zypper) Name() string {
 	return "zypper"
- }
- 
- func (Zypper) IndexURL(baseURL, version, repo, _ string) ([]string, error) {
-	u, err := url.ParseRequestURI(baseURL)
-	if err != nil {
-		return nil, err
-	}
-	
-	repomdURL := u.JoinPath(version, "repo", repo, "repodata/repomd.xml")
-	res, err := http.Get(repomdURL.String())
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
- 
-	var data repomd
-	err = xml.NewDecoder(res.Body).Decode(&data)
+}
+
+// WithPathTemplate returns a copy of the importer that uses tmpl as its path template
+func (z Zypper) WithPathTemplate(tmpl string) Importer {
+	z.PathTemplate = tmpl
+	return z
+}
+
+// WithFetcher returns a copy of the importer that downloads repomd.xml using f
+func (z Zypper) WithFetcher(f Fetcher) Importer {
+	z.Fetcher = f
+	return z
+}
+
+func (z Zypper) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	repoPath := ExpandPathTemplate(cmp.Or(z.PathTemplate, zypperPathTemplate), version, repo, arch)
+	repoURL, data, err := readRepomd(z.Fetcher, baseURL, repoPath)
 	if err != nil {
 		return nil, err
 	}
- 
+
 	gzipFile := data.getFilelists()
 	if gzipFile == "" {
 		return nil, errors.New("no filelists found in repomd.xml")
 	}
- 
-	filelistURL := u.JoinPath(version, "repo", repo, gzipFile)
+
+	filelistURL := repoURL.JoinPath(gzipFile)
 	return []string{filelistURL.String()}, nil
- }
- 
- func (Zypper) ReadPkgData(r io.Reader, out chan Record) {
- 	DNF{}.ReadPkgData(r, out)
- }
\ No newline at end of file
+}
+
+// ManifestURL returns the URL of the repo's repomd.xml file
+func (z Zypper) ManifestURL(baseURL, version, repo, arch string) ([]string, error) {
+	return repomdURL(baseURL, ExpandPathTemplate(cmp.Or(z.PathTemplate, zypperPathTemplate), version, repo, arch))
+}
+
+func (Zypper) ReadPkgData(r io.Reader, out chan Record) {
+	DNF{}.ReadPkgData(r, out)
+}
+
+// DescriptionURL returns the URL of the repo's primary metadata index
+func (z Zypper) DescriptionURL(baseURL, version, repo, arch string) ([]string, error) {
+	return primaryURL(z.Fetcher, baseURL, ExpandPathTemplate(cmp.Or(z.PathTemplate, zypperPathTemplate), version, repo, arch))
+}
+
+func (Zypper) ReadDescriptions(r io.Reader, out chan Record) {
+	readPrimary(r, out)
+}
+
+func (Zypper) CompareVersions(a, b string) int {
+	return CompareRPMVersions(a, b)
+}
@@ -0,0 +1,211 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pull
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// errNoDiffs is returned by pullDiffs when the remote repo
+// doesn't have diffs for the locally cached version of the index.
+var errNoDiffs = errors.New("no diffs available for the cached index")
+
+// indexCachePath returns the path to the decompressed copy of
+// the index that's kept next to s for use with diffs.
+func indexCachePath(s *store.Store) string {
+	return filepath.Join(filepath.Dir(s.Path), "index")
+}
+
+// indexCache manages a new version of the index cache until
+// the store it belongs to has been replaced.
+type indexCache struct {
+	path string
+}
+
+// write copies r into a new temporary cache file next to s, and returns
+// the hex-encoded SHA256 hash of its contents. The previous temporary
+// file is removed once the new one has been written, since r may be
+// reading from it.
+func (ic *indexCache) write(s *store.Store, r io.Reader) (string, error) {
+	fl, err := os.CreateTemp(filepath.Dir(s.Path), "index.*")
+	if err != nil {
+		return "", err
+	}
+	defer fl.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(fl, h), r)
+	if err != nil {
+		os.Remove(fl.Name())
+		return "", err
+	}
+
+	ic.remove()
+	ic.path = fl.Name()
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// commit replaces the index cache of s with the new version
+func (ic *indexCache) commit(s *store.Store) error {
+	if ic.path == "" {
+		return nil
+	}
+	err := os.Rename(ic.path, indexCachePath(s))
+	ic.path = ""
+	return err
+}
+
+// remove deletes the new version of the index cache if it hasn't been committed
+func (ic *indexCache) remove() {
+	if ic.path != "" {
+		os.Remove(ic.path)
+		ic.path = ""
+	}
+}
+
+// pullDiffs updates s by applying the diffs listed in the remote diff index to the
+// cached copy of the previous version of the index, and then importing the result.
+// If the remote repo doesn't have diffs for the cached version, it returns errNoDiffs.
+func pullDiffs(ctx context.Context, opts Options, s *store.Store, di index.DiffImporter, prevMeta store.RepoMeta, repoKey string) error {
+	diffIndexURLs, err := di.DiffIndexURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
+	if err != nil {
+		return err
+	}
+
+	res, err := opts.fetch(ctx, diffIndexURLs)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	diffIndex, err := di.ReadDiffIndex(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if diffIndex.Current == prevMeta.IndexSHA256 {
+		return ErrUpToDate
+	}
+
+	diffs, ok := diffIndex.Diffs[prevMeta.IndexSHA256]
+	if !ok {
+		return errNoDiffs
+	}
+
+	cache := &indexCache{}
+	defer cache.remove()
+
+	curPath := indexCachePath(s)
+	for i, diff := range diffs {
+		diffURL, err := res.Request.URL.Parse(diff.Path)
+		if err != nil {
+			return err
+		}
+
+		hash, err := applyDiff(ctx, opts, s, di, cache, curPath, diffURL, fmt.Sprintf("%s (diff %d/%d)", repoKey, i+1, len(diffs)))
+		if err != nil {
+			return err
+		}
+		curPath = cache.path
+
+		// Check the result of every diff, so that a bad diff is caught
+		// right away instead of being used as the base for the next one.
+		if hash != diff.Result {
+			return fmt.Errorf("index patched with %s has hash %s, expected %s", diff.Path, hash, diff.Result)
+		}
+	}
+
+	if len(diffs) == 0 || diffs[len(diffs)-1].Result != diffIndex.Current {
+		return errors.New("diffs don't result in the current index")
+	}
+
+	patched, err := os.Open(cache.path)
+	if err != nil {
+		return err
+	}
+	defer patched.Close()
+
+	// The importer expects a compressed index, so compress the patched
+	// index on the fly. This is fast enough not to matter compared
+	// to the import itself.
+	pr, pw := io.Pipe()
+	go func() {
+		gw, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+		_, err := io.Copy(gw, patched)
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	// Carry the HTTP caching headers from the last full download forward,
+	// rather than dropping them. The full index has changed since then, so
+	// they can't make a later pull wrongly skip it as up to date.
+	meta := store.RepoMeta{
+		ETag:         prevMeta.ETag,
+		LastModified: prevMeta.LastModified,
+		IndexSHA256:  diffIndex.Current,
+	}
+	if err := importIndex(ctx, opts, s, di, pr, meta, prevMeta.CharTagCounts, nil); err != nil {
+		return err
+	}
+	return cache.commit(s)
+}
+
+// applyDiff downloads the diff at diffURL and applies it to the index at oldPath,
+// writing the result into a new version of cache. It returns the hex-encoded
+// SHA256 hash of the result.
+func applyDiff(ctx context.Context, opts Options, s *store.Store, di index.DiffImporter, cache *indexCache, oldPath string, diffURL *url.URL, title string) (string, error) {
+	old, err := os.Open(oldPath)
+	if err != nil {
+		return "", err
+	}
+	defer old.Close()
+
+	res, err := opts.fetch(ctx, []string{diffURL.String()})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(di.ApplyDiff(pw, old, opts.bodyReader(res, title)))
+	}()
+	defer pr.Close()
+
+	return cache.write(s, pr)
+}
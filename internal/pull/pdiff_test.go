@@ -0,0 +1,162 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package pull
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func gzipString(t *testing.T, s string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPullDiffs(t *testing.T) {
+	const (
+		v1 = "usr/bin/vim editors/vim\n"
+		v2 = "usr/bin/nano editors/nano\nusr/bin/vim editors/vim\n"
+		v3 = "usr/bin/nano editors/nano\nusr/bin/vim editors/vim\nusr/bin/emacs editors/emacs\n"
+		// Each diff turns the previous version into the next one
+		diff1 = "0a\nusr/bin/nano editors/nano\n.\n"
+		diff2 = "2a\nusr/bin/emacs editors/emacs\n.\n"
+	)
+
+	tests := []struct {
+		name      string
+		historyV2 string
+		wantErr   string
+		wantPkgs  []string
+	}{
+		{
+			name:      "ok",
+			historyV2: sha256Hex(v2),
+			wantPkgs:  []string{"vim", "nano", "emacs"},
+		},
+		{
+			// The first diff's result doesn't match the
+			// hash that the diff index says it should have.
+			name:      "bad intermediate hash",
+			historyV2: sha256Hex("something else"),
+			wantErr:   "has hash " + sha256Hex(v2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffIndex := fmt.Sprintf("SHA256-Current: %s 3\nSHA256-History:\n %s 1 d1\n %s 2 d2\n", sha256Hex(v3), sha256Hex(v1), tt.historyV2)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/dists/stable/main/Contents-amd64.diff/Index", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(diffIndex))
+			})
+			mux.HandleFunc("/dists/stable/main/Contents-amd64.diff/d1.gz", func(w http.ResponseWriter, r *http.Request) {
+				w.Write(gzipString(t, diff1))
+			})
+			mux.HandleFunc("/dists/stable/main/Contents-amd64.diff/d2.gz", func(w http.ResponseWriter, r *http.Request) {
+				w.Write(gzipString(t, diff2))
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			s, err := store.Open(filepath.Join(t.TempDir(), "db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+
+			if err := os.WriteFile(indexCachePath(s), []byte(v1), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			prevMeta := store.RepoMeta{
+				ETag:         `"v1"`,
+				LastModified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				IndexSHA256:  sha256Hex(v1),
+			}
+
+			opts := Options{BaseURL: srv.URL, Version: "stable", Repo: "main", Architecture: "amd64"}
+			err = pullDiffs(context.Background(), opts, s, index.APT{}, prevMeta, "stable/main/amd64")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if empty, err := s.Empty(); err != nil || !empty {
+					t.Errorf("store was modified by a failed pull (empty=%t, err=%v)", empty, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range tt.wantPkgs {
+				if _, err := s.GetPkg(name); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+
+			meta, err := s.GetMeta()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.IndexSHA256 != sha256Hex(v3) {
+				t.Errorf("got index hash %s, want %s", meta.IndexSHA256, sha256Hex(v3))
+			}
+			if meta.ETag != prevMeta.ETag || !meta.LastModified.Equal(prevMeta.LastModified) {
+				t.Errorf("caching headers weren't carried forward: got %q, %s", meta.ETag, meta.LastModified)
+			}
+
+			cached, err := os.ReadFile(indexCachePath(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(cached) != v3 {
+				t.Errorf("got cached index %q, want %q", cached, v3)
+			}
+		})
+	}
+}
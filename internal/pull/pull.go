@@ -23,10 +23,16 @@
 package pull
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,6 +45,10 @@ import (
 
 const batchSize = 5000
 
+// maxChanges is the maximum amount of changes kept
+// in the change history of an index.
+const maxChanges = 1000
+
 // ErrUpToDate is returned when a repository index is already
 // up to date and doesn't require a pull.
 var ErrUpToDate = errors.New("repository is already up to date")
@@ -50,6 +60,54 @@ type Options struct {
 	Repo         string
 	Architecture string
 	ProgressFunc func(title string, received, total int64)
+	// TwoPass enables two-pass imports, which count the tags in the index
+	// before importing it so that the bloom filters can be sized correctly.
+	// This makes searches more efficient at the cost of a slower import.
+	TwoPass bool
+	// RateLimit limits the download speed to the given amount of
+	// bytes per second. If it's zero, downloads aren't limited.
+	RateLimit int64
+	// TempDir is the directory where the new index is built before it replaces
+	// the old one. If it's empty, the directory containing the store is used,
+	// which allows the replacement to be atomic. If TempDir is on a different
+	// filesystem, the new index has to be copied instead.
+	TempDir string
+	// Token is an access token that replaces the $token variable in BaseURL,
+	// for private mirrors that require one in their URLs. It's redacted from
+	// any errors returned or logged by the pull.
+	Token string
+	// PDiffs enables incremental updates using diffs for importers that
+	// support them. This requires keeping a decompressed copy of the index
+	// next to the store.
+	PDiffs bool
+	// LatestOnly makes importers that implement [index.VersionComparer] only
+	// import the newest version of each package if the index lists more than
+	// one. This requires keeping the tags of every package with a version in
+	// memory until the whole index has been read.
+	LatestOnly bool
+	// Keyring is the path to an OpenPGP keyring that's used to verify the
+	// signatures of indices for importers that implement [index.SignedImporter].
+	// If it's set, the index is only imported if its signature is valid.
+	Keyring string
+	// Descriptions makes the pull import package descriptions, which are
+	// shown on package pages. For importers that implement [index.DescriptionImporter],
+	// this requires downloading an additional index. Otherwise, descriptions are
+	// only imported if the importer reads them from an index it already uses.
+	Descriptions bool
+	// TrackChanges makes the pull compare the new index with the previous one,
+	// and add the packages that were added, removed, or updated to the index's
+	// change history, which is limited to the newest 1000 changes.
+	TrackChanges bool
+	// Force makes the pull download and import the full index even if
+	// the store is already up to date or could be updated using diffs.
+	Force bool
+	// Logger is used to log problems that don't cause the pull to fail.
+	// If it's nil, [slog.Default] is used.
+	Logger *slog.Logger
+	// Fetcher is used to download indices, and is given to importers that
+	// implement [index.FetchingImporter]. If it's nil, [http.DefaultClient]
+	// is used.
+	Fetcher index.Fetcher
 }
 
 // progressReader keeps track of download progress and calls
@@ -72,91 +130,823 @@ func (pr *progressReader) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// throttledReader limits the rate at which data
+// can be read from r to rate bytes per second.
+type throttledReader struct {
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func (tr *throttledReader) Read(b []byte) (int, error) {
+	if tr.start.IsZero() {
+		tr.start = time.Now()
+	}
+
+	// Limit reads to one second's worth of data,
+	// so that the download doesn't happen in bursts.
+	if int64(len(b)) > tr.rate {
+		b = b[:tr.rate]
+	}
+
+	n, err := tr.r.Read(b)
+	tr.read += int64(n)
+
+	// Sleep until the amount of data we've read
+	// is within the rate limit.
+	expected := time.Duration(float64(tr.read) / float64(tr.rate) * float64(time.Second))
+	if d := expected - time.Since(tr.start); d > 0 {
+		time.Sleep(d)
+	}
+
+	return n, err
+}
+
 // Pull synchronizes a repository index from a remote repository and atomically updates the store.
 // If the index is already up to date, it returns [ErrUpToDate]. If opts.ProgressFunc is set,
 // Pull will call it continuously with the current progress of the pull operation. The original store
-// remains usable and unmodified until the pull operation completes successfully. It will only be
-// blocked for the duration of the atomic replacement operation.
-func Pull(opts Options, s *store.Store, importer index.Importer) error {
+// remains usable and unmodified until the pull operation completes successfully, including during
+// the atomic replacement operation at the end. If ctx is canceled before that, the pull is aborted
+// and the original store is left as it was.
+func Pull(ctx context.Context, opts Options, s *store.Store, importer index.Importer) error {
+	opts.BaseURL = opts.expandBaseURL()
+	return opts.redact(pull(ctx, opts, s, opts.importer(importer)))
+}
+
+func pull(ctx context.Context, opts Options, s *store.Store, importer index.Importer) error {
+	repoKey := strings.Trim(opts.Version+"/"+opts.Repo+"/"+opts.Architecture, "/")
+
+	prevMeta, prevMetaErr := s.GetMeta()
+	// Forced pulls ignore the previous metadata, so that
+	// the full index is always downloaded and imported.
+	hasPrevMeta := prevMetaErr == nil && !opts.Force
+
+	di, ok := importer.(index.DiffImporter)
+	usePDiffs := ok && opts.PDiffs
+	if usePDiffs && hasPrevMeta && prevMeta.IndexSHA256 != "" {
+		// Try to update the index using diffs first, since
+		// they're much smaller than the full index.
+		err := pullDiffs(ctx, opts, s, di, prevMeta, repoKey)
+		if err == nil || errors.Is(err, ErrUpToDate) || ctx.Err() != nil {
+			return err
+		}
+		opts.logger().Info("Couldn't update index using diffs; downloading the full index", slog.String("index", repoKey), slog.Any("reason", opts.redact(err)))
+	}
+
 	indexURLs, err := importer.IndexURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
 	if err != nil {
 		return err
 	}
 
-	var (
-		res  *http.Response
-		errs []error
-	)
-	for _, indexURL := range indexURLs {
-		ires, err := http.Get(indexURL)
+	if hasPrevMeta {
+		// Check whether the index has changed using a HEAD request first,
+		// so that we don't start downloading the index if it hasn't.
+		if header, ok := opts.head(ctx, indexURLs); ok && upToDate(header, prevMeta) {
+			return ErrUpToDate
+		}
+	}
+
+	res, err := opts.fetch(ctx, indexURLs)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Some servers don't support HEAD requests, or return different
+	// headers for them, so check the GET response as well.
+	if hasPrevMeta && upToDate(res.Header, prevMeta) {
+		return ErrUpToDate
+	}
+
+	meta := store.RepoMeta{ETag: res.Header.Get("ETag")}
+	if lastMod := res.Header.Get("Last-Modified"); lastMod != "" {
+		// If the date is malformed, we just skip it rather than failing the
+		// whole pull. The next pull will rely on the ETag instead, or just
+		// download the index again.
+		meta.LastModified, err = parseHTTPTime(lastMod)
 		if err != nil {
-			continue
+			opts.logger().Warn("Ignoring malformed Last-Modified header", slog.String("index", repoKey), slog.Any("error", err))
 		}
+	}
 
-		if ires.StatusCode != 200 {
-			errs = append(errs, fmt.Errorf("http: %s", ires.Status))
-			continue
-		} else {
-			res = ires
-			break
+	if li, ok := importer.(index.LocatedImporter); ok {
+		// The importer downloads files relative to the index while reading it,
+		// so those requests need the index's URL and should be canceled along
+		// with the pull.
+		importer = index.WithFetcher(li.WithIndexURL(res.Request.URL.String()), contextFetcher{ctx, opts.fetcher()})
+	}
+
+	var r io.Reader = opts.bodyReader(res, repoKey)
+	if si, ok := importer.(index.SignedImporter); ok && opts.Keyring != "" {
+		// Verify the whole index before importing any of it, so that
+		// the existing index is left as it was if the signature is invalid.
+		verified, err := verifyIndex(ctx, opts, s, si, res.Request.URL.String(), r)
+		if err != nil {
+			return err
 		}
+		defer os.Remove(verified.Name())
+		defer verified.Close()
+		r = verified
+	}
+
+	if !usePDiffs {
+		return importIndex(ctx, opts, s, importer, r, meta, prevMeta.CharTagCounts, nil)
+	}
+
+	// Keep a copy of the compressed index, so that we can decompress it
+	// into the index cache after it's imported, for use with future diffs.
+	raw, err := os.CreateTemp(opts.tempDir(s), "distrohop-index.*")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(raw.Name())
+	defer raw.Close()
+
+	cache := &indexCache{}
+	defer cache.remove()
 
-	if res == nil {
-		return errors.Join(errs...)
-	} else {
-		defer res.Body.Close()
+	err = importIndex(ctx, opts, s, importer, io.TeeReader(r, raw), meta, prevMeta.CharTagCounts, func(meta *store.RepoMeta) error {
+		if _, err := raw.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		dr, err := index.Decompress(raw)
+		if err != nil {
+			return err
+		}
+		defer dr.Close()
+		meta.IndexSHA256, err = cache.write(s, dr)
+		return err
+	})
+	if err != nil {
+		return err
 	}
+	return cache.commit(s)
+}
 
+// importIndex imports the index read from r into a new store, and then uses it
+// to replace s. The bloom filters are sized based on charTags. If beforeCommit
+// is set, it's called right before meta is written to the new store, which is
+// the last step before the replacement.
+func importIndex(ctx context.Context, opts Options, s *store.Store, importer index.Importer, r io.Reader, meta store.RepoMeta, charTags map[byte]int, beforeCommit func(meta *store.RepoMeta) error) error {
 	repoKey := strings.Trim(opts.Version+"/"+opts.Repo+"/"+opts.Architecture, "/")
 
-	if meta, err := s.GetMeta(); err == nil {
-		// If the ETag stored in the database is the same as the one we got from the
-		// HTTP response, the repo is up to date.
-		if etag := res.Header.Get("ETag"); etag != "" && etag == meta.ETag {
-			return ErrUpToDate
+	tempDir := opts.tempDir(s)
+	dir, err := os.MkdirTemp(tempDir, "distrohop-pull.*")
+	if err != nil {
+		return fmt.Errorf("can't create a temporary store in %s; make sure the directory is writable or configure a different temporary directory: %w", tempDir, err)
+	}
+
+	s2, err := store.Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	// If the pull fails or is canceled before the new store
+	// replaces the old one, clean up the new store.
+	closeS2 := true
+	defer func() {
+		if closeS2 {
+			s2.Close()
 		}
+		os.RemoveAll(dir)
+	}()
 
-		if lastModStr := res.Header.Get("Last-Modified"); lastModStr != "" && !meta.LastModified.IsZero() {
-			lastMod, err := time.Parse(time.RFC1123, lastModStr)
-			// If the last modified time from the HTTP response is before
-			// or equal to the time in the database, the repo is up to date.
-			if err == nil && meta.LastModified.Compare(lastMod) >= 0 {
-				return ErrUpToDate
-			}
+	// Size the bloom filters based on the amount of tags in the previous
+	// version of the index, since it's likely to be similar.
+	filters := store.NewFilters(charTags)
+
+	if opts.TwoPass {
+		// Save the index to a temporary file so that we can read it twice
+		tmp, err := os.CreateTemp(tempDir, "distrohop-index.*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		charTags, err := countTags(tmp, importer)
+		if err != nil {
+			return err
+		}
+		filters = store.NewFilters(charTags)
+
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
 		}
+		r = tmp
 	}
 
-	dir, err := os.MkdirTemp(filepath.Dir(s.Path), "distrohop-pull.*")
+	err = writeRecords(ctx, opts.logger(), s2, filters, opts.Architecture, opts.descriptions(opts.latestOnly(importer, func(out chan index.Record) {
+		importer.ReadPkgData(r, out)
+	})))
 	if err != nil {
 		return err
 	}
 
-	s2, err := store.Open(dir)
+	if mi, ok := importer.(index.MetadataImporter); ok {
+		err = pullMetadata(ctx, opts, s2, filters, mi, repoKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if di, ok := importer.(index.DescriptionImporter); ok && opts.Descriptions {
+		err = pullDescriptions(ctx, opts, s2, filters, di, repoKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s2.WriteFilters(filters)
+	if err != nil {
+		return err
+	}
+
+	meta.Counts, err = s2.Count()
+	if err != nil {
+		return err
+	}
+
+	if opts.TrackChanges {
+		if err := recordChanges(s, s2); err != nil {
+			return err
+		}
+	}
+
+	if beforeCommit != nil {
+		if err := beforeCommit(&meta); err != nil {
+			return err
+		}
+	}
+
+	if err := s2.WriteMeta(meta); err != nil {
+		return err
+	}
+
+	// This is the last chance to abort before
+	// the old store is replaced.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Replace closes s2 itself, and pebble panics
+	// if a database is closed more than once.
+	closeS2 = false
+	return s.Replace(s2)
+}
+
+// recordChanges writes the change history of s to s2, adding the
+// changes between them. If s is empty, every package in s2 would count
+// as added, so there's nothing to record.
+func recordChanges(s, s2 *store.Store) error {
+	if empty, err := s.Empty(); err != nil || empty {
+		return err
+	}
+
+	changes, err := s.Diff(s2)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range changes {
+		changes[i].Time = now
+	}
+
+	history, err := s.GetChanges()
+	if err != nil {
+		return err
+	}
+	// The newest changes come first, so the oldest ones are dropped
+	changes = append(changes, history...)
+	if len(changes) > maxChanges {
+		changes = changes[:maxChanges]
+	}
+	return s2.WriteChanges(changes)
+}
+
+// pullMetadata downloads the metadata index for a [index.MetadataImporter] and writes
+// its records to s. Since metadata isn't available in every repo, it's skipped if none
+// of the metadata index URLs can be downloaded.
+func pullMetadata(ctx context.Context, opts Options, s *store.Store, filters map[byte]*sbloom.Filter, mi index.MetadataImporter, repoKey string) error {
+	metaURLs, err := mi.MetadataURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
+	if err != nil {
+		return err
+	}
+
+	res, err := opts.fetch(ctx, metaURLs)
+	if err != nil {
+		// Unlike other errors, cancellation should still abort the pull
+		return ctx.Err()
+	}
+	defer res.Body.Close()
+
+	r := opts.bodyReader(res, repoKey+" (metadata)")
+	log := opts.logger().With(slog.String("index", repoKey+" (metadata)"))
+	return writeRecords(ctx, log, s, filters, opts.Architecture, opts.descriptions(opts.latestOnly(mi, func(out chan index.Record) {
+		mi.ReadMetadata(r, out)
+	})))
+}
+
+// pullDescriptions downloads the description index for a [index.DescriptionImporter]
+// and writes its records to s. Like metadata, descriptions aren't required, so
+// they're skipped if none of the description index URLs can be downloaded.
+func pullDescriptions(ctx context.Context, opts Options, s *store.Store, filters map[byte]*sbloom.Filter, di index.DescriptionImporter, repoKey string) error {
+	descURLs, err := di.DescriptionURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
 	if err != nil {
 		return err
 	}
 
+	res, err := opts.fetch(ctx, descURLs)
+	if err != nil {
+		return ctx.Err()
+	}
+	defer res.Body.Close()
+
+	r := opts.bodyReader(res, repoKey+" (descriptions)")
+	log := opts.logger().With(slog.String("index", repoKey+" (descriptions)"))
+	return writeRecords(ctx, log, s, filters, opts.Architecture, opts.latestOnly(di, func(out chan index.Record) {
+		di.ReadDescriptions(r, out)
+	}))
+}
+
+// descriptions wraps readFn so that the descriptions of the records it produces
+// are removed if opts.Descriptions isn't set. Otherwise, readFn is returned as-is.
+func (opts Options) descriptions(readFn func(out chan index.Record)) func(out chan index.Record) {
+	if opts.Descriptions {
+		return readFn
+	}
+
+	return func(out chan index.Record) {
+		in := make(chan index.Record)
+		go readFn(in)
+
+		for rec := range in {
+			rec.Description = ""
+			out <- rec
+			if rec.Error != nil {
+				return
+			}
+		}
+		close(out)
+	}
+}
+
+// fetch tries to download each of the given URLs in order using
+// opts.Fetcher, and returns the response from the first successful one.
+func (opts Options) fetch(ctx context.Context, urls []string) (*http.Response, error) {
+	var errs []error
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := opts.fetcher().Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if res.StatusCode != 200 {
+			res.Body.Close()
+			errs = append(errs, fmt.Errorf("http: %s", res.Status))
+			continue
+		}
+
+		// Misconfigured mirrors and CDNs sometimes return an HTML error page
+		// with a 200 status, which would otherwise cause confusing errors
+		// when the importer tries to decompress or parse it.
+		br := bufio.NewReader(res.Body)
+		if start, _ := br.Peek(htmlPeekLen); isHTML(start) {
+			res.Body.Close()
+			errs = append(errs, fmt.Errorf("%s: server returned an HTML page instead of the requested file", u))
+			continue
+		}
+		res.Body = bufferedBody{br, res.Body}
+
+		return res, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no index URLs to try")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// htmlPeekLen is the amount of bytes at the start of a response
+// that are checked to determine whether it's an HTML page.
+const htmlPeekLen = 512
+
+// isHTML checks whether start looks like the start of an HTML document.
+// The Content-Type header isn't used, since some mirrors serve indices
+// with the wrong type.
+func isHTML(start []byte) bool {
+	start = bytes.TrimPrefix(start, []byte("\xEF\xBB\xBF"))
+	start = bytes.TrimLeft(start, " \t\r\n")
+	for _, prefix := range [...]string{"<!doctype html", "<html", "<head", "<body"} {
+		if len(start) >= len(prefix) && strings.EqualFold(string(start[:len(prefix)]), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedBody is a response body that's read through a buffered reader
+type bufferedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// head sends a HEAD request to each of the given URLs in order using opts.Fetcher,
+// and returns the headers from the first successful one. If none of them succeed,
+// for example because the server doesn't support HEAD requests, ok is false.
+func (opts Options) head(ctx context.Context, urls []string) (header http.Header, ok bool) {
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+		if err != nil {
+			return nil, false
+		}
+
+		res, err := opts.fetcher().Do(req)
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			return res.Header, true
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			// The server doesn't support HEAD requests,
+			// so there's no point in trying the other URLs.
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// IndexURLs returns the URLs that the index may be downloaded from, in the order
+// they're tried. If opts.Token is set, it's included in the URLs, but redacted
+// from the returned error.
+func IndexURLs(opts Options, importer index.Importer) ([]string, error) {
+	opts.BaseURL = opts.expandBaseURL()
+	indexURLs, err := opts.importer(importer).IndexURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
+	if err != nil {
+		return nil, opts.redact(err)
+	}
+	return indexURLs, nil
+}
+
+// ManifestURLs returns the URLs of the manifest files that the index URLs of
+// importer are read from, if it's an [index.ManifestImporter]. Otherwise, it
+// returns nil. If opts.Token is set, it's redacted from the returned error.
+func ManifestURLs(opts Options, importer index.Importer) ([]string, error) {
+	mi, ok := opts.importer(importer).(index.ManifestImporter)
+	if !ok {
+		return nil, nil
+	}
+	opts.BaseURL = opts.expandBaseURL()
+	manifestURLs, err := mi.ManifestURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
+	if err != nil {
+		return nil, opts.redact(err)
+	}
+	return manifestURLs, nil
+}
+
+// CheckReachable checks whether any of the index URLs of importer can be downloaded,
+// without downloading the index itself, and returns the first one that can. Servers
+// that don't support HEAD requests are sent a GET request instead, whose body isn't
+// read. If opts.Token is set, it's redacted from the returned URL and error.
+func CheckReachable(ctx context.Context, opts Options, importer index.Importer) (string, error) {
+	opts.BaseURL = opts.expandBaseURL()
+	indexURLs, err := opts.importer(importer).IndexURL(opts.BaseURL, opts.Version, opts.Repo, opts.Architecture)
+	if err != nil {
+		return "", opts.redact(err)
+	}
+
+	var errs []error
+	for _, u := range indexURLs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+		if err != nil {
+			return "", opts.redact(err)
+		}
+
+		res, err := opts.fetcher().Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res.Body.Close()
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			return redactString(u, opts.Token), nil
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			res, err := opts.fetch(ctx, []string{u})
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			res.Body.Close()
+			return redactString(u, opts.Token), nil
+		default:
+			errs = append(errs, fmt.Errorf("%s: http: %s", u, res.Status))
+		}
+	}
+
+	if len(errs) == 0 {
+		return "", errors.New("no index URLs to try")
+	}
+	return "", opts.redact(errors.Join(errs...))
+}
+
+// upToDate checks whether the response headers of an index
+// indicate that it's the same version as the one in meta.
+func upToDate(header http.Header, meta store.RepoMeta) bool {
+	// If the ETag stored in the database is the same as the one we got from the
+	// HTTP response, the repo is up to date.
+	if etag := header.Get("ETag"); etag != "" && etag == meta.ETag {
+		return true
+	}
+
+	if lastModStr := header.Get("Last-Modified"); lastModStr != "" && !meta.LastModified.IsZero() {
+		lastMod, err := parseHTTPTime(lastModStr)
+		// If the last modified time from the HTTP response is before
+		// or equal to the time in the database, the repo is up to date.
+		if err == nil && meta.LastModified.Compare(lastMod) >= 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bodyReader wraps the response body in a [throttledReader] if opts.RateLimit
+// is set, and then in a [progressReader] if opts.ProgressFunc is set.
+func (opts Options) bodyReader(res *http.Response, title string) io.Reader {
 	var r io.Reader = res.Body
-	if opts.ProgressFunc != nil {
-		r = &progressReader{
-			r:          res.Body,
-			title:      repoKey,
-			total:      res.ContentLength,
-			progressFn: opts.ProgressFunc,
+	if opts.RateLimit > 0 {
+		r = &throttledReader{r: r, rate: opts.RateLimit}
+	}
+	if opts.ProgressFunc == nil {
+		return r
+	}
+	return &progressReader{
+		r:          r,
+		title:      title,
+		total:      res.ContentLength,
+		progressFn: opts.ProgressFunc,
+	}
+}
+
+// expandBaseURL returns opts.BaseURL with its $version, $repo, $arch,
+// and $token variables expanded. $token is only expanded if opts.Token
+// is set, so that a missing token causes an obvious error.
+func (opts Options) expandBaseURL() string {
+	vars := map[string]string{
+		"version": opts.Version,
+		"repo":    opts.Repo,
+		"arch":    opts.Architecture,
+	}
+	if opts.Token != "" {
+		vars["token"] = opts.Token
+	}
+	return index.ExpandVars(opts.BaseURL, vars)
+}
+
+// redact hides opts.Token in the message of err, if it's set
+func (opts Options) redact(err error) error {
+	if err == nil || opts.Token == "" {
+		return err
+	}
+	re := redactedError{err: err, secret: opts.Token}
+	if re.Error() == err.Error() {
+		// The error doesn't contain the token,
+		// so there's no need to wrap it.
+		return err
+	}
+	return re
+}
+
+// redactedError hides a secret, such as an access token,
+// in the message of the error it wraps.
+type redactedError struct {
+	err    error
+	secret string
+}
+
+func (re redactedError) Error() string {
+	return redactString(re.err.Error(), re.secret)
+}
+
+// redactString replaces all the occurrences of secret in s with a placeholder
+func redactString(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	// URLs may contain the secret in its escaped form
+	for _, escaped := range []string{secret, url.PathEscape(secret), url.QueryEscape(secret)} {
+		s = strings.ReplaceAll(s, escaped, "[REDACTED]")
+	}
+	return s
+}
+
+func (re redactedError) Unwrap() error {
+	return re.err
+}
+
+// tempDir returns opts.TempDir, or the directory containing s if it's empty
+func (opts Options) tempDir(s *store.Store) string {
+	if opts.TempDir == "" {
+		return filepath.Dir(s.Path)
+	}
+	return opts.TempDir
+}
+
+// fetcher returns opts.Fetcher, or [http.DefaultClient] if it's nil
+func (opts Options) fetcher() index.Fetcher {
+	if opts.Fetcher == nil {
+		return http.DefaultClient
+	}
+	return opts.Fetcher
+}
+
+// contextFetcher sends requests using fetcher with ctx, for importers
+// that download files outside of the methods that accept a context.
+type contextFetcher struct {
+	ctx     context.Context
+	fetcher index.Fetcher
+}
+
+func (cf contextFetcher) Do(req *http.Request) (*http.Response, error) {
+	return cf.fetcher.Do(req.WithContext(cf.ctx))
+}
+
+// importer returns a copy of importer that downloads files using
+// opts.Fetcher, if it's set and the importer downloads any.
+func (opts Options) importer(importer index.Importer) index.Importer {
+	if opts.Fetcher == nil {
+		return importer
+	}
+	return index.WithFetcher(importer, opts.Fetcher)
+}
+
+// logger returns opts.Logger, or [slog.Default] if it's nil
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger == nil {
+		return slog.Default()
+	}
+	return opts.Logger
+}
+
+// httpTimeLayouts contains the time layouts that are accepted in HTTP date headers.
+// HTTP requires RFC1123 dates in GMT, but some servers use other formats.
+var httpTimeLayouts = [...]string{
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC850,
+	time.ANSIC,
+}
+
+// parseHTTPTime parses the value of an HTTP date header, such as Last-Modified,
+// trying each of the layouts in [httpTimeLayouts] until one of them works.
+func parseHTTPTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range httpTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
 		}
 	}
+	return time.Time{}, fmt.Errorf("invalid HTTP date: %q", s)
+}
 
+// countTags reads an index using importer and counts the amount of tags
+// for each package name starting character.
+func countTags(r io.Reader, importer index.Importer) (map[byte]int, error) {
 	out := make(chan index.Record)
 	go importer.ReadPkgData(r, out)
 
-	filters := map[byte]*sbloom.Filter{}
+	counts := map[byte]int{}
+	for rec := range out {
+		if rec.Error != nil {
+			return nil, rec.Error
+		}
+		if len(rec.Name) != 0 {
+			counts[rec.Name[0]] += len(rec.Tags)
+		}
+	}
+	return counts, nil
+}
+
+// latestOnly wraps readFn so that only the records from the newest version of each
+// package are sent on out if opts.LatestOnly is set and importer implements
+// [index.VersionComparer]. Otherwise, readFn is returned as-is. Packages are
+// identified by their name and architecture, so that a package that's only been
+// rebuilt for some architectures doesn't hide the others. Records without a version
+// are sent right away, but the rest are held in memory until readFn has read the
+// whole index, since newer versions may come later.
+func (opts Options) latestOnly(importer index.Importer, readFn func(out chan index.Record)) func(out chan index.Record) {
+	vc, ok := importer.(index.VersionComparer)
+	if !opts.LatestOnly || !ok {
+		return readFn
+	}
+
+	return func(out chan index.Record) {
+		in := make(chan index.Record)
+		readerDone := make(chan struct{})
+		go func() {
+			defer close(readerDone)
+			readFn(in)
+		}()
+
+		type pkgKey struct{ name, arch string }
+		latest := map[pkgKey]index.Record{}
+		for rec := range in {
+			if rec.Error != nil {
+				// Keep receiving in the background until readFn returns,
+				// so that it doesn't block if it sends anything else.
+				go func() {
+					for {
+						select {
+						case _, ok := <-in:
+							if !ok {
+								return
+							}
+						case <-readerDone:
+							return
+						}
+					}
+				}()
+				out <- rec
+				return
+			} else if rec.Version == "" {
+				out <- rec
+				continue
+			}
+
+			key := pkgKey{rec.Name, rec.Arch}
+			cur, ok := latest[key]
+			if !ok {
+				latest[key] = rec
+				continue
+			}
+
+			switch vc.CompareVersions(rec.Version, cur.Version) {
+			case 1:
+				latest[key] = rec
+			case 0:
+				cur.Tags = append(cur.Tags, rec.Tags...)
+				latest[key] = cur
+			}
+		}
+
+		for _, rec := range latest {
+			out <- rec
+		}
+		close(out)
+	}
+}
+
+// writeRecords runs readFn in a new goroutine and writes all the records it
+// produces to s in batches, updating filters with the new tags. Records that
+// don't have an architecture are given arch. Warnings about skipped parts of
+// the index are logged using log.
+func writeRecords(ctx context.Context, log *slog.Logger, s *store.Store, filters map[byte]*sbloom.Filter, arch string, readFn func(out chan index.Record)) error {
+	out := make(chan index.Record)
+	go readFn(out)
+
+	// If we return before readFn is done, keep receiving its records
+	// in the background, so that it doesn't block forever trying to
+	// send them. Readers stop once they've sent an error.
+	readerDone := false
+	defer func() {
+		if !readerDone {
+			go drain(out)
+		}
+	}()
 
 	i := 0
 	collected := make(map[string]index.Record, batchSize)
 	for rec := range out {
 		if rec.Error != nil {
+			readerDone = true
 			return rec.Error
+		} else if rec.Warning != nil {
+			log.Warn("Skipping malformed part of index", slog.Any("error", rec.Warning))
+			continue
+		}
+
+		if rec.Arch == "" {
+			rec.Arch = arch
 		}
 
 		curRec, ok := collected[rec.Name]
@@ -164,11 +954,15 @@ func Pull(opts Options, s *store.Store, importer index.Importer) error {
 			collected[rec.Name] = rec
 		} else {
 			curRec.Tags = append(curRec.Tags, rec.Tags...)
+			curRec.Description = cmp.Or(curRec.Description, rec.Description)
 			collected[rec.Name] = curRec
 		}
 
 		if i >= batchSize {
-			err = s2.WriteBatch(collected, filters)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := s.WriteBatch(collected, filters)
 			if err != nil {
 				return err
 			}
@@ -178,31 +972,20 @@ func Pull(opts Options, s *store.Store, importer index.Importer) error {
 
 		i++
 	}
+	readerDone = true
 
 	if len(collected) != 0 {
-		err = s2.WriteBatch(collected, filters)
-		if err != nil {
-			return err
-		}
-	}
-
-	err = s2.WriteFilters(filters)
-	if err != nil {
-		return err
+		return s.WriteBatch(collected, filters)
 	}
 
-	meta := store.RepoMeta{ETag: res.Header.Get("ETag")}
+	return nil
+}
 
-	if lastMod := res.Header.Get("Last-Modified"); lastMod != "" {
-		meta.LastModified, err = time.Parse(time.RFC1123, lastMod)
-		if err != nil {
-			return err
+// drain receives records from out until it's closed or an error is received
+func drain(out chan index.Record) {
+	for rec := range out {
+		if rec.Error != nil {
+			return
 		}
 	}
-
-	if err := s2.WriteMeta(meta); err != nil {
-		return err
-	}
-
-	return s.Replace(s2)
 }
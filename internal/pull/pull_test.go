@@ -0,0 +1,1037 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package pull
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// openTestStore opens a store in a temporary directory
+// and closes it when the test ends.
+func openTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// lineImporter is an importer for test indices where each line
+// contains a package name followed by its tags, separated by spaces.
+type lineImporter struct{}
+
+func (lineImporter) Name() string { return "lines" }
+
+func (lineImporter) IndexURL(baseURL, version, repo, arch string) ([]string, error) {
+	return []string{baseURL + "/index"}, nil
+}
+
+func (lineImporter) ReadPkgData(r io.Reader, out chan index.Record) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 0 {
+			out <- index.Record{Name: fields[0], Tags: fields[1:]}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		out <- index.Record{Error: err}
+		return
+	}
+	close(out)
+}
+
+// versionedImporter is a [lineImporter] that compares versions like APT
+type versionedImporter struct{ lineImporter }
+
+func (versionedImporter) CompareVersions(a, b string) int {
+	return index.CompareDebianVersions(a, b)
+}
+
+func TestImportIndexTempDir(t *testing.T) {
+	// Permissions don't stop root from writing to a directory,
+	// so use a regular file as the unusable temporary directory.
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tempDir string
+		wantErr string
+	}{
+		{"default", "", ""},
+		{"separate", t.TempDir(), ""},
+		{"unusable", notDir, "can't create a temporary store in " + notDir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := store.Open(filepath.Join(t.TempDir(), "db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+
+			opts := Options{TempDir: tt.tempDir}
+			err = importIndex(context.Background(), opts, s, lineImporter{}, strings.NewReader("vim bin=vim\n"), store.RepoMeta{}, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if empty, err := s.Empty(); err != nil || !empty {
+					t.Errorf("store was modified by a failed import (empty=%t, err=%v)", empty, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.GetPkg("vim"); err != nil {
+				t.Errorf("imported package is missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	errRead := errors.New("read failed")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		readErr error
+		wantErr error
+	}{
+		{"ok", context.Background(), nil, nil},
+		{"canceled", canceled, nil, context.Canceled},
+		{"read error", context.Background(), errRead, errRead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			done := make(chan struct{})
+			readFn := func(out chan index.Record) {
+				defer close(done)
+				for i := range batchSize * 3 {
+					out <- index.Record{Name: "pkg" + strconv.Itoa(i), Tags: []string{"bin=pkg" + strconv.Itoa(i)}}
+				}
+				if tt.readErr != nil {
+					// Readers stop without closing out after sending an error
+					out <- index.Record{Error: tt.readErr}
+					return
+				}
+				close(out)
+			}
+
+			err := writeRecords(tt.ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), s, store.NewFilters(nil), "amd64", readFn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			// The reader should be able to finish even if writeRecords returned early
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("reader is still blocked after writeRecords returned")
+			}
+
+			if tt.wantErr == nil {
+				pkg, err := s.GetPkg("pkg42")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if pkg.Arch != "amd64" {
+					t.Errorf("got arch %q, want %q", pkg.Arch, "amd64")
+				}
+			}
+		})
+	}
+}
+
+func TestLatestOnly(t *testing.T) {
+	records := []index.Record{
+		{Name: "vim", Arch: "amd64", Version: "9.0-1", Tags: []string{"bin=vim-old"}},
+		{Name: "vim", Arch: "amd64", Version: "9.1-1", Tags: []string{"bin=vim"}},
+		{Name: "vim", Arch: "amd64", Version: "9.1-1", Tags: []string{"man=vim.1"}},
+		{Name: "vim", Arch: "i386", Version: "9.0-1", Tags: []string{"bin=vim-i386"}},
+		{Name: "gcc", Arch: "amd64", Version: "1:13.2-1", Tags: []string{"bin=gcc"}},
+		{Name: "gcc", Arch: "amd64", Version: "14.1-1", Tags: []string{"bin=gcc-old"}},
+		{Name: "base", Tags: []string{"lib=base-a"}},
+		{Name: "base", Tags: []string{"lib=base-b"}},
+	}
+
+	tests := []struct {
+		name       string
+		latestOnly bool
+		importer   index.Importer
+		want       map[string][]string
+	}{
+		{
+			name:       "latest",
+			latestOnly: true,
+			importer:   versionedImporter{},
+			want: map[string][]string{
+				"vim/amd64": {"bin=vim", "man=vim.1"},
+				"vim/i386":  {"bin=vim-i386"},
+				"gcc/amd64": {"bin=gcc"},
+				"base/":     {"lib=base-a", "lib=base-b"},
+			},
+		},
+		{
+			name:       "disabled",
+			latestOnly: false,
+			importer:   versionedImporter{},
+			want: map[string][]string{
+				"vim/amd64": {"bin=vim-old", "bin=vim", "man=vim.1"},
+				"vim/i386":  {"bin=vim-i386"},
+				"gcc/amd64": {"bin=gcc", "bin=gcc-old"},
+				"base/":     {"lib=base-a", "lib=base-b"},
+			},
+		},
+		{
+			name:       "no comparer",
+			latestOnly: true,
+			importer:   lineImporter{},
+			want: map[string][]string{
+				"vim/amd64": {"bin=vim-old", "bin=vim", "man=vim.1"},
+				"vim/i386":  {"bin=vim-i386"},
+				"gcc/amd64": {"bin=gcc", "bin=gcc-old"},
+				"base/":     {"lib=base-a", "lib=base-b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readFn := Options{LatestOnly: tt.latestOnly}.latestOnly(tt.importer, func(out chan index.Record) {
+				for _, rec := range records {
+					out <- rec
+				}
+				close(out)
+			})
+
+			out := make(chan index.Record)
+			go readFn(out)
+			got := map[string][]string{}
+			for rec := range out {
+				key := rec.Name + "/" + rec.Arch
+				got[key] = append(got[key], rec.Tags...)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if !slices.Equal(got[key], want) {
+					t.Errorf("%s: got tags %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestOnlyError(t *testing.T) {
+	errRead := errors.New("read failed")
+	done := make(chan struct{})
+	readFn := Options{LatestOnly: true}.latestOnly(versionedImporter{}, func(out chan index.Record) {
+		defer close(done)
+		out <- index.Record{Name: "vim", Version: "9.1-1"}
+		out <- index.Record{Error: errRead}
+		// A misbehaving reader that keeps sending after an error
+		// shouldn't be blocked forever.
+		out <- index.Record{Name: "gcc", Version: "14.1-1"}
+	})
+
+	out := make(chan index.Record)
+	go readFn(out)
+	if rec := <-out; !errors.Is(rec.Error, errRead) {
+		t.Fatalf("got record %+v, want error %v", rec, errRead)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader is still blocked after the error")
+	}
+}
+
+func TestWriteRecordsWarning(t *testing.T) {
+	s := openTestStore(t)
+	logs := &strings.Builder{}
+	log := slog.New(slog.NewTextHandler(logs, nil))
+
+	readFn := func(out chan index.Record) {
+		out <- index.Record{Name: "vim", Tags: []string{"bin=vim"}}
+		out <- index.Record{Warning: &index.ParseError{Line: 2, Err: errors.New("missing package name")}}
+		out <- index.Record{Name: "nano", Tags: []string{"bin=nano"}}
+		close(out)
+	}
+
+	if err := writeRecords(context.Background(), log, s, store.NewFilters(nil), "amd64", readFn); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"vim", "nano"} {
+		if _, err := s.GetPkg(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if !strings.Contains(logs.String(), "line 2: missing package name") {
+		t.Errorf("warning wasn't logged:\n%s", logs)
+	}
+}
+
+// fakeFetcher serves files from a map of URLs to contents
+// and records the URLs that were requested.
+type fakeFetcher struct {
+	files     map[string]string
+	requested []string
+}
+
+func (ff *fakeFetcher) Do(req *http.Request) (*http.Response, error) {
+	ff.requested = append(ff.requested, req.Method+" "+req.URL.String())
+	content, ok := ff.files[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody, Request: req}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(content)), Request: req}, nil
+}
+
+func TestPullFetcher(t *testing.T) {
+	ff := &fakeFetcher{files: map[string]string{"s3://mirror/repo/index": "vim bin=vim\n"}}
+	s := openTestStore(t)
+
+	err := Pull(context.Background(), Options{BaseURL: "s3://mirror/repo", Fetcher: ff}, s, lineImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPkg("vim"); err != nil {
+		t.Errorf("package from fetched index is missing: %v", err)
+	}
+	if !slices.Equal(ff.requested, []string{"GET s3://mirror/repo/index"}) {
+		t.Errorf("got requests %v", ff.requested)
+	}
+
+	url, err := CheckReachable(context.Background(), Options{BaseURL: "s3://mirror/repo", Fetcher: ff}, lineImporter{})
+	if err != nil {
+		t.Fatal(err)
+	} else if url != "s3://mirror/repo/index" {
+		t.Errorf("got reachable URL %q", url)
+	}
+}
+
+// writePkgs writes packages with the given tags to s
+func writePkgs(t *testing.T, s *store.Store, pkgs map[string][]string) {
+	t.Helper()
+	batch := map[string]index.Record{}
+	for name, tags := range pkgs {
+		batch[name] = index.Record{Name: name, Tags: tags}
+	}
+	if err := s.WriteBatch(batch, store.NewFilters(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordChanges(t *testing.T) {
+	old := make([]store.Change, maxChanges)
+	for i := range old {
+		old[i] = store.Change{Name: "old" + strconv.Itoa(i), Type: store.ChangeAdded}
+	}
+
+	tests := []struct {
+		name    string
+		before  map[string][]string
+		history []store.Change
+		want    []string
+	}{
+		{
+			name:   "first pull",
+			before: nil,
+			want:   nil,
+		},
+		{
+			name:    "newest first",
+			before:  map[string][]string{"vim": {"bin=vim"}, "emacs": {"bin=emacs"}},
+			history: []store.Change{{Name: "nano", Type: store.ChangeAdded}},
+			want:    []string{"emacs removed", "vim updated", "zsh added", "nano added"},
+		},
+		{
+			name:    "bounded",
+			before:  map[string][]string{"vim": {"bin=vim"}},
+			history: old,
+			want:    append([]string{"vim updated", "zsh added"}, changeStrings(old[:maxChanges-2])...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := openTestStore(t)
+			writePkgs(t, before, tt.before)
+			if tt.history != nil {
+				if err := before.WriteChanges(tt.history); err != nil {
+					t.Fatal(err)
+				}
+			}
+			after := openTestStore(t)
+			writePkgs(t, after, map[string][]string{"vim": {"bin=vim", "bin=vimdiff"}, "zsh": {"bin=zsh"}})
+
+			if err := recordChanges(before, after); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := after.GetChanges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := changeStrings(changes); !slices.Equal(got, tt.want) {
+				t.Errorf("got %d changes %v, want %d changes %v", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+// changeStrings formats changes as "name type" strings for comparison
+func changeStrings(changes []store.Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.Name+" "+string(c.Type))
+	}
+	return out
+}
+
+// describedImporter is a [lineImporter] with a description index, where
+// each line contains a package name followed by its description.
+type describedImporter struct{ lineImporter }
+
+func (describedImporter) DescriptionURL(baseURL, version, repo, arch string) ([]string, error) {
+	return []string{baseURL + "/descriptions"}, nil
+}
+
+func (describedImporter) ReadDescriptions(r io.Reader, out chan index.Record) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, desc, _ := strings.Cut(scanner.Text(), " ")
+		out <- index.Record{Name: name, Description: desc}
+	}
+	close(out)
+}
+
+func TestPullDescriptions(t *testing.T) {
+	files := map[string]string{
+		"s3://mirror/repo/index":        "vim bin=vim\nnano bin=nano\n",
+		"s3://mirror/repo/descriptions": "vim Vi IMproved\nemacs GNU Emacs\n",
+	}
+
+	tests := []struct {
+		name         string
+		descriptions bool
+		wantDesc     string
+		wantRequests []string
+	}{
+		{
+			name:         "disabled",
+			descriptions: false,
+			wantRequests: []string{"GET s3://mirror/repo/index"},
+		},
+		{
+			name:         "enabled",
+			descriptions: true,
+			wantDesc:     "Vi IMproved",
+			wantRequests: []string{"GET s3://mirror/repo/index", "GET s3://mirror/repo/descriptions"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ff := &fakeFetcher{files: files}
+			s := openTestStore(t)
+
+			opts := Options{BaseURL: "s3://mirror/repo", Fetcher: ff, Descriptions: tt.descriptions}
+			if err := Pull(context.Background(), opts, s, describedImporter{}); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ff.requested, tt.wantRequests) {
+				t.Errorf("got requests %v, want %v", ff.requested, tt.wantRequests)
+			}
+
+			pkg, err := s.GetPkg("vim")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Description != tt.wantDesc || !slices.Equal(pkg.Tags, []string{"bin=vim"}) {
+				t.Errorf("got package %+v", pkg)
+			}
+
+			// Descriptions of packages without tags don't add packages
+			if _, err := s.GetPkg("emacs"); err == nil {
+				t.Error("package that only has a description was added")
+			}
+			counts, err := s.Count()
+			if err != nil {
+				t.Fatal(err)
+			} else if counts.PackageCount != 2 {
+				t.Errorf("got %d packages, want 2", counts.PackageCount)
+			}
+		})
+	}
+}
+
+// locatedImporter is a [lineImporter] whose index only lists package names.
+// The tags of each package are downloaded from a file named after it
+// next to the index, like the binary packages in a Gentoo binhost.
+type locatedImporter struct {
+	lineImporter
+	indexURL string
+	fetcher  index.Fetcher
+}
+
+func (li locatedImporter) WithIndexURL(indexURL string) index.Importer {
+	li.indexURL = indexURL
+	return li
+}
+
+func (li locatedImporter) WithFetcher(f index.Fetcher) index.Importer {
+	li.fetcher = f
+	return li
+}
+
+func (li locatedImporter) ReadPkgData(r io.Reader, out chan index.Record) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := scanner.Text()
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(li.indexURL, "index")+name, nil)
+		if err != nil {
+			out <- index.Record{Error: err}
+			return
+		}
+		res, err := li.fetcher.Do(req)
+		if err != nil {
+			out <- index.Record{Error: err}
+			return
+		}
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			out <- index.Record{Error: err}
+			return
+		}
+		out <- index.Record{Name: name, Tags: strings.Fields(string(data))}
+	}
+	close(out)
+}
+
+// pullKey is the context key used to check that
+// requests are sent with the context of the pull
+type pullKey struct{}
+
+// contextRecorder is a [fakeFetcher] that records
+// the pullKey value of the context of each request
+type contextRecorder struct {
+	*fakeFetcher
+	values []any
+}
+
+func (cr *contextRecorder) Do(req *http.Request) (*http.Response, error) {
+	cr.values = append(cr.values, req.Context().Value(pullKey{}))
+	return cr.fakeFetcher.Do(req)
+}
+
+func TestPullLocatedImporter(t *testing.T) {
+	cr := &contextRecorder{fakeFetcher: &fakeFetcher{files: map[string]string{
+		"s3://mirror/repo/index": "vim\nnano\n",
+		"s3://mirror/repo/vim":   "bin=vim bin=vimdiff",
+		"s3://mirror/repo/nano":  "bin=nano",
+	}}}
+	s := openTestStore(t)
+
+	ctx := context.WithValue(context.Background(), pullKey{}, "pull")
+	if err := Pull(ctx, Options{BaseURL: "s3://mirror/repo", Fetcher: cr}, s, locatedImporter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantRequests := []string{"GET s3://mirror/repo/index", "GET s3://mirror/repo/vim", "GET s3://mirror/repo/nano"}
+	if !slices.Equal(cr.requested, wantRequests) {
+		t.Errorf("got requests %v, want %v", cr.requested, wantRequests)
+	}
+	for i, val := range cr.values {
+		if val != "pull" {
+			t.Errorf("request %d wasn't sent with the context of the pull", i)
+		}
+	}
+
+	pkg, err := s.GetPkg("vim")
+	if err != nil {
+		t.Fatal(err)
+	} else if !slices.Equal(pkg.Tags, []string{"bin=vim", "bin=vimdiff"}) {
+		t.Errorf("got tags %q", pkg.Tags)
+	}
+}
+
+func TestImportIndexTwoPass(t *testing.T) {
+	var index strings.Builder
+	for i := range 500 {
+		fmt.Fprintf(&index, "lib%d lib=lib%d.so file=/usr/lib/lib%d.so\n", i, i, i)
+	}
+	index.WriteString("vim bin=vim man=vim.1\n")
+	index.WriteString("vim-tiny bin=vim\n")
+
+	counts, err := countTags(strings.NewReader(index.String()), lineImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := map[byte]int{'l': 1000, 'v': 3}
+	if !maps.Equal(counts, wantCounts) {
+		t.Errorf("got tag counts %v, want %v", counts, wantCounts)
+	}
+
+	for _, twoPass := range []bool{false, true} {
+		t.Run("two pass "+strconv.FormatBool(twoPass), func(t *testing.T) {
+			s := openTestStore(t)
+			opts := Options{TwoPass: twoPass}
+			err := importIndex(context.Background(), opts, s, lineImporter{}, strings.NewReader(index.String()), store.RepoMeta{}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := s.GetMeta()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(meta.CharTagCounts, wantCounts) {
+				t.Errorf("got stored tag counts %v, want %v", meta.CharTagCounts, wantCounts)
+			}
+
+			results, _, err := s.Search([]string{"bin=vim"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Package.Name)
+			}
+			if want := []string{"vim", "vim-tiny"}; !slices.Equal(got, want) {
+				t.Errorf("got results %q, want %q", got, want)
+			}
+
+			results, _, err = s.Search([]string{"lib=lib250.so"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Package.Name != "lib250" {
+				t.Errorf("expected lib250 to be found in the dense bucket, got %v", results)
+			}
+		})
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	const (
+		rate = 10_000
+		size = 3_000
+	)
+	data := strings.Repeat("x", size)
+
+	res := &http.Response{Body: io.NopCloser(strings.NewReader(data))}
+	r := Options{RateLimit: rate}.bodyReader(res, "test")
+
+	start := time.Now()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if string(got) != data {
+		t.Errorf("got %d bytes of data, want the original %d", len(got), size)
+	}
+
+	want := time.Duration(size) * time.Second / rate
+	if elapsed < want*9/10 {
+		t.Errorf("download took %s, expected it to be throttled to about %s", elapsed, want)
+	} else if elapsed > want*3 {
+		t.Errorf("download took %s, expected about %s", elapsed, want)
+	}
+}
+
+func TestParseHTTPTime(t *testing.T) {
+	want := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"RFC1123", "Tue, 05 Mar 2024 14:30:00 GMT", false},
+		{"RFC1123Z", "Tue, 05 Mar 2024 14:30:00 +0000", false},
+		{"RFC850", "Tuesday, 05-Mar-24 14:30:00 GMT", false},
+		{"ANSIC", "Tue Mar  5 14:30:00 2024", false},
+		{"whitespace", "  Tue, 05 Mar 2024 14:30:00 GMT \t", false},
+		{"ISO 8601", "2024-03-05T14:30:00Z", true},
+		{"garbage", "yesterday-ish", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHTTPTime(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// lastModifiedServer serves a test index with the given Last-Modified header
+func lastModifiedServer(t *testing.T, lastMod string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastMod)
+		io.WriteString(w, "vim bin=vim\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPullLastModifiedRFC1123Z(t *testing.T) {
+	srv := lastModifiedServer(t, "Tue, 05 Mar 2024 14:30:00 +0000")
+	s := openTestStore(t)
+
+	opts := Options{BaseURL: srv.URL}
+	if err := Pull(context.Background(), opts, s, lineImporter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := s.GetMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC); !meta.LastModified.Equal(want) {
+		t.Errorf("got last modified time %s, want %s", meta.LastModified, want)
+	}
+
+	// The stored time is used to tell that the index hasn't changed
+	if err := Pull(context.Background(), opts, s, lineImporter{}); !errors.Is(err, ErrUpToDate) {
+		t.Errorf("got error %v, want %v", err, ErrUpToDate)
+	}
+}
+
+func TestPullMalformedLastModified(t *testing.T) {
+	srv := lastModifiedServer(t, "sometime last week")
+	s := openTestStore(t)
+
+	logs := &strings.Builder{}
+	opts := Options{BaseURL: srv.URL, Logger: slog.New(slog.NewTextHandler(logs, nil))}
+	if err := Pull(context.Background(), opts, s, lineImporter{}); err != nil {
+		t.Fatalf("expected the pull to succeed despite the malformed header, got %v", err)
+	}
+
+	if _, err := s.GetPkg("vim"); err != nil {
+		t.Errorf("index wasn't written: %v", err)
+	}
+	meta, err := s.GetMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.LastModified.IsZero() {
+		t.Errorf("expected no last modified time, got %s", meta.LastModified)
+	}
+	if !strings.Contains(logs.String(), "Ignoring malformed Last-Modified header") {
+		t.Errorf("expected a warning about the header, got logs %q", logs)
+	}
+
+	// Without a usable date, the index is downloaded again
+	if err := Pull(context.Background(), opts, s, lineImporter{}); err != nil {
+		t.Errorf("expected the index to be pulled again, got %v", err)
+	}
+}
+
+// archImporter is a [lineImporter] whose lines have an architecture
+// after the package name, where "-" means that it isn't known.
+type archImporter struct{ lineImporter }
+
+func (archImporter) ReadPkgData(r io.Reader, out chan index.Record) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		rec := index.Record{Name: fields[0], Tags: fields[2:]}
+		if fields[1] != "-" {
+			rec.Arch = fields[1]
+		}
+		out <- rec
+	}
+	close(out)
+}
+
+func TestPullArch(t *testing.T) {
+	ff := &fakeFetcher{files: map[string]string{
+		"s3://mirror/repo/index": "vim amd64 bin=vim\nvim-doc all file=/usr/share/doc/vim/README\nnvi - bin=nvi bin=vi\n",
+	}}
+	s := openTestStore(t)
+
+	opts := Options{BaseURL: "s3://mirror/repo", Fetcher: ff, Architecture: "amd64"}
+	if err := Pull(context.Background(), opts, s, archImporter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records without an architecture get the one that was pulled
+	want := map[string]string{"vim": "amd64", "vim-doc": "all", "nvi": "amd64"}
+	for name, arch := range want {
+		pkg, err := s.GetPkg(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Arch != arch {
+			t.Errorf("%s: got arch %q, want %q", name, pkg.Arch, arch)
+		}
+	}
+
+	results, _, err := s.SearchOpts([]string{"bin=vim", "file=/usr/share/doc/vim/README"}, store.SearchOptions{Arches: []string{"all"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Package.Name != "vim-doc" || results[0].Package.Arch != "all" {
+		t.Errorf("expected only vim-doc with arch all, got %+v", results)
+	}
+}
+
+func TestPullHeadFreshness(t *testing.T) {
+	tests := []struct {
+		name       string
+		headStatus int
+		etag       string
+		wantErr    error
+		wantGets   int
+	}{
+		// The index hasn't changed, so it shouldn't be downloaded again
+		{"unchanged", http.StatusOK, `"v1"`, ErrUpToDate, 0},
+		{"changed", http.StatusOK, `"v2"`, nil, 1},
+		// Without HEAD support, the GET response's ETag is checked instead
+		{"method not allowed", http.StatusMethodNotAllowed, `"v1"`, ErrUpToDate, 1},
+		{"not implemented", http.StatusNotImplemented, `"v1"`, ErrUpToDate, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The pulls are sequential, so the server's
+			// state can be changed between them.
+			etag := `"v1"`
+			var heads, gets int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", etag)
+				if r.Method == http.MethodHead {
+					heads++
+					w.WriteHeader(tt.headStatus)
+					return
+				}
+				gets++
+				io.WriteString(w, "vim bin=vim\n")
+			}))
+			t.Cleanup(srv.Close)
+
+			s := openTestStore(t)
+			opts := Options{BaseURL: srv.URL}
+			if err := Pull(context.Background(), opts, s, lineImporter{}); err != nil {
+				t.Fatal(err)
+			}
+			// There's no stored index yet, so the first pull doesn't check freshness
+			if heads != 0 || gets != 1 {
+				t.Fatalf("first pull: got %d HEAD and %d GET requests, want 0 and 1", heads, gets)
+			}
+
+			etag = tt.etag
+			gets = 0
+			err := Pull(context.Background(), opts, s, lineImporter{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if heads != 1 {
+				t.Errorf("got %d HEAD requests, want 1", heads)
+			}
+			if gets != tt.wantGets {
+				t.Errorf("got %d GET requests, want %d", gets, tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestPullToken(t *testing.T) {
+	const token = "s3cr3t-t0ken"
+	ff := &fakeFetcher{files: map[string]string{
+		"https://mirror.example.com/" + token + "/main/index":        "vim bin=vim\n",
+		"https://mirror.example.com/" + token + "/main/descriptions": "vim Vi IMproved\n",
+	}}
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	opts := Options{
+		BaseURL:      "https://mirror.example.com/$token/$repo",
+		Repo:         "main",
+		Token:        token,
+		Descriptions: true,
+		Fetcher:      ff,
+		Logger:       logger,
+		ProgressFunc: func(title string, received, total int64) {
+			logger.Debug("["+title+"] download", slog.Int64("recvd", received))
+		},
+	}
+
+	s := openTestStore(t)
+	if err := Pull(context.Background(), opts, s, describedImporter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPkg("vim"); err != nil {
+		t.Errorf("package from the expanded URL is missing: %v", err)
+	}
+	wantRequested := []string{
+		"GET https://mirror.example.com/" + token + "/main/index",
+		"GET https://mirror.example.com/" + token + "/main/descriptions",
+	}
+	if !slices.Equal(ff.requested, wantRequested) {
+		t.Errorf("expected requests %v, got %v", wantRequested, ff.requested)
+	}
+
+	indexURLs, err := IndexURLs(opts, describedImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://mirror.example.com/" + token + "/main/index"}; !slices.Equal(indexURLs, want) {
+		t.Errorf("expected index URLs %v, got %v", want, indexURLs)
+	}
+
+	reachable, err := CheckReachable(context.Background(), opts, describedImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(reachable, token) || !strings.Contains(reachable, "[REDACTED]") {
+		t.Errorf("expected the token to be redacted from the reachable URL, got %q", reachable)
+	}
+
+	// The HTTP client's errors include the URLs that were tried,
+	// which must not reveal the token.
+	failOpts := opts
+	failOpts.BaseURL = "http://127.0.0.1:1/$token/$repo"
+	failOpts.Fetcher = http.DefaultClient
+	err = Pull(context.Background(), failOpts, openTestStore(t), describedImporter{})
+	if err == nil {
+		t.Fatal("expected pulling a missing index to fail")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error contains the token: %v", err)
+	}
+	if !strings.Contains(err.Error(), "[REDACTED]") {
+		t.Errorf("expected the token to be redacted from the error, got %v", err)
+	}
+
+	// Without a token, $token isn't expanded, so the mistake is obvious
+	opts.Token = ""
+	indexURLs, err = IndexURLs(opts, describedImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://mirror.example.com/$token/main/index"}; !slices.Equal(indexURLs, want) {
+		t.Errorf("expected index URLs %v, got %v", want, indexURLs)
+	}
+
+	if logs.Len() == 0 {
+		t.Error("expected the pulls to log their progress")
+	}
+	if strings.Contains(logs.String(), token) {
+		t.Errorf("logs contain the token:\n%s", logs.String())
+	}
+}
+
+func TestPullHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"html", "<!DOCTYPE html>\n<html><body>Service Unavailable</body></html>", true},
+		{"bom and whitespace", "\xEF\xBB\xBF\n  <HTML><head><title>Error</title></head></html>", true},
+		{"index", "vim bin=vim\n", false},
+		{"index with markup", "vim file=/usr/share/vim/<html>\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Misconfigured mirrors serve error pages
+				// with a 200 status and the wrong type.
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, tt.body)
+			}))
+			t.Cleanup(srv.Close)
+
+			s := openTestStore(t)
+			err := Pull(context.Background(), Options{BaseURL: srv.URL}, s, lineImporter{})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.GetPkg("vim"); err != nil {
+					t.Errorf("package from the index is missing: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error for an HTML page")
+			}
+			if msg := err.Error(); !strings.Contains(msg, srv.URL+"/index") || !strings.Contains(msg, "HTML page") {
+				t.Errorf("expected the error to name the URL and the problem, got %q", msg)
+			}
+			if empty, err := s.Empty(); err != nil || !empty {
+				t.Error("expected nothing to be imported from an HTML page")
+			}
+		})
+	}
+}
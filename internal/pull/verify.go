@@ -0,0 +1,149 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pull
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// maxSignatureSize is the maximum size of a detached signature file.
+// Signatures are much smaller than this, so anything larger is rejected
+// rather than read into memory.
+const maxSignatureSize = 64 * 1024
+
+// armorPrefix is the start of an ASCII-armored OpenPGP file
+var armorPrefix = []byte("-----BEGIN PGP")
+
+// ErrBadSignature is returned when the signature of an index can't be verified
+var ErrBadSignature = errors.New("index signature verification failed")
+
+// verifyIndex downloads the detached signature of the index at indexURL and
+// copies the index read from r into a temporary file, checking it against the
+// signature using the keyring at opts.Keyring. The file is only returned if the
+// signature is valid, in which case it's positioned at its start and the caller
+// is responsible for closing and removing it.
+func verifyIndex(ctx context.Context, opts Options, s *store.Store, si index.SignedImporter, indexURL string, r io.Reader) (*os.File, error) {
+	keyring, err := loadKeyring(opts.Keyring)
+	if err != nil {
+		return nil, fmt.Errorf("can't load keyring %s: %w", opts.Keyring, err)
+	}
+
+	res, err := opts.fetch(ctx, []string{si.SignatureURL(indexURL)})
+	if err != nil {
+		return nil, fmt.Errorf("can't download index signature: %w", err)
+	}
+	defer res.Body.Close()
+
+	sig, err := io.ReadAll(io.LimitReader(res.Body, maxSignatureSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(sig) > maxSignatureSize {
+		return nil, fmt.Errorf("%w: signature is larger than %d bytes", ErrBadSignature, maxSignatureSize)
+	}
+
+	tmp, err := os.CreateTemp(opts.tempDir(s), "distrohop-index.*")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkSignature(keyring, io.TeeReader(r, tmp), sig)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+// checkSignature reads all of signed and checks it against the binary or
+// ASCII-armored detached signature sig, using the keys in keyring.
+func checkSignature(keyring openpgp.KeyRing, signed io.Reader, sig []byte) error {
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), armorPrefix) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+
+	_, err := check(keyring, signedReader{signed}, bytes.NewReader(sig), nil)
+	if err != nil {
+		// Read errors from signed shouldn't be
+		// reported as invalid signatures.
+		var readErr *signedReadError
+		if errors.As(err, &readErr) {
+			return readErr.err
+		}
+		return fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+
+	// The signature may be rejected before signed is read, but if it's
+	// accepted, all of signed has to have been read to compute the hash.
+	_, err = io.Copy(io.Discard, signed)
+	return err
+}
+
+// signedReader wraps the errors returned by r in a [signedReadError]
+type signedReader struct {
+	r io.Reader
+}
+
+func (sr signedReader) Read(b []byte) (int, error) {
+	n, err := sr.r.Read(b)
+	if err != nil && err != io.EOF {
+		err = &signedReadError{err}
+	}
+	return n, err
+}
+
+// signedReadError wraps errors that occurred while reading signed data,
+// so that they can be told apart from signature verification errors.
+type signedReadError struct {
+	err error
+}
+
+func (sre *signedReadError) Error() string {
+	return sre.err.Error()
+}
+
+// loadKeyring reads a binary or ASCII-armored OpenPGP keyring from path
+func loadKeyring(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), armorPrefix) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
@@ -0,0 +1,187 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package pull
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// newTestEntity generates an OpenPGP key for signing test indices
+func newTestEntity(t *testing.T) *openpgp.Entity {
+	t.Helper()
+	entity, err := openpgp.NewEntity("distrohop", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+// writeKeyring writes the public key of entity to a file in
+// a temporary directory, optionally ASCII-armored.
+func writeKeyring(t *testing.T, entity *openpgp.Entity, armored bool) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if armored {
+		w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := entity.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	} else if err := entity.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign returns a detached signature of data made with
+// entity, optionally ASCII-armored.
+func sign(t *testing.T, entity *openpgp.Entity, data []byte, armored bool) []byte {
+	t.Helper()
+	signFn := openpgp.DetachSign
+	if armored {
+		signFn = openpgp.ArmoredDetachSign
+	}
+	buf := &bytes.Buffer{}
+	if err := signFn(buf, entity, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pacmanFilesDB returns an uncompressed pacman .files
+// database containing a single package with a single file.
+func pacmanFilesDB(t *testing.T, name, version, file string) []byte {
+	t.Helper()
+	entries := []struct{ name, content string }{
+		{name + "-" + version + "/desc", "%NAME%\n" + name + "\n\n%VERSION%\n" + version + "\n"},
+		{name + "-" + version + "/files", "%FILES%\n" + file + "\n"},
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPullSigned(t *testing.T) {
+	signer := newTestEntity(t)
+	other := newTestEntity(t)
+	db := pacmanFilesDB(t, "vim", "9.1-1", "usr/bin/vim")
+
+	tests := []struct {
+		name    string
+		armored bool
+		sig     []byte
+		wantErr string
+	}{
+		{"good", false, sign(t, signer, db, false), ""},
+		{"good armored", true, sign(t, signer, db, true), ""},
+		{"wrong key", false, sign(t, other, db, false), ErrBadSignature.Error()},
+		{"wrong data", false, sign(t, signer, append(bytes.Clone(db), 0), false), ErrBadSignature.Error()},
+		{"garbage", false, []byte("not a signature"), ErrBadSignature.Error()},
+		{"missing", false, nil, "can't download index signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/core.files":
+					w.Write(db)
+				case r.URL.Path == "/core.files.sig" && tt.sig != nil:
+					w.Write(tt.sig)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			s := openTestStore(t)
+			filters := store.NewFilters(nil)
+			err := s.WriteBatch(map[string]index.Record{"old": {Name: "old", Tags: []string{"bin=old"}}}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.WriteFilters(filters); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := Options{BaseURL: srv.URL, Repo: "core", Keyring: writeKeyring(t, signer, tt.armored)}
+			err = Pull(context.Background(), opts, s, index.Pacman{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				// The existing index must be left intact
+				if _, err := s.GetPkg("old"); err != nil {
+					t.Errorf("existing package is missing after a failed pull: %v", err)
+				}
+				if _, err := s.GetPkg("vim"); err == nil {
+					t.Error("unverified package was imported")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.GetPkg("vim"); err != nil {
+				t.Errorf("verified package is missing: %v", err)
+			}
+			if _, err := s.GetPkg("old"); err == nil {
+				t.Error("existing index wasn't replaced")
+			}
+		})
+	}
+}
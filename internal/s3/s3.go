@@ -0,0 +1,210 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the hex-encoded SHA256 hash of an empty request body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Transport is an [http.RoundTripper] that downloads objects from S3-compatible
+// object storage, using URLs in the "s3://bucket/key" format. It's meant to be
+// registered for the s3 scheme using [http.Transport.RegisterProtocol], so that
+// any HTTP client using that transport can download from S3. Objects are requested
+// using path-style URLs, which are supported by most S3-compatible services.
+type Transport struct {
+	// Endpoint is the base URL of the S3 API, such as "https://minio.example.com".
+	// If it's empty, the AWS S3 endpoint for Region is used.
+	Endpoint string
+	// Region is the region that requests are signed for.
+	// If it's empty, "us-east-1" is used.
+	Region string
+	// AccessKey and SecretKey are the credentials used to sign requests.
+	// If AccessKey is empty, requests aren't signed, which only works
+	// for public buckets.
+	AccessKey string
+	SecretKey string
+	// Base is the transport used to send requests to the S3 API.
+	// If it's nil, [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// RoundTrip converts an s3:// request into a request to the S3 API and sends it
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("s3: method %s isn't supported", req.Method)
+	}
+
+	bucket := req.URL.Host
+	if bucket == "" {
+		return nil, errors.New("s3: no bucket in URL")
+	}
+
+	endpoint, err := url.Parse(t.endpoint())
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint: %w", err)
+	}
+	objPath := strings.TrimSuffix(endpoint.Path, "/") + "/" + bucket + "/" + strings.TrimPrefix(req.URL.Path, "/")
+	endpoint.Path = objPath
+	endpoint.RawPath = uriEncode(objPath)
+	endpoint.RawQuery = ""
+
+	out := req.Clone(req.Context())
+	out.URL = endpoint
+	out.Host = endpoint.Host
+	out.Body = nil
+	out.ContentLength = 0
+	if t.AccessKey != "" {
+		t.sign(out)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(out)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+// The host header, any x-amz-* headers, and the range header are signed.
+func (t *Transport) sign(req *http.Request) {
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+	ts := now().UTC()
+	amzDate := ts.Format("20060102T150405Z")
+	scope := ts.Format("20060102") + "/" + t.region() + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(vals, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.SecretKey), ts.Format("20060102"))
+	key = hmacSHA256(key, t.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// endpoint returns t.Endpoint, or the AWS endpoint for t's region if it's empty
+func (t *Transport) endpoint() string {
+	if t.Endpoint == "" {
+		return "https://s3." + t.region() + ".amazonaws.com"
+	}
+	return t.Endpoint
+}
+
+// region returns t.Region, or "us-east-1" if it's empty
+func (t *Transport) region() string {
+	if t.Region == "" {
+		return "us-east-1"
+	}
+	return t.Region
+}
+
+// uriEncode percent-encodes a URL path the way AWS Signature Version 4
+// requires, which escapes every byte except slashes and unreserved characters.
+func uriEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
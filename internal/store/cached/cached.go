@@ -23,14 +23,21 @@
 package cached
 
 import (
-	"strings"
+	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 	"go.elara.ws/distrohop/internal/store"
 )
 
-var _ store.ReadOnly = (*Store)(nil)
+var (
+	_ store.ReadOnly       = (*Store)(nil)
+	_ store.OptionSearcher = (*Store)(nil)
+	_ store.Streamer       = (*Store)(nil)
+	_ store.Lister         = (*Store)(nil)
+)
 
 // cacheRecord represents a single item stored in the cache
 type cacheRecord struct {
@@ -43,6 +50,11 @@ type cacheRecord struct {
 type Store struct {
 	store.ReadOnly
 	cache *cache.Cache
+
+	// MinConfidence is the minimum confidence that the best result of
+	// a search must have for the search to be cached. This keeps searches
+	// that only produce low-value near misses from filling up the cache.
+	MinConfidence float32
 }
 
 // New creates a new cached store with the provided cache settings and underlying store.
@@ -56,17 +68,113 @@ func New(s store.ReadOnly, exp, cleanup time.Duration) Store {
 // Search retrieves cached search results for the given tags. If the search doesn't exist
 // in the cache, it queries the underlying store and adds the results to the cache.
 func (cs Store) Search(tags []string) ([]store.TagResult, time.Duration, error) {
-	cacheKey := strings.Join(tags, "\x1F")
+	return cs.search(string(store.EncodeTags(tags)), func() ([]store.TagResult, time.Duration, error) {
+		return cs.ReadOnly.Search(tags)
+	})
+}
+
+// SearchOpts retrieves cached search results for the given tags and options. If the
+// underlying store doesn't implement [go.elara.ws/distrohop/internal/store.OptionSearcher],
+// it returns an error unless opts is the zero value. The timeout doesn't affect the
+// results of a complete search, so searches with different timeouts share cached results.
+func (cs Store) SearchOpts(tags []string, opts store.SearchOptions) ([]store.TagResult, time.Duration, error) {
+	defaultOpts := len(opts.Arches) == 0 && opts.Mode == store.ModeAny && !opts.IDF && !opts.CrossType
+	if defaultOpts && opts.Timeout == 0 {
+		return cs.Search(tags)
+	}
+
+	searcher, ok := cs.ReadOnly.(store.OptionSearcher)
+	if !ok {
+		return nil, 0, errors.New("underlying store doesn't support search options")
+	}
+
+	cacheKey := string(store.EncodeTags(tags))
+	if !defaultOpts {
+		// Encode the options and tags separately and then encode them
+		// together, so that the key can't be ambiguous. The encoded options
+		// aren't a valid tag, so this can't collide with keys from [Store.Search].
+		cacheKey = string(store.EncodeTags([]string{
+			opts.Mode.String(),
+			strconv.FormatBool(opts.IDF),
+			strconv.FormatBool(opts.CrossType),
+			string(store.EncodeTags(opts.Arches)),
+			cacheKey,
+		}))
+	}
+	return cs.search(cacheKey, func() ([]store.TagResult, time.Duration, error) {
+		return searcher.SearchOpts(tags, opts)
+	})
+}
+
+// search returns the cached results for cacheKey if they exist. Otherwise, it calls
+// searchFn and adds its results to the cache. Partial results are returned along with
+// [go.elara.ws/distrohop/internal/store.ErrPartial], but they aren't cached.
+func (cs Store) search(cacheKey string, searchFn func() ([]store.TagResult, time.Duration, error)) ([]store.TagResult, time.Duration, error) {
 	if results, ok := cs.cache.Get(cacheKey); ok {
 		record := results.(cacheRecord)
 		return record.results, record.latency, nil
 	}
-	res, latency, err := cs.ReadOnly.Search(tags)
-	if err != nil {
+	res, latency, err := searchFn()
+	if errors.Is(err, store.ErrPartial) {
+		return res, latency, err
+	} else if err != nil {
 		return nil, 0, err
 	}
-	if len(res) != 0 {
+	// Results are sorted by confidence, so the first
+	// one has the highest confidence
+	if len(res) != 0 && res[0].Confidence >= cs.MinConfidence {
 		cs.cache.Set(cacheKey, cacheRecord{res, latency}, cache.DefaultExpiration)
 	}
 	return res, latency, nil
 }
+
+// Flush removes all the search results from the cache
+func (cs Store) Flush() {
+	cs.cache.Flush()
+}
+
+// Warmup runs a search for each of the given queries, adding their
+// results to the cache so that later identical searches are fast. If the
+// underlying store is empty, there's nothing to cache, so nothing is done.
+func (cs Store) Warmup(queries [][]string) error {
+	var errs []error
+	for _, tags := range queries {
+		if _, _, err := cs.Search(tags); errors.Is(err, store.ErrEmpty) {
+			return nil
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SearchStream streams search results from the underlying store, bypassing the cache.
+// If the underlying store doesn't implement [go.elara.ws/distrohop/internal/store.Streamer],
+// the results are retrieved using [Store.Search] instead.
+func (cs Store) SearchStream(ctx context.Context, tags []string, fn func(store.TagResult) error) error {
+	if streamer, ok := cs.ReadOnly.(store.Streamer); ok {
+		return streamer.SearchStream(ctx, tags, fn)
+	}
+
+	results, _, err := cs.Search(tags)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPkgNames lists the packages in the underlying store. If it doesn't implement
+// [go.elara.ws/distrohop/internal/store.Lister], [go.elara.ws/distrohop/internal/store.ErrListUnsupported]
+// is returned.
+func (cs Store) ListPkgNames(ctx context.Context, fn func(name string) error) error {
+	lister, ok := cs.ReadOnly.(store.Lister)
+	if !ok {
+		return store.ErrListUnsupported
+	}
+	return lister.ListPkgNames(ctx, fn)
+}
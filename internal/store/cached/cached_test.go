@@ -0,0 +1,149 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package cached
+
+import (
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+// countingStore counts the searches that reach the underlying store
+type countingStore struct {
+	*mem.Store
+	searches int
+}
+
+func (cs *countingStore) Search(tags []string) ([]store.TagResult, time.Duration, error) {
+	cs.searches++
+	return cs.Store.Search(tags)
+}
+
+func TestWarmup(t *testing.T) {
+	ms := &countingStore{Store: mem.New()}
+	ms.Add("vim", "bin=vim", "man=vim.1")
+	ms.Add("nano", "bin=nano")
+
+	cs := New(ms, time.Hour, time.Hour)
+	queries := [][]string{{"bin=vim"}, {"bin=nano"}}
+	if err := cs.Warmup(queries); err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	if n := cs.cache.ItemCount(); n != len(queries) {
+		t.Fatalf("expected %d cached searches after warmup, got %d", len(queries), n)
+	}
+	if ms.searches != len(queries) {
+		t.Fatalf("expected %d searches during warmup, got %d", len(queries), ms.searches)
+	}
+
+	for _, tags := range queries {
+		res, _, err := cs.Search(tags)
+		if err != nil {
+			t.Fatalf("Search(%v): %v", tags, err)
+		}
+		if len(res) == 0 {
+			t.Errorf("Search(%v): expected cached results", tags)
+		}
+	}
+	if ms.searches != len(queries) {
+		t.Errorf("expected warmed up searches to be served from the cache, but the store was searched %d times", ms.searches)
+	}
+}
+
+func TestWarmupFlush(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim")
+
+	cs := New(ms, time.Hour, time.Hour)
+	if err := cs.Warmup([][]string{{"bin=vim"}}); err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	cs.Flush()
+	if n := cs.cache.ItemCount(); n != 0 {
+		t.Errorf("expected an empty cache after flushing, got %d items", n)
+	}
+}
+
+func TestWarmupEmptyStore(t *testing.T) {
+	cs := New(mem.New(), time.Hour, time.Hour)
+	if err := cs.Warmup([][]string{{"bin=vim"}}); err != nil {
+		t.Errorf("expected no error warming up an empty store, got %v", err)
+	}
+	if n := cs.cache.ItemCount(); n != 0 {
+		t.Errorf("expected nothing to be cached for an empty store, got %d items", n)
+	}
+}
+
+func TestWarmupInvalidTag(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim")
+
+	cs := New(ms, time.Hour, time.Hour)
+	if err := cs.Warmup([][]string{{"invalid"}, {"bin=vim"}}); err == nil {
+		t.Error("expected an error for a query with an invalid tag")
+	}
+	if n := cs.cache.ItemCount(); n != 1 {
+		t.Errorf("expected the valid query to still be cached, got %d items", n)
+	}
+}
+
+func TestMinConfidence(t *testing.T) {
+	ms := &countingStore{Store: mem.New()}
+	ms.Add("vim", "bin=vim", "bin=vimdiff")
+	ms.Add("nano", "bin=nano")
+
+	cs := New(ms, time.Hour, time.Hour)
+	cs.MinConfidence = 0.5
+
+	tests := []struct {
+		name       string
+		tags       []string
+		wantCached bool
+	}{
+		// The best result only has one of the four tags
+		{"low confidence", []string{"bin=vim", "bin=a", "bin=b", "bin=c"}, false},
+		{"at threshold", []string{"bin=vim", "bin=a"}, true},
+		{"full match", []string{"bin=nano"}, true},
+		{"no results", []string{"bin=emacs"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := ms.searches
+			for range 2 {
+				if _, _, err := cs.Search(tt.tags); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// If the results were cached, the second
+			// search doesn't reach the underlying store.
+			wantSearches := 2
+			if tt.wantCached {
+				wantSearches = 1
+			}
+			if n := ms.searches - before; n != wantSearches {
+				t.Errorf("got %d searches of the underlying store, want %d", n, wantSearches)
+			}
+		})
+	}
+}
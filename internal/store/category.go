@@ -0,0 +1,84 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Category is a human-friendly classification of a search result's confidence score
+type Category string
+
+const (
+	// CategoryExact is used for results that matched every search tag
+	CategoryExact Category = "exact"
+	// CategoryStrong is used for results that matched most of the search tags
+	CategoryStrong Category = "strong"
+	// CategoryPartial is used for results that matched some of the search tags
+	CategoryPartial Category = "partial"
+	// CategoryWeak is used for results that only matched a few of the search tags
+	CategoryWeak Category = "weak"
+)
+
+// ParseCategory parses a result category name
+func ParseCategory(s string) (Category, error) {
+	switch c := Category(s); c {
+	case CategoryExact, CategoryStrong, CategoryPartial, CategoryWeak:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid result category: %q", s)
+	}
+}
+
+// CategoryThresholds contains the minimum confidence scores for result categories.
+// Results with a confidence of 1 are always exact, and results with a confidence
+// below Partial are weak.
+type CategoryThresholds struct {
+	Strong  float32
+	Partial float32
+}
+
+// Category returns the category for the given confidence score
+func (ct CategoryThresholds) Category(confidence float32) Category {
+	switch {
+	case confidence >= 1:
+		return CategoryExact
+	case confidence >= ct.Strong:
+		return CategoryStrong
+	case confidence >= ct.Partial:
+		return CategoryPartial
+	default:
+		return CategoryWeak
+	}
+}
+
+// Categorize returns a copy of results with their Category fields set according
+// to ct. The original results aren't modified, since they may be shared with a cache.
+func Categorize(results []TagResult, ct CategoryThresholds) []TagResult {
+	out := slices.Clone(results)
+	for i := range out {
+		out[i].Category = ct.Category(out[i].Confidence)
+	}
+	return out
+}
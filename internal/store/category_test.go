@@ -0,0 +1,87 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCategory(t *testing.T) {
+	ct := CategoryThresholds{Strong: 0.75, Partial: 0.5}
+
+	tests := []struct {
+		confidence float32
+		want       Category
+	}{
+		{1, CategoryExact},
+		{0.99, CategoryStrong},
+		{0.75, CategoryStrong},
+		{0.7499, CategoryPartial},
+		{0.5, CategoryPartial},
+		{0.4999, CategoryWeak},
+		{0, CategoryWeak},
+	}
+
+	for _, tt := range tests {
+		if got := ct.Category(tt.confidence); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.confidence, tt.want, got)
+		}
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	ct := CategoryThresholds{Strong: 0.75, Partial: 0.5}
+	results := []TagResult{
+		{Confidence: 1, Package: Package{Name: "a"}},
+		{Confidence: 0.75, Package: Package{Name: "b"}},
+		{Confidence: 0.5, Package: Package{Name: "c"}},
+		{Confidence: 0.25, Package: Package{Name: "d"}},
+	}
+
+	out := Categorize(results, ct)
+	got := make([]Category, len(out))
+	for i, result := range out {
+		got[i] = result.Category
+	}
+	want := []Category{CategoryExact, CategoryStrong, CategoryPartial, CategoryWeak}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, result := range results {
+		if result.Category != "" {
+			t.Errorf("expected the original results not to be modified, got %s for %s", result.Category, result.Package.Name)
+		}
+	}
+}
+
+func TestParseCategory(t *testing.T) {
+	for _, c := range []Category{CategoryExact, CategoryStrong, CategoryPartial, CategoryWeak} {
+		if got, err := ParseCategory(string(c)); err != nil || got != c {
+			t.Errorf("%s: expected %s, got %q (%v)", c, c, got, err)
+		}
+	}
+	if _, err := ParseCategory("perfect"); err == nil {
+		t.Error("expected an error for an invalid category")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// ChangeType is the kind of change that was made to a package
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeUpdated ChangeType = "updated"
+)
+
+// Change describes a package that was added, removed,
+// or updated between two versions of an index
+type Change struct {
+	Name string     `json:"name"`
+	Type ChangeType `json:"type"`
+	// Time is when the new version of the index was pulled
+	Time time.Time `json:"time"`
+}
+
+// changesKey is the database key for the change history
+var changesKey = []byte("\x02CHANGES")
+
+// Diff compares the packages in s with the ones in s2, and returns the
+// changes that turn s into s2, sorted by package name. Packages whose
+// tags are different count as updated. The returned changes don't have
+// a time set.
+func (s *Store) Diff(s2 *Store) ([]Change, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer db.release()
+	db2, err := s2.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer db2.release()
+
+	oldIter, err := db.NewIter(pkgIterOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer oldIter.Close()
+
+	newIter, err := db2.NewIter(pkgIterOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer newIter.Close()
+
+	var out []Change
+	oldIter.First()
+	newIter.First()
+	for oldIter.Valid() || newIter.Valid() {
+		cmp := 0
+		switch {
+		case !oldIter.Valid():
+			cmp = 1
+		case !newIter.Valid():
+			cmp = -1
+		default:
+			cmp = bytes.Compare(oldIter.Key(), newIter.Key())
+		}
+
+		switch {
+		case cmp < 0:
+			out = append(out, Change{Name: string(oldIter.Key()), Type: ChangeRemoved})
+			oldIter.Next()
+		case cmp > 0:
+			out = append(out, Change{Name: string(newIter.Key()), Type: ChangeAdded})
+			newIter.Next()
+		default:
+			oldVal, err := oldIter.ValueAndErr()
+			if err != nil {
+				return nil, err
+			}
+			newVal, err := newIter.ValueAndErr()
+			if err != nil {
+				return nil, err
+			}
+			// Tags are always stored sorted and without duplicates,
+			// so packages with the same tags have the same value.
+			if !bytes.Equal(oldVal, newVal) {
+				out = append(out, Change{Name: string(oldIter.Key()), Type: ChangeUpdated})
+			}
+			oldIter.Next()
+			newIter.Next()
+		}
+	}
+
+	return out, errors.Join(oldIter.Error(), newIter.Error())
+}
+
+// WriteChanges writes the change history to the database
+func (s *Store) WriteChanges(changes []Change) error {
+	db, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer db.release()
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return db.Set(changesKey, data, nil)
+}
+
+// GetChanges reads the change history from the database.
+// If there isn't one, it returns nil.
+func (s *Store) GetChanges() ([]Change, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer db.release()
+
+	data, cl, err := db.Get(changesKey)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	var out []Change
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
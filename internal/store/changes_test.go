@@ -0,0 +1,124 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string][]string
+		after  map[string][]string
+		want   []Change
+	}{
+		{
+			name:   "unchanged",
+			before: map[string][]string{"vim": {"bin=vim"}, "nano": {"bin=nano"}},
+			after:  map[string][]string{"vim": {"bin=vim"}, "nano": {"bin=nano"}},
+		},
+		{
+			name:   "tag order",
+			before: map[string][]string{"vim": {"bin=vim", "man=vim.1"}},
+			after:  map[string][]string{"vim": {"man=vim.1", "bin=vim", "bin=vim"}},
+		},
+		{
+			name:   "added",
+			before: map[string][]string{"vim": {"bin=vim"}},
+			after:  map[string][]string{"vim": {"bin=vim"}, "emacs": {"bin=emacs"}, "zsh": {"bin=zsh"}},
+			want:   []Change{{Name: "emacs", Type: ChangeAdded}, {Name: "zsh", Type: ChangeAdded}},
+		},
+		{
+			name:   "removed",
+			before: map[string][]string{"vim": {"bin=vim"}, "emacs": {"bin=emacs"}, "zsh": {"bin=zsh"}},
+			after:  map[string][]string{"vim": {"bin=vim"}},
+			want:   []Change{{Name: "emacs", Type: ChangeRemoved}, {Name: "zsh", Type: ChangeRemoved}},
+		},
+		{
+			name:   "updated",
+			before: map[string][]string{"vim": {"bin=vim"}, "nano": {"bin=nano"}},
+			after:  map[string][]string{"vim": {"bin=vim", "bin=vimdiff"}, "nano": {"bin=nano"}},
+			want:   []Change{{Name: "vim", Type: ChangeUpdated}},
+		},
+		{
+			name:   "mixed",
+			before: map[string][]string{"a": {"bin=a"}, "b": {"bin=b"}, "d": {"bin=d"}},
+			after:  map[string][]string{"b": {"bin=b2"}, "c": {"bin=c"}, "d": {"bin=d"}, "e": {"bin=e"}},
+			want: []Change{
+				{Name: "a", Type: ChangeRemoved},
+				{Name: "b", Type: ChangeUpdated},
+				{Name: "c", Type: ChangeAdded},
+				{Name: "e", Type: ChangeAdded},
+			},
+		},
+		{
+			name:   "empty before",
+			before: map[string][]string{},
+			after:  map[string][]string{"vim": {"bin=vim"}},
+			want:   []Change{{Name: "vim", Type: ChangeAdded}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := newTestStore(t, tt.before)
+			after := newTestStore(t, tt.after)
+
+			got, err := before.Diff(after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangesRoundTrip(t *testing.T) {
+	s := newTestStore(t, nil)
+
+	got, err := s.GetChanges()
+	if err != nil {
+		t.Fatal(err)
+	} else if got != nil {
+		t.Errorf("got changes %v from a store without any", got)
+	}
+
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	want := []Change{{Name: "vim", Type: ChangeUpdated, Time: now}, {Name: "nano", Type: ChangeAdded, Time: now}}
+	if err := s.WriteChanges(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, func(a, b Change) bool {
+		return a.Name == b.Name && a.Type == b.Type && a.Time.Equal(b.Time)
+	}) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -23,10 +23,15 @@
 package combined
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
@@ -34,7 +39,12 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-var _ store.ReadOnly = (*Store)(nil)
+var (
+	_ store.ReadOnly       = (*Store)(nil)
+	_ store.OptionSearcher = (*Store)(nil)
+	_ store.Streamer       = (*Store)(nil)
+	_ store.Lister         = (*Store)(nil)
+)
 
 var ErrNotFound = errors.New("no such package")
 
@@ -42,30 +52,109 @@ var ErrNotFound = errors.New("no such package")
 // It implements [go.elara.ws/distrohop/internal/store.ReadOnly].
 type Store struct {
 	Stores []store.ReadOnly
+
+	// Normalize enables confidence normalization. Stores whose packages have more
+	// tags on average are more likely to overlap with any given search, so when
+	// this is enabled, the confidence of each result is scaled by the square root
+	// of the ratio between the mean tags per package across all stores and the
+	// tags per package of the result's store, and then capped at 1. This makes
+	// confidence scores from different stores more comparable. Stores that don't
+	// implement [go.elara.ws/distrohop/internal/store.MetaProvider] aren't normalized.
+	Normalize bool
+
+	// MergePackages makes [Store.GetPkg] return the union of the tags of
+	// every store that contains the package, rather than the tags from
+	// only one of them. This is useful when the files of a package are
+	// split differently across the components of a distro.
+	MergePackages bool
+
+	// arches contains the architecture of each store in Stores,
+	// at the same index. Stores with an unknown architecture
+	// have an empty string.
+	arches []string
+
+	// names contains the name of each store in Stores that was
+	// added using [Store.AddNamed], at the same index. Other
+	// stores have an empty string.
+	names []string
 }
 
 // New creates a new combined store with the provided individual stores.
 func New(stores ...store.ReadOnly) *Store {
-	return &Store{stores}
+	return &Store{Stores: stores}
 }
 
 // Add adds a new store to the combined store.
 func (cs *Store) Add(s store.ReadOnly) {
+	cs.AddArch(s, "")
+}
+
+// AddArch adds a new store containing an index for the given architecture
+// to the combined store.
+func (cs *Store) AddArch(s store.ReadOnly, arch string) {
+	// Stores may have been added directly to the Stores slice,
+	// so make sure the architectures line up with them.
+	for len(cs.arches) < len(cs.Stores) {
+		cs.arches = append(cs.arches, "")
+	}
 	cs.Stores = append(cs.Stores, s)
+	cs.arches = append(cs.arches, arch)
+}
+
+// AddNamed adds a new store with the given name to the combined store. The Source
+// of each of its search results is prefixed with the name and a slash, so that
+// results can be told apart when the combined store contains other combined stores
+// whose indices have the same names, such as the repos in a repo group.
+func (cs *Store) AddNamed(s store.ReadOnly, name string) {
+	cs.AddArch(s, "")
+	for len(cs.names) < len(cs.Stores)-1 {
+		cs.names = append(cs.names, "")
+	}
+	cs.names = append(cs.names, name)
+}
+
+// storeName returns the name of the store at index i
+func (cs *Store) storeName(i int) string {
+	if i < len(cs.names) {
+		return cs.names[i]
+	}
+	return ""
+}
+
+// withSource returns res with its Source prefixed by the name of the store
+// at index i, if it has one. See [Store.AddNamed].
+func (cs *Store) withSource(i int, res store.TagResult) store.TagResult {
+	if name := cs.storeName(i); name != "" {
+		res.Source = strings.Trim(name+"/"+res.Source, "/")
+	}
+	return res
+}
+
+// storeArch returns the architecture of the store at index i
+func (cs *Store) storeArch(i int) string {
+	if i < len(cs.arches) {
+		return cs.arches[i]
+	}
+	return ""
 }
 
-// GetPkg retrieves a package by name from any of the stores in the combined store.
-// If the package is not found in any store, it returns [github.com/cockroachdb/pebble.ErrNotFound].
+// GetPkg retrieves a package by name from the stores in the combined store. If more
+// than one store contains the package, the one that comes first in [Store.Stores] is
+// used, unless [Store.MergePackages] is set, in which case the tags from every store
+// that contains the package are merged together. If the package is not found in any
+// store, it returns [ErrNotFound].
 func (cs *Store) GetPkg(name string) (out store.Package, err error) {
-	mtx := &sync.Mutex{}
+	// Each goroutine writes to its own index, so the
+	// results can be processed in a consistent order.
+	pkgs := make([]*store.Package, len(cs.Stores))
 	wg := &errgroup.Group{}
-	for _, s := range cs.Stores {
+	for i, s := range cs.Stores {
 		wg.Go(func() error {
+			// Stores that are themselves combined stores, such as
+			// the repos in a group, return ErrNotFound instead.
 			if pkg, err := s.GetPkg(name); err == nil {
-				mtx.Lock()
-				out = pkg
-				mtx.Unlock()
-			} else if !errors.Is(err, pebble.ErrNotFound) {
+				pkgs[i] = &pkg
+			} else if !errors.Is(err, pebble.ErrNotFound) && !errors.Is(err, ErrNotFound) {
 				return err
 			}
 			return nil
@@ -73,11 +162,33 @@ func (cs *Store) GetPkg(name string) (out store.Package, err error) {
 	}
 	if err := wg.Wait(); err != nil {
 		return out, err
-	} else if out.Name == "" {
+	}
+
+	for _, pkg := range pkgs {
+		if pkg == nil {
+			continue
+		} else if !cs.MergePackages {
+			return *pkg, nil
+		}
+		if out.Name == "" {
+			out.Arch = pkg.Arch
+		} else if out.Arch != pkg.Arch {
+			// The merged package doesn't have a single architecture
+			out.Arch = ""
+		}
+		out.Name = pkg.Name
+		out.Tags = append(out.Tags, pkg.Tags...)
+		// The description is taken from the first store that has one
+		out.Description = cmp.Or(out.Description, pkg.Description)
+	}
+
+	if out.Name == "" {
 		return out, fmt.Errorf("%w: %q", ErrNotFound, name)
-	} else {
-		return out, nil
 	}
+
+	slices.Sort(out.Tags)
+	out.Tags = slices.Compact(out.Tags)
+	return out, nil
 }
 
 // GetPkgNamesByPrefix retrieves package names that match the given prefix from all stores.
@@ -107,17 +218,90 @@ func (cs *Store) GetPkgNamesByPrefix(prefix string, n int) (out []string, err er
 	return out, nil
 }
 
+// ListPkgNames calls fn with the name of every package in any of the stores, in sorted
+// order. Packages that are in multiple stores are only listed once. If any of the stores
+// don't implement [go.elara.ws/distrohop/internal/store.Lister],
+// [go.elara.ws/distrohop/internal/store.ErrListUnsupported] is returned.
+func (cs *Store) ListPkgNames(ctx context.Context, fn func(name string) error) error {
+	var names []string
+	for _, s := range cs.Stores {
+		lister, ok := s.(store.Lister)
+		if !ok {
+			return store.ErrListUnsupported
+		}
+		err := lister.ListPkgNames(ctx, func(name string) error {
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Search searches for packages across all stores based on the provided tags.
 // It returns a slice of search results and an error.
 func (cs *Store) Search(tags []string) (out []store.TagResult, latency time.Duration, err error) {
+	return cs.SearchOpts(tags, store.SearchOptions{})
+}
+
+// SearchOpts searches for packages across all the stores using the given options.
+// If opts.Arches is set, stores added with a different architecture are skipped, and the rest
+// filter their packages by architecture if they support it. In [go.elara.ws/distrohop/internal/store.ModeAll],
+// stores that don't implement [go.elara.ws/distrohop/internal/store.OptionSearcher] are searched
+// normally, and only their results with a confidence of 1 are kept. Confidence normalization
+// is skipped in that mode, since every result has the same confidence. Empty stores are skipped,
+// and if all the searched stores are empty, [go.elara.ws/distrohop/internal/store.ErrEmpty] is returned.
+// If any of the stores time out, the results from all of them are returned along with
+// [go.elara.ws/distrohop/internal/store.ErrPartial].
+func (cs *Store) SearchOpts(tags []string, opts store.SearchOptions) (out []store.TagResult, latency time.Duration, err error) {
+	var factors []float64
+	if cs.Normalize && opts.Mode == store.ModeAny {
+		factors = cs.normFactors()
+	}
+
+	var empty atomic.Int32
+	var partial atomic.Bool
+	searched := 0
 	mtx := &sync.Mutex{}
 	wg := &errgroup.Group{}
-	for _, s := range cs.Stores {
+	for i, s := range cs.Stores {
+		if arch := cs.storeArch(i); arch != "" && len(opts.Arches) != 0 && !slices.Contains(opts.Arches, arch) {
+			continue
+		}
+		searched++
 		wg.Go(func() error {
-			results, dur, err := s.Search(tags)
-			if err != nil {
+			results, dur, err := searchOpts(s, tags, opts)
+			if errors.Is(err, store.ErrEmpty) {
+				empty.Add(1)
+				return nil
+			} else if errors.Is(err, store.ErrPartial) {
+				partial.Store(true)
+			} else if err != nil {
 				return err
 			}
+			if (factors != nil && factors[i] != 1) || cs.storeName(i) != "" {
+				// The results may be shared with a cache,
+				// so we need to copy them before modifying them.
+				results = slices.Clone(results)
+				for j := range results {
+					results[j] = cs.withSource(i, results[j])
+					if factors != nil {
+						results[j].Confidence = min(1, float32(float64(results[j].Confidence)*factors[i]))
+					}
+				}
+			}
 			mtx.Lock()
 			latency += dur
 			out = append(out, results...)
@@ -127,8 +311,124 @@ func (cs *Store) Search(tags []string) (out []store.TagResult, latency time.Dura
 	}
 	if err := wg.Wait(); err != nil {
 		return nil, latency, err
+	} else if searched != 0 && int(empty.Load()) == searched {
+		return nil, latency, store.ErrEmpty
 	} else {
 		store.SortResults(out)
+		if partial.Load() {
+			return out, latency, store.ErrPartial
+		}
 		return out, latency, nil
 	}
 }
+
+// searchOpts searches s using opts if it implements [go.elara.ws/distrohop/internal/store.OptionSearcher].
+// Otherwise, it falls back to a regular search, filtering the results if necessary.
+func searchOpts(s store.ReadOnly, tags []string, opts store.SearchOptions) ([]store.TagResult, time.Duration, error) {
+	if searcher, ok := s.(store.OptionSearcher); ok {
+		return searcher.SearchOpts(tags, opts)
+	}
+
+	results, dur, err := s.Search(tags)
+	if err != nil || opts.Mode == store.ModeAny {
+		return results, dur, err
+	}
+
+	var out []store.TagResult
+	for _, res := range results {
+		if res.Confidence == 1 {
+			out = append(out, res)
+		}
+	}
+	return out, dur, nil
+}
+
+// SearchStream streams search results from all the stores as they're found.
+// Stores that don't implement [go.elara.ws/distrohop/internal/store.Streamer]
+// are searched normally, and their results are streamed once the search completes.
+// Calls to fn are never concurrent. Like [Store.SearchOpts], it skips empty stores and
+// returns [go.elara.ws/distrohop/internal/store.ErrEmpty] if all of them are empty.
+func (cs *Store) SearchStream(ctx context.Context, tags []string, fn func(store.TagResult) error) error {
+	var empty atomic.Int32
+	mtx := &sync.Mutex{}
+	emit := func(res store.TagResult) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return fn(res)
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	for i, s := range cs.Stores {
+		wg.Go(func() error {
+			err := searchStream(ctx, s, tags, func(res store.TagResult) error {
+				return emit(cs.withSource(i, res))
+			})
+			if errors.Is(err, store.ErrEmpty) {
+				empty.Add(1)
+				return nil
+			}
+			return err
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return err
+	} else if len(cs.Stores) != 0 && int(empty.Load()) == len(cs.Stores) {
+		return store.ErrEmpty
+	}
+	return nil
+}
+
+// searchStream streams the results from s using [go.elara.ws/distrohop/internal/store.Streamer]
+// if it's implemented. Otherwise, it searches s normally and streams all the results at once.
+func searchStream(ctx context.Context, s store.ReadOnly, tags []string, fn func(store.TagResult) error) error {
+	if streamer, ok := s.(store.Streamer); ok {
+		return streamer.SearchStream(ctx, tags, fn)
+	}
+
+	results, _, err := s.Search(tags)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normFactors calculates the confidence normalization factor for each store.
+// See [Store.Normalize] for details.
+func (cs *Store) normFactors() []float64 {
+	factors := make([]float64, len(cs.Stores))
+	avgs := make([]float64, len(cs.Stores))
+
+	var sum float64
+	var n int
+	for i, s := range cs.Stores {
+		factors[i] = 1
+		mp, ok := s.(store.MetaProvider)
+		if !ok {
+			continue
+		}
+		meta, err := mp.GetMeta()
+		if err != nil || meta.PackageCount == 0 || meta.TagCount == 0 {
+			continue
+		}
+		avgs[i] = float64(meta.TagCount) / float64(meta.PackageCount)
+		sum += avgs[i]
+		n++
+	}
+
+	if n == 0 {
+		return factors
+	}
+
+	mean := sum / float64(n)
+	for i, avg := range avgs {
+		if avg != 0 {
+			factors[i] = math.Sqrt(mean / avg)
+		}
+	}
+	return factors
+}
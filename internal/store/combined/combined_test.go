@@ -0,0 +1,385 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package combined
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+// fakeStore wraps a mem store, adding a fixed latency to each
+// search and failing every request if err is set. It only
+// implements [store.ReadOnly], so the fallback paths are used.
+type fakeStore struct {
+	ms      *mem.Store
+	latency time.Duration
+	err     error
+}
+
+func (fs fakeStore) GetPkg(name string) (store.Package, error) {
+	if fs.err != nil {
+		return store.Package{}, fs.err
+	}
+	return fs.ms.GetPkg(name)
+}
+
+func (fs fakeStore) GetPkgNamesByPrefix(prefix string, n int) ([]string, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	return fs.ms.GetPkgNamesByPrefix(prefix, n)
+}
+
+func (fs fakeStore) Search(tags []string) ([]store.TagResult, time.Duration, error) {
+	if fs.err != nil {
+		return nil, fs.latency, fs.err
+	}
+	results, _, err := fs.ms.Search(tags)
+	return results, fs.latency, err
+}
+
+// slowStore wraps a store, delaying every package lookup
+type slowStore struct {
+	store.ReadOnly
+	delay time.Duration
+}
+
+func (ss slowStore) GetPkg(name string) (store.Package, error) {
+	time.Sleep(ss.delay)
+	return ss.ReadOnly.GetPkg(name)
+}
+
+func newMem(name string, pkgs map[string][]string) *mem.Store {
+	ms := mem.New()
+	ms.Name = name
+	for pkg, tags := range pkgs {
+		ms.Add(pkg, tags...)
+	}
+	return ms
+}
+
+func TestSearch(t *testing.T) {
+	errFailed := errors.New("failed")
+	main := newMem("main", map[string][]string{"vim": {"bin=vim", "bin=vimdiff"}})
+	extra := newMem("extra", map[string][]string{"neovim": {"bin=nvim", "bin=vim"}})
+
+	tests := []struct {
+		name        string
+		stores      []store.ReadOnly
+		want        []string
+		wantLatency time.Duration
+		wantErr     error
+	}{
+		{
+			name:        "latency is summed",
+			stores:      []store.ReadOnly{fakeStore{main, time.Second, nil}, fakeStore{extra, 2 * time.Second, nil}},
+			want:        []string{"main:vim", "extra:neovim"},
+			wantLatency: 3 * time.Second,
+		},
+		{
+			name:        "empty stores are skipped",
+			stores:      []store.ReadOnly{fakeStore{main, time.Second, nil}, mem.New()},
+			want:        []string{"main:vim"},
+			wantLatency: time.Second,
+		},
+		{
+			name:    "all empty",
+			stores:  []store.ReadOnly{mem.New(), mem.New()},
+			wantErr: store.ErrEmpty,
+		},
+		{
+			name:    "error",
+			stores:  []store.ReadOnly{fakeStore{main, 0, nil}, fakeStore{extra, 0, errFailed}},
+			wantErr: errFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := New(tt.stores...)
+			results, latency, err := cs.Search([]string{"bin=vim", "bin=vimdiff"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Source+":"+res.Package.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if err == nil && latency != tt.wantLatency {
+				t.Errorf("got latency %s, want %s", latency, tt.wantLatency)
+			}
+		})
+	}
+}
+
+func TestGetPkg(t *testing.T) {
+	errFailed := errors.New("failed")
+	main := newMem("main", map[string][]string{"vim": {"bin=vim"}})
+	extra := newMem("extra", map[string][]string{"vim": {"bin=vimdiff"}, "neovim": {"bin=nvim"}})
+
+	tests := []struct {
+		name     string
+		pkg      string
+		stores   []store.ReadOnly
+		merge    bool
+		wantTags []string
+		wantErr  error
+	}{
+		{"first store wins", "vim", []store.ReadOnly{main, extra}, false, []string{"bin=vim"}, nil},
+		{"merged", "vim", []store.ReadOnly{main, extra}, true, []string{"bin=vim", "bin=vimdiff"}, nil},
+		{"second store", "neovim", []store.ReadOnly{main, extra}, false, []string{"bin=nvim"}, nil},
+		{"not found", "emacs", []store.ReadOnly{main, extra}, false, nil, ErrNotFound},
+		{"error", "vim", []store.ReadOnly{main, fakeStore{extra, 0, errFailed}}, false, nil, errFailed},
+		{"nested", "neovim", []store.ReadOnly{New(main), New(extra)}, false, []string{"bin=nvim"}, nil},
+		{"nested merged", "vim", []store.ReadOnly{New(main), New(mem.New()), New(extra)}, true, []string{"bin=vim", "bin=vimdiff"}, nil},
+		{"nested not found", "emacs", []store.ReadOnly{New(main), New(extra)}, false, nil, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := New(tt.stores...)
+			cs.MergePackages = tt.merge
+			pkg, err := cs.GetPkg(tt.pkg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(pkg.Tags, tt.wantTags) {
+				t.Errorf("got tags %q, want %q", pkg.Tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestSearchDeterministic(t *testing.T) {
+	// Every store has packages with the same names and confidences, so
+	// the order only depends on the tiebreakers, not on which store's
+	// search happens to finish first.
+	pkgs := map[string][]string{
+		"vim": {"bin=vi", "bin=vim"},
+		"nvi": {"bin=vi", "bin=nvi"},
+	}
+	var stores []store.ReadOnly
+	for _, name := range []string{"extra", "main", "community", "core"} {
+		stores = append(stores, newMem(name, pkgs))
+	}
+	cs := New(stores...)
+
+	want := []string{
+		"community:nvi", "core:nvi", "extra:nvi", "main:nvi",
+		"community:vim", "core:vim", "extra:vim", "main:vim",
+	}
+	for i := range 100 {
+		results, _, err := cs.Search([]string{"bin=vi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, res := range results {
+			got = append(got, res.Source+":"+res.Package.Name)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("search %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSearchArches(t *testing.T) {
+	vim := map[string][]string{"vim": {"bin=vim"}}
+	// The extra store's architecture isn't known, so it's always searched,
+	// but it filters its packages using their own architectures.
+	extra := newMem("extra", map[string][]string{"vim-gtk3": {"bin=vim"}, "vim-common": {"bin=vim"}})
+	extra.SetArch("vim-gtk3", "amd64")
+
+	cs := New()
+	cs.AddArch(newMem("main/amd64", vim), "amd64")
+	cs.AddArch(newMem("main/arm64", vim), "arm64")
+	cs.Add(extra)
+
+	tests := []struct {
+		name   string
+		arches []string
+		want   []string
+	}{
+		{"no filter", nil, []string{"main/amd64:vim", "main/arm64:vim", "extra:vim-common", "extra:vim-gtk3"}},
+		{"amd64", []string{"amd64"}, []string{"main/amd64:vim", "extra:vim-common", "extra:vim-gtk3"}},
+		{"arm64", []string{"arm64"}, []string{"main/arm64:vim", "extra:vim-common"}},
+		{"both", []string{"amd64", "arm64"}, []string{"main/amd64:vim", "main/arm64:vim", "extra:vim-common", "extra:vim-gtk3"}},
+		{"unknown", []string{"riscv64"}, []string{"extra:vim-common"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := cs.SearchOpts([]string{"bin=vim"}, store.SearchOptions{Arches: tt.arches})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Source+":"+res.Package.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// metaStore wraps a mem store, reporting the given counts as its metadata
+type metaStore struct {
+	*mem.Store
+	counts store.Counts
+}
+
+func (ms metaStore) GetMeta() (store.RepoMeta, error) {
+	return store.RepoMeta{Counts: ms.counts}, nil
+}
+
+func TestSearchNormalize(t *testing.T) {
+	// The dense store's packages have 10 tags on average, so its results
+	// are more likely to overlap with any search than the sparse store's.
+	dense := metaStore{
+		newMem("dense", map[string][]string{"vim": {"bin=vim", "bin=ex"}}),
+		store.Counts{PackageCount: 100, TagCount: 1000},
+	}
+	sparse := metaStore{
+		newMem("sparse", map[string][]string{"nvi": {"bin=vi"}}),
+		store.Counts{PackageCount: 100, TagCount: 100},
+	}
+
+	tests := []struct {
+		name      string
+		normalize bool
+		want      []string
+	}{
+		{"raw", false, []string{"dense:vim", "sparse:nvi"}},
+		{"normalized", true, []string{"sparse:nvi", "dense:vim"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := New(dense, sparse)
+			cs.Normalize = tt.normalize
+			results, _, err := cs.Search([]string{"bin=vim", "bin=vi", "bin=ex"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Source+":"+res.Package.Name)
+				if res.Confidence > 1 {
+					t.Errorf("%s: confidence %v is greater than 1", res.Package.Name, res.Confidence)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPkgMerge(t *testing.T) {
+	main := newMem("main", map[string][]string{"vim": {"bin=vim", "man=vim.1"}, "nano": {"bin=nano"}})
+	main.SetArch("vim", "amd64")
+	main.SetArch("nano", "amd64")
+	updates := newMem("updates", map[string][]string{"vim": {"bin=vim", "bin=vimdiff"}})
+	updates.SetArch("vim", "amd64")
+	updates.SetDescription("vim", "Vi IMproved")
+	backports := newMem("backports", map[string][]string{"vim": {"file=/usr/share/vim/vim91/defaults.vim"}, "nano": {"man=nano.1"}})
+	backports.SetArch("nano", "arm64")
+
+	cs := New(main, updates, backports)
+	cs.MergePackages = true
+
+	tests := []struct {
+		name     string
+		wantTags []string
+		wantArch string
+		wantDesc string
+	}{
+		// Each store contributes its own tags, and the
+		// ones that more than one store has are deduplicated.
+		{
+			name:     "vim",
+			wantTags: []string{"bin=vim", "bin=vimdiff", "file=/usr/share/vim/vim91/defaults.vim", "man=vim.1"},
+			wantArch: "",
+			wantDesc: "Vi IMproved",
+		},
+		{
+			name:     "nano",
+			wantTags: []string{"bin=nano", "man=nano.1"},
+			wantArch: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg, err := cs.GetPkg(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(pkg.Tags, tt.wantTags) {
+				t.Errorf("got tags %q, want %q", pkg.Tags, tt.wantTags)
+			}
+			if pkg.Arch != tt.wantArch {
+				t.Errorf("got arch %q, want %q", pkg.Arch, tt.wantArch)
+			}
+			if pkg.Description != tt.wantDesc {
+				t.Errorf("got description %q, want %q", pkg.Description, tt.wantDesc)
+			}
+		})
+	}
+
+	// Packages with the same architecture in every store keep it
+	cs = New(main, updates)
+	cs.MergePackages = true
+	pkg, err := cs.GetPkg("vim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Arch != "amd64" {
+		t.Errorf("got arch %q, want amd64", pkg.Arch)
+	}
+}
+
+func TestGetPkgDeterministic(t *testing.T) {
+	// The first store is the slowest, so its lookup finishes
+	// last, but its package should still always be returned.
+	stores := []store.ReadOnly{
+		slowStore{newMem("main", map[string][]string{"vim": {"bin=vim"}}), 5 * time.Millisecond},
+		slowStore{newMem("updates", map[string][]string{"vim": {"bin=vimdiff"}}), time.Millisecond},
+		newMem("backports", map[string][]string{"vim": {"bin=vimtutor"}}),
+	}
+	cs := New(stores...)
+
+	for i := range 20 {
+		pkg, err := cs.GetPkg("vim")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"bin=vim"}; !slices.Equal(pkg.Tags, want) {
+			t.Fatalf("lookup %d: got tags %q from the wrong store, want %q", i, pkg.Tags, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/pebble"
+)
+
+// bloomFilter is a decoded bloom filter that can be looked up concurrently
+// without locking. [sbloom.Filter] shares one hash function between all of
+// its lookups, so it can't be. bloomFilter reads the same encoding, but hashes
+// each lookup with its own xxhash digest, which is the hash function the
+// store's filters are created with. It's never modified after it's decoded.
+type bloomFilter struct {
+	seeds   [][]byte
+	filters []*bloomSubfilter
+}
+
+// bloomSubfilter is one of the fixed-size filters that make up a scalable
+// bloom filter. Its fields match the gob encoding used by sbloom.
+type bloomSubfilter struct {
+	Log  uint
+	K    int
+	Bins [][]uint8
+	Left uint64
+}
+
+// gobBloomFilter matches the gob encoding of [sbloom.Filter]
+type gobBloomFilter struct {
+	Hash    any
+	Seeds   [][]byte
+	Filters []*bloomSubfilter
+}
+
+// decodeFilter decodes a bloom filter encoded by [sbloom.Filter.GobEncode]
+func decodeFilter(data []byte) (*bloomFilter, error) {
+	var gf gobBloomFilter
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&gf); err != nil {
+		return nil, err
+	}
+
+	if _, ok := gf.Hash.(*xxhash.Digest); !ok {
+		return nil, fmt.Errorf("unsupported hash function %T", gf.Hash)
+	}
+
+	// Make sure lookups can't index past the end of the
+	// seeds or bins if the filter was encoded incorrectly.
+	for _, sub := range gf.Filters {
+		if sub == nil || sub.Log < 3 || sub.Log > 63 || sub.K > len(gf.Seeds) || sub.K > len(sub.Bins) {
+			return nil, errors.New("invalid filter parameters")
+		}
+		for _, bin := range sub.Bins[:sub.K] {
+			if uint64(len(bin)) != 1<<sub.Log>>3 {
+				return nil, errors.New("invalid filter size")
+			}
+		}
+	}
+
+	return &bloomFilter{seeds: gf.Seeds, filters: gf.Filters}, nil
+}
+
+// lookup checks whether the filter may contain the given value
+func (bf *bloomFilter) lookup(value []byte) bool {
+	for _, sub := range bf.filters {
+		if sub.lookup(value, bf.seeds[:sub.K]) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup checks whether the subfilter may contain the given value,
+// using the same hashing as sbloom.
+func (sf *bloomSubfilter) lookup(value []byte, seeds [][]byte) bool {
+	var d xxhash.Digest
+	for i, seed := range seeds {
+		d.Reset()
+		d.Write(seed)
+		d.Write(value)
+		n := mixHash(d.Sum64(), sf.Log)
+		if sf.Bins[i][n>>3]&(1<<(n&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mixHash folds a hash value into log bits
+func mixHash(val uint64, log uint) (out uint64) {
+	mask := uint64(1)<<log - 1
+	for val > 0 {
+		out ^= val & mask
+		val >>= log
+	}
+	return out
+}
+
+// filterEntry is a decoded bloom filter cached in memory, along with the error
+// that occurred while loading it, so that missing and corrupted filters don't
+// have to be loaded again either. Each entry is loaded once, the first time
+// it's needed, and isn't modified afterwards.
+type filterEntry struct {
+	once   sync.Once
+	filter *bloomFilter
+	err    error
+}
+
+// lookup checks whether the filter may contain the given value
+func (fe *filterEntry) lookup(value []byte) bool {
+	return fe.filter.lookup(value)
+}
+
+// filterCache caches the decoded bloom filters of a database. Each
+// database has its own cache, so replacing a store's database also
+// discards the filters of the old one.
+type filterCache struct {
+	entries [256]atomic.Pointer[filterEntry]
+}
+
+// invalidate removes the cached filter for the given first package name
+// character. It has to be called after the filter is changed in the
+// database, so that a filter loaded concurrently isn't kept in the cache.
+func (fc *filterCache) invalidate(firstChar byte) {
+	fc.entries[firstChar].Store(nil)
+}
+
+// filter returns the bloom filter for the given first package name character,
+// loading it from the database if it isn't cached yet.
+func (r *dbRef) filter(firstChar byte) *filterEntry {
+	slot := &r.filters.entries[firstChar]
+	fe := slot.Load()
+	for fe == nil {
+		newEntry := &filterEntry{}
+		if slot.CompareAndSwap(nil, newEntry) {
+			fe = newEntry
+		} else {
+			fe = slot.Load()
+		}
+	}
+
+	fe.once.Do(func() {
+		fe.filter, fe.err = readFilter(r.DB, firstChar)
+		// Other errors may be temporary, so the filter is loaded
+		// again the next time it's needed.
+		if fe.err != nil && !errors.Is(fe.err, pebble.ErrNotFound) && !errors.Is(fe.err, ErrCorruptFilter) {
+			slot.CompareAndSwap(fe, nil)
+		}
+	})
+	return fe
+}
+
+// readFilter reads and decodes the bloom filter for the given
+// first package name character from db.
+func readFilter(db *pebble.DB, firstChar byte) (*bloomFilter, error) {
+	data, cl, err := db.Get([]byte{0x02, firstChar})
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	filter, err := decodeFilter(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptFilter, err)
+	}
+
+	return filter, nil
+}
+
+// cachedFilter returns the cached bloom filter for the given
+// first package name character from the store's current database.
+func (s *Store) cachedFilter(firstChar byte) (*filterEntry, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer db.release()
+	return db.filter(firstChar), nil
+}
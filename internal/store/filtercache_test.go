@@ -0,0 +1,260 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/sbloom"
+)
+
+func TestDecodeFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		size int
+		tags int
+	}{
+		{"empty", 0, 0},
+		{"sized", 1000, 1000},
+		// An unsized filter has to grow, so it contains several subfilters
+		{"grown", 0, 20_000},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFilter(tt.size)
+			for i := range tt.tags {
+				f.Add([]byte(fmt.Sprintf("file=/usr/bin/%d", i)))
+			}
+			data, err := f.GobEncode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bf, err := decodeFilter(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range tt.tags {
+				value := []byte(fmt.Sprintf("file=/usr/bin/%d", i))
+				if !bf.lookup(value) {
+					t.Fatalf("added value %q not found", value)
+				}
+			}
+			// Values that weren't added have to give the same
+			// false positives as sbloom's own lookup.
+			for i := range 10_000 {
+				value := []byte(fmt.Sprintf("bin=missing%d", i))
+				if got, want := bf.lookup(value), f.Lookup(value); got != want {
+					t.Fatalf("lookup(%q) = %t, want %t", value, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFilterMatchesSbloom(t *testing.T) {
+	// A small filter that's filled far past its capacity has a high
+	// false positive rate, so the lookups of keys that weren't added
+	// disagree with each other if the hashing differs in any way.
+	f := sbloom.NewSizedFilter(xxhash.New(), filterK, minFilterLog)
+	for i := range 5000 {
+		f.Add([]byte(fmt.Sprintf("lib=lib%d.so", i)))
+	}
+	data, err := f.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bf, err := decodeFilter(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reference filter is decoded from the same data,
+	// so that both lookups use the encoded filter.
+	ref := &sbloom.Filter{}
+	if err := ref.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+
+	positives := 0
+	for i := range 100_000 {
+		var value []byte
+		if i%2 == 0 {
+			value = []byte(fmt.Sprintf("lib=lib%d.so", i/2))
+		} else {
+			value = []byte(fmt.Sprintf("bin=missing%d", i))
+		}
+		got, want := bf.lookup(value), ref.Lookup(value)
+		if got != want {
+			t.Fatalf("lookup(%q) = %t, want %t", value, got, want)
+		}
+		if got && i%2 == 1 {
+			positives++
+		}
+	}
+	if positives == 0 {
+		t.Error("expected some false positives, so that they're compared too")
+	}
+}
+
+func TestDecodeFilterInvalid(t *testing.T) {
+	valid, err := newFilter(0).GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnvFilter, err := sbloom.NewFilter(fnv.New64(), filterK).GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"garbage", []byte("not a bloom filter")},
+		{"truncated", valid[:len(valid)/2]},
+		{"unsupported hash", fnvFilter},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeFilter(tt.data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestFilterCacheInvalidate(t *testing.T) {
+	s := newTestStore(t, map[string][]string{"abc": {"bin=abc"}})
+
+	fe, err := s.cachedFilter('a')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.err != nil || !fe.lookup([]byte("bin=abc")) {
+		t.Fatalf("unexpected filter state: %v", fe.err)
+	}
+
+	f := newFilter(0)
+	f.Add([]byte("bin=xyz"))
+	if err := s.WriteFilters(map[byte]*sbloom.Filter{'a': f}); err != nil {
+		t.Fatal(err)
+	}
+
+	fe, err = s.cachedFilter('a')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.err != nil || !fe.lookup([]byte("bin=xyz")) {
+		t.Fatal("cached filter wasn't replaced after writing a new one")
+	}
+}
+
+// BenchmarkFilterLookup compares looking up tags in cached bloom
+// filters with decoding the filter again for every request.
+func BenchmarkFilterLookup(b *testing.B) {
+	pkgs := map[string][]string{}
+	for i := range 5000 {
+		name := fmt.Sprintf("pkg%d", i)
+		pkgs[name] = []string{"bin=" + name, "file=/usr/bin/" + name}
+	}
+	s := newTestStore(b, pkgs)
+	tag := []byte("bin=pkg1234")
+
+	b.Run("cached", func(b *testing.B) {
+		for range b.N {
+			fe, err := s.cachedFilter('p')
+			if err != nil || !fe.lookup(tag) {
+				b.Fatal("tag not found", err)
+			}
+		}
+	})
+
+	b.Run("cached-parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				fe, err := s.cachedFilter('p')
+				if err != nil || !fe.lookup(tag) {
+					b.Error("tag not found", err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("decode-per-request", func(b *testing.B) {
+		for range b.N {
+			f, err := s.GetFilter('p')
+			if err != nil || !f.Lookup(tag) {
+				b.Fatal("tag not found", err)
+			}
+		}
+	})
+}
+
+func TestSearchCorruptFilter(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"vim":      {"bin=vim", "bin=vimdiff"},
+		"vim-tiny": {"bin=vim"},
+		"nano":     {"bin=nano"},
+	})
+	logs := &strings.Builder{}
+	s.Logger = slog.New(slog.NewTextHandler(logs, nil))
+
+	// Overwrite the filter for "v" with garbage
+	db, err := s.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Set([]byte{0x02, 'v'}, []byte("not a bloom filter"), nil)
+	db.filters.invalidate('v')
+	db.release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := s.Search([]string{"bin=vim"})
+	if err != nil {
+		t.Fatalf("expected the search to succeed despite the corrupt filter, got %v", err)
+	}
+	if got, want := resultNames(results), []string{"vim", "vim-tiny"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !strings.Contains(logs.String(), "Scanning chunk without its bloom filter") {
+		t.Errorf("expected a warning about the corrupt filter, got logs %q", logs)
+	}
+
+	// Other chunks still use their filters
+	results, _, err = s.Search([]string{"bin=nano"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultNames(results), []string{"nano"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
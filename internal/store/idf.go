@@ -0,0 +1,96 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"math"
+	"slices"
+
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+// WeightIDF returns a copy of results with their confidence scores recalculated so
+// that each search tag is weighted by its inverse document frequency (IDF) in addition
+// to its regular weight. This makes rare tags count more than tags that almost every
+// package has. total is the amount of packages in the store that was searched.
+//
+// The document frequency of each search tag is the amount of results that contain it.
+// In [ModeAny], every package that contains at least one of the search tags is a result,
+// so this is the same as the amount of packages in the store that contain the tag.
+// Search tags that only matched related tags of another type count with their
+// weight reduced by [tags.CrossTypeWeight], but not towards document frequencies.
+// The results are sorted again after their confidence scores are updated.
+func WeightIDF(results []TagResult, searchTags []string, total int) []TagResult {
+	freqs := make([]int, len(searchTags))
+	for _, res := range results {
+		for i, stag := range searchTags {
+			if overlapContains(res.Overlap, stag) {
+				freqs[i]++
+			}
+		}
+	}
+
+	weights := make([]float32, len(searchTags))
+	var searchWeight float32
+	for i, stag := range searchTags {
+		weights[i] = tagWeight(stag) * idf(freqs[i], total)
+		searchWeight += weights[i]
+	}
+
+	out := slices.Clone(results)
+	if searchWeight == 0 {
+		return out
+	}
+	for i, res := range out {
+		var overlapWeight float32
+		for j, stag := range searchTags {
+			if overlapContains(res.Overlap, stag) {
+				overlapWeight += weights[j]
+			} else if crossTypeContains(res.CrossType, stag) {
+				overlapWeight += weights[j] * tags.CrossTypeWeight
+			}
+		}
+		out[i].Confidence = min(1, overlapWeight/searchWeight)
+	}
+	SortResults(out)
+	return out
+}
+
+// idf calculates the smoothed inverse document frequency of a tag that's
+// contained in freq out of total packages. It's always at least 1, so
+// tags that every package has still count towards confidence scores.
+func idf(freq, total int) float32 {
+	return float32(math.Log(float64(total+1)/float64(freq+1))) + 1
+}
+
+// overlapContains checks whether the search tag stag is in the overlap list of a
+// search result. The overlap list contains package tags for glob search
+// tags, so they have to be matched against it again.
+func overlapContains(overlap []string, stag string) bool {
+	if slices.Contains(overlap, stag) {
+		return true
+	}
+	return isGlob(stag) && slices.ContainsFunc(overlap, func(tag string) bool {
+		return matchGlob(stag, tag)
+	})
+}
@@ -0,0 +1,88 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchIDF(t *testing.T) {
+	// Almost every package links to libc, but only one
+	// other package has the rare executable.
+	pkgs := map[string][]string{
+		"alpha": {"lib=libc.so.6"},
+		"omega": {"bin=rare"},
+	}
+	for i := range 20 {
+		pkgs[fmt.Sprintf("filler%02d", i)] = []string{"lib=libc.so.6", fmt.Sprintf("bin=filler%02d", i)}
+	}
+	s := newTestStore(t, pkgs)
+	searchTags := []string{"lib=libc.so.6", "bin=rare"}
+
+	results, _, err := s.SearchOpts(searchTags, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without IDF, both tags count the same, so every result
+	// is tied, and omega is sorted after the others by name.
+	names := resultNames(results)
+	if names[0] != "alpha" || names[len(names)-1] != "omega" {
+		t.Errorf("expected the results to be sorted by name without IDF, got %v", names)
+	}
+	for _, res := range results {
+		if res.Confidence != 0.5 {
+			t.Errorf("expected %s to have a confidence of 0.5 without IDF, got %v", res.Package.Name, res.Confidence)
+		}
+	}
+
+	idfResults, _, err := s.SearchOpts(searchTags, SearchOptions{IDF: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idfResults) != len(results) {
+		t.Fatalf("expected IDF not to change the results, got %d instead of %d", len(idfResults), len(results))
+	}
+	// With IDF, the rare tag counts more, so omega comes first
+	if idfResults[0].Package.Name != "omega" {
+		t.Errorf("expected omega to rank first with IDF, got %v", resultNames(idfResults))
+	}
+	confidences := map[string]float32{}
+	for _, res := range idfResults {
+		confidences[res.Package.Name] = res.Confidence
+	}
+	if confidences["omega"] <= 0.5 || confidences["alpha"] >= 0.5 {
+		t.Errorf("expected the rare tag to outweigh the common one, got omega %v and alpha %v", confidences["omega"], confidences["alpha"])
+	}
+	if confidences["alpha"] != confidences["filler00"] {
+		t.Errorf("expected packages with the same tags to have the same confidence, got %v and %v", confidences["alpha"], confidences["filler00"])
+	}
+}
+
+func TestIDF(t *testing.T) {
+	if got := idf(10, 10); got != 1 {
+		t.Errorf("expected a tag that every package has to have an IDF of 1, got %v", got)
+	}
+	if idf(1, 100) <= idf(50, 100) {
+		t.Error("expected rare tags to have a higher IDF than common ones")
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mem
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+var (
+	_ store.ReadOnly       = (*Store)(nil)
+	_ store.OptionSearcher = (*Store)(nil)
+	_ store.Streamer       = (*Store)(nil)
+	_ store.Lister         = (*Store)(nil)
+)
+
+// Store represents an in-memory package store. It's useful for testing
+// and for very small datasets that don't need persistent storage.
+// It implements [go.elara.ws/distrohop/internal/store.ReadOnly].
+type Store struct {
+	mtx    sync.RWMutex
+	pkgs   map[string][]string
+	arches map[string]string
+	descs  map[string]string
+
+	// Name identifies the store. It's set as the source of all search results.
+	Name string
+}
+
+// New creates a new empty in-memory store
+func New() *Store {
+	return &Store{pkgs: map[string][]string{}, arches: map[string]string{}, descs: map[string]string{}}
+}
+
+// Add adds a package with the given tags to the store. If the package
+// already exists, the new tags are merged with its existing ones.
+func (ms *Store) Add(name string, tags ...string) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	tags = append(ms.pkgs[name], tags...)
+	slices.Sort(tags)
+	ms.pkgs[name] = slices.Compact(tags)
+}
+
+// SetArch sets the architecture of the given package
+func (ms *Store) SetArch(name, arch string) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	ms.arches[name] = arch
+}
+
+// SetDescription sets the description of the given package
+func (ms *Store) SetDescription(name, desc string) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	ms.descs[name] = desc
+}
+
+// GetPkg retrieves a package from the store by its name. If the package
+// doesn't exist, it returns [github.com/cockroachdb/pebble.ErrNotFound],
+// like [go.elara.ws/distrohop/internal/store.Store] does.
+func (ms *Store) GetPkg(name string) (store.Package, error) {
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+	tags, ok := ms.pkgs[name]
+	if !ok {
+		return store.Package{}, pebble.ErrNotFound
+	}
+	return store.Package{Name: name, Tags: slices.Clone(tags), Arch: ms.arches[name], Description: ms.descs[name]}, nil
+}
+
+// GetPkgNamesByPrefix returns up to n sorted package names that start with prefix
+func (ms *Store) GetPkgNamesByPrefix(prefix string, n int) ([]string, error) {
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+
+	var out []string
+	for name := range ms.pkgs {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, name)
+		}
+	}
+
+	slices.Sort(out)
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+// ListPkgNames calls fn with the name of every package in the store, in sorted order
+func (ms *Store) ListPkgNames(ctx context.Context, fn func(name string) error) error {
+	ms.mtx.RLock()
+	names := slices.Sorted(maps.Keys(ms.pkgs))
+	ms.mtx.RUnlock()
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search searches for packages in the store that match the given tags.
+// It scores results the same way [go.elara.ws/distrohop/internal/store.Store.Search] does,
+// and returns [go.elara.ws/distrohop/internal/store.ErrEmpty] if no packages have been added.
+func (ms *Store) Search(tags []string) ([]store.TagResult, time.Duration, error) {
+	return ms.SearchOpts(tags, store.SearchOptions{})
+}
+
+// SearchOpts works like [Store.Search], but applies the given options.
+func (ms *Store) SearchOpts(tags []string, opts store.SearchOptions) ([]store.TagResult, time.Duration, error) {
+	start := time.Now()
+	var results []store.TagResult
+	err := ms.searchStream(context.Background(), tags, opts, func(res store.TagResult) error {
+		results = append(results, res)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if opts.IDF && opts.Mode == store.ModeAny {
+		ms.mtx.RLock()
+		total := len(ms.pkgs)
+		ms.mtx.RUnlock()
+		results = store.WeightIDF(results, tags, total)
+	} else {
+		store.SortResults(results)
+	}
+	return results, time.Since(start), nil
+}
+
+// SearchStream calls fn with each search result as it's found, without sorting.
+func (ms *Store) SearchStream(ctx context.Context, tags []string, fn func(store.TagResult) error) error {
+	return ms.searchStream(ctx, tags, store.SearchOptions{}, fn)
+}
+
+func (ms *Store) searchStream(ctx context.Context, tags []string, opts store.SearchOptions, fn func(store.TagResult) error) error {
+	if err := store.ValidateTags(tags); err != nil {
+		return err
+	}
+
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+
+	if len(ms.pkgs) == 0 {
+		return store.ErrEmpty
+	}
+
+	for name, ptags := range ms.pkgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		overlapTags, conf := store.Overlap(tags, ptags)
+		var crossTags []string
+		if opts.CrossType && opts.Mode == store.ModeAny {
+			var crossConf float32
+			crossTags, crossConf = store.CrossTypeOverlap(tags, ptags)
+			conf += crossConf
+		}
+		if conf == 0 || (opts.Mode == store.ModeAll && conf != 1) {
+			continue
+		}
+
+		arch := ms.arches[name]
+		if arch != "" && len(opts.Arches) != 0 && !slices.Contains(opts.Arches, arch) {
+			continue
+		}
+
+		err := fn(store.TagResult{
+			Confidence: conf,
+			Overlap:    overlapTags,
+			CrossType:  crossTags,
+			Package:    store.Package{Name: name, Tags: slices.Clone(ptags), Arch: arch},
+			Source:     ms.Name,
+			FullMatch:  store.FullMatch(tags, ptags),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package mem
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+func newTestStore() *Store {
+	ms := New()
+	ms.Name = "test"
+	ms.Add("vim", "bin=vim", "bin=vimdiff", "man=vim.1")
+	ms.Add("vim-tiny", "bin=vim")
+	ms.Add("nano", "bin=nano", "man=nano.1")
+	ms.SetArch("nano", "x86_64")
+	ms.SetDescription("vim", "Vi IMproved")
+	return ms
+}
+
+func TestGetPkg(t *testing.T) {
+	ms := newTestStore()
+	ms.Add("vim", "bin=vim", "bin=ex")
+
+	tests := []struct {
+		name    string
+		want    store.Package
+		wantErr error
+	}{
+		{"vim", store.Package{Name: "vim", Tags: []string{"bin=ex", "bin=vim", "bin=vimdiff", "man=vim.1"}, Description: "Vi IMproved"}, nil},
+		{"nano", store.Package{Name: "nano", Tags: []string{"bin=nano", "man=nano.1"}, Arch: "x86_64"}, nil},
+		{"emacs", store.Package{}, pebble.ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := ms.GetPkg(tt.name)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got.Name != tt.want.Name || got.Arch != tt.want.Arch || got.Description != tt.want.Description || !slices.Equal(got.Tags, tt.want.Tags) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetPkgNamesByPrefix(t *testing.T) {
+	ms := newTestStore()
+	tests := []struct {
+		prefix string
+		n      int
+		want   []string
+	}{
+		{"vim", 10, []string{"vim", "vim-tiny"}},
+		{"vim", 1, []string{"vim"}},
+		{"", 10, []string{"nano", "vim", "vim-tiny"}},
+		{"emacs", 10, nil},
+	}
+	for _, tt := range tests {
+		got, err := ms.GetPkgNamesByPrefix(tt.prefix, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q (%d): got %q, want %q", tt.prefix, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ms := newTestStore()
+	tests := []struct {
+		name string
+		tags []string
+		opts store.SearchOptions
+		want []string
+	}{
+		{"single", []string{"bin=nano"}, store.SearchOptions{}, []string{"nano"}},
+		{"ranked", []string{"bin=vim", "bin=vimdiff"}, store.SearchOptions{}, []string{"vim", "vim-tiny"}},
+		{"mode all", []string{"bin=vim", "bin=vimdiff"}, store.SearchOptions{Mode: store.ModeAll}, []string{"vim"}},
+		{"arch", []string{"man=nano.1", "man=vim.1"}, store.SearchOptions{Arches: []string{"aarch64"}}, []string{"vim"}},
+		{"no match", []string{"bin=emacs"}, store.SearchOptions{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := ms.SearchOpts(tt.tags, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Package.Name)
+				if res.Source != ms.Name {
+					t.Errorf("%s: got source %q, want %q", res.Package.Name, res.Source, ms.Name)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		store   *Store
+		tags    []string
+		wantErr error
+	}{
+		{"empty", New(), []string{"bin=vim"}, store.ErrEmpty},
+		{"invalid tag", newTestStore(), []string{"vim"}, store.ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.store.Search(tt.tags); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestListPkgNames(t *testing.T) {
+	ms := newTestStore()
+	var got []string
+	err := ms.ListPkgNames(context.Background(), func(name string) error {
+		got = append(got, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nano", "vim", "vim-tiny"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
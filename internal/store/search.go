@@ -23,17 +23,24 @@
 package store
 
 import (
+	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"log/slog"
+	"path"
 	"regexp"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/tags"
+	"golang.org/x/sync/errgroup"
 )
 
 func init() {
@@ -73,8 +80,195 @@ type TagResult struct {
 	Confidence float32
 	// A list of overlapping tags
 	Overlap []string
+	// A list of package tags that didn't overlap, but are related to search
+	// tags of another type, which is only set if cross-type matching was
+	// enabled. See [CrossTypeOverlap].
+	CrossType []string `json:",omitempty"`
 	// The package associated with the tag result
 	Package Package
+	// The name of the store the result came from
+	Source string
+	// Whether every one of the package's tags matched the search,
+	// which makes it a strong match even if the search contained
+	// extra tags that lowered its confidence score.
+	FullMatch bool
+	// The category of the result's confidence score, which is
+	// only set if the result was passed to [Categorize].
+	Category Category `json:",omitempty"`
+	// The inputs of the confidence score formula, which are
+	// only set if the result was passed to [AddDebugInfo].
+	Debug *ResultDebug `json:",omitempty"`
+	// How many of the search tags of each type overlapped, which is
+	// only set if the result was passed to [AddBreakdown].
+	Breakdown []TypeOverlap `json:",omitempty"`
+}
+
+// TypeOverlap contains the amount of search tags of a single
+// type that overlapped with a package's tags
+type TypeOverlap struct {
+	// The key of the tag type, such as "bin"
+	Key string
+	// The amount of search tags of this type that overlapped
+	Matched int
+	// The amount of search tags of this type
+	Total int
+}
+
+// ResultDebug contains the numbers that a search result's confidence score
+// was calculated from. Unless the confidence was normalized by a combined store
+// or weighted using [WeightIDF], it's equal to (OverlapWeight + CrossTypeWeight)
+// / SearchWeight.
+type ResultDebug struct {
+	// The amount of tags in the search
+	SearchTagCount int
+	// The amount of tags in the package
+	PackageTagCount int
+	// The amount of search tags that overlapped with the package's tags
+	OverlapCount int
+	// The total weight of the search tags
+	SearchWeight float32
+	// The total weight of the search tags that overlapped with the package's tags
+	OverlapWeight float32
+	// The total weight of the search tags that only matched related tags
+	// of another type, after it was reduced for cross-type matching
+	CrossTypeWeight float32 `json:",omitempty"`
+}
+
+// AddDebugInfo returns a copy of results with their Debug fields set,
+// based on the search tags that produced them. The original results
+// aren't modified, since they may be shared with a cache.
+func AddDebugInfo(results []TagResult, searchTags []string) []TagResult {
+	var searchWeight float32
+	for _, tag := range searchTags {
+		searchWeight += tagWeight(tag)
+	}
+
+	out := slices.Clone(results)
+	for i, res := range out {
+		var overlapWeight, crossTypeWeight float32
+		for _, stag := range searchTags {
+			if overlapContains(res.Overlap, stag) {
+				overlapWeight += tagWeight(stag)
+			} else if crossTypeContains(res.CrossType, stag) {
+				crossTypeWeight += tagWeight(stag) * tags.CrossTypeWeight
+			}
+		}
+
+		out[i].Debug = &ResultDebug{
+			SearchTagCount:  len(searchTags),
+			PackageTagCount: len(res.Package.Tags),
+			OverlapCount:    len(res.Overlap),
+			SearchWeight:    searchWeight,
+			OverlapWeight:   overlapWeight,
+			CrossTypeWeight: crossTypeWeight,
+		}
+	}
+	return out
+}
+
+// AddBreakdown returns a copy of results with their Breakdown fields set,
+// based on the search tags that produced them. The tag types are in the
+// order they first appear in searchTags. The original results aren't
+// modified, since they may be shared with a cache.
+func AddBreakdown(results []TagResult, searchTags []string) []TagResult {
+	var totals []TypeOverlap
+	for _, stag := range searchTags {
+		key := tagKey(stag)
+		i := slices.IndexFunc(totals, func(to TypeOverlap) bool { return to.Key == key })
+		if i == -1 {
+			totals = append(totals, TypeOverlap{Key: key})
+			i = len(totals) - 1
+		}
+		totals[i].Total++
+	}
+
+	out := slices.Clone(results)
+	for i, res := range out {
+		breakdown := slices.Clone(totals)
+		for _, stag := range searchTags {
+			if !overlapContains(res.Overlap, stag) {
+				continue
+			}
+			key := tagKey(stag)
+			j := slices.IndexFunc(breakdown, func(to TypeOverlap) bool { return to.Key == key })
+			breakdown[j].Matched++
+		}
+		out[i].Breakdown = breakdown
+	}
+	return out
+}
+
+// SearchMode determines how search tags are matched against packages
+type SearchMode uint8
+
+const (
+	// ModeAny matches packages that contain any of the search tags.
+	// Their confidence is based on how many of the tags they contain.
+	ModeAny SearchMode = iota
+	// ModeAll only matches packages that contain all of the search
+	// tags, so the confidence of every result is 1.
+	ModeAll
+)
+
+// ParseSearchMode parses a search mode name. An empty string is
+// parsed as [ModeAny].
+func ParseSearchMode(s string) (SearchMode, error) {
+	switch s {
+	case "", "any":
+		return ModeAny, nil
+	case "all":
+		return ModeAll, nil
+	default:
+		return 0, fmt.Errorf("invalid search mode: %q", s)
+	}
+}
+
+// String returns the name of the search mode
+func (m SearchMode) String() string {
+	if m == ModeAll {
+		return "all"
+	}
+	return "any"
+}
+
+// SearchOptions represents options that change the behavior of a search.
+// The zero value represents the default behavior of [ReadOnly.Search].
+type SearchOptions struct {
+	// Arches limits the search to packages from indices for the given
+	// architectures. If it's empty, all architectures are searched. Packages
+	// whose architecture isn't known are always included.
+	Arches []string
+	// Mode determines how search tags are matched against packages
+	Mode SearchMode
+	// IDF weights the search tags by their inverse document frequency
+	// using [WeightIDF]. It has no effect in [ModeAll], since every
+	// result contains all the search tags.
+	IDF bool
+	// CrossType enables cross-type matching, so that search tags that
+	// only match related tags of another type, such as bin=foo and
+	// desktop=foo, count towards confidence scores with a reduced weight.
+	// See [CrossTypeOverlap]. Like IDF, it has no effect in [ModeAll].
+	CrossType bool
+	// Timeout is how long the search may run before it stops scanning.
+	// Instead of failing, a search that times out returns the results it
+	// found so far along with [ErrPartial]. If it's zero, there's no timeout.
+	Timeout time.Duration
+}
+
+// crossType reports whether the options enable cross-type matching
+func (opts SearchOptions) crossType() bool {
+	return opts.CrossType && opts.Mode == ModeAny
+}
+
+// OptionSearcher is implemented by stores that support searching with [SearchOptions]
+type OptionSearcher interface {
+	// SearchOpts works like [ReadOnly.Search], but applies the given options
+	SearchOpts(tags []string, opts SearchOptions) ([]TagResult, time.Duration, error)
+}
+
+// Streamer is implemented by stores that can stream search results as they're found
+type Streamer interface {
+	SearchStream(ctx context.Context, tags []string, fn func(TagResult) error) error
 }
 
 // Search searches for packages in the store that match the given tags.
@@ -82,148 +276,441 @@ type TagResult struct {
 // if any tag does not conform to this format. The function spawns multiple
 // worker goroutines (defined by s.SearchThreads) to perform a concurrent search.
 // The result is a list of [TagResult] structs representing the matching packages.
+// If the store doesn't contain any packages, [ErrEmpty] is returned, so that
+// callers can tell an empty index apart from a search without any matches.
 func (s *Store) Search(tags []string) ([]TagResult, time.Duration, error) {
+	return s.SearchOpts(tags, SearchOptions{})
+}
+
+// SearchOpts works like [Store.Search], but applies the given options. If
+// opts.Timeout passes before the search finishes, the results found until
+// then are returned along with [ErrPartial].
+func (s *Store) SearchOpts(tags []string, opts SearchOptions) ([]TagResult, time.Duration, error) {
 	start := time.Now()
-	for _, tag := range tags {
-		if !tagRegex.MatchString(tag) {
-			return nil, 0, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	var results []TagResult
+	err := s.searchStream(ctx, tags, opts, func(res TagResult) error {
+		results = append(results, res)
+		return nil
+	})
+	partial := opts.Timeout > 0 && errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !partial {
+		return nil, 0, err
+	}
+	results = DedupResults(results)
+	if opts.IDF && opts.Mode == ModeAny {
+		// If the package count isn't known, such as in indices pulled
+		// by older versions, the results are the best approximation.
+		total := len(results)
+		if meta, err := s.GetMeta(); err == nil && meta.PackageCount > total {
+			total = meta.PackageCount
 		}
+		results = WeightIDF(results, tags, total)
+	} else {
+		SortResults(results)
+	}
+	if partial {
+		return results, time.Since(start), ErrPartial
 	}
+	return results, time.Since(start), nil
+}
 
-	optsMtx := &sync.Mutex{}
-	opts := iterOpts
+// SearchStream works like [Store.Search], but instead of collecting and sorting
+// the results, it calls fn with each result as soon as it's found, so the results
+// are unordered. Calls to fn are never concurrent. If fn returns an error or ctx is
+// canceled, the search stops and the error is returned.
+func (s *Store) SearchStream(ctx context.Context, tags []string, fn func(TagResult) error) error {
+	return s.searchStream(ctx, tags, SearchOptions{}, fn)
+}
 
-	var results []TagResult
-	resultsMtx := &sync.Mutex{}
-	wg := &sync.WaitGroup{}
-	errs := make(chan error)
-	for range s.SearchThreads {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+func (s *Store) searchStream(ctx context.Context, tags []string, opts SearchOptions, fn func(TagResult) error) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+
+	if empty, err := s.Empty(); err != nil {
+		return err
+	} else if empty {
+		return ErrEmpty
+	}
+
+	// With cross-type matching, chunks that only contain
+	// related tags have to be scanned as well.
+	filterTags := tags
+	if opts.crossType() {
+		filterTags = withRelated(tags)
+	}
+
+	rangesMtx := &sync.Mutex{}
+	ranges := iterOpts
+
+	fnMtx := &sync.Mutex{}
+	emit := func(res TagResult) error {
+		fnMtx.Lock()
+		defer fnMtx.Unlock()
+		return fn(res)
+	}
+
+	// Any extra goroutines would exit immediately
+	// without anything to do, so there's no point
+	// in spawning more of them than there are ranges.
+	threads := min(max(s.SearchThreads, 1), len(ranges))
+
+	wg, ctx := errgroup.WithContext(ctx)
+	for range threads {
+		wg.Go(func() error {
 			for {
-				optsMtx.Lock()
-				if len(opts) == 0 {
-					// If we have no more options structs left,
-					// we can exit the goroutine
-					optsMtx.Unlock()
-					return
+				if err := ctx.Err(); err != nil {
+					return err
 				}
-				opt := opts[0]
-				opts = opts[1:]
-				optsMtx.Unlock()
 
-				found := false
-				if filter, err := s.GetFilter(opt.LowerBound[0]); err == nil {
-					for _, tag := range tags {
-						if filter.Lookup(unsafeBytes(tag)) {
-							found = true
-							break
-						}
-					}
-				} else if !errors.Is(err, pebble.ErrNotFound) {
-					errs <- err
-					return
+				rangesMtx.Lock()
+				if len(ranges) == 0 {
+					// If we have no more ranges left,
+					// we can exit the goroutine
+					rangesMtx.Unlock()
+					return nil
 				}
+				rng := ranges[0]
+				ranges = ranges[1:]
+				rangesMtx.Unlock()
 
 				// Skip the current chunk if the bloom filter
-				// doesn't contain any of the tags, or if it doesn't
+				// doesn't contain the tags we need, or if it doesn't
 				// exist, which indicates that there are no packages
 				// with the starting character we're looking for.
-				if !found {
+				// If the filter is corrupted, we can't skip anything,
+				// so the whole chunk is scanned.
+				fe, err := s.cachedFilter(rng.LowerBound[0])
+				if err != nil {
+					return err
+				}
+				if err := fe.err; err == nil {
+					if !filterMatches(fe, filterTags, opts.Mode) {
+						s.filterStats.skipped.Add(1)
+						continue
+					}
+				} else if errors.Is(err, pebble.ErrNotFound) {
 					continue
+				} else if errors.Is(err, ErrCorruptFilter) {
+					s.logger().Warn(
+						"Scanning chunk without its bloom filter; refresh the index to rebuild it",
+						slog.String("store", s.Name),
+						slog.String("char", string(rng.LowerBound[0])),
+						slog.Any("error", err),
+					)
+				} else {
+					return err
 				}
 
-				// Create a new iterator that scans through the range defined in opt
-				iter, err := s.db.NewIter(opt)
+				found := false
+				err = s.searchRange(ctx, rng, tags, opts, func(res TagResult) error {
+					found = true
+					return emit(res)
+				})
 				if err != nil {
-					errs <- err
-					return
+					return err
 				}
 
-				var out []TagResult
-				for iter.First(); iter.Valid(); iter.Next() {
-					val, err := iter.ValueAndErr()
-					if err != nil {
-						errs <- err
-						iter.Close()
-						return
-					}
+				s.filterStats.scanned.Add(1)
+				if !found {
+					s.filterStats.falsePositives.Add(1)
+				}
+			}
+		})
+	}
 
-					// Convert the tag data to a string using an unsafe operation
-					// so that we can split it by the unit separator character
-					// and check if it has overlap without incurring the cost
-					// of copying the value for a string conversion.
-					//
-					// If we find that there's overlap, we'll copy the data
-					// later, before returning it.
-					ptags := strings.Split(unsafeString(val), "\x1F")
-					overlapTags, conf := overlap(tags, ptags)
-					if conf == 0 {
-						// If the confidence is zero, there's no overlap,
-						// so we can continue to the next value
-						continue
-					}
+	return wg.Wait()
+}
 
-					out = append(out, TagResult{
-						Confidence: conf,
-						Overlap:    overlapTags,
-						Package: Package{
-							Name: string(iter.Key()),
-							// We need to do a deep copy here because we previously
-							// used an unsafe operation to convert the tag data to
-							// a string, and the values created by that will be
-							// invalidated when the iterator is closed.
-							Tags: cloneStringSlice(ptags),
-						},
-					})
-				}
+// FilterStats contains statistics about how effective a store's bloom
+// filters have been at avoiding unnecessary scans during searches.
+type FilterStats struct {
+	// Skipped is the number of chunks that were skipped
+	// because their bloom filter didn't contain the search tags.
+	Skipped uint64 `json:"skipped"`
+	// Scanned is the number of chunks that had to be scanned
+	// because their bloom filter may have contained the search tags.
+	Scanned uint64 `json:"scanned"`
+	// FalsePositives is the number of scanned chunks that didn't contain
+	// any matching packages. Tags with glob patterns can't be looked up in
+	// bloom filters, so searches that contain them also count towards this.
+	FalsePositives uint64 `json:"falsePositives"`
+}
 
-				if err := iter.Error(); err != nil {
-					errs <- err
-					iter.Close()
-					return
-				}
+// filterStats contains the counters used to calculate [FilterStats]
+type filterStats struct {
+	skipped        atomic.Uint64
+	scanned        atomic.Uint64
+	falsePositives atomic.Uint64
+}
+
+// FilterStats returns the bloom filter statistics for all
+// the searches that have been performed on the store.
+func (s *Store) FilterStats() FilterStats {
+	return FilterStats{
+		Skipped:        s.filterStats.skipped.Load(),
+		Scanned:        s.filterStats.scanned.Load(),
+		FalsePositives: s.filterStats.falsePositives.Load(),
+	}
+}
 
-				iter.Close()
-				resultsMtx.Lock()
-				results = append(results, out...)
-				resultsMtx.Unlock()
+// filterMatches checks whether a chunk with the given bloom filter may contain
+// packages matching tags. In [ModeAny], at least one of the tags has to be in the
+// filter, while in [ModeAll], all of them have to be. Bloom filters only support
+// exact lookups, so glob tags are always assumed to be in it.
+func filterMatches(fe *filterEntry, tags []string, mode SearchMode) bool {
+	for _, tag := range tags {
+		found := isGlob(tag) || fe.lookup(unsafeBytes(tag))
+		if found && mode == ModeAny {
+			return true
+		} else if !found && mode == ModeAll {
+			return false
+		}
+	}
+	return mode == ModeAll
+}
+
+// searchRange scans through the range defined in rng and calls
+// fn for every package that matches the search tags.
+func (s *Store) searchRange(ctx context.Context, rng *pebble.IterOptions, tags []string, opts SearchOptions, fn func(TagResult) error) error {
+	db, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer db.release()
+
+	iter, err := db.NewIter(rng)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	arches := &archCursor{db: db, rng: rng}
+	defer arches.close()
+
+	i := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		// Check for cancellation periodically rather than on
+		// every iteration, since it requires taking a lock.
+		if i++; i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-		}()
+		}
+
+		val, err := iter.ValueAndErr()
+		if err != nil {
+			return err
+		}
+
+		// Convert the tag data to a string using an unsafe operation
+		// so that we can decode it and check if it has overlap
+		// without incurring the cost of copying the value for
+		// a string conversion.
+		//
+		// If we find that there's overlap, we'll copy the data
+		// later, before returning it.
+		ptags := DecodeTags(unsafeString(val))
+		overlapTags, conf := Overlap(tags, ptags)
+		var crossTags []string
+		if opts.crossType() {
+			var crossConf float32
+			crossTags, crossConf = CrossTypeOverlap(tags, ptags)
+			conf += crossConf
+		}
+		if conf == 0 || (opts.Mode == ModeAll && conf != 1) {
+			// If the confidence is zero, there's no overlap, and in
+			// ModeAll, every tag has to overlap, so we can continue
+			// to the next value
+			continue
+		}
+
+		name := unsafeString(iter.Key())
+		arch, err := arches.get(name)
+		if err != nil {
+			return err
+		}
+		if arch != "" && len(opts.Arches) != 0 && !slices.Contains(opts.Arches, arch) {
+			continue
+		}
+
+		err = fn(TagResult{
+			Confidence: conf,
+			// Overlapping tags may come from the package's tags
+			// if the search contained glob patterns, so they need
+			// to be copied for the same reason as the package tags.
+			Overlap:   cloneStringSlice(overlapTags),
+			CrossType: cloneStringSlice(crossTags),
+			Source:    s.Name,
+			FullMatch: FullMatch(tags, ptags),
+			Package: Package{
+				Name: strings.Clone(name),
+				Arch: arch,
+				// We need to do a deep copy here because we previously
+				// used an unsafe operation to convert the tag data to
+				// a string, and the values created by that will be
+				// invalidated when the iterator is closed.
+				Tags: cloneStringSlice(ptags),
+			},
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+	return iter.Error()
+}
+
+// archCursor looks up the architectures of the packages in a chunk while it's
+// being scanned. The packages are scanned in key order, and their architecture
+// keys are in the same order, so a single iterator that only ever moves forward
+// can find all of them, which is much cheaper than a separate lookup for each
+// match. The iterator is only created once it's first needed, so chunks
+// without any matches don't pay for it.
+type archCursor struct {
+	db   *dbRef
+	rng  *pebble.IterOptions
+	iter *pebble.Iterator
+}
 
-	select {
-	case err := <-errs:
+// get returns the architecture of the given package, or an empty string if it
+// wasn't recorded. Each call must be for a package that comes after the previous one.
+func (ac *archCursor) get(name string) (string, error) {
+	if ac.iter == nil {
+		iter, err := ac.db.NewIter(&pebble.IterOptions{
+			LowerBound: archKey(string(ac.rng.LowerBound)),
+			UpperBound: archKey(string(ac.rng.UpperBound)),
+		})
 		if err != nil {
-			return nil, 0, err
+			return "", err
 		}
-	case <-done:
-		SortResults(results)
-		return results, time.Since(start), nil
+		ac.iter = iter
 	}
 
-	SortResults(results)
-	return results, time.Since(start), nil
+	key := archKey(name)
+	if !ac.iter.SeekGE(key) || !bytes.Equal(ac.iter.Key(), key) {
+		return "", ac.iter.Error()
+	}
+	val, err := ac.iter.ValueAndErr()
+	if err != nil {
+		return "", err
+	}
+	return string(val), nil
 }
 
-// SortResults sorts tag results by confidence
+// close closes the cursor's iterator, if it was created
+func (ac *archCursor) close() {
+	if ac.iter != nil {
+		ac.iter.Close()
+	}
+}
+
+// ValidateTags returns an error wrapping [ErrInvalidTag] if any of
+// the given tags aren't in the "key=value" or "key~=pattern" format,
+// or if the pattern of a glob tag is invalid.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return fmt.Errorf("%w: %q: %s", ErrInvalidTag, tag, err)
+		}
+	}
+	return nil
+}
+
+// validateTag returns an error describing what's wrong with tag, if anything
+func validateTag(tag string) error {
+	key, val, ok := strings.Cut(tag, "=")
+	glob := isGlob(tag)
+	key = strings.TrimSuffix(key, "~")
+	switch {
+	case !ok:
+		return errors.New("missing '=' between the key and the value")
+	case key == "":
+		return errors.New("empty key")
+	case val == "":
+		return errors.New("empty value")
+	case !tagRegex.MatchString(key + "=" + val):
+		return errors.New("the key must end with a letter, number, or underscore")
+	case glob && !validGlob(val):
+		return errors.New("invalid glob pattern")
+	}
+	return nil
+}
+
+// isGlob reports whether the search tag stag is a glob tag, which uses "~=" instead
+// of "=" to match its value as a pattern, such as lib~=libssl.so.*. Tags are never
+// treated as globs just because their values contain wildcard characters, since
+// package tags can contain them too, and they're used as search tags when searching
+// for a package's equivalents.
+func isGlob(stag string) bool {
+	key, _, ok := strings.Cut(stag, "=")
+	return ok && strings.HasSuffix(key, "~")
+}
+
+// tagKey returns the key of the search tag stag, without the "~" of glob tags
+func tagKey(stag string) string {
+	key, _, _ := strings.Cut(stag, "=")
+	return strings.TrimSuffix(key, "~")
+}
+
+// tagWeight returns the [go.elara.ws/distrohop/internal/tags.Weight] of the search tag stag
+func tagWeight(stag string) float32 {
+	return tags.Weight(tagKey(stag))
+}
+
+// matchGlob reports whether the package tag ptag has the same key as the glob
+// tag stag, and a value that matches its pattern. The pattern syntax is
+// the same as [path.Match].
+func matchGlob(stag, ptag string) bool {
+	_, pattern, _ := strings.Cut(stag, "=")
+	pkey, val, _ := strings.Cut(ptag, "=")
+	if tagKey(stag) != pkey {
+		return false
+	}
+	matched, _ := path.Match(pattern, val)
+	return matched
+}
+
+// validGlob reports whether pattern is a valid glob pattern
+func validGlob(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// SortResults sorts tag results by confidence. Results with equal confidence
+// are sorted by package name and then by source, so that the order is
+// always deterministic. To break ties differently, use [SortResultsBy].
 func SortResults(results []TagResult) {
-	slices.SortFunc(results, func(a, b TagResult) int {
-		if a.Confidence < b.Confidence {
-			return 1
-		} else if a.Confidence > b.Confidence {
-			return -1
-		} else {
-			return strings.Compare(a.Package.Name, b.Package.Name)
+	SortResultsBy(results, Tiebreak{})
+}
+
+// DedupResults removes duplicate results for the same package, keeping
+// the one with the highest confidence. Results from a single store should
+// never contain duplicates, but this guards against bugs in the way the
+// search is split between workers. The order of the remaining results
+// is preserved, and the returned slice shares memory with results.
+func DedupResults(results []TagResult) []TagResult {
+	seen := make(map[string]int, len(results))
+	out := results[:0]
+	for _, res := range results {
+		if i, ok := seen[res.Package.Name]; ok {
+			if res.Confidence > out[i].Confidence {
+				out[i] = res
+			}
+			continue
 		}
-	})
+		seen[res.Package.Name] = len(out)
+		out = append(out, res)
+	}
+	clear(results[len(out):])
+	return out
 }
 
 // cloneStringSlice creates a deep copy of a slice of strings
@@ -0,0 +1,625 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		tag     string
+		wantErr string
+	}{
+		{"bin=vim", ""},
+		{"lib~=libssl.so.*", ""},
+		// Wildcard characters are literal without "~="
+		{"bin=[", ""},
+		{"file=/usr/share/doc/*", ""},
+		{"lib~=libssl.so.[", "invalid glob pattern"},
+		{"vim", "missing '=' between the key and the value"},
+		{"=vim", "empty key"},
+		{"~=vim", "empty key"},
+		{"bin=", "empty value"},
+		{"bin~=", "empty value"},
+		{"bin-=vim", "the key must end with a letter, number, or underscore"},
+	}
+	for _, tt := range tests {
+		err := ValidateTags([]string{"bin=vim", tt.tag})
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tt.tag, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.tag)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("%q: error %v doesn't wrap ErrInvalidTag", tt.tag, err)
+		}
+		// The message names the tag and explains what's wrong with it
+		if want := fmt.Sprintf("%s: %q: %s", ErrInvalidTag, tt.tag, tt.wantErr); err.Error() != want {
+			t.Errorf("got error %q, want %q", err, want)
+		}
+	}
+}
+
+func TestOverlapGlob(t *testing.T) {
+	ptags := []string{"bin=[", "bin=openssl", "lib=libssl.so.3"}
+	tests := []struct {
+		name        string
+		stags       []string
+		wantOverlap []string
+		wantConf    float32
+	}{
+		{"literal", []string{"lib=libssl.so.3"}, []string{"lib=libssl.so.3"}, 1},
+		{"literal wildcard", []string{"lib=libssl.so.*"}, nil, 0},
+		{"glob", []string{"lib~=libssl.so.*"}, []string{"lib=libssl.so.3"}, 1},
+		{"glob key mismatch", []string{"bin~=libssl*"}, nil, 0},
+		{"bracket literal", []string{"bin=["}, []string{"bin=["}, 1},
+		{"bracket class", []string{"bin~=[no]*"}, []string{"bin=openssl"}, 1},
+		{"mixed", []string{"lib~=libssl.so.*", "lib=libcrypto.so.3"}, []string{"lib=libssl.so.3"}, 0.5},
+	}
+	for _, tt := range tests {
+		overlap, conf := Overlap(tt.stags, ptags)
+		if !slices.Equal(overlap, tt.wantOverlap) || conf != tt.wantConf {
+			t.Errorf("%s: got %q (%v), want %q (%v)", tt.name, overlap, conf, tt.wantOverlap, tt.wantConf)
+		}
+	}
+}
+
+func TestSearchGlob(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"libssl3":   {"lib=libssl.so.3"},
+		"libssl1.1": {"lib=libssl.so.1.1"},
+		"brackets":  {"bin=["},
+		"nettle":    {"lib=libnettle.so.8"},
+	})
+
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"literal", []string{"lib=libssl.so.3"}, []string{"libssl3"}},
+		{"literal wildcard", []string{"lib=libssl.so.*"}, nil},
+		{"glob", []string{"lib~=libssl.so.*"}, []string{"libssl1.1", "libssl3"}},
+		{"glob no match", []string{"lib~=libfoo.so.*"}, nil},
+		{"stored wildcard", []string{"bin=["}, []string{"brackets"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := s.Search(tt.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultNames(results); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchStream(t *testing.T) {
+	// Spread the packages across many first characters, so
+	// that several workers search their ranges concurrently.
+	pkgs := map[string][]string{}
+	for i := range 200 {
+		name := fmt.Sprintf("%c-pkg%d", 'a'+i%26, i)
+		tags := []string{"bin=" + name}
+		if i%3 == 0 {
+			tags = append(tags, "lib=libcommon.so.1")
+		}
+		pkgs[name] = tags
+	}
+	s := newTestStore(t, pkgs)
+
+	search := []string{"lib=libcommon.so.1", "bin=a-pkg0"}
+	seen := map[string]int{}
+	err := s.SearchStream(context.Background(), search, func(res TagResult) error {
+		seen[res.Package.Name]++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := s.Search(search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(results) {
+		t.Errorf("got %d streamed results, want %d", len(seen), len(results))
+	}
+	for _, res := range results {
+		if n := seen[res.Package.Name]; n != 1 {
+			t.Errorf("%s: got %d streamed results, want exactly 1", res.Package.Name, n)
+		}
+	}
+}
+
+func TestSearchStreamError(t *testing.T) {
+	// The packages are all in the same range, so only
+	// one worker can find them.
+	s := newTestStore(t, map[string][]string{
+		"vim":      {"bin=vim"},
+		"vim-tiny": {"bin=vim"},
+		"vim-gtk3": {"bin=vim"},
+	})
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := s.SearchStream(context.Background(), []string{"bin=vim"}, func(TagResult) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("expected the search to stop after the callback failed, got %d calls", calls)
+	}
+}
+
+func TestSearchModeAll(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"vim":      {"bin=vim", "bin=vimdiff", "man=vim.1"},
+		"vim-tiny": {"bin=vim"},
+		"neovim":   {"bin=nvim", "bin=vimdiff"},
+		"nano":     {"bin=nano"},
+	})
+
+	tests := []struct {
+		name string
+		mode SearchMode
+		tags []string
+		want []string
+	}{
+		{"any", ModeAny, []string{"bin=vim", "bin=vimdiff"}, []string{"vim", "neovim", "vim-tiny"}},
+		{"all", ModeAll, []string{"bin=vim", "bin=vimdiff"}, []string{"vim"}},
+		{"all single tag", ModeAll, []string{"bin=vim"}, []string{"vim", "vim-tiny"}},
+		{"all no full match", ModeAll, []string{"bin=vim", "bin=nano"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := s.SearchOpts(tt.tags, SearchOptions{Mode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultNames(results); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.mode == ModeAll {
+				for _, res := range results {
+					if res.Confidence != 1 {
+						t.Errorf("%s: got confidence %v, want 1", res.Package.Name, res.Confidence)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDedupResults(t *testing.T) {
+	result := func(name string, conf float32) TagResult {
+		return TagResult{Package: Package{Name: name}, Confidence: conf}
+	}
+
+	tests := []struct {
+		name    string
+		results []TagResult
+		want    []TagResult
+	}{
+		{
+			name:    "no duplicates",
+			results: []TagResult{result("vim", 1), result("nano", 0.5)},
+			want:    []TagResult{result("vim", 1), result("nano", 0.5)},
+		},
+		{
+			name:    "higher confidence later",
+			results: []TagResult{result("vim", 0.5), result("nano", 0.75), result("vim", 1)},
+			want:    []TagResult{result("vim", 1), result("nano", 0.75)},
+		},
+		{
+			name:    "higher confidence first",
+			results: []TagResult{result("emacs", 0.25), result("vim", 1), result("nano", 0.75), result("vim", 0.5)},
+			want:    []TagResult{result("emacs", 0.25), result("vim", 1), result("nano", 0.75)},
+		},
+		{
+			name:    "many duplicates",
+			results: []TagResult{result("vim", 0.25), result("vim", 0.75), result("vim", 0.5)},
+			want:    []TagResult{result("vim", 0.75)},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DedupResults(slices.Clone(tt.results))
+			if !slices.EqualFunc(got, tt.want, func(a, b TagResult) bool {
+				return a.Package.Name == b.Package.Name && a.Confidence == b.Confidence
+			}) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterStats(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"apache2": {"bin=apache2"},
+		"bash":    {"bin=bash"},
+		"curl":    {"bin=curl"},
+	})
+
+	tests := []struct {
+		name string
+		tags []string
+		want FilterStats
+	}{
+		// Only the chunk for "a" has the tag, so the other two are skipped.
+		// Chunks without any packages don't have filters, so they aren't counted.
+		{"one chunk", []string{"bin=apache2"}, FilterStats{Skipped: 2, Scanned: 1}},
+		{"two chunks", []string{"bin=bash", "bin=curl"}, FilterStats{Skipped: 1, Scanned: 2}},
+		{"no matches", []string{"bin=zsh"}, FilterStats{Skipped: 3}},
+		// Glob tags can't be looked up in the filters, so every chunk is
+		// scanned, and the ones without any matches are false positives.
+		{"glob", []string{"bin~=c*"}, FilterStats{Scanned: 3, FalsePositives: 2}},
+	}
+
+	var total FilterStats
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.Search(tt.tags); err != nil {
+				t.Fatal(err)
+			}
+			// The counters accumulate across searches
+			total.Skipped += tt.want.Skipped
+			total.Scanned += tt.want.Scanned
+			total.FalsePositives += tt.want.FalsePositives
+			if got := s.FilterStats(); got != total {
+				t.Errorf("got %+v, want %+v", got, total)
+			}
+		})
+	}
+}
+
+func TestSearchArch(t *testing.T) {
+	s := newTestStore(t, nil)
+	// Packages with and without architectures are interleaved,
+	// so the lookups have to skip over the missing ones.
+	batch := map[string]index.Record{
+		"nvi":      {Name: "nvi", Arch: "arm64", Tags: []string{"bin=vi"}},
+		"vim":      {Name: "vim", Arch: "amd64", Tags: []string{"bin=vi", "bin=vim"}},
+		"vim-doc":  {Name: "vim-doc", Tags: []string{"bin=vi"}},
+		"vim-gtk3": {Name: "vim-gtk3", Arch: "arm64", Tags: []string{"bin=vi"}},
+		"vim-tiny": {Name: "vim-tiny", Arch: "amd64", Tags: []string{"bin=vi"}},
+	}
+	filters := NewFilters(nil)
+	if err := s.WriteBatch(batch, filters); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFilters(filters); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		arches []string
+		want   []string
+	}{
+		{"all", nil, []string{"nvi", "vim", "vim-doc", "vim-gtk3", "vim-tiny"}},
+		{"amd64", []string{"amd64"}, []string{"vim", "vim-doc", "vim-tiny"}},
+		{"arm64", []string{"arm64"}, []string{"nvi", "vim-doc", "vim-gtk3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, err := s.SearchOpts([]string{"bin=vi"}, SearchOptions{Arches: tt.arches})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.SortFunc(results, func(a, b TagResult) int { return strings.Compare(a.Package.Name, b.Package.Name) })
+			if got := resultNames(results); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, res := range results {
+				if want := batch[res.Package.Name].Arch; res.Package.Arch != want {
+					t.Errorf("%s: got arch %q, want %q", res.Package.Name, res.Package.Arch, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchEmpty(t *testing.T) {
+	s := newTestStore(t, nil)
+
+	if empty, err := s.Empty(); err != nil || !empty {
+		t.Fatalf("expected a new store to be empty, got %v (%v)", empty, err)
+	}
+	if _, _, err := s.Search([]string{"bin=vim"}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected ErrEmpty from Search, got %v", err)
+	}
+	err := s.SearchStream(context.Background(), []string{"bin=vim"}, func(TagResult) error {
+		t.Error("expected no results from an empty store")
+		return nil
+	})
+	if !errors.Is(err, ErrEmpty) {
+		t.Errorf("expected ErrEmpty from SearchStream, got %v", err)
+	}
+	// Invalid tags are still reported as such
+	if _, _, err := s.Search([]string{"vim"}); err == nil || errors.Is(err, ErrEmpty) {
+		t.Errorf("expected a validation error for an invalid tag, got %v", err)
+	}
+
+	// Once the store has packages, a search without
+	// matches is no longer reported as empty.
+	writeTestPkgs(t, s, map[string][]string{"nano": {"bin=nano"}})
+	if empty, err := s.Empty(); err != nil || empty {
+		t.Fatalf("expected the store not to be empty, got %v (%v)", empty, err)
+	}
+	results, _, err := s.Search([]string{"bin=vim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %v", resultNames(results))
+	}
+}
+
+func TestSearchThreads(t *testing.T) {
+	// Spread the packages across every range, so that each
+	// worker has something to do if there are enough of them.
+	pkgs := map[string][]string{}
+	for _, c := range "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz" {
+		pkgs[string(c)+"-editor"] = []string{"bin=vim", "bin=" + string(c)}
+		pkgs[string(c)+"-other"] = []string{"bin=" + string(c)}
+	}
+	s := newTestStore(t, pkgs)
+
+	s.SearchThreads = 1
+	want, _, err := s.Search([]string{"bin=vim", "bin=x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(iterOpts)+1 {
+		t.Fatalf("expected a result from every range and one more from x, got %d", len(want))
+	}
+
+	for _, threads := range []int{-1, 0, 4, len(iterOpts), 200} {
+		t.Run(fmt.Sprint(threads), func(t *testing.T) {
+			s.SearchThreads = threads
+			got, _, err := s.Search([]string{"bin=vim", "bin=x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resultNames(got), resultNames(want)) {
+				t.Errorf("got %v, want %v", resultNames(got), resultNames(want))
+			}
+		})
+	}
+}
+
+func TestFullMatch(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		// Every tag of vim-tiny is in the search
+		"vim-tiny": {"bin=vim"},
+		// vim has a tag that isn't in the search
+		"vim": {"bin=vim", "bin=vimdiff", "man=vim.1"},
+		// libssl's tag only matches a glob search tag
+		"libssl3": {"lib=libssl.so.3"},
+	})
+
+	results, _, err := s.Search([]string{"bin=vim", "bin=vimdiff", "lib~=libssl.so.*", "bin=ex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	confidences := map[string]float32{}
+	for _, res := range results {
+		got[res.Package.Name] = res.FullMatch
+		confidences[res.Package.Name] = res.Confidence
+	}
+	want := map[string]bool{"vim-tiny": true, "vim": false, "libssl3": true}
+	if !maps.Equal(got, want) {
+		t.Errorf("expected full matches %v, got %v", want, got)
+	}
+	// The partial match has a higher confidence, so
+	// FullMatch is the only way to tell them apart.
+	if confidences["vim"] <= confidences["vim-tiny"] {
+		t.Errorf("expected vim to have a higher confidence than vim-tiny, got %v and %v", confidences["vim"], confidences["vim-tiny"])
+	}
+
+	tests := []struct {
+		name  string
+		stags []string
+		ptags []string
+		want  bool
+	}{
+		{"exact", []string{"bin=vim"}, []string{"bin=vim"}, true},
+		{"extra search tags", []string{"bin=vim", "bin=ex"}, []string{"bin=vim"}, true},
+		{"extra package tags", []string{"bin=vim"}, []string{"bin=vim", "bin=vimdiff"}, false},
+		{"glob", []string{"lib~=libssl.so.*"}, []string{"lib=libssl.so.3", "lib=libssl.so.1.1"}, true},
+		{"no package tags", []string{"bin=vim"}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := FullMatch(tt.stags, tt.ptags); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddBreakdown(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"nautilus":      {"bin=nautilus", "bin=nautilus-autorun-software", "lib=libnautilus-extension.so.4", "desktop=org.gnome.Nautilus"},
+		"nautilus-libs": {"lib=libnautilus-extension.so.4", "lib=libnautilus-extension.so.1"},
+	})
+	searchTags := []string{
+		"bin=nautilus", "bin=nautilus-autorun-software",
+		"lib~=libnautilus-extension.so.*", "lib=libnautilus-extension.so.3", "lib=libgtk-4.so.1",
+		"desktop=nautilus",
+	}
+
+	results, _, err := s.Search(searchTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := AddBreakdown(results, searchTags)
+
+	want := map[string][]TypeOverlap{
+		"nautilus": {
+			{Key: "bin", Matched: 2, Total: 2},
+			{Key: "lib", Matched: 1, Total: 3},
+			{Key: "desktop", Matched: 0, Total: 1},
+		},
+		"nautilus-libs": {
+			{Key: "bin", Matched: 0, Total: 2},
+			{Key: "lib", Matched: 1, Total: 3},
+			{Key: "desktop", Matched: 0, Total: 1},
+		},
+	}
+	if len(out) != len(want) {
+		t.Fatalf("expected %d results, got %v", len(want), resultNames(out))
+	}
+	for _, res := range out {
+		if !slices.Equal(res.Breakdown, want[res.Package.Name]) {
+			t.Errorf("%s: expected breakdown %v, got %v", res.Package.Name, want[res.Package.Name], res.Breakdown)
+		}
+	}
+
+	// The results may be shared with a cache, so they must not be modified
+	for _, res := range results {
+		if res.Breakdown != nil {
+			t.Errorf("expected the original result for %s not to have a breakdown", res.Package.Name)
+		}
+	}
+}
+
+func TestSearchCrossType(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"nautilus": {"bin=nautilus", "lib=libnautilus-extension.so.4"},
+		"gedit":    {"bin=gedit", "desktop=org.gnome.gedit"},
+	})
+	searchTags := []string{"desktop=org.gnome.Nautilus", "lib=libnautilus-extension.so.4"}
+
+	// Without cross-type matching, only the lib tag matches
+	results, _, err := s.SearchOpts(searchTags, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Package.Name != "nautilus" {
+		t.Fatalf("expected only nautilus, got %v", resultNames(results))
+	}
+	if results[0].Confidence != 0.5 || len(results[0].CrossType) != 0 {
+		t.Errorf("expected a confidence of 0.5 without cross-type matches, got %v %v", results[0].Confidence, results[0].CrossType)
+	}
+
+	// With it, the desktop entry ID matches the lowercase
+	// executable name at half of its weight.
+	results, _, err = s.SearchOpts(searchTags, SearchOptions{CrossType: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Package.Name != "nautilus" {
+		t.Fatalf("expected only nautilus, got %v", resultNames(results))
+	}
+	if want := float32(1+tags.CrossTypeWeight) / 2; results[0].Confidence != want {
+		t.Errorf("expected a confidence of %v, got %v", want, results[0].Confidence)
+	}
+	if want := []string{"bin=nautilus"}; !slices.Equal(results[0].CrossType, want) {
+		t.Errorf("expected cross-type matches %v, got %v", want, results[0].CrossType)
+	}
+	if want := []string{"lib=libnautilus-extension.so.4"}; !slices.Equal(results[0].Overlap, want) {
+		t.Errorf("expected overlap %v, got %v", want, results[0].Overlap)
+	}
+
+	// A package that only has the related tag is found through it alone
+	results, _, err = s.SearchOpts([]string{"desktop=org.gnome.Nautilus"}, SearchOptions{CrossType: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Confidence != tags.CrossTypeWeight {
+		t.Errorf("expected nautilus with a confidence of %v, got %+v", tags.CrossTypeWeight, results)
+	}
+	results, _, err = s.SearchOpts([]string{"desktop=org.gnome.Nautilus"}, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results without cross-type matching, got %v", resultNames(results))
+	}
+
+	// Cross-type matching has no effect in ModeAll
+	results, _, err = s.SearchOpts([]string{"desktop=org.gnome.Nautilus"}, SearchOptions{CrossType: true, Mode: ModeAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results in ModeAll, got %v", resultNames(results))
+	}
+}
+
+func TestSearchTimeout(t *testing.T) {
+	pkgs := make(map[string][]string, 2000)
+	for i := range 2000 {
+		pkgs[fmt.Sprintf("pkg%04d", i)] = []string{"bin=common", fmt.Sprintf("bin=pkg%04d", i)}
+	}
+	s := newTestStore(t, pkgs)
+
+	results, _, err := s.SearchOpts([]string{"bin=common"}, SearchOptions{Timeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(pkgs) {
+		t.Fatalf("expected %d results, got %d", len(pkgs), len(results))
+	}
+
+	// The search can't finish in a nanosecond, so it returns
+	// whatever it found until then instead of failing.
+	results, _, err = s.SearchOpts([]string{"bin=common"}, SearchOptions{Timeout: time.Nanosecond})
+	if !errors.Is(err, ErrPartial) {
+		t.Fatalf("expected ErrPartial, got %v", err)
+	}
+	if len(results) >= len(pkgs) {
+		t.Errorf("expected fewer than %d results, got %d", len(pkgs), len(results))
+	}
+	for _, res := range results {
+		if res.Confidence != 1 {
+			t.Errorf("expected partial results to be scored normally, got %v for %s", res.Confidence, res.Package.Name)
+		}
+	}
+}
@@ -24,14 +24,19 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"unsafe"
 
@@ -39,10 +44,33 @@ import (
 	"github.com/cockroachdb/pebble"
 	"github.com/zeebo/sbloom"
 	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/tags"
 )
 
-// ErrBlocked is returned when a store's database is being updated
-var ErrBlocked = errors.New("database is being updated; please try again later")
+// ErrEmpty is returned when searching a store that doesn't contain any packages,
+// such as one whose index hasn't been pulled yet.
+var ErrEmpty = errors.New("index not yet populated; please try again later")
+
+// ErrPartial is returned along with the results of a search that stopped
+// scanning because its [SearchOptions.Timeout] passed. The results only
+// contain the packages that were found before then.
+var ErrPartial = errors.New("search timed out; results are incomplete")
+
+// ErrCorruptFilter is returned when a bloom filter stored in the database can't be decoded
+var ErrCorruptFilter = errors.New("corrupted bloom filter")
+
+// ErrLocked is returned when a store's database can't be opened because another
+// process is using it, even after waiting for the process to release it.
+var ErrLocked = errors.New("database is locked by another process")
+
+const (
+	// openBackoff is how long to wait before retrying to open a locked
+	// database for the first time. It's doubled after each retry.
+	openBackoff = 200 * time.Millisecond
+	// maxOpenBackoff is the longest time to wait between
+	// retries while opening a locked database
+	maxOpenBackoff = 2 * time.Second
+)
 
 func init() {
 	gob.Register(&xxhash.Digest{})
@@ -54,6 +82,12 @@ type Package struct {
 	Name string
 	// A list of tags associated with the package
 	Tags []string
+	// The architecture of the index the package came from. It's empty
+	// for packages imported before architectures were recorded.
+	Arch string `json:",omitempty"`
+	// The description of the package. It's empty unless descriptions
+	// were enabled for the repo and its index contains them.
+	Description string `json:",omitempty"`
 }
 
 type nopLogger struct{}
@@ -68,55 +102,211 @@ type ReadOnly interface {
 	Search(tags []string) ([]TagResult, time.Duration, error)
 }
 
+// ErrListUnsupported is returned when listing the packages of a store that
+// doesn't implement [Lister]
+var ErrListUnsupported = errors.New("store doesn't support listing packages")
+
+// Lister is implemented by stores that can list all of their packages
+type Lister interface {
+	// ListPkgNames calls fn with the name of every package in the store, in sorted
+	// order. If fn returns an error or ctx is canceled, listing stops and the error
+	// is returned.
+	ListPkgNames(ctx context.Context, fn func(name string) error) error
+}
+
 // Store represents persistent storage for package data
 type Store struct {
 	Path string
-	db   *pebble.DB
 
-	// blocked is used to ensure that all other operations finish
-	// running before a [Store.Replace] operation, and cannot
-	// start running until the replace operation is completed.
-	// [Store.Replace] does a write lock on the RWMutex. All
-	// other operations do read locks.
-	blocked sync.RWMutex
+	// db is the handle for the store's current database. It's swapped
+	// out by [Store.Replace], so operations have to get it using
+	// [Store.acquire] rather than loading it directly.
+	db atomic.Pointer[dbRef]
+
+	// Name identifies the index stored in the store, such as its repo
+	// and architecture. It's set as the source of all search results.
+	Name string
+
+	// replaceMtx ensures that only one [Store.Replace]
+	// operation runs at a time.
+	replaceMtx sync.Mutex
 
 	// SearchThreads is the number of worker goroutines to be used
-	// for searching the database for a tag. The default is 4.
+	// for searching the database for a tag. The default is 4. Each
+	// goroutine scans one package name starting character at a time,
+	// so the number is capped at the amount of possible starting
+	// characters, and values less than 1 are treated as 1.
 	SearchThreads int
+
+	// Logger is used to log problems that don't cause operations
+	// to fail. If it's nil, [slog.Default] is used.
+	Logger *slog.Logger
+
+	// filterStats keeps track of how effective the bloom filters are
+	filterStats filterStats
 }
 
-// Open initializes and opens a [Store] at the specified path
+// logger returns s.Logger, or [slog.Default] if it's nil
+func (s *Store) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// Open initializes and opens a [Store] at the specified path. If another process
+// holds the database's lock, it fails with [ErrLocked] right away. Use [OpenContext]
+// to wait for the lock instead.
 func Open(path string) (*Store, error) {
-	db, err := pebble.Open(path, &pebble.Options{Logger: nopLogger{}})
+	// With a canceled context, opening the
+	// database isn't retried if it's locked.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return OpenContext(ctx, path)
+}
+
+// OpenContext is like [Open], but if another process holds the database's lock,
+// such as a previous instance that's still shutting down, opening it is retried
+// until ctx is done, and then it fails with [ErrLocked].
+func OpenContext(ctx context.Context, path string) (*Store, error) {
+	db, err := openDB(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	return &Store{
+	s := &Store{
 		Path:          path,
-		db:            db,
 		SearchThreads: 4,
-	}, err
+	}
+	s.db.Store(&dbRef{DB: db})
+	return s, nil
+}
+
+// openDB opens the database at path, retrying with exponential
+// backoff while another process holds its lock, until ctx is done
+func openDB(ctx context.Context, path string) (*pebble.DB, error) {
+	backoff := openBackoff
+	for {
+		db, err := pebble.Open(path, &pebble.Options{Logger: nopLogger{}})
+		if err == nil || !isLockHeld(err) {
+			return db, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %w", ErrLocked, err)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxOpenBackoff)
+	}
+}
+
+// isLockHeld reports whether err was returned by pebble because another process
+// holds the lock on a database. Errors from creating the lock file itself, such as
+// permission errors, are wrapped in an [os.PathError], so they're excluded.
+func isLockHeld(err error) bool {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES)
+}
+
+// dbRef is a handle for one of a store's databases. Operations hold a read
+// lock on it while they use the database, so that it doesn't get closed
+// under them if it's swapped out by [Store.Replace] in the meantime.
+type dbRef struct {
+	*pebble.DB
+	mtx     sync.RWMutex
+	retired bool
+	filters filterCache
+}
+
+// acquire returns the store's current database. The caller has to release
+// it once it's done using it. If the store has been closed, [pebble.ErrClosed]
+// is returned.
+func (s *Store) acquire() (*dbRef, error) {
+	for {
+		ref := s.db.Load()
+		if ref.mtx.TryRLock() {
+			if !ref.retired {
+				return ref, nil
+			}
+			ref.mtx.RUnlock()
+		}
+
+		// The database is being retired. If it hasn't been swapped out, that's
+		// because the store is being closed. Otherwise, we can try again with
+		// the new database without having to wait for the old one.
+		if s.db.Load() == ref {
+			return nil, pebble.ErrClosed
+		}
+	}
+}
+
+// release releases a database returned by [Store.acquire]
+func (r *dbRef) release() {
+	r.mtx.RUnlock()
+}
+
+// retire waits for all the operations using the database to release
+// it and then closes it. Once a database has been retired, it can't
+// be acquired anymore.
+func (r *dbRef) retire() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.retired {
+		return pebble.ErrClosed
+	}
+	r.retired = true
+	return r.Close()
+}
+
+// swap makes db the store's current database and retires the previous one
+func (s *Store) swap(db *pebble.DB) error {
+	return s.db.Swap(&dbRef{DB: db}).retire()
+}
+
+// reopen opens the database at s.Path and makes it the store's current database
+func (s *Store) reopen() error {
+	db, err := pebble.Open(s.Path, &pebble.Options{Logger: nopLogger{}})
+	if err != nil {
+		return err
+	}
+	return s.swap(db)
 }
 
 // WriteBatch writes a batch of index records to the store.
 // It merges existing tags with new ones and ensures they're unique.
 func (s *Store) WriteBatch(batch map[string]index.Record, filters map[byte]*sbloom.Filter) error {
-	if !s.blocked.TryRLock() {
-		return ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
-	b := s.db.NewBatch()
+	b := db.NewBatch()
 	defer b.Close()
 
 	for _, item := range batch {
-		if len(item.Name) == 0 || len(item.Tags) == 0 {
+		if len(item.Name) == 0 {
+			continue
+		}
+
+		if item.Description != "" {
+			if err := b.Set(descKey(item.Name), unsafeBytes(item.Description), nil); err != nil {
+				return err
+			}
+		}
+
+		if len(item.Tags) == 0 {
 			continue
 		}
 
 		key := unsafeBytes(item.Name)
 
-		curVal, cl, err := s.db.Get(key)
+		curVal, cl, err := db.Get(key)
 		if err == pebble.ErrNotFound {
 			// Remove any duplicate tags
 			slices.Sort(item.Tags)
@@ -131,7 +321,7 @@ func (s *Store) WriteBatch(batch map[string]index.Record, filters map[byte]*sblo
 		} else {
 			// Since the package already exists in the database, combine its existing
 			// tags with the ones we just got
-			tags := strings.Split(unsafeString(curVal), "\x1F")
+			tags := DecodeTags(unsafeString(curVal))
 			tags = append(tags, item.Tags...)
 			// Remove any duplicate tags
 			slices.Sort(tags)
@@ -144,6 +334,12 @@ func (s *Store) WriteBatch(batch map[string]index.Record, filters map[byte]*sblo
 			}
 			cl.Close()
 		}
+
+		if item.Arch != "" {
+			if err := b.Set(archKey(item.Name), unsafeBytes(item.Arch), nil); err != nil {
+				return err
+			}
+		}
 	}
 	// Commit the batch to persistent storage
 	return b.Commit(nil)
@@ -152,10 +348,11 @@ func (s *Store) WriteBatch(batch map[string]index.Record, filters map[byte]*sblo
 // WriteFilters writes bloom filters for each package name starting character
 // to the database.
 func (s *Store) WriteFilters(filters map[byte]*sbloom.Filter) error {
-	if !s.blocked.TryRLock() {
-		return ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
 	for firstChar, filter := range filters {
 		data, err := filter.GobEncode()
@@ -163,23 +360,26 @@ func (s *Store) WriteFilters(filters map[byte]*sbloom.Filter) error {
 			return err
 		}
 
-		err = s.db.Set([]byte{0x02, firstChar}, data, nil)
+		err = db.Set([]byte{0x02, firstChar}, data, nil)
 		if err != nil {
 			return err
 		}
+		db.filters.invalidate(firstChar)
 	}
 	return nil
 }
 
 // GetFilter gets the bloom filter for the given first package name character
-// from the database.
+// from the database. The filter is decoded separately for each call, so unlike
+// the filters cached for searches, it can be used freely by the caller.
 func (s *Store) GetFilter(firstChar byte) (*sbloom.Filter, error) {
-	if !s.blocked.TryRLock() {
-		return nil, ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
-	data, cl, err := s.db.Get([]byte{0x02, firstChar})
+	data, cl, err := db.Get([]byte{0x02, firstChar})
 	if err != nil {
 		return nil, err
 	}
@@ -188,61 +388,293 @@ func (s *Store) GetFilter(firstChar byte) (*sbloom.Filter, error) {
 	filter := &sbloom.Filter{}
 	err = filter.GobDecode(data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrCorruptFilter, err)
 	}
 
 	return filter, nil
 }
 
-// joinTags converts the given tags to bytes, joins them with \x1F as the separator,
-// and updates the correct bloom filter for the first character of the package name.
+const (
+	// filterK is the k value for bloom filters, which
+	// gives them a false positive rate below 1/2^k
+	filterK = 10
+	// minFilterLog is the minimum base 2 logarithm of the
+	// initial amount of bits in each bin of a bloom filter
+	minFilterLog = 10
+	// maxFilterLog is the maximum base 2 logarithm of the
+	// initial amount of bits in each bin of a bloom filter
+	maxFilterLog = 26
+)
+
+// RebuildFilters recreates all the bloom filters in the store from the packages it
+// contains, sized according to their current tag counts. This repairs filters that
+// are corrupted or out of date without having to pull the index again. The tag counts
+// in the store's metadata are updated as well, if it has any.
+func (s *Store) RebuildFilters() error {
+	counts, err := s.Count()
+	if err != nil {
+		return err
+	}
+
+	filters := NewFilters(counts.CharTagCounts)
+	if err := s.fillFilters(filters); err != nil {
+		return err
+	}
+
+	// Remove the filters for characters that no packages start with anymore,
+	// since they'd otherwise keep searches from skipping their chunks.
+	for _, char := range startChars {
+		if _, ok := filters[char]; ok {
+			continue
+		}
+		if err := s.deleteFilter(char); err != nil {
+			return err
+		}
+	}
+
+	if err := s.WriteFilters(filters); err != nil {
+		return err
+	}
+
+	meta, err := s.GetMeta()
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	meta.Counts = counts
+	return s.WriteMeta(meta)
+}
+
+// fillFilters adds the tags of every package in the store to the
+// filter for the first character of the package's name.
+func (s *Store) fillFilters(filters map[byte]*sbloom.Filter) error {
+	db, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer db.release()
+
+	iter, err := db.NewIter(pkgIterOpts)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		val, err := iter.ValueAndErr()
+		if err != nil {
+			return err
+		}
+		joinTags(iter.Key()[0], DecodeTags(unsafeString(val)), filters)
+	}
+	return iter.Error()
+}
+
+// deleteFilter removes the bloom filter for the given first
+// package name character from the database, if it exists.
+func (s *Store) deleteFilter(firstChar byte) error {
+	db, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer db.release()
+
+	if err := db.Delete([]byte{0x02, firstChar}, nil); err != nil {
+		return err
+	}
+	db.filters.invalidate(firstChar)
+	return nil
+}
+
+// NewFilters creates bloom filters for use with [Store.WriteBatch], sized according
+// to the expected amount of tags for each package name starting character, such as
+// the CharTagCounts from a previous import. Filters for starting characters that
+// aren't in charTags are created with the minimum size when they're first needed.
+func NewFilters(charTags map[byte]int) map[byte]*sbloom.Filter {
+	filters := make(map[byte]*sbloom.Filter, len(charTags))
+	for char, n := range charTags {
+		filters[char] = newFilter(n)
+	}
+	return filters
+}
+
+// newFilter creates a bloom filter that can hold about n tags before it
+// has to grow. Bloom filters that grow have to add more internal filters,
+// each of which adds to the overall false positive rate, so sizing them
+// correctly makes searches skip more chunks.
+func newFilter(n int) *sbloom.Filter {
+	// Each internal filter can hold about 2^(log-1) items
+	// before it's considered full and a new one is added.
+	log := uint(minFilterLog)
+	for log < maxFilterLog && 1<<(log-1) < n {
+		log++
+	}
+	return sbloom.NewSizedFilter(xxhash.New(), filterK, log)
+}
+
+// joinTags encodes the given tags using [EncodeTags] and updates
+// the correct bloom filter for the first character of the package name.
 func joinTags(firstChar byte, tags []string, filters map[byte]*sbloom.Filter) []byte {
 	if _, ok := filters[firstChar]; !ok {
-		filters[firstChar] = sbloom.NewFilter(xxhash.New(), 10)
+		filters[firstChar] = newFilter(0)
+	}
+	for _, tag := range tags {
+		filters[firstChar].Add(unsafeBytes(tag))
 	}
+	return EncodeTags(tags)
+}
+
+const (
+	// tagSep is the unit separator character, which separates encoded tags
+	tagSep = 0x1F
+	// tagEsc is the escape character, which precedes any occurrences of
+	// tagSep or itself within encoded tags
+	tagEsc = 0x1B
+)
+
+// EncodeTags joins the given tags with the unit separator character (\x1F).
+// Any separator or escape (\x1B) characters within the tags are escaped,
+// so [DecodeTags] always returns the original tags.
+func EncodeTags(tags []string) []byte {
 	out := &bytes.Buffer{}
 	for i, tag := range tags {
-		btag := unsafeBytes(tag)
-		filters[firstChar].Add(btag)
-		out.Write(btag)
+		if strings.IndexByte(tag, tagSep) == -1 && strings.IndexByte(tag, tagEsc) == -1 {
+			out.WriteString(tag)
+		} else {
+			for j := 0; j < len(tag); j++ {
+				if tag[j] == tagSep || tag[j] == tagEsc {
+					out.WriteByte(tagEsc)
+				}
+				out.WriteByte(tag[j])
+			}
+		}
 		if i != len(tags)-1 {
-			out.WriteByte(0x1F)
+			out.WriteByte(tagSep)
 		}
 	}
 	return out.Bytes()
 }
 
+// DecodeTags splits data encoded by [EncodeTags] back into tags. If data
+// doesn't contain any escaped characters, the returned tags share memory
+// with data, so they must be cloned if data is going to be invalidated.
+func DecodeTags(data string) []string {
+	if strings.IndexByte(data, tagEsc) == -1 {
+		return strings.Split(data, string(rune(tagSep)))
+	}
+
+	var (
+		out []string
+		cur strings.Builder
+	)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case tagEsc:
+			if i+1 < len(data) {
+				i++
+				cur.WriteByte(data[i])
+			}
+		case tagSep:
+			out = append(out, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(data[i])
+		}
+	}
+	return append(out, cur.String())
+}
+
 // GetPkg retrieves a package from the store by its name
 func (s *Store) GetPkg(name string) (Package, error) {
-	if !s.blocked.TryRLock() {
-		return Package{}, ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return Package{}, err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
-	data, cl, err := s.db.Get(unsafeBytes(name))
+	data, cl, err := db.Get(unsafeBytes(name))
 	if err != nil {
 		return Package{}, err
 	}
 	defer cl.Close()
 
+	arch, err := getArch(db, name)
+	if err != nil {
+		return Package{}, err
+	}
+
+	desc, err := getDescription(db, name)
+	if err != nil {
+		return Package{}, err
+	}
+
 	return Package{
-		Name: name,
-		Tags: strings.Split(string(data), "\x1F"),
+		Name:        name,
+		Tags:        DecodeTags(string(data)),
+		Arch:        arch,
+		Description: desc,
 	}, nil
 }
 
+// archKey returns the database key for the architecture of the given package.
+// Keys starting with 0x03 only contain architectures, so they never get in
+// the way of the package and internal data keys.
+func archKey(name string) []byte {
+	return append([]byte{0x03}, name...)
+}
+
+// getArch returns the architecture of the given package from db,
+// or an empty string if it wasn't recorded.
+func getArch(db *dbRef, name string) (string, error) {
+	data, cl, err := db.Get(archKey(name))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer cl.Close()
+	return string(data), nil
+}
+
+// descKey returns the database key for the description of the given package.
+// Like architectures, descriptions are stored under their own prefix, 0x01.
+func descKey(name string) []byte {
+	return append([]byte{0x01}, name...)
+}
+
+// getDescription returns the description of the given package from db,
+// or an empty string if it doesn't have one.
+func getDescription(db *dbRef, name string) (string, error) {
+	data, cl, err := db.Get(descKey(name))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer cl.Close()
+	return string(data), nil
+}
+
 func (s *Store) GetPkgNamesByPrefix(prefix string, n int) ([]string, error) {
-	if !s.blocked.TryRLock() {
-		return nil, ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
 	out := make([]string, 0, n)
 
-	iter, err := s.db.NewIter(&pebble.IterOptions{
+	opts := &pebble.IterOptions{
 		LowerBound: unsafeBytes(prefix),
-		UpperBound: append(unsafeBytes(prefix[:len(prefix)-1]), prefix[len(prefix)-1]+1),
-	})
+		UpperBound: prefixUpperBound(prefix),
+	}
+	if prefix == "" {
+		// Skip the internal keys that come before the packages
+		opts.LowerBound = pkgIterOpts.LowerBound
+	}
+
+	iter, err := db.NewIter(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +696,62 @@ func (s *Store) GetPkgNamesByPrefix(prefix string, n int) ([]string, error) {
 	return out, nil
 }
 
+// ListPkgNames calls fn with the name of every package in the store, in sorted
+// order. The names are collected before fn is called, so that a slow fn doesn't
+// keep the database from being replaced, and fn can use the store itself.
+func (s *Store) ListPkgNames(ctx context.Context, fn func(name string) error) error {
+	names, err := s.pkgNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pkgNames returns the names of all the packages in the store
+func (s *Store) pkgNames() ([]string, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer db.release()
+
+	iter, err := db.NewIter(pkgIterOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var out []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		out = append(out, string(iter.Key()))
+	}
+	return out, iter.Error()
+}
+
+// prefixUpperBound returns the smallest key that's greater than every key
+// starting with prefix, or nil if there's no such key. Keys are compared byte
+// by byte, so incrementing the last byte of the prefix works even if it's
+// part of a multibyte UTF-8 character, but trailing 0xFF bytes can't be
+// incremented and have to be removed first.
+func prefixUpperBound(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xFF {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
 // metaKey is the database key for repository metadata
 var metaKey = []byte("\x02META")
 
@@ -271,30 +759,111 @@ var metaKey = []byte("\x02META")
 type RepoMeta struct {
 	ETag         string
 	LastModified time.Time
+	// IndexSHA256 is the hex-encoded SHA256 hash of the decompressed
+	// index, which is used to find the diffs that apply to it. It's
+	// only set if the pull used diffs or was configured to use them.
+	IndexSHA256 string `json:",omitempty"`
+	Counts
+}
+
+// Counts contains statistics about the contents of a store
+type Counts struct {
+	// The amount of packages in the index
+	PackageCount int
+	// The total amount of tags in the index, across all packages
+	TagCount int
+	// The amount of tags for each package name starting character
+	CharTagCounts map[byte]int
+}
+
+// MetaProvider is implemented by stores that have repository metadata
+type MetaProvider interface {
+	GetMeta() (RepoMeta, error)
+}
+
+// pkgIterOpts contains iterator options that skip the keys containing
+// internal data, so that only package keys are iterated over.
+var pkgIterOpts = &pebble.IterOptions{LowerBound: []byte{0x04}}
+
+// Empty reports whether the store doesn't contain any packages
+func (s *Store) Empty() (bool, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer db.release()
+
+	iter, err := db.NewIter(pkgIterOpts)
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+
+	return !iter.First(), iter.Error()
+}
+
+// Count returns statistics about the amount of packages and tags in the store
+func (s *Store) Count() (Counts, error) {
+	db, err := s.acquire()
+	if err != nil {
+		return Counts{}, err
+	}
+	defer db.release()
+
+	iter, err := db.NewIter(nil)
+	if err != nil {
+		return Counts{}, err
+	}
+	defer iter.Close()
+
+	out := Counts{CharTagCounts: map[byte]int{}}
+	for iter.First(); iter.Valid(); iter.Next() {
+		// Keys starting with 0x02 contain internal data, such as
+		// bloom filters and metadata, and keys starting with 0x01
+		// and 0x03 contain package descriptions and architectures.
+		key := iter.Key()
+		if key[0] == 0x01 || key[0] == 0x02 || key[0] == 0x03 {
+			continue
+		}
+
+		val, err := iter.ValueAndErr()
+		if err != nil {
+			return Counts{}, err
+		}
+
+		n := len(DecodeTags(unsafeString(val)))
+		out.PackageCount++
+		out.TagCount += n
+		out.CharTagCounts[key[0]] += n
+	}
+
+	return out, iter.Error()
 }
 
 // WriteMeta writes the repository metadata to the database
 func (s *Store) WriteMeta(meta RepoMeta) error {
-	if !s.blocked.TryRLock() {
-		return ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
 	data, err := json.Marshal(meta)
 	if err != nil {
 		return err
 	}
-	return s.db.Set(metaKey, data, nil)
+	return db.Set(metaKey, data, nil)
 }
 
 // GetMeta reads the repository metadata from the database
 func (s *Store) GetMeta() (RepoMeta, error) {
-	if !s.blocked.TryRLock() {
-		return RepoMeta{}, ErrBlocked
+	db, err := s.acquire()
+	if err != nil {
+		return RepoMeta{}, err
 	}
-	defer s.blocked.RUnlock()
+	defer db.release()
 
-	data, cl, err := s.db.Get(metaKey)
+	data, cl, err := db.Get(metaKey)
 	if err != nil {
 		return RepoMeta{}, err
 	}
@@ -305,77 +874,215 @@ func (s *Store) GetMeta() (RepoMeta, error) {
 }
 
 // Replace atomically replaces the database from s with the database from s2.
-// The store is blocked during the replacement, causing any concurrent operations
-// to fail with [ErrBlocked]. The replacement operation closes and moves s2's
-// database, so s2 is no longer usable after this operation.
+// Operations on s keep working during the replacement: while the databases are
+// being moved, they're served from a read-only checkpoint of the old database,
+// so they never have to wait for the replacement. Writes made during that time
+// fail, since they'd be lost anyway. The replacement operation closes and moves
+// s2's database, so s2 is no longer usable after this operation. If s2 is on a
+// different filesystem than s, its database has to be copied, so the replacement
+// takes longer.
 //
 // This function attempts to roll back in case of partial failures. However, cleanup
 // failures may result in leftover temporary files.
 func (s *Store) Replace(s2 *Store) error {
-	// Clean up any leftover old db files. We don't need to lock at this
-	// point because concurrent operations are still safe to execute.
-	oldPath := filepath.Join(filepath.Dir(s.Path), "db-old")
-	if err := os.RemoveAll(oldPath); err != nil {
+	s.replaceMtx.Lock()
+	defer s.replaceMtx.Unlock()
+
+	dir := filepath.Dir(s.Path)
+	oldPath := filepath.Join(dir, "db-old")
+	newPath := filepath.Join(dir, "db-new")
+	ckptPath := filepath.Join(dir, "db-checkpoint")
+
+	// Clean up any leftover files from previous replacements
+	for _, path := range []string{oldPath, newPath, ckptPath} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	if err := s2.Close(); err != nil {
 		return err
 	}
 
-	// Do a write lock, which will prevent any new operations
-	// from executing and block until all existing operations
-	// complete.
-	s.blocked.Lock()
+	// Move s2's database next to the old one first, so that the
+	// slow copy between filesystems, if needed, happens while
+	// the old database is still in place.
+	if err := os.Rename(s2.Path, newPath); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			err = moveDir(s2.Path, newPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	if err := s2.db.Close(); err != nil {
-		s.blocked.Unlock()
-		return err
+	// Checkpoints consist of hard links to the database's files,
+	// so creating one is cheap, and it stays valid while the
+	// old database is moved out of the way.
+	ckpt, err := s.openCheckpoint(ckptPath)
+	if err != nil {
+		return errors.Join(err, os.RemoveAll(ckptPath))
 	}
-	if err := s.db.Close(); err != nil {
-		s.blocked.Unlock()
-		return err
+	if err := s.swap(ckpt); err != nil {
+		return errors.Join(err, s.reopen())
 	}
 
 	if err := os.Rename(s.Path, oldPath); err != nil {
-		s.blocked.Unlock()
-		return err
+		return errors.Join(err, s.reopen())
+	}
+	if err := os.Rename(newPath, s.Path); err != nil {
+		return errors.Join(err, os.Rename(oldPath, s.Path), s.reopen())
 	}
-	if err := os.Rename(s2.Path, s.Path); err != nil {
-		s.blocked.Unlock()
-		return errors.Join(err, os.Rename(oldPath, s.Path))
+	if err := s.reopen(); err != nil {
+		return errors.Join(
+			err,
+			os.Rename(s.Path, newPath),
+			os.Rename(oldPath, s.Path),
+			s.reopen(),
+		)
 	}
 
-	db, err := pebble.Open(s.Path, &pebble.Options{Logger: nopLogger{}})
+	return errors.Join(os.RemoveAll(oldPath), os.RemoveAll(ckptPath))
+}
+
+// openCheckpoint creates a checkpoint of the store's current
+// database at path and opens it in read-only mode.
+func (s *Store) openCheckpoint(path string) (*pebble.DB, error) {
+	db, err := s.acquire()
 	if err != nil {
-		s.blocked.Unlock()
-		return err
+		return nil, err
 	}
-	s.db = db
-
-	// We can unlock here even though there's more work to do because the replace
-	// operation itself is complete and concurrent operations are now safe to
-	// execute again.
-	s.blocked.Unlock()
+	err = db.Checkpoint(path)
+	db.release()
+	if err != nil {
+		return nil, err
+	}
+	return pebble.Open(path, &pebble.Options{Logger: nopLogger{}, ReadOnly: true})
+}
 
-	return os.RemoveAll(oldPath)
+// moveDir recursively copies the src directory to dst and then removes src.
+// It's used to move directories between filesystems, where renaming
+// them isn't possible. If the copy fails, dst is removed.
+func moveDir(src, dst string) error {
+	err := os.CopyFS(dst, os.DirFS(src))
+	if err != nil {
+		return errors.Join(err, os.RemoveAll(dst))
+	}
+	return os.RemoveAll(src)
 }
 
-// Close closes the underlying database
+// Close waits for any running operations to finish and then closes the
+// underlying database. Operations started afterwards fail with [pebble.ErrClosed].
 func (s *Store) Close() error {
-	if !s.blocked.TryRLock() {
-		return ErrBlocked
-	}
-	defer s.blocked.RUnlock()
-	return s.db.Close()
+	return s.db.Load().retire()
 }
 
-// overlap calculates the overlap between two sets of tags.
-// It returns the list of overlapping tags and a confidence score.
-func overlap(stags, ptags []string) ([]string, float32) {
-	var overlapTags []string
+// Overlap calculates the overlap between a set of search tags and a package's tags.
+// It returns the list of overlapping tags and a confidence score. Glob search tags
+// (see [ValidateTags]) count as overlapping if any of the package's tags
+// match them, and the first matching package tag is added to the overlap list.
+// Each search tag counts towards the confidence score according to its
+// [go.elara.ws/distrohop/internal/tags.Weight].
+func Overlap(stags, ptags []string) ([]string, float32) {
+	var (
+		overlapTags   []string
+		total, weight float32
+	)
 	for _, stag := range stags {
-		if slices.Contains(ptags, stag) {
+		w := tagWeight(stag)
+		total += w
+		if isGlob(stag) {
+			for _, ptag := range ptags {
+				if matchGlob(stag, ptag) {
+					overlapTags = append(overlapTags, ptag)
+					weight += w
+					break
+				}
+			}
+		} else if slices.Contains(ptags, stag) {
 			overlapTags = append(overlapTags, stag)
+			weight += w
+		}
+	}
+	if total == 0 {
+		return overlapTags, 0
+	}
+	return overlapTags, weight / total
+}
+
+// CrossTypeOverlap calculates the cross-type overlap between a set of search tags and
+// a package's tags. Search tags that didn't overlap with the package's tags, but are
+// related to one of them according to [go.elara.ws/distrohop/internal/tags.Related],
+// such as bin=foo and desktop=foo, count towards the confidence score with their weight
+// reduced by [go.elara.ws/distrohop/internal/tags.CrossTypeWeight]. It returns the list
+// of related package tags and the amount to add to the confidence score from [Overlap].
+// Glob search tags are skipped.
+func CrossTypeOverlap(stags, ptags []string) ([]string, float32) {
+	var (
+		crossTags     []string
+		total, weight float32
+	)
+	for _, stag := range stags {
+		w := tagWeight(stag)
+		total += w
+		if isGlob(stag) || slices.Contains(ptags, stag) {
+			continue
+		}
+		for _, rel := range tags.Related(stag) {
+			if slices.Contains(ptags, rel) {
+				crossTags = append(crossTags, rel)
+				weight += w * tags.CrossTypeWeight
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return crossTags, 0
+	}
+	return crossTags, weight / total
+}
+
+// crossTypeContains checks whether the search tag stag is related
+// to any of the cross-type tags of a search result
+func crossTypeContains(crossTags []string, stag string) bool {
+	if len(crossTags) == 0 || isGlob(stag) {
+		return false
+	}
+	return slices.ContainsFunc(tags.Related(stag), func(rel string) bool {
+		return slices.Contains(crossTags, rel)
+	})
+}
+
+// withRelated returns stags along with the tags related to each of them
+// according to [go.elara.ws/distrohop/internal/tags.Related]
+func withRelated(stags []string) []string {
+	out := slices.Clone(stags)
+	for _, stag := range stags {
+		if !isGlob(stag) {
+			out = append(out, tags.Related(stag)...)
+		}
+	}
+	return out
+}
+
+// FullMatch reports whether every one of a package's tags is matched by the search
+// tags, either exactly or by a glob pattern. Packages without any tags never match.
+func FullMatch(stags, ptags []string) bool {
+	if len(ptags) == 0 {
+		return false
+	}
+	for _, ptag := range ptags {
+		matched := slices.ContainsFunc(stags, func(stag string) bool {
+			if isGlob(stag) {
+				return matchGlob(stag, ptag)
+			}
+			return stag == ptag
+		})
+		if !matched {
+			return false
 		}
 	}
-	return overlapTags, float32(len(overlapTags)) / float32(len(stags))
+	return true
 }
 
 // unsafeBytes converts a string to a byte slice using unsafe operations
@@ -0,0 +1,451 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/index"
+)
+
+// newTestStore creates a store in a temporary directory containing
+// packages with the given tags, and closes it when the test ends.
+func newTestStore(t testing.TB, pkgs map[string][]string) *Store {
+	t.Helper()
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	writeTestPkgs(t, s, pkgs)
+	return s
+}
+
+// writeTestPkgs writes packages with the given tags to s, along with their bloom filters
+func writeTestPkgs(t testing.TB, s *Store, pkgs map[string][]string) {
+	t.Helper()
+	batch := make(map[string]index.Record, len(pkgs))
+	for name, tags := range pkgs {
+		batch[name] = index.Record{Name: name, Tags: tags}
+	}
+	filters := NewFilters(nil)
+	if err := s.WriteBatch(batch, filters); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFilters(filters); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resultNames returns the names of the packages in results, in order
+func resultNames(results []TagResult) []string {
+	var out []string
+	for _, res := range results {
+		out = append(out, res.Package.Name)
+	}
+	return out
+}
+
+func TestEncodeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"plain", []string{"bin=vim", "man=vim.1"}, "bin=vim\x1Fman=vim.1"},
+		{"separator", []string{"file=a\x1Fb", "bin=vim"}, "file=a\x1B\x1Fb\x1Fbin=vim"},
+		{"escape", []string{"file=a\x1Bb"}, "file=a\x1B\x1Bb"},
+		{"trailing escape", []string{"file=a\x1B", "bin=vim"}, "file=a\x1B\x1B\x1Fbin=vim"},
+	}
+	for _, tt := range tests {
+		got := EncodeTags(tt.tags)
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if decoded := DecodeTags(string(got)); !slices.Equal(decoded, tt.tags) {
+			t.Errorf("%s: round trip: got %q, want %q", tt.name, decoded, tt.tags)
+		}
+	}
+}
+
+func TestSeparatorInTag(t *testing.T) {
+	sepTag := "file=/usr/share/a\x1Fb"
+	s := newTestStore(t, map[string][]string{
+		"sep":   {sepTag, "bin=sep"},
+		"plain": {"file=/usr/share/a", "file=b"},
+	})
+
+	pkg, err := s.GetPkg("sep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bin=sep", sepTag}; !slices.Equal(pkg.Tags, want) {
+		t.Errorf("got tags %q, want %q", pkg.Tags, want)
+	}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{sepTag}, []string{"sep"}},
+		// The halves of the tag shouldn't match on their own
+		{[]string{"file=/usr/share/a"}, []string{"plain"}},
+		{[]string{"file=b"}, []string{"plain"}},
+	}
+	for _, tt := range tests {
+		results, _, err := s.Search(tt.tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resultNames(results); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.tags, got, tt.want)
+		}
+		for _, res := range results {
+			if !slices.Equal(res.Overlap, tt.tags) {
+				t.Errorf("%q: got overlap %q", tt.tags, res.Overlap)
+			}
+		}
+	}
+}
+
+// BenchmarkFilterFalsePositives fills a dense bucket's bloom filter with
+// denseTags tags, and reports the rate of false positives for tags that
+// were never added, with and without sizing the filter up front.
+func BenchmarkFilterFalsePositives(b *testing.B) {
+	const denseTags, lookups = 200_000, 100_000
+	for _, bc := range []struct {
+		name string
+		size int
+	}{
+		{"unsized", 0},
+		{"sized", denseTags},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var fpRate float64
+			for range b.N {
+				f := newFilter(bc.size)
+				for i := range denseTags {
+					f.Add([]byte(fmt.Sprintf("file=/usr/share/%d", i)))
+				}
+
+				falsePositives := 0
+				for i := range lookups {
+					if f.Lookup([]byte(fmt.Sprintf("bin=missing%d", i))) {
+						falsePositives++
+					}
+				}
+				fpRate = float64(falsePositives) / lookups
+			}
+			b.ReportMetric(fpRate*100, "%fp")
+		})
+	}
+}
+
+func TestReplaceConcurrentReads(t *testing.T) {
+	const replacements = 10
+
+	s, err := Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	writeTestPkgs(t, s, map[string][]string{"vim": {"bin=vim"}, "nano": {"bin=nano"}})
+
+	stop := make(chan struct{})
+	errs := make(chan error, 2)
+	var wg sync.WaitGroup
+	readers := []func() error{
+		func() error {
+			results, _, err := s.Search([]string{"bin=vim"})
+			if err == nil && !slices.Contains(resultNames(results), "vim") {
+				err = fmt.Errorf("search results %v don't contain vim", resultNames(results))
+			}
+			return err
+		},
+		func() error {
+			_, err := s.GetPkg("nano")
+			return err
+		},
+	}
+	for _, read := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := read(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range replacements {
+		s2, err := Open(filepath.Join(t.TempDir(), "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestPkgs(t, s2, map[string][]string{
+			"vim":  {"bin=vim", "bin=vim" + strconv.Itoa(i)},
+			"nano": {"bin=nano"},
+		})
+		if err := s.Replace(s2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("read failed during a replacement: %v", err)
+	}
+
+	pkg, err := s.GetPkg("vim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bin=vim" + strconv.Itoa(replacements-1); !slices.Contains(pkg.Tags, want) {
+		t.Errorf("got tags %v after the last replacement, want %s", pkg.Tags, want)
+	}
+}
+
+// TestHelperHoldLock isn't a real test. TestOpenContextLocked runs it in a separate
+// process to hold the lock on a database until its standard input is closed.
+func TestHelperHoldLock(t *testing.T) {
+	path := os.Getenv("DISTROHOP_HOLD_LOCK")
+	if path == "" {
+		t.Skip("only run by TestOpenContextLocked")
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	fmt.Println("locked")
+	io.Copy(io.Discard, os.Stdin)
+}
+
+// holdLock locks the database at path in another process, and returns
+// a function that makes the process release it and exit.
+func holdLock(t *testing.T, path string) (release func()) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHoldLock$")
+	cmd.Env = append(os.Environ(), "DISTROHOP_HOLD_LOCK="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	release = sync.OnceFunc(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	t.Cleanup(release)
+
+	sc := bufio.NewScanner(stdout)
+	for sc.Scan() {
+		if sc.Text() == "locked" {
+			go io.Copy(io.Discard, stdout)
+			return release
+		}
+	}
+	t.Fatal("helper process exited without locking the database")
+	return nil
+}
+
+func TestOpenContextLocked(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		releaseAfter time.Duration
+		wantErr      bool
+	}{
+		{name: "no wait", timeout: 0, wantErr: true},
+		{name: "timeout", timeout: 500 * time.Millisecond, wantErr: true},
+		{name: "released", timeout: 10 * time.Second, releaseAfter: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			s, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			release := holdLock(t, path)
+			if tt.releaseAfter > 0 {
+				time.AfterFunc(tt.releaseAfter, release)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			s, err = OpenContext(ctx, path)
+			elapsed := time.Since(start)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrLocked) {
+					t.Fatalf("got error %v, want %v", err, ErrLocked)
+				}
+				if elapsed < tt.timeout {
+					t.Errorf("gave up after %s, before the %s timeout", elapsed, tt.timeout)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			if elapsed < tt.releaseAfter {
+				t.Errorf("opened after %s, before the lock was released", elapsed)
+			}
+		})
+	}
+}
+
+func TestNewFilters(t *testing.T) {
+	const dense = 5000
+	filters := NewFilters(map[byte]int{'l': dense, 'v': 3})
+
+	encodedSize := func(char byte) int {
+		t.Helper()
+		data, err := filters[char].GobEncode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(data)
+	}
+
+	// Filters for characters with few tags get the minimum
+	// size, so they're the same as ones created on demand.
+	joinTags('a', nil, filters)
+	if sparse, onDemand := encodedSize('v'), encodedSize('a'); sparse != onDemand {
+		t.Errorf("got sparse filter size %d, want the minimum size %d", sparse, onDemand)
+	}
+
+	// A filter sized for the dense bucket shouldn't have to add internal
+	// filters while its tags are added, but one with the minimum size should.
+	// Adding a filter at least doubles the size, while the encoded counters
+	// only change it by a few bytes.
+	sizedBefore := encodedSize('l')
+	for i := range dense {
+		tag := []string{"lib=lib" + strconv.Itoa(i) + ".so"}
+		joinTags('l', tag, filters)
+		joinTags('a', tag, filters)
+	}
+	if sizedAfter := encodedSize('l'); sizedAfter > sizedBefore*3/2 {
+		t.Errorf("sized filter grew from %d to %d bytes", sizedBefore, sizedAfter)
+	}
+	if minSize := encodedSize('v'); encodedSize('a') <= minSize*2 {
+		t.Errorf("expected the minimum-sized filter to grow past %d bytes", minSize*2)
+	}
+
+	for i := range dense {
+		if !filters['l'].Lookup([]byte("lib=lib" + strconv.Itoa(i) + ".so")) {
+			t.Fatalf("tag %d is missing from the sized filter", i)
+		}
+	}
+}
+
+func TestGetPkgNamesByPrefix(t *testing.T) {
+	s := newTestStore(t, map[string][]string{
+		"cafe":     {"bin=cafe"},
+		"café":     {"bin=café"},
+		"caféine":  {"bin=caféine"},
+		"cafè":     {"bin=cafè"},
+		"cafg":     {"bin=cafg"},
+		"日本語":      {"bin=nihongo"},
+		"日本語-doc":  {"file=/usr/share/doc/nihongo"},
+		"日本酒":      {"bin=sake"},
+		"vim":      {"bin=vim"},
+		"vim-tiny": {"bin=vi"},
+	})
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"vim", []string{"vim", "vim-tiny"}},
+		{"caf", []string{"cafe", "cafg", "cafè", "café", "caféine"}},
+		{"café", []string{"café", "caféine"}},
+		{"cafè", []string{"cafè"}},
+		{"日本", []string{"日本語", "日本語-doc", "日本酒"}},
+		{"日本語", []string{"日本語", "日本語-doc"}},
+		{"日本酒", []string{"日本酒"}},
+		{"emacs", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := s.GetPkgNamesByPrefix(tt.prefix, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []byte
+	}{
+		{"vim", []byte("vin")},
+		// é is 0xC3 0xA9, so the bound is right after
+		// every key that starts with the full character
+		{"café", []byte("caf\xC3\xAA")},
+		{"a\xFF", []byte("b")},
+		{"\xFF\xFF", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := prefixUpperBound(tt.prefix); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TiebreakMode determines how results with the same confidence are ordered
+type TiebreakMode string
+
+const (
+	// TiebreakName orders results with the same confidence by package name
+	TiebreakName TiebreakMode = "name"
+	// TiebreakOverlap puts results with more overlapping tags first
+	TiebreakOverlap TiebreakMode = "overlap"
+	// TiebreakRepo puts results from sources earlier in
+	// the priority list of a [Tiebreak] first
+	TiebreakRepo TiebreakMode = "repo"
+)
+
+// ParseTiebreakMode parses a tiebreak mode name. An empty
+// string is parsed as [TiebreakName].
+func ParseTiebreakMode(s string) (TiebreakMode, error) {
+	switch m := TiebreakMode(s); m {
+	case "":
+		return TiebreakName, nil
+	case TiebreakName, TiebreakOverlap, TiebreakRepo:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid tiebreak mode: %q", s)
+	}
+}
+
+// Tiebreak determines how [SortResultsBy] orders results with the same confidence.
+// The zero value orders them by package name, like [SortResults].
+type Tiebreak struct {
+	Mode TiebreakMode
+	// Priority is a list of sources in order of preference, used by [TiebreakRepo].
+	// An entry without an architecture, such as "main", matches every architecture
+	// of that component. Results from sources that aren't in the list come last.
+	Priority []string
+}
+
+// compare compares two results with the same confidence
+func (tb Tiebreak) compare(a, b TagResult) int {
+	switch tb.Mode {
+	case TiebreakOverlap:
+		return cmp.Compare(len(b.Overlap), len(a.Overlap))
+	case TiebreakRepo:
+		return cmp.Compare(tb.priority(a.Source), tb.priority(b.Source))
+	default:
+		return 0
+	}
+}
+
+// priority returns the position of source in the priority list,
+// or the length of the list if it's not in it.
+func (tb Tiebreak) priority(source string) int {
+	component, _, _ := strings.Cut(source, "/")
+	for i, entry := range tb.Priority {
+		if entry == source || entry == component {
+			return i
+		}
+	}
+	return len(tb.Priority)
+}
+
+// SortResultsBy sorts tag results by confidence, ordering results with equal
+// confidence according to tb. Results that are still tied are sorted by package
+// name and then by source, so that the order is always deterministic.
+func SortResultsBy(results []TagResult, tb Tiebreak) {
+	slices.SortFunc(results, func(a, b TagResult) int {
+		if a.Confidence < b.Confidence {
+			return 1
+		} else if a.Confidence > b.Confidence {
+			return -1
+		} else if c := tb.compare(a, b); c != 0 {
+			return c
+		} else if c := strings.Compare(a.Package.Name, b.Package.Name); c != 0 {
+			return c
+		} else {
+			return strings.Compare(a.Source, b.Source)
+		}
+	})
+}
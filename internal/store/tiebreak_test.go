@@ -0,0 +1,87 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSortResultsBy(t *testing.T) {
+	// Every result except the first has the same confidence, so
+	// only the tiebreaker determines the order of the others.
+	results := []TagResult{
+		{Confidence: 0.5, Overlap: []string{"bin=a"}, Package: Package{Name: "alpha"}, Source: "universe/amd64"},
+		{Confidence: 0.5, Overlap: []string{"bin=a", "bin=b", "bin=c"}, Package: Package{Name: "charlie"}, Source: "restricted/amd64"},
+		{Confidence: 1, Overlap: []string{"bin=a"}, Package: Package{Name: "zulu"}, Source: "universe/amd64"},
+		{Confidence: 0.5, Overlap: []string{"bin=a", "bin=b"}, Package: Package{Name: "bravo"}, Source: "main/amd64"},
+		{Confidence: 0.5, Overlap: []string{"bin=a"}, Package: Package{Name: "bravo"}, Source: "main/arm64"},
+	}
+
+	tests := []struct {
+		name string
+		tb   Tiebreak
+		want []string
+	}{
+		{"zero", Tiebreak{}, []string{"zulu", "alpha", "bravo", "bravo", "charlie"}},
+		{"name", Tiebreak{Mode: TiebreakName}, []string{"zulu", "alpha", "bravo", "bravo", "charlie"}},
+		{"overlap", Tiebreak{Mode: TiebreakOverlap}, []string{"zulu", "charlie", "bravo", "alpha", "bravo"}},
+		{"repo", Tiebreak{Mode: TiebreakRepo, Priority: []string{"main", "universe/amd64"}}, []string{"zulu", "bravo", "bravo", "alpha", "charlie"}},
+		{"repo with arch", Tiebreak{Mode: TiebreakRepo, Priority: []string{"main/arm64", "restricted"}}, []string{"zulu", "bravo", "charlie", "alpha", "bravo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := slices.Clone(results)
+			SortResultsBy(sorted, tt.tb)
+			if got := resultNames(sorted); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Results that are still tied are sorted by source
+	sorted := slices.Clone(results)
+	SortResultsBy(sorted, Tiebreak{})
+	if sorted[2].Source != "main/amd64" || sorted[3].Source != "main/arm64" {
+		t.Errorf("expected tied results to be sorted by source, got %s and %s", sorted[2].Source, sorted[3].Source)
+	}
+}
+
+func TestParseTiebreakMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want TiebreakMode
+	}{
+		{"", TiebreakName},
+		{"name", TiebreakName},
+		{"overlap", TiebreakOverlap},
+		{"repo", TiebreakRepo},
+	}
+	for _, tt := range tests {
+		if got, err := ParseTiebreakMode(tt.in); err != nil || got != tt.want {
+			t.Errorf("%q: expected %s, got %q (%v)", tt.in, tt.want, got, err)
+		}
+	}
+	if _, err := ParseTiebreakMode("random"); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
@@ -24,9 +24,63 @@ package tags
 
 import (
 	"path"
+	"slices"
 	"strings"
 )
 
+// Keys of the tag types that distrohop generates
+const (
+	KeyBin        = "bin"
+	KeyIcon       = "icon"
+	KeyMan        = "man"
+	KeyPy         = "py"
+	KeyPkgCfg     = "pkgcfg"
+	KeyDesktop    = "desktop"
+	KeyDBus       = "dbus"
+	KeySystemd    = "systemd"
+	KeyHdr        = "hdr"
+	KeyGettext    = "gettext"
+	KeyLib        = "lib"
+	KeyAppArmor   = "apparmor"
+	KeySELinux    = "selinux"
+	KeyUdev       = "udev"
+	KeyCompletion = "completion"
+	KeyFile       = "file"
+	KeySrc        = "src"
+	KeyProvides   = "provides"
+)
+
+// Type describes a kind of tag. Tags are in the "key=value" format,
+// and the key determines what the value represents.
+type Type struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Types contains every tag type that distrohop generates. Tags are generated
+// from file paths by [Generate], except for the src and provides tags, which come
+// from package metadata in repos that provide it.
+var Types = []Type{
+	{KeyBin, "Executable in a bin, sbin, games, or libexec directory"},
+	{KeyIcon, "Icon image in an icons or pixmaps directory"},
+	{KeyMan, "Manual page"},
+	{KeyPy, "Python package"},
+	{KeyPkgCfg, "pkg-config module"},
+	{KeyDesktop, "Desktop entry ID"},
+	{KeyDBus, "D-Bus service"},
+	{KeySystemd, "systemd unit"},
+	{KeyHdr, "C or C++ header, relative to the include directory"},
+	{KeyGettext, "Translation domain"},
+	{KeyLib, "Shared or static library, with and without its version and lib prefix"},
+	{KeyAppArmor, "AppArmor profile"},
+	{KeySELinux, "SELinux policy module"},
+	{KeyUdev, "udev rules file, with and without its extension and priority prefix"},
+	{KeyCompletion, "Command with a bash, zsh, or fish completion file"},
+	{KeyFile, "Full path of a file that doesn't match any other tag type"},
+	{KeySrc, "Source package that the package was built from, if its name is different"},
+	{KeyProvides, "Virtual package provided by the package"},
+}
+
 // Generate generates a list of tags based on the input filename.
 func Generate(filePath string) (tags []string) {
 	lastSlash := strings.LastIndexByte(filePath, '/')
@@ -36,46 +90,64 @@ func Generate(filePath string) (tags []string) {
 	for _, elem := range pathElems {
 		switch elem {
 		case "usr", "opt", "local", "share":
-			// Skip directories that we don't care about
+			// Skip directories that we don't care about. This includes the
+			// /usr/local prefix, so that the files of FreeBSD packages, which
+			// are all installed under it, get the same tags as on Linux.
 			continue
 		case "bin", "sbin":
-			tags = append(tags, "bin="+name)
+			tags = append(tags, KeyBin+"="+name)
 			added = true
+		case "games":
+			// Only files directly in the games directory are executables.
+			// Game data is in its subdirectories, or in /usr/share/games.
+			if path.Base(dir) == "games" && !slices.Contains(pathElems, "share") {
+				tags = append(tags, KeyBin+"="+name)
+				added = true
+			}
+		case "libexec":
+			// Helper programs are either directly in libexec or in a subdirectory
+			// named after their package, such as /usr/libexec/git-core. Some
+			// packages also put private shared libraries there, which aren't
+			// executables.
+			if _, sub, _ := strings.Cut(filePath, "/libexec/"); strings.Count(sub, "/") <= 1 && !isSharedLib(name) {
+				tags = append(tags, KeyBin+"="+name)
+				added = true
+			}
 		case "icons", "pixmaps":
 			switch path.Ext(name) {
 			case ".svg", ".png", ".jpg", ".jpeg":
-				tags = append(tags, "icon="+name)
+				tags = append(tags, KeyIcon+"="+name)
 				added = true
 			}
 		case "man":
 			if manName := manualName(name); manName != "" {
-				tags = append(tags, "man="+manName)
+				tags = append(tags, KeyMan+"="+manName)
 				added = true
 			}
 		case "dist-packages", "site-packages":
 			if pyName := pythonName(filePath); pyName != "" {
-				tags = append(tags, "py="+pyName)
+				tags = append(tags, KeyPy+"="+pyName)
 				added = true
 			}
 		case "pkgconfig", "pkg-config":
 			if path.Ext(name) == ".pc" {
-				tags = append(tags, "pkgcfg="+strings.TrimSuffix(name, ".pc"))
+				tags = append(tags, KeyPkgCfg+"="+strings.TrimSuffix(name, ".pc"))
 				added = true
 			}
 		case "applications":
 			if path.Ext(name) == ".desktop" {
-				tags = append(tags, "desktop="+strings.TrimSuffix(name, ".desktop"))
+				tags = append(tags, KeyDesktop+"="+strings.TrimSuffix(name, ".desktop"))
 				added = true
 			}
 		case "dbus-1":
 			if path.Ext(name) == ".service" {
-				tags = append(tags, "dbus="+strings.TrimSuffix(name, ".service"))
+				tags = append(tags, KeyDBus+"="+strings.TrimSuffix(name, ".service"))
 				added = true
 			}
 		case "systemd":
 			switch path.Ext(name) {
 			case ".service", ".target", ".socket", ".timer":
-				tags = append(tags, "systemd="+name)
+				tags = append(tags, KeySystemd+"="+name)
 				added = true
 			}
 		case "include":
@@ -85,22 +157,58 @@ func Generate(filePath string) (tags []string) {
 				if !ok {
 					hdrName = name
 				}
-				tags = append(tags, "hdr="+hdrName)
+				tags = append(tags, KeyHdr+"="+hdrName)
+				added = true
+			}
+		case "locale", "locale-langpack":
+			// Translations are in <locale>/<lang>/LC_MESSAGES/<domain>.mo. The
+			// language is dropped so that every translation of the same domain
+			// gets the same tag.
+			if path.Ext(name) == ".mo" && path.Base(dir) == "LC_MESSAGES" {
+				tags = append(tags, KeyGettext+"="+strings.TrimSuffix(name, ".mo"))
 				added = true
 			}
 		case "lib", "lib32", "lib64":
 			if libName, soversion, ok := strings.Cut(name, ".so"); ok && soversionIsValid(soversion) {
-				tags = append(tags, "lib="+name)
+				tags = append(tags, KeyLib+"="+name)
 				lastChar := name[len(name)-1]
 				if lastChar >= '0' || lastChar <= '9' {
-					tags = append(tags, "lib="+libName+".so")
+					tags = append(tags, KeyLib+"="+libName+".so")
 					canonicalLibName := strings.TrimPrefix(libName, "lib")
-					tags = append(tags, "lib="+canonicalLibName)
+					tags = append(tags, KeyLib+"="+canonicalLibName)
 				}
 				added = true
 			} else if path.Ext(name) == ".a" {
-				tags = append(tags, "lib="+name)
-				tags = append(tags, "lib="+strings.TrimSuffix(name, ".a"))
+				tags = append(tags, KeyLib+"="+name)
+				tags = append(tags, KeyLib+"="+strings.TrimSuffix(name, ".a"))
+				added = true
+			}
+		case "apparmor.d":
+			// Only files directly in apparmor.d are profiles. Its subdirectories
+			// contain abstractions, tunables, and local overrides.
+			if path.Base(dir) == "apparmor.d" && !strings.HasPrefix(name, ".") {
+				tags = append(tags, KeyAppArmor+"="+name)
+				added = true
+			}
+		case "selinux":
+			if modName := selinuxModuleName(name); modName != "" {
+				tags = append(tags, KeySELinux+"="+modName)
+				added = true
+			}
+		case "rules.d":
+			if path.Ext(name) == ".rules" && path.Base(path.Dir(dir)) == "udev" {
+				// The priority prefix only determines the order in which
+				// the rules are applied, and it often differs between distros.
+				rulesName := udevRulesName(name)
+				tags = append(tags, KeyUdev+"="+rulesName)
+				tags = append(tags, KeyUdev+"="+strings.TrimSuffix(rulesName, ".rules"))
+				added = true
+			}
+		case "bash-completion", "bash_completion.d", "zsh", "fish":
+			// Every shell names its completion files differently, so the
+			// command name is used to make them match across shells.
+			if cmdName := completionName(dir, name); cmdName != "" {
+				tags = append(tags, KeyCompletion+"="+cmdName)
 				added = true
 			}
 		default:
@@ -113,14 +221,69 @@ func Generate(filePath string) (tags []string) {
 	}
 
 	if !added {
-		tags = append(tags, "file="+filePath)
+		tags = append(tags, KeyFile+"="+filePath)
 	}
 
 	return tags
 }
 
+// weights contains the weights of tag keys that don't count fully towards
+// confidence scores. Tags with any other key have a weight of 1.
+var weights = map[string]float32{
+	// Translations are often shared between packages that do very different
+	// things, such as libraries and the apps that use them, so they're not a
+	// good indication that two packages are equivalent.
+	KeyGettext: 0.25,
+}
+
+// Weight returns how much the given tag counts towards confidence scores
+func Weight(tag string) float32 {
+	key, _, _ := strings.Cut(tag, "=")
+	if weight, ok := weights[key]; ok {
+		return weight
+	}
+	return 1
+}
+
+// CrossTypeWeight is the fraction of a search tag's weight that counts towards
+// a confidence score when the tag didn't match, but a related tag of another
+// type did. See [Related].
+const CrossTypeWeight = 0.5
+
+// Related returns the tags of other types that may refer to the same thing as tag,
+// which are used for cross-type matching. An app may only have an executable in one
+// distro and only a desktop entry in another, so bin and desktop tags with the same
+// value are related. Desktop entry IDs are often in reverse-DNS notation, such as
+// org.gnome.Nautilus, so they're also related to executables named after their
+// last component in lowercase.
+func Related(tag string) []string {
+	key, val, _ := strings.Cut(tag, "=")
+	switch key {
+	case KeyBin:
+		return []string{KeyDesktop + "=" + val}
+	case KeyDesktop:
+		out := []string{KeyBin + "=" + val}
+		if i := strings.LastIndexByte(val, '.'); i != -1 && i < len(val)-1 {
+			if stem := strings.ToLower(val[i+1:]); stem != val {
+				out = append(out, KeyBin+"="+stem)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// manualName returns the name of the manual page in the given file,
+// or an empty string if it's not one. Most distros compress manual pages
+// using gzip, but Gentoo uses bzip2 by default, and the compression can
+// be changed in both Gentoo and Arch, so other formats are accepted too.
 func manualName(fileName string) string {
-	fileName = strings.TrimSuffix(fileName, ".gz")
+	for _, ext := range [...]string{".gz", ".bz2", ".xz", ".zst"} {
+		if name, ok := strings.CutSuffix(fileName, ext); ok {
+			fileName = name
+			break
+		}
+	}
 	ext := path.Ext(fileName)
 	if len(ext) == 0 || !isNum(ext[1:]) {
 		return ""
@@ -144,6 +307,55 @@ func pythonName(filePath string) string {
 	return ""
 }
 
+// selinuxModuleName returns the name of the SELinux policy module
+// in the given file, or an empty string if it's not a module.
+func selinuxModuleName(fileName string) string {
+	for _, ext := range [...]string{".pp", ".pp.bz2"} {
+		if modName, ok := strings.CutSuffix(fileName, ext); ok {
+			return modName
+		}
+	}
+	return ""
+}
+
+// udevRulesName removes the numeric priority prefix from the name of a
+// udev rules file, unless the name would be empty without it.
+func udevRulesName(fileName string) string {
+	prefix, rest, ok := strings.Cut(fileName, "-")
+	if !ok || prefix == "" || strings.TrimSuffix(rest, ".rules") == "" || !isNum(prefix) {
+		return fileName
+	}
+	return rest
+}
+
+// completionName returns the name of the command completed by the shell
+// completion file in dir, or an empty string if it's not a completion file.
+func completionName(dir, fileName string) string {
+	switch {
+	case strings.HasSuffix(dir, "/bash-completion/completions"), strings.HasSuffix(dir, "/bash_completion.d"):
+		return strings.TrimSuffix(fileName, ".bash")
+	case strings.HasSuffix(dir, "/zsh/site-functions"), strings.HasSuffix(dir, "/zsh/vendor-completions"):
+		// zsh completion functions are named after the command with
+		// an underscore prefix. Other functions may be in the same
+		// directory, so files without the prefix are skipped.
+		if cmdName, ok := strings.CutPrefix(fileName, "_"); ok {
+			return cmdName
+		}
+	case strings.HasSuffix(dir, "/fish/completions"), strings.HasSuffix(dir, "/fish/vendor_completions.d"):
+		if cmdName, ok := strings.CutSuffix(fileName, ".fish"); ok {
+			return cmdName
+		}
+	}
+	return ""
+}
+
+// isSharedLib checks whether fileName is the name of a shared library,
+// with or without a version, such as libfoo.so or libfoo.so.1.2.
+func isSharedLib(fileName string) bool {
+	_, soversion, ok := strings.Cut(fileName, ".so")
+	return ok && soversionIsValid(soversion)
+}
+
 func soversionIsValid(s string) bool {
 	if s == "" {
 		return true
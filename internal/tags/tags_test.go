@@ -0,0 +1,163 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package tags
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/usr/share/locale/de/LC_MESSAGES/nautilus.mo", []string{"gettext=nautilus"}},
+		{"/usr/share/locale/pt_BR/LC_MESSAGES/nautilus.mo", []string{"gettext=nautilus"}},
+		{"/usr/share/locale-langpack/en_GB/LC_MESSAGES/gedit.mo", []string{"gettext=gedit"}},
+		{"/usr/share/locale/de/LC_MESSAGES/nautilus.po", []string{"file=/usr/share/locale/de/LC_MESSAGES/nautilus.po"}},
+		{"/usr/share/locale/locale.alias", []string{"file=/usr/share/locale/locale.alias"}},
+		{"/etc/apparmor.d/usr.sbin.cupsd", []string{"apparmor=usr.sbin.cupsd"}},
+		{"/etc/apparmor.d/abstractions/base", []string{"file=/etc/apparmor.d/abstractions/base"}},
+		{"/etc/apparmor.d/local/usr.sbin.cupsd", []string{"file=/etc/apparmor.d/local/usr.sbin.cupsd"}},
+		{"/etc/apparmor.d/.hidden", []string{"file=/etc/apparmor.d/.hidden"}},
+		{"/usr/share/selinux/packages/container.pp", []string{"selinux=container"}},
+		{"/usr/share/selinux/packages/targeted/container.pp.bz2", []string{"selinux=container"}},
+		{"/usr/share/selinux/devel/include/container.if", []string{"file=/usr/share/selinux/devel/include/container.if"}},
+		{"/usr/lib/udev/rules.d/70-uaccess.rules", []string{"udev=uaccess.rules", "udev=uaccess"}},
+		{"/etc/udev/rules.d/99-android.rules", []string{"udev=android.rules", "udev=android"}},
+		{"/lib/udev/rules.d/libsane.rules", []string{"udev=libsane.rules", "udev=libsane"}},
+		{"/usr/lib/udev/rules.d/60-persistent-storage-dm.rules", []string{"udev=persistent-storage-dm.rules", "udev=persistent-storage-dm"}},
+		{"/usr/lib/udev/rules.d/70-.rules", []string{"udev=70-.rules", "udev=70-"}},
+		{"/usr/lib/udev/rules.d/README", []string{"file=/usr/lib/udev/rules.d/README"}},
+		{"/etc/polkit-1/rules.d/50-default.rules", []string{"file=/etc/polkit-1/rules.d/50-default.rules"}},
+		{"/usr/share/bash-completion/completions/git", []string{"completion=git"}},
+		{"/usr/share/bash-completion/completions/rg.bash", []string{"completion=rg"}},
+		{"/etc/bash_completion.d/git-prompt", []string{"completion=git-prompt"}},
+		{"/usr/share/zsh/site-functions/_git", []string{"completion=git"}},
+		{"/usr/share/zsh/vendor-completions/_rg", []string{"completion=rg"}},
+		{"/usr/share/zsh/site-functions/prompt_pure_setup", []string{"file=/usr/share/zsh/site-functions/prompt_pure_setup"}},
+		{"/usr/share/fish/vendor_completions.d/git.fish", []string{"completion=git"}},
+		{"/usr/share/fish/completions/rg.fish", []string{"completion=rg"}},
+		{"/usr/share/fish/vendor_functions.d/fisher.fish", []string{"file=/usr/share/fish/vendor_functions.d/fisher.fish"}},
+		{"/usr/bin/vim", []string{"bin=vim"}},
+		{"/usr/sbin/sshd", []string{"bin=sshd"}},
+		{"/bin/sh", []string{"bin=sh"}},
+		{"/usr/local/bin/pkg", []string{"bin=pkg"}},
+		{"/usr/games/fortune", []string{"bin=fortune"}},
+		{"/usr/local/games/nethack", []string{"bin=nethack"}},
+		{"/usr/share/games/fortunes/art", []string{"file=/usr/share/games/fortunes/art"}},
+		{"/usr/games/lib/data", []string{"file=/usr/games/lib/data"}},
+		{"/usr/libexec/polkit-agent-helper-1", []string{"bin=polkit-agent-helper-1"}},
+		{"/usr/libexec/git-core/git-remote-http", []string{"bin=git-remote-http"}},
+		{"/usr/libexec/git-core/mergetools/vimdiff", []string{"file=/usr/libexec/git-core/mergetools/vimdiff"}},
+		{"/usr/libexec/thunderbird/libxul.so", []string{"file=/usr/libexec/thunderbird/libxul.so"}},
+		{"/usr/libexec/libfoo.so.1.2", []string{"file=/usr/libexec/libfoo.so.1.2"}},
+		{"/usr/libexec/gnome-session-socket", []string{"bin=gnome-session-socket"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Generate(tt.path); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want float32
+	}{
+		{"gettext=nautilus", 0.25},
+		{"bin=nautilus", 1},
+		{"file=/usr/share/locale/de/LC_MESSAGES/nautilus.mo", 1},
+		{"unknown", 1},
+	}
+
+	for _, tt := range tests {
+		if got := Weight(tt.tag); got != tt.want {
+			t.Errorf("%s: expected weight %v, got %v", tt.tag, tt.want, got)
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	keys := map[string]bool{}
+	for _, typ := range Types {
+		if keys[typ.Key] {
+			t.Errorf("duplicate tag type %q", typ.Key)
+		}
+		keys[typ.Key] = true
+		if typ.Description == "" {
+			t.Errorf("tag type %q has no description", typ.Key)
+		}
+	}
+
+	known := []string{
+		KeyBin, KeyIcon, KeyMan, KeyPy, KeyPkgCfg, KeyDesktop, KeyDBus, KeySystemd, KeyHdr,
+		KeyGettext, KeyLib, KeyAppArmor, KeySELinux, KeyUdev, KeyCompletion, KeyFile, KeySrc, KeyProvides,
+	}
+	for _, key := range known {
+		if !keys[key] {
+			t.Errorf("expected tag type %q to be listed", key)
+		}
+	}
+
+	// Every tag that Generate produces must have a listed type
+	for _, filePath := range []string{
+		"/usr/bin/vim",
+		"/usr/share/icons/hicolor/scalable/apps/vim.svg",
+		"/usr/share/man/man1/vim.1.gz",
+		"/usr/lib/python3/dist-packages/yaml/__init__.py",
+		"/usr/lib/pkgconfig/gtk4.pc",
+		"/usr/share/applications/org.gnome.Nautilus.desktop",
+		"/usr/share/dbus-1/services/org.gnome.Nautilus.service",
+		"/usr/lib/systemd/system/sshd.service",
+		"/usr/include/zlib.h",
+		"/usr/share/locale/de/LC_MESSAGES/nautilus.mo",
+		"/usr/lib/libz.so.1",
+		"/etc/apparmor.d/usr.sbin.cupsd",
+		"/usr/share/selinux/packages/container.pp.bz2",
+		"/usr/lib/udev/rules.d/60-persistent-storage.rules",
+		"/usr/share/bash-completion/completions/git",
+		"/etc/vimrc",
+	} {
+		for _, tag := range Generate(filePath) {
+			key, _, _ := strings.Cut(tag, "=")
+			if !keys[key] {
+				t.Errorf("%s: tag %q has an unlisted type", filePath, tag)
+			}
+		}
+	}
+
+	data, err := json.Marshal(Types[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"key":"bin","description":"` + Types[0].Description + `"}`; string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
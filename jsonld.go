@@ -0,0 +1,113 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/salix"
+)
+
+// schemaContext is the JSON-LD context for schema.org entities
+const schemaContext = "https://schema.org"
+
+// schemaApplication represents a package as a schema.org SoftwareApplication
+type schemaApplication struct {
+	Context         string `json:"@context,omitempty"`
+	Type            string `json:"@type"`
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+	Description     string `json:"description,omitempty"`
+}
+
+// schemaListItem represents a schema.org ListItem
+type schemaListItem struct {
+	Type     string            `json:"@type"`
+	Position int               `json:"position"`
+	Item     schemaApplication `json:"item"`
+}
+
+// schemaItemList represents search results as a schema.org ItemList. If the
+// search was for the equivalents of a package, About is set to that package.
+type schemaItemList struct {
+	Context         string             `json:"@context"`
+	Type            string             `json:"@type"`
+	About           *schemaApplication `json:"about,omitempty"`
+	NumberOfItems   int                `json:"numberOfItems"`
+	ItemListElement []schemaListItem   `json:"itemListElement"`
+}
+
+// packageJSONLD returns the JSON-LD representation of the given package in repo.
+// siteURL is the absolute URL of the distrohop instance.
+func packageJSONLD(cfg *config.Config, siteURL, repo, name string) schemaApplication {
+	return schemaApplication{
+		Type:            "SoftwareApplication",
+		Name:            name,
+		URL:             siteURL + "/pkg/" + url.PathEscape(repo) + "/" + url.PathEscape(name),
+		OperatingSystem: cfg.DisplayName(repo),
+	}
+}
+
+// resultsJSONLD returns the JSON-LD representation of the given search results
+// from inRepo. If fromRepo and pkgName are set, the results are described as
+// equivalents of that package.
+func resultsJSONLD(cfg *config.Config, siteURL, inRepo, fromRepo, pkgName string, results []store.TagResult) schemaItemList {
+	out := schemaItemList{
+		Context:         schemaContext,
+		Type:            "ItemList",
+		NumberOfItems:   len(results),
+		ItemListElement: make([]schemaListItem, len(results)),
+	}
+
+	if fromRepo != "" && pkgName != "" {
+		about := packageJSONLD(cfg, siteURL, fromRepo, pkgName)
+		out.About = &about
+	}
+
+	for i, result := range results {
+		out.ItemListElement[i] = schemaListItem{
+			Type:     "ListItem",
+			Position: i + 1,
+			Item:     packageJSONLD(cfg, siteURL, inRepo, result.Package.Name),
+		}
+	}
+
+	return out
+}
+
+// renderJSONLD writes ld as a JSON-LD document if the request has a format=jsonld
+// query parameter. Otherwise, it adds ld to vars so that it can be embedded in the
+// page, and executes the template with the given name.
+func renderJSONLD(ns *salix.Namespace, w http.ResponseWriter, r *http.Request, name string, vars map[string]any, ld any) error {
+	if r.URL.Query().Get("format") == "jsonld" {
+		w.Header().Set("Content-Type", "application/ld+json")
+		return json.NewEncoder(w).Encode(ld)
+	}
+	vars["jsonld"] = ld
+	return executeTemplate(ns, w, r, name, vars)
+}
@@ -0,0 +1,147 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+func TestResultsJSONLD(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{
+		{Name: "debian", DisplayName: "Debian"},
+		{Name: "fedora", DisplayName: "Fedora"},
+	}}
+	results := []store.TagResult{
+		{Package: store.Package{Name: "vim"}},
+		{Package: store.Package{Name: "neovim"}},
+	}
+
+	ld := resultsJSONLD(cfg, "https://example.com", "debian", "fedora", "vim-enhanced", results)
+	if ld.Context != schemaContext || ld.Type != "ItemList" {
+		t.Errorf("unexpected context or type: %q, %q", ld.Context, ld.Type)
+	}
+	if ld.NumberOfItems != 2 || len(ld.ItemListElement) != 2 {
+		t.Fatalf("expected 2 items, got %d (%d elements)", ld.NumberOfItems, len(ld.ItemListElement))
+	}
+	for i, name := range []string{"vim", "neovim"} {
+		item := ld.ItemListElement[i]
+		if item.Type != "ListItem" || item.Position != i+1 {
+			t.Errorf("item %d: unexpected type or position: %q, %d", i, item.Type, item.Position)
+		}
+		want := schemaApplication{
+			Type:            "SoftwareApplication",
+			Name:            name,
+			URL:             "https://example.com/pkg/debian/" + name,
+			OperatingSystem: "Debian",
+		}
+		if item.Item != want {
+			t.Errorf("item %d: expected %+v, got %+v", i, want, item.Item)
+		}
+	}
+
+	if ld.About == nil {
+		t.Fatal("expected about to be set for a package search")
+	}
+	if ld.About.Name != "vim-enhanced" || ld.About.URL != "https://example.com/pkg/fedora/vim-enhanced" || ld.About.OperatingSystem != "Fedora" {
+		t.Errorf("unexpected about: %+v", ld.About)
+	}
+
+	ld = resultsJSONLD(cfg, "https://example.com", "debian", "", "", results)
+	if ld.About != nil {
+		t.Errorf("expected no about for a tag search, got %+v", ld.About)
+	}
+}
+
+func TestRenderJSONLD(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{{Name: "debian", DisplayName: "Debian"}}}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := resultsView{
+		Results: []store.TagResult{{
+			Confidence: 1,
+			Category:   store.CategoryExact,
+			Overlap:    []string{"bin=vim"},
+			Package:    store.Package{Name: "vim", Tags: []string{"bin=vim"}},
+		}},
+		InRepo: "debian",
+		Tags:   []string{"bin=vim"},
+	}
+
+	checkList := func(t *testing.T, data []byte) {
+		t.Helper()
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("invalid JSON-LD: %v\n%s", err, data)
+		}
+		if doc["@context"] != schemaContext || doc["@type"] != "ItemList" {
+			t.Errorf("unexpected context or type: %v, %v", doc["@context"], doc["@type"])
+		}
+		items, _ := doc["itemListElement"].([]any)
+		if len(items) != 1 {
+			t.Fatalf("expected 1 item, got %v", doc["itemListElement"])
+		}
+		item, _ := items[0].(map[string]any)["item"].(map[string]any)
+		if item["@type"] != "SoftwareApplication" || item["name"] != "vim" || item["url"] != "http://example.com/pkg/debian/vim" {
+			t.Errorf("unexpected item: %v", item)
+		}
+	}
+
+	t.Run("document", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/search/tags?format=jsonld", nil)
+		if err := renderResults(ns, rec, req, cfg, rv); err != nil {
+			t.Fatal(err)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/ld+json" {
+			t.Errorf("expected application/ld+json content type, got %q", ct)
+		}
+		checkList(t, rec.Body.Bytes())
+	})
+
+	t.Run("embedded", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/search/tags", nil)
+		if err := renderResults(ns, rec, req, cfg, rv); err != nil {
+			t.Fatal(err)
+		}
+
+		const open = `<script type="application/ld+json">`
+		_, after, ok := strings.Cut(rec.Body.String(), open)
+		if !ok {
+			t.Fatal("expected the page to embed a JSON-LD script")
+		}
+		data, _, ok := strings.Cut(after, "</script>")
+		if !ok {
+			t.Fatal("unterminated JSON-LD script")
+		}
+		checkList(t, []byte(data))
+	})
+}
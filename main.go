@@ -23,20 +23,27 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/fs"
 	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 	"github.com/go-co-op/gocron/v2"
 	"go.elara.ws/distrohop/internal/config"
@@ -45,8 +52,8 @@ import (
 	"go.elara.ws/distrohop/internal/store"
 	"go.elara.ws/distrohop/internal/store/cached"
 	"go.elara.ws/distrohop/internal/store/combined"
+	"go.elara.ws/distrohop/internal/tags"
 	"go.elara.ws/loggers"
-	"go.elara.ws/salix"
 )
 
 //go:embed templates
@@ -56,6 +63,10 @@ var tmpls embed.FS
 var assets embed.FS
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(doctor(os.Stdout))
+	}
+
 	log := slog.New(loggers.NewPretty(os.Stderr, loggers.Options{Level: slog.LevelDebug}))
 	cfg, err := config.Load()
 	if err != nil {
@@ -63,14 +74,31 @@ func main() {
 		os.Exit(1)
 	}
 
-	dataDir, err := userDataDir()
+	fetcher := newFetcher(cfg)
+
+	dataDir, err := dataDirectory(cfg)
 	if err != nil {
 		log.Error("Error getting data directory", slog.Any("error", err))
 		os.Exit(1)
 	}
-	dataDir = filepath.Join(dataDir, "distrohop")
+
+	if len(os.Args) > 1 && os.Args[1] == "rebuild" {
+		if err := rebuild(log, cfg, fetcher, dataDir, os.Args[2:]); err != nil {
+			log.Error("Error rebuilding index", slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
 
 	stores := map[string]store.ReadOnly{}
+	caches := map[string]cached.Store{}
+	var refreshJobs []*refreshJob
+
+	// pullSem limits how many refresh jobs can pull their index at once
+	var pullSem chan struct{}
+	if cfg.MaxPulls > 0 {
+		pullSem = make(chan struct{}, cfg.MaxPulls)
+	}
 
 	// Create a scheduler for repo refresh tasks
 	sched, err := gocron.NewScheduler(
@@ -84,92 +112,155 @@ func main() {
 	defer sched.Shutdown()
 
 	for _, repo := range cfg.Repos {
-		// Create a combined store for the repo
-		cs := combined.New()
-		// Create a cached store for the combined store
-		stores[repo.Name] = cached.New(cs, time.Hour, 10*time.Minute)
+		cs, cache := newRepoStore(cfg, repo)
+		stores[repo.Name] = cache
+		caches[repo.Name] = cache
 
 		for _, repoName := range repo.Repos {
 			for _, arch := range repo.Architectures {
-				dbPath := filepath.Join(dataDir, repo.Name, repo.Version, repoName, arch, "db")
-				// Open a store for a specific index within a repo
-				s, err := store.Open(dbPath)
+				dbPath := indexDBPath(dataDir, repo, repoName, arch)
+				// Open a store for a specific index within a repo. A previous instance
+				// may still be shutting down, so wait for it to release the database.
+				openCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.LockTimeout))
+				s, err := store.OpenContext(openCtx, dbPath)
+				cancel()
 				if err == nil {
+					s.Name = strings.Trim(repoName+"/"+arch, "/")
+					s.Logger = log
 					// Add the index store to the combined store for the repo
-					cs.Add(s)
+					cs.AddArch(s, arch)
 				} else {
 					log.Error("Error opening database", slog.Any("error", err))
 					os.Exit(1)
 				}
 
 				// Schedule a refresh job for the repo
-				if job := scheduleRefresh(log, s, sched, repo, repoName, arch); job != nil {
+				rj := &refreshJob{Repo: repo.Name, Store: s}
+				if rj.Job = scheduleRefresh(log, fetcher, rj, cache, sched, pullSem, repo, repoName, arch, cfg.TempDir); rj.Job != nil {
+					refreshJobs = append(refreshJobs, rj)
 					// Run the refresh job immediately on startup
-					if err := job.RunNow(); err != nil {
-						log.Warn("Error executing repo refresh task on startup", slog.String("repo", repoName), slog.Any("error", err))
+					if err := rj.Job.RunNow(); err != nil {
+						log.Warn("Error executing repo refresh task on startup", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+					}
+					if repo.WatchIndex {
+						if err := watchIndex(log, fetcher, rj, repo, repoName, arch, cfg.TempDir); err != nil {
+							log.Warn("Error watching index files", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+						}
 					}
 				}
 			}
 		}
 	}
 
-	tmplFS, err := fs.Sub(tmpls, "templates")
-	if err != nil {
-		log.Error("Error getting templates subdirectory", slog.Any("error", err))
-		os.Exit(1)
+	// Each repo group gets a combined store containing the stores of
+	// its member repos, so that searching it searches all of them. The
+	// member stores are already cached, and their caches are flushed when
+	// they're refreshed, so the group stores aren't cached separately.
+	groups := map[string]store.ReadOnly{}
+	for _, group := range cfg.Groups() {
+		gs := combined.New()
+		gs.Normalize = cfg.NormalizeConfidence
+		for _, repo := range cfg.GroupRepos(group) {
+			gs.AddNamed(stores[repo], repo)
+		}
+		groups[group] = gs
 	}
 
-	ns := salix.New().
-		WithEscapeHTML(true).
-		WithWriteOnSuccess(true).
-		WithTagMap(map[string]salix.Tag{
-			"icon": salix.FSTag{
-				FS:         assets,
-				PathPrefix: "assets/icons",
-				Extension:  ".svg",
-			},
-		}).
-		WithVarMap(map[string]any{
-			"sprintf": fmt.Sprintf,
-		})
-
-	err = ns.ParseFSGlob(tmplFS, "*")
+	ns, err := newNamespace(cfg)
 	if err != nil {
 		log.Error("Error parsing templates", slog.Any("error", err))
 		os.Exit(1)
 	}
 
 	mux := chi.NewMux()
+	mux.Use(middleware.RequestID, requestID, requestLogger(log))
 
-	mux.Handle("/assets/*", http.FileServer(http.FS(assets)))
+	mux.Handle("/assets/*", assetsHandler(cfg.BasePath))
 
 	mux.Get("/", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
-		return ns.ExecuteTemplate(w, "home.html", map[string]any{"cfg": cfg})
+		return executeTemplate(ns, w, r, "home.html", map[string]any{
+			"cfg":    cfg,
+			"groups": cfg.Groups(),
+		})
 	}))
 
 	mux.Get("/about", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
-		return ns.ExecuteTemplate(w, "about.html", nil)
+		return executeTemplate(ns, w, r, "about.html", nil)
+	}))
+
+	mux.Get("/theme/{theme}", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		theme := chi.URLParam(r, "theme")
+		if !slices.Contains(themes[:], theme) {
+			return httpError{fmt.Errorf("no such theme: %q", theme), http.StatusNotFound}
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "theme",
+			Value:    theme,
+			Path:     cfg.BasePath + "/",
+			MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// Only redirect back to pages on this site
+		redirect := cfg.BasePath + "/"
+		if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host {
+			redirect = ref.RequestURI()
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return nil
+	}))
+
+	mux.With(requireAdmin(cfg.AdminToken, guiErrHandler(ns))).Get("/admin", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		statuses := make([]refreshStatus, len(refreshJobs))
+		for i, rj := range refreshJobs {
+			statuses[i] = rj.status()
+		}
+
+		return executeTemplate(ns, w, r, "admin.html", map[string]any{
+			"statuses": statuses,
+		})
+	}))
+
+	mux.Get("/opensearch.xml", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		repo := cfg.RepoName(r.URL.Query().Get("repo"))
+		if repo == "" && len(cfg.Repos) != 0 {
+			repo = cfg.Repos[0].Name
+		}
+		if _, ok := stores[repo]; !ok {
+			return httpError{fmt.Errorf("no such repo: %q", repo), http.StatusNotFound}
+		}
+
+		return writeOpenSearch(ns, w, r, cfg.BasePath, repo)
 	}))
 
 	mux.Get("/pkg/{repo}/{package}", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
-		repo := chi.URLParam(r, "repo")
+		repo := cfg.RepoName(chi.URLParam(r, "repo"))
 		s, ok := stores[repo]
+		if !ok {
+			// Results from a group search link to the group, in which case
+			// the package is shown from the first member repo that has it.
+			s, ok = groups[repo]
+		}
 		if !ok {
 			return fmt.Errorf("no such repo: %q", repo)
 		}
 
 		pkgName := chi.URLParam(r, "package")
 		pkg, err := s.GetPkg(pkgName)
-		if errors.Is(err, pebble.ErrNotFound) {
+		if errors.Is(err, pebble.ErrNotFound) || errors.Is(err, combined.ErrNotFound) {
 			return fmt.Errorf("no such package: %q", pkgName)
 		} else if err != nil {
 			return err
 		}
 
-		return ns.ExecuteTemplate(w, "package.html", map[string]any{
+		ld := packageJSONLD(cfg, requestBaseURL(r)+cfg.BasePath, repo, pkg.Name)
+		ld.Context = schemaContext
+		ld.Description = pkg.Description
+		return renderJSONLD(ns, w, r, "package.html", map[string]any{
 			"inRepo": repo,
 			"pkg":    pkg,
-		})
+		}, ld)
 	}))
 
 	mux.Handle("/suggestions", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
@@ -177,18 +268,13 @@ func main() {
 			return httpError{fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed}
 		}
 
-		repo := r.URL.Query().Get("repo")
+		repo := cfg.RepoName(r.URL.Query().Get("repo"))
 		s, ok := stores[repo]
 		if !ok {
 			return httpError{fmt.Errorf("no such repo: %q", repo), http.StatusNotFound}
 		}
 
-		pkgs, err := s.GetPkgNamesByPrefix(r.URL.Query().Get("input"), 10)
-		if err != nil {
-			return err
-		}
-
-		return json.NewEncoder(w).Encode(pkgs)
+		return writeSuggestions(w, s, repo, r.URL.Query())
 	}))
 
 	limiter := httprate.Limit(
@@ -200,43 +286,97 @@ func main() {
 		})),
 	)
 
-	mux.With(limiter).Route("/search", func(search chi.Router) {
-		search.Get("/tags", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+	// The tiebreak mode was already validated by config.Load
+	tiebreakMode, _ := store.ParseTiebreakMode(cfg.Tiebreak)
+
+	searchCfg := searchConfig{
+		Thresholds: store.CategoryThresholds{
+			Strong:  cfg.StrongConfidence,
+			Partial: cfg.PartialConfidence,
+		},
+		IDF:       cfg.IDFWeighting,
+		CrossType: cfg.CrossTypeMatching,
+		Tiebreak: store.Tiebreak{
+			Mode:     tiebreakMode,
+			Priority: cfg.TiebreakPriority,
+		},
+		Precision:  cfg.ConfidencePrecision,
+		Timeout:    time.Duration(cfg.SearchTimeout),
+		MaxResults: cfg.MaxResults,
+	}
+
+	// searchSem is shared between all the routes that perform
+	// searches to limit how many can run concurrently.
+	var searchSem chan struct{}
+	if cfg.MaxSearches > 0 {
+		searchSem = make(chan struct{}, cfg.MaxSearches)
+	}
+
+	searchLimiter := limitConcurrency(
+		searchSem,
+		time.Duration(cfg.SearchQueueTimeout),
+		handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+			return httpError{errors.New("The server is too busy right now. Please try again later."), http.StatusServiceUnavailable}
+		}),
+	)
+
+	mux.With(limiter, searchLimiter).Route("/search", func(search chi.Router) {
+		search.Get("/", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
 			query := r.URL.Query()
-			tags := query["tag"]
 
-			inRepo := query.Get("in")
-			in, ok := stores[inRepo]
-			if !ok {
-				return httpError{fmt.Errorf("no such repo: %q", inRepo), http.StatusNotFound}
+			q := strings.TrimSpace(query.Get("q"))
+			if q == "" {
+				return httpError{errors.New("empty search query"), http.StatusBadRequest}
 			}
 
-			results, latency, err := in.Search(tags)
+			inRepo, in, err := searchTarget(cfg, stores, groups, query)
+			if err != nil {
+				return err
+			}
+
+			fromRepo := cfg.RepoName(query.Get("from"))
+			if _, ok := stores[fromRepo]; fromRepo != "" && !ok {
+				return httpError{fmt.Errorf("no such repo: %q", fromRepo), http.StatusNotFound}
+			}
+
+			ftq, err := resolveQuery(cfg, stores, q, fromRepo, inRepo)
+			if err != nil {
+				return err
+			}
+
+			results, latency, err := searchQuery(in, ftq.Tags, query, searchCfg)
+			partial := errors.Is(err, store.ErrPartial)
 			if errors.Is(err, store.ErrInvalidTag) {
 				return httpError{err, http.StatusBadRequest}
-			} else if err != nil {
+			} else if err != nil && !partial {
 				return err
 			}
 
-			return ns.ExecuteTemplate(w, "results.html", map[string]any{
-				"results":  results,
-				"fromRepo": "",
-				"inRepo":   inRepo,
-				"tags":     tags,
-				"procTime": latency,
+			return renderResults(ns, w, r, cfg, resultsView{
+				Results:  results,
+				InRepo:   inRepo,
+				FromRepo: ftq.FromRepo,
+				PkgName:  ftq.PkgName,
+				Tags:     ftq.Tags,
+				Latency:  latency,
+				Partial:  partial,
+				Group:    groups[inRepo] != nil,
 			})
 		}))
 
+		search.Get("/tags", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+			return renderTagSearch(ns, w, r, cfg, stores, groups, searchCfg)
+		}))
+
 		search.Get("/pkg", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
 			query := r.URL.Query()
 
-			inRepo := query.Get("in")
-			in, ok := stores[inRepo]
-			if !ok {
-				return httpError{fmt.Errorf("no such repo: %q", inRepo), http.StatusNotFound}
+			inRepo, in, err := searchTarget(cfg, stores, groups, query)
+			if err != nil {
+				return err
 			}
 
-			fromRepo := query.Get("from")
+			fromRepo := cfg.RepoName(query.Get("from"))
 			from, ok := stores[fromRepo]
 			if !ok {
 				return httpError{fmt.Errorf("no such repo: %q", fromRepo), http.StatusNotFound}
@@ -248,18 +388,224 @@ func main() {
 				return err
 			}
 
-			results, latency, err := in.Search(pkg.Tags)
+			results, latency, err := searchQuery(in, pkg.Tags, query, searchCfg)
+			partial := errors.Is(err, store.ErrPartial)
+			if err != nil && !partial {
+				return err
+			}
+
+			return renderResults(ns, w, r, cfg, resultsView{
+				Results:  results,
+				InRepo:   inRepo,
+				FromRepo: fromRepo,
+				PkgName:  pkgName,
+				Latency:  latency,
+				Partial:  partial,
+				Group:    groups[inRepo] != nil,
+			})
+		}))
+	})
+
+	apiLimiter := httprate.Limit(
+		10,
+		10*time.Second,
+		httprate.WithKeyFuncs(httprate.KeyByRealIP),
+		httprate.WithLimitHandler(handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			return httpError{errors.New("too many requests"), http.StatusTooManyRequests}
+		})),
+	)
+
+	apiSearchLimiter := limitConcurrency(
+		searchSem,
+		time.Duration(cfg.SearchQueueTimeout),
+		handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			return httpError{errors.New("server is too busy"), http.StatusServiceUnavailable}
+		}),
+	)
+
+	batchSlots := &searchSlots{sem: searchSem, timeout: time.Duration(cfg.SearchQueueTimeout)}
+
+	mux.With(cors(cfg.CORSOrigins, cfg.CORSMethods), apiLimiter).Route("/api", func(api chi.Router) {
+		api.With(requireAdmin(cfg.AdminToken, handleErrJSON)).Post("/cache/flush", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			return flushCaches(w, caches, cfg.RepoName(r.URL.Query().Get("repo")))
+		}))
+
+		api.With(requireAdmin(cfg.AdminToken, handleErrJSON)).Get("/status", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			out := make([]refreshStatus, len(refreshJobs))
+			for i, rj := range refreshJobs {
+				out[i] = rj.status()
+			}
+			return json.NewEncoder(w).Encode(out)
+		}))
+
+		api.With(requireAdmin(cfg.AdminToken, handleErrJSON)).Get("/stats", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			out := make([]indexStats, len(refreshJobs))
+			for i, rj := range refreshJobs {
+				out[i] = rj.stats()
+			}
+			return json.NewEncoder(w).Encode(out)
+		}))
+
+		api.With(requireAdmin(cfg.AdminToken, handleErrJSON)).Post("/refresh", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			repo := cfg.RepoName(r.URL.Query().Get("repo"))
+			if repo == "" {
+				return httpError{errors.New("no repo provided"), http.StatusBadRequest}
+			}
+			index := r.URL.Query().Get("index")
+
+			refreshing := []string{}
+			for _, rj := range refreshJobs {
+				if rj.Repo != repo || (index != "" && rj.Store.Name != index) {
+					continue
+				}
+				if err := rj.Job.RunNow(); err != nil {
+					return err
+				}
+				refreshing = append(refreshing, strings.Trim(rj.Repo+"/"+rj.Store.Name, "/"))
+			}
+
+			if len(refreshing) == 0 {
+				return httpError{fmt.Errorf("no such repo index: %q", strings.Trim(repo+"/"+index, "/")), http.StatusNotFound}
+			}
+
+			return json.NewEncoder(w).Encode(map[string]any{
+				"refreshing": refreshing,
+			})
+		}))
+
+		api.With(apiSearchLimiter).Post("/search/paths", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			var req struct {
+				In    string   `json:"in"`
+				Paths []string `json:"paths"`
+			}
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+			if err != nil {
+				return httpError{fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest}
+			}
+
+			in, ok := stores[cfg.RepoName(req.In)]
+			if !ok {
+				return httpError{fmt.Errorf("no such repo: %q", req.In), http.StatusNotFound}
+			}
+
+			return searchPaths(w, in, req.Paths, r.URL.Query(), searchCfg, cfg.MaxSearchTags)
+		}))
+
+		// Batches run many searches, so each one acquires its own
+		// search slot instead of holding one for the whole request.
+		api.Post("/equivalent/batch", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			var req struct {
+				From     string   `json:"from"`
+				In       string   `json:"in"`
+				Packages []string `json:"packages"`
+			}
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+			if err != nil {
+				return httpError{fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest}
+			}
+
+			from, ok := stores[cfg.RepoName(req.From)]
+			if !ok {
+				return httpError{fmt.Errorf("no such repo: %q", req.From), http.StatusNotFound}
+			}
+
+			in, ok := stores[cfg.RepoName(req.In)]
+			if !ok {
+				return httpError{fmt.Errorf("no such repo: %q", req.In), http.StatusNotFound}
+			}
+
+			if len(req.Packages) == 0 {
+				return httpError{errors.New("no packages provided"), http.StatusBadRequest}
+			} else if len(req.Packages) > maxBatchPackages {
+				return httpError{fmt.Errorf("too many packages; the maximum is %d", maxBatchPackages), http.StatusBadRequest}
+			}
+
+			streamEquivalents(r.Context(), w, from, in, req.Packages, r.URL.Query(), searchCfg, batchSlots)
+			return nil
+		}))
+
+		// Coverage reports search for every package in a repo, so they're only
+		// available to admins, and each search acquires its own search slot.
+		api.With(requireAdmin(cfg.AdminToken, handleErrJSON)).Get("/coverage", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			query := r.URL.Query()
+
+			from, ok := stores[cfg.RepoName(query.Get("from"))]
+			if !ok {
+				return httpError{fmt.Errorf("no such repo: %q", query.Get("from")), http.StatusNotFound}
+			}
+
+			in, ok := stores[cfg.RepoName(query.Get("in"))]
+			if !ok {
+				return httpError{fmt.Errorf("no such repo: %q", query.Get("in")), http.StatusNotFound}
+			}
+
+			return streamCoverage(r.Context(), w, from, in, query, searchCfg, batchSlots)
+		}))
+
+		api.With(apiSearchLimiter).Get("/whatprovides", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			query := r.URL.Query()
+
+			_, in, err := searchTarget(cfg, stores, groups, query)
 			if err != nil {
 				return err
 			}
 
-			return ns.ExecuteTemplate(w, "results.html", map[string]any{
-				"results":  results,
-				"fromRepo": fromRepo,
-				"inRepo":   inRepo,
-				"pkgName":  pkgName,
-				"procTime": latency,
+			return whatProvides(w, in, query, searchCfg)
+		}))
+
+		api.Get("/changes", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			repo := cfg.RepoName(r.URL.Query().Get("repo"))
+			if _, ok := stores[repo]; !ok {
+				return httpError{fmt.Errorf("no such repo: %q", repo), http.StatusNotFound}
+			}
+			index := r.URL.Query().Get("index")
+
+			out := []indexChange{}
+			for _, rj := range refreshJobs {
+				if rj.Repo != repo || (index != "" && rj.Store.Name != index) {
+					continue
+				}
+				changes, err := rj.changes()
+				if err != nil {
+					return err
+				}
+				out = append(out, changes...)
+			}
+
+			// Show the newest changes first
+			slices.SortStableFunc(out, func(a, b indexChange) int {
+				return b.Time.Compare(a.Time)
 			})
+			return json.NewEncoder(w).Encode(out)
+		}))
+
+		api.Get("/tagtypes", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			return json.NewEncoder(w).Encode(tags.Types)
+		}))
+
+		api.Get("/suggestions", handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+			query := r.URL.Query()
+
+			// If no repos are specified, every repo is searched
+			var repoNames []string
+			for _, repo := range query["repo"] {
+				repo = cfg.RepoName(repo)
+				if _, ok := stores[repo]; !ok {
+					return httpError{fmt.Errorf("no such repo: %q", repo), http.StatusNotFound}
+				}
+				repoNames = append(repoNames, repo)
+			}
+			if len(repoNames) == 0 {
+				for _, repo := range cfg.Repos {
+					repoNames = append(repoNames, repo.Name)
+				}
+			}
+
+			out, err := globalSuggestions(stores, repoNames, query.Get("input"), 10)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(w).Encode(out)
 		}))
 	})
 
@@ -273,7 +619,7 @@ func main() {
 
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: mux,
+		Handler: withBasePath(cfg.BasePath, mux),
 	}
 
 	ch := make(chan os.Signal, 1)
@@ -284,6 +630,211 @@ func main() {
 	srv.ListenAndServe()
 }
 
+// assetsHandler serves the embedded static assets. The file server uses the
+// full request path, so the base path has to be removed from it.
+func assetsHandler(basePath string) http.Handler {
+	return http.StripPrefix(basePath, http.FileServer(http.FS(assets)))
+}
+
+// withBasePath serves h under basePath, for when distrohop is behind a
+// reverse proxy that forwards a subpath to it. If basePath is empty,
+// h is returned as-is.
+func withBasePath(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	root := chi.NewMux()
+	root.Mount(basePath, h)
+	return root
+}
+
+// searchConfig contains the configured defaults for searches
+type searchConfig struct {
+	// Thresholds are the confidence thresholds used to categorize results
+	Thresholds store.CategoryThresholds
+	// IDF enables inverse document frequency weighting
+	// for searches that don't set the idf parameter.
+	IDF bool
+	// CrossType enables cross-type matching for
+	// searches that don't set the crosstype parameter.
+	CrossType bool
+	// Tiebreak determines the order of results with the same confidence
+	Tiebreak store.Tiebreak
+	// Precision is the amount of decimal places that confidences are rounded
+	// to in API responses. If it's negative, they aren't rounded.
+	Precision int
+	// Timeout is how long a search may run before its partial
+	// results are returned. If it's zero, there's no timeout.
+	Timeout time.Duration
+	// MaxResults is the maximum amount of results a search returns.
+	// If it's zero or negative, there's no limit.
+	MaxResults int
+}
+
+// partialHeader is the response header that JSON API routes set
+// to "true" when a search timed out and its results are partial.
+const partialHeader = "X-Partial-Results"
+
+// searchTarget returns the name and store of the repo or repo group that a search
+// request is for. The group parameter selects a group, and the in parameter selects
+// a repo by its name or display name. Groups can also be selected using the in
+// parameter, since their names can't be the same as those of any repo.
+func searchTarget(cfg *config.Config, stores, groups map[string]store.ReadOnly, query url.Values) (string, store.ReadOnly, error) {
+	if group := query.Get("group"); group != "" {
+		s, ok := groups[group]
+		if !ok {
+			return "", nil, httpError{fmt.Errorf("no such group: %q", group), http.StatusNotFound}
+		}
+		return group, s, nil
+	}
+
+	inRepo := cfg.RepoName(query.Get("in"))
+	if s, ok := stores[inRepo]; ok {
+		return inRepo, s, nil
+	} else if s, ok := groups[inRepo]; ok {
+		return inRepo, s, nil
+	}
+	return "", nil, httpError{fmt.Errorf("no such repo: %q", inRepo), http.StatusNotFound}
+}
+
+// searchQuery searches s for the given tags, using the search options from query.
+// The arch parameter limits the search to indices for the given architectures, the
+// mode parameter sets the search mode, the idf parameter enables or disables inverse
+// document frequency weighting, and the crosstype parameter enables or disables
+// cross-type matching. The results are categorized using sc.Thresholds and sorted
+// using sc.Tiebreak, and the category parameter limits them to the given categories.
+// Only the first sc.MaxResults of the sorted and filtered results are kept, so the
+// category filter and tiebreaker affect which results are cut off. Each result
+// includes a breakdown of its overlap by tag type. If the debug parameter is true,
+// the results include the inputs of their confidence scores. Searching an index
+// that hasn't been populated yet results in a 503 error rather than an empty list
+// of results. If the search times out, the partial results are returned along with
+// [store.ErrPartial].
+func searchQuery(s store.ReadOnly, tags []string, query url.Values, sc searchConfig) ([]store.TagResult, time.Duration, error) {
+	var categories []store.Category
+	for _, name := range query["category"] {
+		category, err := store.ParseCategory(name)
+		if err != nil {
+			return nil, 0, httpError{err, http.StatusBadRequest}
+		}
+		categories = append(categories, category)
+	}
+
+	results, latency, err := searchOpts(s, tags, query, sc)
+	partial := errors.Is(err, store.ErrPartial)
+	if errors.Is(err, store.ErrEmpty) {
+		return nil, latency, httpError{err, http.StatusServiceUnavailable}
+	} else if err != nil && !partial {
+		return nil, latency, err
+	}
+
+	results = store.Categorize(results, sc.Thresholds)
+	if sc.Tiebreak.Mode != store.TiebreakName {
+		// The stores always break ties by name, so the results
+		// only have to be sorted again for other tiebreakers.
+		store.SortResultsBy(results, sc.Tiebreak)
+	}
+	if len(categories) != 0 {
+		results = slices.DeleteFunc(results, func(res store.TagResult) bool {
+			return !slices.Contains(categories, res.Category)
+		})
+	}
+	if sc.MaxResults > 0 && len(results) > sc.MaxResults {
+		results = results[:sc.MaxResults]
+	}
+
+	results = store.AddBreakdown(results, tags)
+	if isDebug(query) {
+		results = store.AddDebugInfo(results, tags)
+	}
+	if partial {
+		return results, latency, store.ErrPartial
+	}
+	return results, latency, nil
+}
+
+// isDebug checks whether the query asks for the inputs
+// of the confidence score formula to be included in results
+func isDebug(query url.Values) bool {
+	debug, _ := strconv.ParseBool(query.Get("debug"))
+	return debug
+}
+
+// searchOpts searches s using the search options in query. If query doesn't contain
+// the idf or crosstype parameters, sc determines whether IDF weighting and cross-type
+// matching are used. The search times out after sc.Timeout.
+func searchOpts(s store.ReadOnly, tags []string, query url.Values, sc searchConfig) ([]store.TagResult, time.Duration, error) {
+	mode, err := store.ParseSearchMode(query.Get("mode"))
+	if err != nil {
+		return nil, 0, httpError{err, http.StatusBadRequest}
+	}
+
+	idf, err := boolParam(query, "idf", sc.IDF)
+	if err != nil {
+		return nil, 0, err
+	}
+	crossType, err := boolParam(query, "crosstype", sc.CrossType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := store.SearchOptions{
+		Arches:    slices.DeleteFunc(slices.Clone(query["arch"]), func(arch string) bool { return arch == "" }),
+		Mode:      mode,
+		IDF:       idf,
+		CrossType: crossType,
+		Timeout:   sc.Timeout,
+	}
+	if len(opts.Arches) == 0 && opts.Mode == store.ModeAny && !opts.IDF && !opts.CrossType && opts.Timeout == 0 {
+		return s.Search(tags)
+	}
+
+	searcher, ok := s.(store.OptionSearcher)
+	if !ok {
+		return nil, 0, httpError{errors.New("this repo doesn't support search options"), http.StatusBadRequest}
+	}
+	return searcher.SearchOpts(tags, opts)
+}
+
+// boolParam parses the boolean query parameter with the given name,
+// returning def if it's missing and an HTTP 400 error if it's invalid.
+func boolParam(query url.Values, name string, def bool) (bool, error) {
+	if !query.Has(name) {
+		return def, nil
+	}
+	val, err := strconv.ParseBool(query.Get(name))
+	if err != nil {
+		return false, httpError{fmt.Errorf("invalid %s parameter: %q", name, query.Get(name)), http.StatusBadRequest}
+	}
+	return val, nil
+}
+
+// checkTagLimit returns an HTTP 400 error if a search request contains more
+// than limit tags, so that clients can't make the server do an unbounded amount
+// of work with a single request. If limit is zero or less, there's no limit.
+func checkTagLimit(tags []string, limit int) error {
+	if limit > 0 && len(tags) > limit {
+		return httpError{fmt.Errorf("too many tags in search: %d (the maximum is %d)", len(tags), limit), http.StatusBadRequest}
+	}
+	return nil
+}
+
+// roundConfidences returns a copy of results with their confidences rounded to
+// the given amount of decimal places, for API responses. The results themselves
+// aren't modified, since they may be cached. If places is negative, results is
+// returned as-is.
+func roundConfidences(results []store.TagResult, places int) []store.TagResult {
+	if places < 0 {
+		return results
+	}
+	scale := math.Pow10(places)
+	out := slices.Clone(results)
+	for i := range out {
+		out[i].Confidence = float32(math.Round(float64(out[i].Confidence)*scale) / scale)
+	}
+	return out
+}
+
 // handleShutdown handles a shutdown signal, such as an OS interrupt
 func handleShutdown(ch chan os.Signal, log *slog.Logger, srv *http.Server, sched gocron.Scheduler) {
 	sig := <-ch
@@ -292,44 +843,47 @@ func handleShutdown(ch chan os.Signal, log *slog.Logger, srv *http.Server, sched
 	sched.Shutdown()
 }
 
-// scheduleRefresh schedules a job to refresh a repo index database
-func scheduleRefresh(log *slog.Logger, s *store.Store, sched gocron.Scheduler, repo config.Repo, repoName, arch string) (job gocron.Job) {
+// refreshDelay returns a random delay within the given jitter window, which is
+// used to spread out refreshes that are scheduled at the same time. If jitter
+// isn't positive, it returns zero.
+func refreshDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return rand.N(jitter)
+}
+
+// newRepoStore creates the combined store for repo, which its indices are added
+// to, so that searching the repo searches all of its components and architectures.
+// It also returns the cached store for the combined store, which is used for searches.
+func newRepoStore(cfg *config.Config, repo config.Repo) (*combined.Store, cached.Store) {
+	cs := combined.New()
+	cs.Normalize = cfg.NormalizeConfidence
+	cs.MergePackages = repo.MergePackages
+	cache := cached.New(cs, time.Hour, 10*time.Minute)
+	cache.MinConfidence = cfg.CacheMinConfidence
+	return cs, cache
+}
+
+// scheduleRefresh schedules a job to refresh a repo index database. If pullSem
+// isn't nil, the job waits for a free slot in it before pulling the index.
+func scheduleRefresh(log *slog.Logger, fetcher index.Fetcher, rj *refreshJob, cache cached.Store, sched gocron.Scheduler, pullSem chan struct{}, repo config.Repo, repoName, arch, tempDir string) (job gocron.Job) {
 	var err error
 	job, err = sched.NewJob(
 		gocron.CronJob(repo.RefreshSchedule, true),
-		gocron.NewTask(func() {
-			opts := pull.Options{
-				BaseURL:      repo.BaseURL,
-				Version:      repo.Version,
-				Repo:         repoName,
-				Architecture: arch,
-				ProgressFunc: func(title string, received, total int64) {
-					log.Debug(
-						fmt.Sprintf("[%s] download", title),
-						slog.Int64("recvd", received),
-						slog.Int64("total", total),
-					)
-				},
-			}
-
-			importer, err := index.GetImporter(repo.Type)
-			if err != nil {
-				log.Error("Error getting importer", slog.Any("error", err))
-				return
+		gocron.NewTask(func(ctx context.Context) {
+			// Wait for a random amount of time within the jitter window, so
+			// that repos with the same schedule don't all refresh at once.
+			if delay := refreshDelay(time.Duration(repo.RefreshJitter)); delay > 0 {
+				log.Debug("Delaying refresh", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Duration("delay", delay))
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
 			}
 
-			log.Info(
-				"Pulling repo",
-				slog.String("name", repo.Name),
-				slog.String("version", repo.Version),
-				slog.String("repo", repoName),
-				slog.String("arch", arch),
-			)
-
-			err = pull.Pull(opts, s, importer)
-			if err != nil && !errors.Is(err, pull.ErrUpToDate) {
-				log.Warn("Error pulling repository", slog.String("repo", repoName), slog.Any("error", err))
-			}
+			runPull(ctx, log, fetcher, rj, cache, pullSem, repo, repoName, arch, tempDir)
 
 			nextRun, err := job.NextRun()
 			if err != nil {
@@ -341,19 +895,175 @@ func scheduleRefresh(log *slog.Logger, s *store.Store, sched gocron.Scheduler, r
 					"Next refresh scheduled for %s",
 					nextRun.Format(time.RFC1123),
 				),
-				slog.String("name", repo.Name),
+				slog.String("repo", repo.Name),
 				slog.String("version", repo.Version),
-				slog.String("repo", repoName),
+				slog.String("component", repoName),
 				slog.String("arch", arch),
 			)
 		}),
 	)
 	if err != nil {
-		log.Warn("Error scheduling repo refresh task", slog.String("repo", repoName), slog.Any("error", err))
+		log.Warn("Error scheduling repo refresh task", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
 	}
 	return job
 }
 
+// runPull pulls the index of rj and records the result. If pullSem isn't
+// nil, it waits for a free slot in it first, so that no more pulls than
+// its capacity run at once.
+func runPull(ctx context.Context, log *slog.Logger, fetcher index.Fetcher, rj *refreshJob, cache cached.Store, pullSem chan struct{}, repo config.Repo, repoName, arch, tempDir string) {
+	opts := pullOptions(log, fetcher, repo, repoName, arch, tempDir)
+	importer, err := repoImporter(repo)
+	if err != nil {
+		log.Error("Error getting importer", slog.Any("error", err))
+		return
+	}
+
+	if pullSem != nil {
+		select {
+		case pullSem <- struct{}{}:
+		default:
+			log.Info("Waiting for other pulls to finish", slog.String("repo", repo.Name), slog.String("component", repoName), slog.String("arch", arch))
+			select {
+			case pullSem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	log.Info(
+		"Pulling repo",
+		slog.String("repo", repo.Name),
+		slog.String("version", repo.Version),
+		slog.String("component", repoName),
+		slog.String("arch", arch),
+	)
+
+	pullCtx := ctx
+	if repo.PullTimeout > 0 {
+		var cancel context.CancelFunc
+		pullCtx, cancel = context.WithTimeout(ctx, time.Duration(repo.PullTimeout))
+		defer cancel()
+	}
+
+	err = pull.Pull(pullCtx, opts, rj.Store, importer)
+	if pullSem != nil {
+		<-pullSem
+	}
+	rj.setResult(err)
+	if err == nil {
+		// The index changed, so any cached search results are stale
+		cache.Flush()
+		warmupCache(log, cache, repo)
+	} else if !errors.Is(err, pull.ErrUpToDate) {
+		log.Warn("Error pulling repository", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+	}
+}
+
+// pullOptions returns the options for pulling the given index of repo
+// using fetcher
+func pullOptions(log *slog.Logger, fetcher index.Fetcher, repo config.Repo, repoName, arch, tempDir string) pull.Options {
+	return pull.Options{
+		BaseURL:      repo.BaseURL,
+		Version:      repo.Version,
+		Repo:         repoName,
+		Architecture: arch,
+		TwoPass:      repo.TwoPassImport,
+		RateLimit:    repo.PullRateLimit,
+		TempDir:      tempDir,
+		PDiffs:       repo.PDiffs,
+		Token:        repo.Token,
+		LatestOnly:   repo.LatestOnly,
+		Keyring:      repo.Keyring,
+		Descriptions: repo.Descriptions,
+		TrackChanges: repo.TrackChanges,
+		Logger:       log,
+		Fetcher:      fetcher,
+		ProgressFunc: func(title string, received, total int64) {
+			log.Debug(
+				fmt.Sprintf("[%s] download", title),
+				slog.Int64("recvd", received),
+				slog.Int64("total", total),
+			)
+		},
+	}
+}
+
+// repoImporter returns the importer for the given repo's type,
+// using the repo's index path template if it has one.
+func repoImporter(repo config.Repo) (index.Importer, error) {
+	importer, err := index.GetImporter(repo.Type)
+	if err != nil {
+		return nil, err
+	}
+	if repo.IndexPathTemplate != "" {
+		importer, err = index.WithPathTemplate(importer, repo.IndexPathTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if repo.Branch != "" {
+		importer, err = index.WithBranch(importer, repo.Branch)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := importer.(index.SignedImporter); repo.Keyring != "" && !ok {
+		return nil, fmt.Errorf("%s importer doesn't support signature verification", importer.Name())
+	}
+	if repo.Descriptions && !supportsDescriptions(importer) {
+		return nil, fmt.Errorf("%s importer doesn't support package descriptions", importer.Name())
+	}
+	return importer, nil
+}
+
+// supportsDescriptions reports whether importer can import package descriptions.
+// Besides importers that implement [index.DescriptionImporter], APT reads them
+// from the package metadata it already downloads.
+func supportsDescriptions(importer index.Importer) bool {
+	switch importer.(type) {
+	case index.DescriptionImporter, index.APT:
+		return true
+	default:
+		return false
+	}
+}
+
+// indexDBPath returns the path of the database for the given index of repo
+func indexDBPath(dataDir string, repo config.Repo, repoName, arch string) string {
+	return filepath.Join(dataDir, repo.Name, repo.Version, repoName, arch, "db")
+}
+
+// warmupCache runs the repo's configured warmup queries to repopulate its search cache
+func warmupCache(log *slog.Logger, cache cached.Store, repo config.Repo) {
+	if len(repo.WarmupQueries) == 0 {
+		return
+	}
+
+	queries := make([][]string, len(repo.WarmupQueries))
+	for i, query := range repo.WarmupQueries {
+		queries[i] = strings.Fields(query)
+	}
+
+	if err := cache.Warmup(queries); err != nil {
+		log.Warn("Error warming up search cache", slog.String("repo", repo.Name), slog.Any("error", err))
+	}
+}
+
+// dataDirectory returns the directory that contains distrohop's indices,
+// which is the data_dir setting if it's set.
+func dataDirectory(cfg *config.Config) (string, error) {
+	if cfg.DataDir != "" {
+		return cfg.DataDir, nil
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "distrohop"), nil
+}
+
 // userDataDir returns the directory where distrohop should store its indices
 func userDataDir() (string, error) {
 	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
@@ -0,0 +1,472 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/cached"
+	"go.elara.ws/distrohop/internal/store/combined"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestSearchQueryMaxResults(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim", "bin=vimdiff", "bin=ex", "bin=view")
+	ms.Add("neovim", "bin=nvim", "bin=vim", "bin=vimdiff")
+	ms.Add("busybox", "bin=ex", "bin=sh", "bin=ls", "bin=cat", "bin=vi")
+	tags := []string{"bin=vim", "bin=vimdiff", "bin=ex", "bin=view"}
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		maxResults int
+		want       []string
+	}{
+		{"no limit", url.Values{}, 0, []string{"vim", "neovim", "busybox"}},
+		{"best result is kept", url.Values{}, 1, []string{"vim"}},
+		{"category is filtered first", url.Values{"category": {"weak"}}, 1, []string{"busybox"}},
+		{"several categories", url.Values{"category": {"weak", "partial"}}, 1, []string{"neovim"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := searchConfig{
+				Thresholds: store.CategoryThresholds{Strong: 0.75, Partial: 0.4},
+				Tiebreak:   store.Tiebreak{Mode: store.TiebreakName},
+				MaxResults: tt.maxResults,
+			}
+			results, _, err := searchQuery(ms, tags, tt.query, sc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Package.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQueryEmpty(t *testing.T) {
+	_, _, err := searchQuery(mem.New(), []string{"bin=vim"}, url.Values{}, searchConfig{})
+	var httpErr httpError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503 error for an empty index, got %v", err)
+	}
+	if httpErr.error != store.ErrEmpty {
+		t.Errorf("expected ErrEmpty, got %v", httpErr.error)
+	}
+}
+
+// timeoutStore is a store that never finishes searching
+// before its timeout, so it never has any results
+type timeoutStore struct {
+	*mem.Store
+}
+
+func (ts timeoutStore) SearchOpts(tags []string, opts store.SearchOptions) ([]store.TagResult, time.Duration, error) {
+	time.Sleep(opts.Timeout)
+	return nil, opts.Timeout, store.ErrPartial
+}
+
+func TestSearchPartial(t *testing.T) {
+	fast := mem.New()
+	fast.Add("vim", "bin=vim")
+	fast.Add("vim-tiny", "bin=vim", "bin=vi")
+	cs := combined.New(fast, timeoutStore{mem.New()})
+	sc := searchConfig{
+		Tiebreak:  store.Tiebreak{Mode: store.TiebreakName},
+		Precision: -1,
+		Timeout:   time.Millisecond,
+	}
+
+	results, _, err := searchQuery(cs, []string{"bin=vim"}, url.Values{}, sc)
+	if !errors.Is(err, store.ErrPartial) {
+		t.Fatalf("expected ErrPartial, got %v", err)
+	}
+	var got []string
+	for _, res := range results {
+		got = append(got, res.Package.Name)
+	}
+	if !slices.Equal(got, []string{"vim", "vim-tiny"}) {
+		t.Errorf("expected the results of the store that finished, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+		return searchPaths(w, cs, []string{"/usr/bin/vim"}, r.URL.Query(), sc, 0)
+	})
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/search/paths", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := rec.Header().Get(partialHeader); got != "true" {
+		t.Errorf("expected the %s header to be true, got %q", partialHeader, got)
+	}
+	if !strings.Contains(rec.Body.String(), `"Name":"vim-tiny"`) {
+		t.Errorf("expected the partial results in the body, got %s", rec.Body)
+	}
+
+	// Searches that finish in time don't set the header
+	rec = httptest.NewRecorder()
+	handler = handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+		return searchPaths(w, fast, []string{"/usr/bin/vim"}, r.URL.Query(), sc, 0)
+	})
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/search/paths", nil))
+	if got := rec.Header().Get(partialHeader); got != "" {
+		t.Errorf("expected no %s header, got %q", partialHeader, got)
+	}
+}
+
+func TestSearchDisplayName(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{
+		{Name: "ubuntu-noble", DisplayName: "Ubuntu 24.04", Repos: []string{"main", "universe"}, Architectures: []string{"amd64"}},
+		{Name: "debian-bookworm", DisplayName: "Debian 12", Repos: []string{"main"}, Architectures: []string{"amd64"}},
+	}}
+
+	components := map[string][][]string{
+		"main":     {{"vim", "bin=vim"}, {"nano", "bin=nano"}},
+		"universe": {{"neovim", "bin=nvim", "bin=vim"}},
+	}
+	stores := map[string]store.ReadOnly{}
+	for _, repo := range cfg.Repos {
+		cs, cache := newRepoStore(cfg, repo)
+		stores[repo.Name] = cache
+		if repo.Name != "ubuntu-noble" {
+			continue
+		}
+		for _, component := range repo.Repos {
+			ms := mem.New()
+			ms.Name = component + "/amd64"
+			for _, pkg := range components[component] {
+				ms.Add(pkg[0], pkg[1:]...)
+			}
+			cs.AddArch(ms, "amd64")
+		}
+	}
+
+	repo := cfg.RepoName("Ubuntu 24.04")
+	if repo != "ubuntu-noble" {
+		t.Fatalf("expected the display name to resolve to ubuntu-noble, got %q", repo)
+	}
+	results, _, err := searchQuery(stores[repo], []string{"bin=vim"}, url.Values{}, searchConfig{Tiebreak: store.Tiebreak{Mode: store.TiebreakName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, res := range results {
+		got = append(got, res.Source+":"+res.Package.Name)
+	}
+	slices.Sort(got)
+	if want := []string{"main/amd64:vim", "universe/amd64:neovim"}; !slices.Equal(got, want) {
+		t.Errorf("expected results from every component %v, got %v", want, got)
+	}
+	if name := cfg.DisplayName(repo); name != "Ubuntu 24.04" {
+		t.Errorf("expected the display name to be shown for the results, got %q", name)
+	}
+}
+
+func TestRoundConfidences(t *testing.T) {
+	ms := mem.New()
+	ms.Add("a", "bin=a")
+	ms.Add("ab", "bin=a", "bin=b")
+	paths := []string{"/usr/bin/a", "/usr/bin/b", "/usr/bin/c"}
+
+	tests := []struct {
+		precision int
+		want      []string
+	}{
+		{3, []string{`"Confidence":0.667`, `"Confidence":0.333`}},
+		{1, []string{`"Confidence":0.7`, `"Confidence":0.3`}},
+		{0, []string{`"Confidence":1`, `"Confidence":0`}},
+		{-1, []string{`"Confidence":0.6666667`, `"Confidence":0.33333334`}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.precision), func(t *testing.T) {
+			sc := searchConfig{Tiebreak: store.Tiebreak{Mode: store.TiebreakName}, Precision: tt.precision}
+			rec := httptest.NewRecorder()
+			if err := searchPaths(rec, ms, paths, url.Values{}, sc, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			// The results are still sorted by their unrounded confidences
+			body := rec.Body.String()
+			first, second := strings.Index(body, tt.want[0]), strings.Index(body, tt.want[1])
+			if first == -1 || second == -1 {
+				t.Fatalf("expected the output to contain %v, got %s", tt.want, body)
+			} else if first > second {
+				t.Errorf("expected %s to come before %s, got %s", tt.want[0], tt.want[1], body)
+			}
+		})
+	}
+
+	// The original results may be cached, so they must not be modified
+	results := []store.TagResult{{Confidence: 2.0 / 3}}
+	rounded := roundConfidences(results, 2)
+	if rounded[0].Confidence != 0.67 || results[0].Confidence != 2.0/3 {
+		t.Errorf("expected a rounded copy, got %v and original %v", rounded[0].Confidence, results[0].Confidence)
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	for _, jitter := range []time.Duration{0, -time.Minute} {
+		if d := refreshDelay(jitter); d != 0 {
+			t.Errorf("jitter %s: got delay %s, want 0", jitter, d)
+		}
+	}
+
+	// Split the jitter window into buckets and make sure that the
+	// delays are within it and spread out across all of the buckets.
+	const (
+		jitter  = 10 * time.Minute
+		buckets = 10
+		samples = 1000
+	)
+	counts := make([]int, buckets)
+	for range samples {
+		d := refreshDelay(jitter)
+		if d < 0 || d >= jitter {
+			t.Fatalf("got delay %s, want it within [0, %s)", d, jitter)
+		}
+		counts[d*buckets/jitter]++
+	}
+	for i, n := range counts {
+		// Each bucket should get about 100 samples, so this
+		// is practically impossible unless they're clustered.
+		if n < samples/buckets/4 {
+			t.Errorf("bucket %d got %d of %d delays, expected them to be spread out: %v", i, n, samples, counts)
+		}
+	}
+}
+
+func TestDataDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		dataDir string
+		docker  bool
+		want    string
+	}{
+		{"config", "/srv/distrohop", false, "/srv/distrohop"},
+		{"config in docker", "/srv/distrohop", true, "/srv/distrohop"},
+		{"xdg", "", false, "/xdg/data/distrohop"},
+		{"docker", "", true, "/data/distrohop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_DATA_HOME", "/xdg/data")
+			t.Setenv("RUNNING_IN_DOCKER", strconv.FormatBool(tt.docker))
+
+			got, err := dataDirectory(&config.Config{DataDir: tt.dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// blockingFetcher is an [index.Fetcher] whose requests block until release
+// is closed. It records how many requests were in flight at once.
+type blockingFetcher struct {
+	release chan struct{}
+
+	mtx      sync.Mutex
+	inFlight int
+	maxSeen  int
+	total    int
+}
+
+func (bf *blockingFetcher) Do(req *http.Request) (*http.Response, error) {
+	bf.mtx.Lock()
+	bf.inFlight++
+	bf.total++
+	bf.maxSeen = max(bf.maxSeen, bf.inFlight)
+	bf.mtx.Unlock()
+
+	defer func() {
+		bf.mtx.Lock()
+		bf.inFlight--
+		bf.mtx.Unlock()
+	}()
+
+	select {
+	case <-bf.release:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody, Request: req}, nil
+}
+
+func (bf *blockingFetcher) counts() (inFlight, maxSeen, total int) {
+	bf.mtx.Lock()
+	defer bf.mtx.Unlock()
+	return bf.inFlight, bf.maxSeen, bf.total
+}
+
+func TestRunPullLimit(t *testing.T) {
+	const maxPulls, pulls = 2, 5
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bf := &blockingFetcher{release: make(chan struct{})}
+	pullSem := make(chan struct{}, maxPulls)
+	repo := config.Repo{Name: "arch", Type: "pacman", BaseURL: "https://mirror.example.com/$repo/os/$arch"}
+
+	jobs := make([]*refreshJob, pulls)
+	for i := range jobs {
+		s, err := store.Open(filepath.Join(t.TempDir(), "index"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		jobs[i] = &refreshJob{Repo: repo.Name, Store: s}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, rj := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache := cached.New(rj.Store, time.Minute, time.Minute)
+			runPull(ctx, log, bf, rj, cache, pullSem, repo, "core"+strconv.Itoa(i), "x86_64", t.TempDir())
+		}()
+	}
+
+	// Wait for the first pulls to start, and give the
+	// others a chance to exceed the limit if they could.
+	for {
+		if inFlight, _, _ := bf.counts(); inFlight == maxPulls {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for pulls to start")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if inFlight, _, _ := bf.counts(); inFlight != maxPulls {
+		t.Errorf("expected %d pulls to run at once, got %d", maxPulls, inFlight)
+	}
+
+	close(bf.release)
+	wg.Wait()
+
+	_, maxSeen, total := bf.counts()
+	if maxSeen > maxPulls {
+		t.Errorf("expected at most %d pulls to run at once, got %d", maxPulls, maxSeen)
+	}
+	if total < pulls {
+		t.Errorf("expected every queued pull to run eventually, got %d requests for %d pulls", total, pulls)
+	}
+	for _, rj := range jobs {
+		if st := rj.status(); st.LastError == "" {
+			t.Errorf("expected the result of the pull of %s to be recorded", st.Index)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	cfg := &config.Config{
+		BasePath: "/distrohop",
+		Repos:    []config.Repo{{Name: "debian", DisplayName: "Debian"}},
+	}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewMux()
+	mux.Handle("/assets/*", assetsHandler(cfg.BasePath))
+	mux.Get("/", handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		return executeTemplate(ns, w, r, "home.html", map[string]any{
+			"cfg":    cfg,
+			"groups": cfg.Groups(),
+		})
+	}))
+	handler := withBasePath(cfg.BasePath, mux)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/distrohop/", http.StatusOK},
+		{"/distrohop/assets/css/style.css", http.StatusOK},
+		{"/", http.StatusNotFound},
+		{"/assets/css/style.css", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/distrohop/", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`href="/distrohop/assets/css/style.css"`,
+		`href="/distrohop/about"`,
+		`action="/distrohop/search/tags"`,
+		`href="/distrohop/opensearch.xml"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the page to contain %s", want)
+		}
+	}
+	for _, unwanted := range []string{`href="/assets/`, `src="/assets/`, `action="/search`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("expected the page not to contain %s", unwanted)
+		}
+	}
+
+	if h := withBasePath("", mux); h != http.Handler(mux) {
+		t.Error("expected the handler to be used as-is without a base path")
+	}
+}
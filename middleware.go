@@ -0,0 +1,204 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestID sets the X-Request-Id response header to the ID assigned to the
+// request by [middleware.RequestID], so that users can report it.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestLogger returns a middleware that logs every request along with its ID.
+// Requests that result in a server error are logged as warnings.
+func requestLogger(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			level := slog.LevelDebug
+			if ww.Status() >= 500 {
+				level = slog.LevelWarn
+			}
+
+			log.Log(
+				r.Context(),
+				level,
+				"Handled request",
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", ww.Status()),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// limitConcurrency returns a middleware that allows at most cap(sem) requests
+// to be handled at once. Excess requests wait up to timeout for one of the
+// running requests to finish, after which onLimit is called to handle them
+// instead. If sem is nil, the number of requests isn't limited.
+func limitConcurrency(sem chan struct{}, timeout time.Duration, onLimit http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if sem == nil {
+			return next
+		}
+		slots := &searchSlots{sem: sem, timeout: timeout}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := slots.acquire(r.Context())
+			if errors.Is(err, errBusy) {
+				onLimit.ServeHTTP(w, r)
+				return
+			} else if err != nil {
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errBusy is returned by [searchSlots.acquire] if no slot became free in time
+var errBusy = errors.New("server is too busy")
+
+// searchSlots limits how many searches can run at once. Routes that run a single
+// search hold a slot for the whole request using [limitConcurrency], while routes
+// that run many searches per request acquire one for each search instead, so that
+// they can't run more searches at once than everything else.
+type searchSlots struct {
+	sem     chan struct{}
+	timeout time.Duration
+}
+
+// acquire waits up to ss.timeout for a free slot, and returns a function that releases
+// it. If there's no free slot in time, it returns [errBusy]. If ss or its semaphore
+// is nil, the number of searches isn't limited, so it returns right away.
+func (ss *searchSlots) acquire(ctx context.Context) (release func(), err error) {
+	if ss == nil || ss.sem == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(ss.timeout)
+	defer timer.Stop()
+
+	select {
+	case ss.sem <- struct{}{}:
+		return func() { <-ss.sem }, nil
+	case <-timer.C:
+		return nil, errBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cors returns a middleware that adds CORS headers to responses for requests
+// from the given origins, allowing them to use the given methods. An origin of
+// "*" allows all origins. Preflight requests are answered directly with a 204
+// status code. If origins is empty, no CORS headers are added, so browsers only
+// allow same-origin requests.
+func cors(origins, methods []string) func(http.Handler) http.Handler {
+	allowAll := slices.Contains(origins, "*")
+	allowMethods := strings.Join(methods, ", ")
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response depends on the origin unless all
+			// origins are allowed, so caches need to know that.
+			if !allowAll {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowAll && !slices.Contains(origins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAdmin returns a middleware that only allows requests that provide the
+// given admin token, either as a bearer token or as the password for HTTP basic
+// authentication, which lets browsers access admin pages. If token is empty, admin
+// routes are disabled and all requests are rejected. Rejections are written using
+// handleErr, which should be [handleErrJSON] for API routes, or the result of
+// [guiErrHandler] for HTML pages.
+func requireAdmin(token string, handleErr func(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return handleErr(func(w http.ResponseWriter, r *http.Request) error {
+			if token == "" {
+				return httpError{errors.New("admin routes are disabled"), http.StatusForbidden}
+			}
+
+			reqToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				_, reqToken, ok = r.BasicAuth()
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="distrohop admin"`)
+				return httpError{errors.New("invalid admin token"), http.StatusUnauthorized}
+			}
+
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
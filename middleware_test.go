@@ -0,0 +1,366 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.elara.ws/distrohop/internal/config"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ns, err := newNamespace(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := []refreshStatus{{
+		Repo:         "debian",
+		Index:        "main/amd64",
+		LastPull:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		PackageCount: 1234,
+		LastError:    "connection refused",
+	}}
+	adminPage := handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		return executeTemplate(ns, w, r, "admin.html", map[string]any{"statuses": statuses})
+	})
+	apiRoute := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := w.Write([]byte(`{"ok":true}`))
+		return err
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		auth       func(r *http.Request)
+		gui        bool
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "page",
+			token:      "secret",
+			auth:       func(r *http.Request) { r.SetBasicAuth("admin", "secret") },
+			gui:        true,
+			wantStatus: http.StatusOK,
+			want:       []string{"debian", "main/amd64", "2024-01-02 03:04:05 UTC", "1234", "connection refused", "Refresh failed", "res.ok"},
+		},
+		{
+			name:       "page without token",
+			token:      "secret",
+			auth:       func(r *http.Request) {},
+			gui:        true,
+			wantStatus: http.StatusUnauthorized,
+			want:       []string{"<html", "invalid admin token"},
+		},
+		{
+			name:       "page disabled",
+			auth:       func(r *http.Request) { r.SetBasicAuth("admin", "") },
+			gui:        true,
+			wantStatus: http.StatusForbidden,
+			want:       []string{"<html", "admin routes are disabled"},
+		},
+		{
+			name:       "api",
+			token:      "secret",
+			auth:       func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			wantStatus: http.StatusOK,
+			want:       []string{`{"ok":true}`},
+		},
+		{
+			name:       "api with wrong token",
+			token:      "secret",
+			auth:       func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+			wantStatus: http.StatusUnauthorized,
+			want:       []string{`"error":"invalid admin token"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h http.Handler
+			if tt.gui {
+				h = requireAdmin(tt.token, guiErrHandler(ns))(adminPage)
+			} else {
+				h = requireAdmin(tt.token, handleErrJSON)(apiRoute)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			tt.auth(req)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected output to contain %q, got %q", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ns, err := newNamespace(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := func(w http.ResponseWriter, r *http.Request) error {
+		return httpError{errors.New("no such repo"), http.StatusNotFound}
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		gui     bool
+		reqID   string
+	}{
+		{name: "json", handler: handleErrJSON(failing)},
+		{name: "json with incoming id", handler: handleErrJSON(failing), reqID: "client-id-123"},
+		{name: "gui", handler: handleErrGUI(ns, failing), gui: true},
+		{name: "gui with incoming id", handler: handleErrGUI(ns, failing), gui: true, reqID: "client-id-456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := &bytes.Buffer{}
+			log := slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			handler := middleware.RequestID(requestID(requestLogger(log)(tt.handler)))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/search/tags", nil)
+			if tt.reqID != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.reqID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(middleware.RequestIDHeader)
+			if id == "" {
+				t.Fatal("response doesn't have a request ID header")
+			} else if tt.reqID != "" && id != tt.reqID {
+				t.Errorf("got request ID %q, want the incoming ID %q", id, tt.reqID)
+			}
+
+			if tt.gui {
+				if !strings.Contains(rec.Body.String(), "<code>"+id+"</code>") {
+					t.Errorf("error page doesn't contain the request ID %q", id)
+				}
+			} else {
+				var body struct {
+					RequestID string `json:"requestID"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				} else if body.RequestID != id {
+					t.Errorf("got request ID %q in the response body, want %q", body.RequestID, id)
+				}
+			}
+
+			var entry struct {
+				RequestID string `json:"request_id"`
+				Status    int    `json:"status"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.RequestID != id || entry.Status != http.StatusNotFound {
+				t.Errorf("got log entry %s, want request ID %q and status 404", logs, id)
+			}
+		})
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	const limit = 2
+
+	var running, max atomic.Int32
+	unblock := make(chan struct{})
+	started := make(chan struct{}, limit)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			cur := max.Load()
+			if n <= cur || max.CompareAndSwap(cur, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	})
+	onLimit := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+		return httpError{errors.New("server is too busy"), http.StatusServiceUnavailable}
+	})
+	limited := limitConcurrency(make(chan struct{}, limit), 20*time.Millisecond, onLimit)(handler)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, limit)
+	for i := range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			limited.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search/tags", nil))
+			statuses[i] = rec.Code
+		}()
+	}
+	for range limit {
+		<-started
+	}
+
+	// All the slots are taken, so this request should be rejected once the timeout expires
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search/tags", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d for an excess request, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "server is too busy") {
+		t.Errorf("expected the limit handler's error in the body, got %q", rec.Body.String())
+	}
+
+	close(unblock)
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("request %d: expected status %d, got %d", i, http.StatusOK, status)
+		}
+	}
+	if n := max.Load(); n > limit {
+		t.Errorf("expected at most %d concurrent requests, got %d", limit, n)
+	}
+
+	// The slots were released, so new requests should be handled again
+	rec = httptest.NewRecorder()
+	limited.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search/tags", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d after the slots were released, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestLimitConcurrencyQueue(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	onLimit := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	limited := limitConcurrency(sem, time.Second, onLimit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Free the slot before the queue timeout expires, so
+	// the queued request should be handled rather than rejected.
+	sem <- struct{}{}
+	time.AfterFunc(20*time.Millisecond, func() { <-sem })
+
+	rec := httptest.NewRecorder()
+	limited.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/tags", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a queued request to be handled once a slot was freed, got status %d", rec.Code)
+	}
+}
+
+func TestLimitConcurrencyUnlimited(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	onLimit := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected requests not to be limited without a semaphore")
+	})
+	rec := httptest.NewRecorder()
+	limitConcurrency(nil, 0, onLimit)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	methods := []string{"GET", "POST"}
+
+	tests := []struct {
+		name       string
+		origins    []string
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantOrigin string
+		wantVary   bool
+	}{
+		{"same origin only", nil, http.MethodGet, "https://app.example", false, http.StatusOK, "", false},
+		{"configured origin", []string{"https://app.example"}, http.MethodGet, "https://app.example", false, http.StatusOK, "https://app.example", true},
+		{"other origin", []string{"https://app.example"}, http.MethodGet, "https://evil.example", false, http.StatusOK, "", true},
+		{"no origin", []string{"https://app.example"}, http.MethodGet, "", false, http.StatusOK, "", true},
+		{"wildcard", []string{"*"}, http.MethodGet, "https://any.example", false, http.StatusOK, "*", false},
+		{"preflight", []string{"https://app.example"}, http.MethodOptions, "https://app.example", true, http.StatusNoContent, "https://app.example", true},
+		{"preflight from other origin", []string{"https://app.example"}, http.MethodOptions, "https://evil.example", true, http.StatusOK, "", true},
+		{"options without preflight", []string{"https://app.example"}, http.MethodOptions, "https://app.example", false, http.StatusOK, "https://app.example", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/search/tags", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			rec := httptest.NewRecorder()
+			cors(tt.origins, methods)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("got allowed origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Vary") == "Origin"; got != tt.wantVary {
+				t.Errorf("got Vary: Origin %t, want %t", got, tt.wantVary)
+			}
+
+			wantMethods := ""
+			if tt.wantStatus == http.StatusNoContent {
+				wantMethods = "GET, POST"
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != wantMethods {
+				t.Errorf("got allowed methods %q, want %q", got, wantMethods)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+// searchPaths searches s for the packages that best match the given file paths,
+// and writes the results to w as JSON. The tags of all the paths are combined
+// into a single search, so packages that contain more of the files rank higher.
+// If the paths have more than maxTags tags, an HTTP 400 error is returned.
+func searchPaths(w http.ResponseWriter, s store.ReadOnly, paths []string, query url.Values, sc searchConfig, maxTags int) error {
+	var pathTags []string
+	seen := map[string]struct{}{}
+	for _, fpath := range paths {
+		if fpath == "" {
+			continue
+		} else if fpath[0] != '/' {
+			fpath = "/" + fpath
+		}
+		for _, tag := range tags.Generate(fpath) {
+			if _, ok := seen[tag]; !ok {
+				seen[tag] = struct{}{}
+				pathTags = append(pathTags, tag)
+			}
+		}
+	}
+
+	if len(pathTags) == 0 {
+		return httpError{errors.New("no valid paths provided"), http.StatusBadRequest}
+	}
+	if err := checkTagLimit(pathTags, maxTags); err != nil {
+		return err
+	}
+
+	results, _, err := searchQuery(s, pathTags, query, sc)
+	if errors.Is(err, store.ErrPartial) {
+		w.Header().Set(partialHeader, "true")
+	} else if errors.Is(err, store.ErrInvalidTag) {
+		return httpError{err, http.StatusBadRequest}
+	} else if err != nil {
+		return err
+	}
+
+	if results == nil {
+		results = []store.TagResult{}
+	}
+	return json.NewEncoder(w).Encode(roundConfidences(results, sc.Precision))
+}
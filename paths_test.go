@@ -0,0 +1,221 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestSearchPaths(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim", "bin=vimdiff", "man=vim.1")
+	ms.Add("vim-tiny", "bin=vim")
+	ms.Add("nano", "bin=nano", "man=nano.1")
+
+	tests := []struct {
+		name       string
+		paths      []string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "ranked by overlap",
+			paths:      []string{"/usr/bin/vim", "/usr/bin/vimdiff", "/usr/share/man/man1/vim.1.gz"},
+			wantStatus: http.StatusOK,
+			want:       []string{"vim", "vim-tiny"},
+		},
+		{
+			name:       "relative and duplicate paths",
+			paths:      []string{"usr/bin/nano", "/usr/bin/nano", ""},
+			wantStatus: http.StatusOK,
+			want:       []string{"nano"},
+		},
+		{
+			name:       "no matches",
+			paths:      []string{"/usr/bin/emacs"},
+			wantStatus: http.StatusOK,
+			want:       []string{},
+		},
+		{
+			name:       "no paths",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "only empty paths",
+			paths:      []string{"", ""},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := searchConfig{
+				Thresholds: store.CategoryThresholds{Strong: 0.75, Partial: 0.4},
+				Tiebreak:   store.Tiebreak{Mode: store.TiebreakName},
+				Precision:  -1,
+			}
+			handler := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+				var req struct {
+					Paths []string `json:"paths"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					return err
+				}
+				return searchPaths(w, ms, req.Paths, r.URL.Query(), sc, 0)
+			})
+
+			body, err := json.Marshal(map[string]any{"in": "debian", "paths": tt.paths})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/api/search/paths", bytes.NewReader(body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			} else if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var results []store.TagResult
+			if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, res := range results {
+				got = append(got, res.Package.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(results) != 0 && results[0].Confidence != 1 {
+				t.Errorf("expected the best match to have a confidence of 1, got %v", results[0].Confidence)
+			}
+		})
+	}
+}
+
+func TestCheckTagLimit(t *testing.T) {
+	cfg := &config.Config{
+		MaxSearchTags: 2,
+		Repos:         []config.Repo{{Name: "debian", DisplayName: "Debian"}},
+	}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := mem.New()
+	ms.Add("vim", "bin=vim", "bin=vimdiff")
+	stores := map[string]store.ReadOnly{"debian": ms}
+	sc := searchConfig{Tiebreak: store.Tiebreak{Mode: store.TiebreakName}, Precision: -1}
+
+	tagSearch := handleErrGUI(ns, func(w http.ResponseWriter, r *http.Request) error {
+		return renderTagSearch(ns, w, r, cfg, stores, nil, sc)
+	})
+	pathSearch := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+		var req struct {
+			Paths []string `json:"paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return err
+		}
+		return searchPaths(w, ms, req.Paths, r.URL.Query(), sc, cfg.MaxSearchTags)
+	})
+
+	pathsBody := func(paths ...string) *bytes.Reader {
+		body, err := json.Marshal(map[string]any{"paths": paths})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.NewReader(body)
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		req        *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "tags within limit",
+			handler:    tagSearch,
+			req:        httptest.NewRequest(http.MethodGet, "/search/tags?in=debian&tag=bin=vim&tag=bin=vimdiff", nil),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tags over limit",
+			handler:    tagSearch,
+			req:        httptest.NewRequest(http.MethodGet, "/search/tags?in=debian&tag=bin=vim&tag=bin=vimdiff&tag=bin=ex", nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// The limit is checked before anything else,
+			// including whether the repo exists.
+			name:       "tags over limit in missing repo",
+			handler:    tagSearch,
+			req:        httptest.NewRequest(http.MethodGet, "/search/tags?in=missing&tag=bin=vim&tag=bin=vimdiff&tag=bin=ex", nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "paths within limit",
+			handler:    pathSearch,
+			req:        httptest.NewRequest(http.MethodPost, "/api/search/paths", pathsBody("/usr/bin/vim", "/usr/bin/vimdiff")),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "paths over limit",
+			handler:    pathSearch,
+			req:        httptest.NewRequest(http.MethodPost, "/api/search/paths", pathsBody("/usr/bin/vim", "/usr/bin/vimdiff", "/usr/bin/ex")),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// Duplicate tags are removed before the limit is checked
+			name:       "duplicate paths",
+			handler:    pathSearch,
+			req:        httptest.NewRequest(http.MethodPost, "/api/search/paths", pathsBody("/usr/bin/vim", "/bin/vim", "usr/bin/vim")),
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, tt.req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "too many tags") {
+				t.Errorf("expected the error to explain the limit, got %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/combined"
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+// freeTextQuery represents a free-text search query that has
+// been resolved to a list of tags.
+type freeTextQuery struct {
+	// Tags is the list of tags to search for
+	Tags []string
+	// FromRepo is the repo the query was resolved in, if the
+	// query was a package name
+	FromRepo string
+	// PkgName is the name of the package the query was resolved to,
+	// if the query was a package name
+	PkgName string
+}
+
+// resolveQuery guesses what kind of input q is and converts it to a list of tags.
+//
+// If q contains a slash, it's treated as a file path and its tags are generated
+// using [tags.Generate]. Otherwise, if a package named q exists in fromRepo (or in
+// any repo other than inRepo if fromRepo is empty), the package's tags are used.
+// If neither of those apply, q is treated as the name of a binary.
+func resolveQuery(cfg *config.Config, stores map[string]store.ReadOnly, q, fromRepo, inRepo string) (freeTextQuery, error) {
+	if strings.Contains(q, "/") {
+		if q[0] != '/' {
+			q = "/" + q
+		}
+		return freeTextQuery{Tags: tags.Generate(q)}, nil
+	}
+
+	var repos []string
+	if fromRepo != "" {
+		repos = []string{fromRepo}
+	} else {
+		for _, repo := range cfg.Repos {
+			if repo.Name != inRepo {
+				repos = append(repos, repo.Name)
+			}
+		}
+	}
+
+	for _, repo := range repos {
+		s, ok := stores[repo]
+		if !ok {
+			continue
+		}
+
+		pkg, err := s.GetPkg(q)
+		if errors.Is(err, pebble.ErrNotFound) || errors.Is(err, combined.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return freeTextQuery{}, err
+		}
+
+		return freeTextQuery{
+			Tags:     pkg.Tags,
+			FromRepo: repo,
+			PkgName:  pkg.Name,
+		}, nil
+	}
+
+	return freeTextQuery{Tags: []string{tags.KeyBin + "=" + q}}, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestResolveQuery(t *testing.T) {
+	debian := mem.New()
+	debian.Add("vim", "bin=vim", "bin=vimdiff", "bin=xxd")
+	arch := mem.New()
+	arch.Add("vim", "bin=vim", "bin=vimdiff")
+	arch.Add("firefox", "bin=firefox", "desktop=firefox")
+
+	cfg := &config.Config{Repos: []config.Repo{{Name: "debian"}, {Name: "arch"}}}
+	stores := map[string]store.ReadOnly{"debian": debian, "arch": arch}
+
+	tests := []struct {
+		name     string
+		q        string
+		fromRepo string
+		inRepo   string
+		want     freeTextQuery
+	}{
+		{
+			name: "path",
+			q:    "/usr/bin/curl",
+			want: freeTextQuery{Tags: []string{"bin=curl"}},
+		},
+		{
+			name: "relative path",
+			q:    "usr/bin/curl",
+			want: freeTextQuery{Tags: []string{"bin=curl"}},
+		},
+		{
+			name:   "package in another repo",
+			q:      "firefox",
+			inRepo: "debian",
+			want:   freeTextQuery{Tags: []string{"bin=firefox", "desktop=firefox"}, FromRepo: "arch", PkgName: "firefox"},
+		},
+		{
+			name:   "search repo is skipped",
+			q:      "vim",
+			inRepo: "debian",
+			want:   freeTextQuery{Tags: []string{"bin=vim", "bin=vimdiff"}, FromRepo: "arch", PkgName: "vim"},
+		},
+		{
+			name:     "package in from repo",
+			q:        "vim",
+			fromRepo: "debian",
+			inRepo:   "arch",
+			want:     freeTextQuery{Tags: []string{"bin=vim", "bin=vimdiff", "bin=xxd"}, FromRepo: "debian", PkgName: "vim"},
+		},
+		{
+			name:     "package missing from from repo",
+			q:        "firefox",
+			fromRepo: "debian",
+			inRepo:   "arch",
+			want:     freeTextQuery{Tags: []string{"bin=firefox"}},
+		},
+		{
+			name:   "binary name",
+			q:      "curl",
+			inRepo: "arch",
+			want:   freeTextQuery{Tags: []string{"bin=curl"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveQuery(cfg, stores, tt.q, tt.fromRepo, tt.inRepo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Tags, tt.want.Tags) || got.FromRepo != tt.want.FromRepo || got.PkgName != tt.want.PkgName {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
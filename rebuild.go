@@ -0,0 +1,154 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/pull"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// rebuild implements the rebuild command, which rebuilds the indices of a repo
+// from scratch. Each index is pulled again from upstream even if it's up to date.
+// If that fails, its bloom filters are rebuilt from the data it already contains.
+// The server shouldn't be running at the same time, since it keeps the databases open.
+func rebuild(log *slog.Logger, cfg *config.Config, fetcher index.Fetcher, dataDir string, args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	repoFlag := fs.String("repo", "", "Name of the repo to rebuild")
+	indexFlag := fs.String("index", "", "Only rebuild the given index of the repo (for example, main/amd64)")
+	fs.Parse(args)
+
+	if *repoFlag == "" {
+		return errors.New("no repo provided; use --repo <name>")
+	}
+
+	name := cfg.RepoName(*repoFlag)
+	idx := -1
+	for i, repo := range cfg.Repos {
+		if repo.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return fmt.Errorf("no such repo: %q", *repoFlag)
+	}
+	repo := cfg.Repos[idx]
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	found := false
+	for _, repoName := range repo.Repos {
+		for _, arch := range repo.Architectures {
+			indexName := strings.Trim(repoName+"/"+arch, "/")
+			if *indexFlag != "" && indexName != *indexFlag {
+				continue
+			}
+			found = true
+
+			if err := rebuildIndex(ctx, log, cfg, fetcher, dataDir, repo, repoName, arch); err != nil {
+				return fmt.Errorf("%s: %w", indexName, err)
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no such index in repo %q: %q", repo.Name, *indexFlag)
+	}
+	return nil
+}
+
+// rebuildIndex rebuilds a single index of repo. If its database is corrupted, it's
+// moved out of the way to a ".corrupt" directory next to it, and the index is pulled
+// into a new one. Databases that can't be opened for any other reason, such as being
+// locked by a running server, are left alone.
+func rebuildIndex(ctx context.Context, log *slog.Logger, cfg *config.Config, fetcher index.Fetcher, dataDir string, repo config.Repo, repoName, arch string) error {
+	log = log.With(slog.String("repo", repo.Name), slog.String("component", repoName), slog.String("arch", arch))
+
+	dbPath := indexDBPath(dataDir, repo, repoName, arch)
+	openCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.LockTimeout))
+	s, err := store.OpenContext(openCtx, dbPath)
+	cancel()
+	canRepair := err == nil
+	if pebble.IsCorruptionError(err) {
+		corruptPath := dbPath + ".corrupt"
+		log.Warn("Moving corrupted database out of the way", slog.String("path", corruptPath), slog.Any("error", err))
+		// Only the latest corrupted database is kept
+		if err := os.RemoveAll(corruptPath); err != nil {
+			return err
+		}
+		if err := os.Rename(dbPath, corruptPath); err != nil {
+			return err
+		}
+		s, err = store.Open(dbPath)
+	}
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.Logger = log
+
+	importer, err := repoImporter(repo)
+	if err != nil {
+		return err
+	}
+
+	opts := pullOptions(log, fetcher, repo, repoName, arch, cfg.TempDir)
+	opts.Force = true
+
+	pullCtx := ctx
+	if repo.PullTimeout > 0 {
+		var cancel context.CancelFunc
+		pullCtx, cancel = context.WithTimeout(ctx, time.Duration(repo.PullTimeout))
+		defer cancel()
+	}
+
+	log.Info("Pulling repo")
+	err = pull.Pull(pullCtx, opts, s, importer)
+	if err == nil {
+		log.Info("Rebuilt index from upstream")
+		return nil
+	} else if !canRepair || ctx.Err() != nil {
+		return err
+	}
+
+	log.Warn("Couldn't pull index; rebuilding bloom filters from existing data instead", slog.Any("error", err))
+	if err := s.RebuildFilters(); err != nil {
+		return err
+	}
+	log.Info("Rebuilt bloom filters")
+	return nil
+}
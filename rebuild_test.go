@@ -0,0 +1,190 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// newContentsServer returns a server for an APT repo containing a
+// Contents index with the given contents for stable/main/amd64.
+// If contents is empty, every request fails.
+func newContentsServer(t *testing.T, contents string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contents == "" || r.URL.Path != "/dists/stable/main/Contents-amd64.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		gw := gzip.NewWriter(w)
+		io.WriteString(gw, contents)
+		gw.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeTestDB creates a database at dbPath containing a package with the given tags
+func writeTestDB(t *testing.T, dbPath, name string, tags ...string) {
+	t.Helper()
+	s, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	filters := store.NewFilters(nil)
+	if err := s.WriteBatch(map[string]index.Record{name: {Name: name, Tags: tags}}, filters); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFilters(filters); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corruptDB overwrites the manifests of the database at dbPath with garbage
+func corruptDB(t *testing.T, dbPath string) {
+	t.Helper()
+	manifests, err := filepath.Glob(filepath.Join(dbPath, "MANIFEST-*"))
+	if err != nil || len(manifests) == 0 {
+		t.Fatalf("no manifests found in %s: %v", dbPath, err)
+	}
+	for _, manifest := range manifests {
+		if err := os.WriteFile(manifest, []byte("garbage"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	const contents = "usr/bin/vim editors/vim\n"
+
+	tests := []struct {
+		name        string
+		contents    string
+		setup       func(t *testing.T, dbPath string)
+		wantErr     bool
+		wantPkg     string
+		wantCorrupt bool
+	}{
+		{
+			name:     "new",
+			contents: contents,
+			setup:    func(t *testing.T, dbPath string) {},
+			wantPkg:  "vim",
+		},
+		{
+			name:     "existing",
+			contents: contents,
+			setup: func(t *testing.T, dbPath string) {
+				writeTestDB(t, dbPath, "old", "bin=old")
+			},
+			wantPkg: "vim",
+		},
+		{
+			// The existing data is kept and its filters are rebuilt
+			name: "upstream down",
+			setup: func(t *testing.T, dbPath string) {
+				writeTestDB(t, dbPath, "old", "bin=old")
+			},
+			wantPkg: "old",
+		},
+		{
+			name:     "corrupted",
+			contents: contents,
+			setup: func(t *testing.T, dbPath string) {
+				writeTestDB(t, dbPath, "old", "bin=old")
+				corruptDB(t, dbPath)
+			},
+			wantPkg:     "vim",
+			wantCorrupt: true,
+		},
+		{
+			// Errors other than corruption must not remove anything
+			name:     "not a database",
+			contents: contents,
+			setup: func(t *testing.T, dbPath string) {
+				if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(dbPath, []byte("keep me"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newContentsServer(t, tt.contents)
+			cfg := &config.Config{}
+			repo := config.Repo{Name: "debian", Type: "apt", BaseURL: srv.URL, Version: "stable"}
+			dataDir := t.TempDir()
+			dbPath := indexDBPath(dataDir, repo, "main", "amd64")
+			tt.setup(t, dbPath)
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			err := rebuildIndex(context.Background(), log, cfg, http.DefaultClient, dataDir, repo, "main", "amd64")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if data, err := os.ReadFile(dbPath); err != nil || string(data) != "keep me" {
+					t.Errorf("existing data was modified (%q, %v)", data, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			_, statErr := os.Stat(dbPath + ".corrupt")
+			if gotCorrupt := statErr == nil; gotCorrupt != tt.wantCorrupt {
+				t.Errorf("got corrupted database kept = %t, want %t", gotCorrupt, tt.wantCorrupt)
+			}
+
+			s, err := store.Open(dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			results, _, err := s.Search([]string{"bin=" + tt.wantPkg})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Package.Name != tt.wantPkg {
+				t.Errorf("got results %+v, want %s", results, tt.wantPkg)
+			}
+		})
+	}
+}
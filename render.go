@@ -0,0 +1,230 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/i18n"
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/salix"
+)
+
+// newNamespace creates the template namespace
+// and parses all the embedded templates into it.
+func newNamespace(cfg *config.Config) (*salix.Namespace, error) {
+	tmplFS, err := fs.Sub(tmpls, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	ns := salix.New().
+		WithEscapeHTML(true).
+		WithWriteOnSuccess(true).
+		WithTagMap(map[string]salix.Tag{
+			"icon": salix.FSTag{
+				FS:         assets,
+				PathPrefix: "assets/icons",
+				Extension:  ".svg",
+			},
+		}).
+		WithVarMap(map[string]any{
+			"sprintf": fmt.Sprintf,
+			"tr":      i18n.Translate,
+			// categoryColors maps result categories to badge colors
+			"categoryColors": categoryColors,
+			// basePath is prepended to all the links in
+			// the templates, and it doesn't end in a slash.
+			"basePath": cfg.BasePath,
+			// displayName returns the display name of a repo
+			"displayName": cfg.DisplayName,
+		})
+
+	return ns, ns.ParseFSGlob(tmplFS, "*")
+}
+
+// themes contains the names of all the supported UI themes.
+// The first one is the default.
+var themes = [...]string{"dark", "light"}
+
+// categoryColors contains the Bulma color classes
+// used for the badges of each result category
+var categoryColors = map[store.Category]string{
+	store.CategoryExact:   "is-success",
+	store.CategoryStrong:  "is-info",
+	store.CategoryPartial: "is-warning",
+	store.CategoryWeak:    "is-danger",
+}
+
+// requestTheme returns the UI theme selected by the request's theme cookie,
+// or the default theme if the cookie is missing or invalid.
+func requestTheme(r *http.Request) string {
+	if c, err := r.Cookie("theme"); err == nil && slices.Contains(themes[:], c.Value) {
+		return c.Value
+	}
+	return themes[0]
+}
+
+// executeTemplate executes the template with the given name, adding the
+// request-specific variables that every template expects to vars.
+func executeTemplate(ns *salix.Namespace, w http.ResponseWriter, r *http.Request, name string, vars map[string]any) error {
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	vars["locale"] = i18n.FromRequest(r)
+	vars["theme"] = requestTheme(r)
+	return ns.ExecuteTemplate(w, name, vars)
+}
+
+// requestBaseURL returns the scheme and host that the client used to
+// reach the server. The scheme is taken from the X-Forwarded-Proto header
+// if it's set, so that it's correct behind a TLS-terminating reverse proxy.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// writeOpenSearch writes an OpenSearch description document for repo to w,
+// which lets browsers add it as a search engine. The URLs in it are based on
+// the address that the client used to reach the server and basePath.
+func writeOpenSearch(ns *salix.Namespace, w http.ResponseWriter, r *http.Request, basePath, repo string) error {
+	// The search terms placeholder must not be escaped,
+	// so it's appended after the query is encoded.
+	baseURL := requestBaseURL(r) + basePath
+	repoQuery := url.Values{"repo": {repo}}.Encode()
+	inQuery := url.Values{"in": {repo}}.Encode()
+
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	return ns.ExecuteTemplate(w, "opensearch.xml", map[string]any{
+		"repo":           repo,
+		"baseURL":        baseURL,
+		"searchURL":      baseURL + "/search?" + inQuery + "&q={searchTerms}",
+		"suggestionsURL": baseURL + "/suggestions?format=opensearch&" + repoQuery + "&input={searchTerms}",
+		"selfURL":        baseURL + "/opensearch.xml?" + repoQuery,
+	})
+}
+
+// resultsView contains the data that's shown on the search results page
+type resultsView struct {
+	// Results are the search results
+	Results []store.TagResult
+	// InRepo is the repo that was searched
+	InRepo string
+	// FromRepo is the repo containing the package whose equivalents
+	// were searched for, if the search was for a package
+	FromRepo string
+	// PkgName is the name of the package whose equivalents
+	// were searched for, if the search was for a package
+	PkgName string
+	// Tags are the tags that were searched for, if the search was for tags
+	Tags []string
+	// Latency is how long the search took
+	Latency time.Duration
+	// Partial is true if the search timed out, so
+	// the results may not contain every match
+	Partial bool
+	// Group is true if InRepo is a repo group rather than a repo
+	Group bool
+}
+
+// vars returns the template variables for the results page, using
+// the options in query that affect how the results are shown.
+func (rv resultsView) vars(query url.Values) map[string]any {
+	return map[string]any{
+		"results":  rv.Results,
+		"fromRepo": rv.FromRepo,
+		"inRepo":   rv.InRepo,
+		"tags":     rv.Tags,
+		"pkgName":  rv.PkgName,
+		"procTime": rv.Latency,
+		"partial":  rv.Partial,
+		"group":    rv.Group,
+		"debug":    isDebug(query),
+
+		"resultRepo": rv.resultRepo,
+	}
+}
+
+// resultRepo returns the repo that res came from. Results from a
+// group have the name of their repo at the start of their source.
+func (rv resultsView) resultRepo(res store.TagResult) string {
+	if !rv.Group {
+		return rv.InRepo
+	}
+	repo, _, _ := strings.Cut(res.Source, "/")
+	return repo
+}
+
+// renderResults renders the search results page for rv, or its JSON-LD
+// representation if it was requested.
+func renderResults(ns *salix.Namespace, w http.ResponseWriter, r *http.Request, cfg *config.Config, rv resultsView) error {
+	ld := resultsJSONLD(cfg, requestBaseURL(r)+cfg.BasePath, rv.InRepo, rv.FromRepo, rv.PkgName, rv.Results)
+	return renderJSONLD(ns, w, r, "results.html", rv.vars(r.URL.Query()), ld)
+}
+
+// renderTagSearch searches the repo or group selected by the query parameters of r
+// for the tags in its tag parameters, and renders the results. If there are more
+// than cfg.MaxSearchTags tags, an HTTP 400 error is returned before searching.
+func renderTagSearch(ns *salix.Namespace, w http.ResponseWriter, r *http.Request, cfg *config.Config, stores, groups map[string]store.ReadOnly, sc searchConfig) error {
+	query := r.URL.Query()
+	tags := query["tag"]
+	if err := checkTagLimit(tags, cfg.MaxSearchTags); err != nil {
+		return err
+	}
+
+	inRepo, in, err := searchTarget(cfg, stores, groups, query)
+	if err != nil {
+		return err
+	}
+
+	results, latency, err := searchQuery(in, tags, query, sc)
+	partial := errors.Is(err, store.ErrPartial)
+	if errors.Is(err, store.ErrInvalidTag) {
+		return httpError{err, http.StatusBadRequest}
+	} else if err != nil && !partial {
+		return err
+	}
+
+	return renderResults(ns, w, r, cfg, resultsView{
+		Results: results,
+		InRepo:  inRepo,
+		Tags:    tags,
+		Latency: latency,
+		Partial: partial,
+		Group:   groups[inRepo] != nil,
+	})
+}
@@ -0,0 +1,368 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/i18n"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+func TestRenderResults(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{
+		{Name: "debian", DisplayName: "Debian"},
+		{Name: "fedora", DisplayName: "Fedora"},
+	}}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []store.TagResult{{
+		Confidence: 1,
+		Category:   store.CategoryExact,
+		Overlap:    []string{"bin=vim"},
+		Package:    store.Package{Name: "vim", Tags: []string{"bin=vim"}},
+		Source:     "main/amd64",
+	}}
+
+	crossResults := []store.TagResult{{
+		Confidence: 0.75,
+		Category:   store.CategoryPartial,
+		Overlap:    []string{"bin=vim"},
+		CrossType:  []string{"desktop=gvim"},
+		Package:    store.Package{Name: "vim", Tags: []string{"bin=vim", "desktop=gvim"}},
+		Source:     "main/amd64",
+	}}
+
+	tests := []struct {
+		name  string
+		rv    resultsView
+		query string
+		want  []string
+	}{
+		{
+			name: "tags",
+			rv:   resultsView{Results: results, InRepo: "debian", Tags: []string{"bin=vim"}, Latency: time.Millisecond},
+			want: []string{"Searching for", "in <code>Debian</code>", "Found 1 packages in 1ms"},
+		},
+		{
+			name: "package",
+			rv:   resultsView{Results: results, InRepo: "debian", FromRepo: "fedora", PkgName: "vim-enhanced", Tags: []string{"bin=vim"}},
+			want: []string{"<code>vim-enhanced</code> from <code>Fedora</code> in <code>Debian</code>", "Found 1 packages"},
+		},
+		{
+			name: "partial",
+			rv:   resultsView{Results: results, InRepo: "debian", Tags: []string{"bin=vim"}, Partial: true},
+			want: []string{i18n.Translate(i18n.DefaultLocale, "partial_results")},
+		},
+		{
+			name:  "debug",
+			rv:    resultsView{Results: store.AddDebugInfo(crossResults, []string{"bin=vim", "bin=gvim"}), InRepo: "debian", Tags: []string{"bin=vim", "bin=gvim"}},
+			query: "?debug=true",
+			want:  []string{"1 of 2 search tags matched, with a weight of 1.00 / 2.00, plus 0.50 from related tags of other types. The package has 2 tags."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/search/tags"+tt.query, nil)
+			if err := renderResults(ns, rec, req, cfg, tt.rv); err != nil {
+				t.Fatal(err)
+			}
+
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected output to contain %q", want)
+				}
+			}
+			if strings.Contains(body, "%!") {
+				t.Error("output contains a formatting error")
+			}
+		})
+	}
+}
+
+func TestResultsViewVars(t *testing.T) {
+	results := []store.TagResult{
+		{Package: store.Package{Name: "vim"}, Source: "debian/main/amd64"},
+		{Package: store.Package{Name: "vim-enhanced"}, Source: "fedora/x86_64"},
+	}
+
+	tests := []struct {
+		name      string
+		rv        resultsView
+		query     url.Values
+		want      map[string]any
+		wantRepos []string
+	}{
+		{
+			name:  "tags",
+			rv:    resultsView{Results: results[:1], InRepo: "debian", Tags: []string{"bin=vim"}, Latency: time.Millisecond},
+			query: url.Values{},
+			want: map[string]any{
+				"fromRepo": "", "inRepo": "debian", "pkgName": "", "procTime": time.Millisecond,
+				"partial": false, "group": false, "debug": false,
+			},
+			wantRepos: []string{"debian"},
+		},
+		{
+			name:  "package",
+			rv:    resultsView{Results: results[:1], InRepo: "debian", FromRepo: "fedora", PkgName: "vim-enhanced", Tags: []string{"bin=vim"}, Partial: true},
+			query: url.Values{"debug": {"true"}},
+			want: map[string]any{
+				"fromRepo": "fedora", "inRepo": "debian", "pkgName": "vim-enhanced", "procTime": time.Duration(0),
+				"partial": true, "group": false, "debug": true,
+			},
+			wantRepos: []string{"debian"},
+		},
+		{
+			// The repo of each result in a group comes from its source
+			name:  "group",
+			rv:    resultsView{Results: results, InRepo: "editors", Tags: []string{"bin=vim"}, Group: true},
+			query: url.Values{"debug": {"invalid"}},
+			want: map[string]any{
+				"fromRepo": "", "inRepo": "editors", "pkgName": "", "procTime": time.Duration(0),
+				"partial": false, "group": true, "debug": false,
+			},
+			wantRepos: []string{"debian", "fedora"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.rv.vars(tt.query)
+			for key, want := range tt.want {
+				if got := vars[key]; got != want {
+					t.Errorf("%s: got %v, want %v", key, got, want)
+				}
+			}
+			if got := vars["tags"].([]string); !slices.Equal(got, tt.rv.Tags) {
+				t.Errorf("tags: got %v, want %v", got, tt.rv.Tags)
+			}
+			gotResults := vars["results"].([]store.TagResult)
+			if len(gotResults) != len(tt.rv.Results) {
+				t.Fatalf("results: got %d, want %d", len(gotResults), len(tt.rv.Results))
+			}
+
+			resultRepo := vars["resultRepo"].(func(store.TagResult) string)
+			for i, res := range gotResults {
+				if got := resultRepo(res); got != tt.wantRepos[i] {
+					t.Errorf("repo of %s: got %q, want %q", res.Package.Name, got, tt.wantRepos[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	i18n.Register("test", i18n.Catalog{
+		"nav_search":    "T-Search",
+		"searching_for": "T-Searching for",
+		"about_what":    "T-What is Distrohop?",
+		"admin_title":   "T-Admin",
+		"admin_never":   "T-Never",
+		"admin_refresh": "T-Refresh now",
+	})
+
+	cfg := &config.Config{Repos: []config.Repo{{Name: "debian", DisplayName: "Debian"}}}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := []refreshStatus{{Repo: "debian", Index: "main/amd64"}}
+	rv := resultsView{InRepo: "debian", Tags: []string{"bin=vim"}}
+
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		render         func(w http.ResponseWriter, r *http.Request) error
+		want           []string
+		dontWant       []string
+	}{
+		{
+			name:  "results",
+			query: "?lang=test",
+			render: func(w http.ResponseWriter, r *http.Request) error {
+				return renderResults(ns, w, r, cfg, rv)
+			},
+			want:     []string{`lang="test"`, "T-Search", "T-Searching for"},
+			dontWant: []string{">Searching for"},
+		},
+		{
+			name:           "about",
+			acceptLanguage: "test",
+			render: func(w http.ResponseWriter, r *http.Request) error {
+				return executeTemplate(ns, w, r, "about.html", nil)
+			},
+			want:     []string{"T-What is Distrohop?"},
+			dontWant: []string{">What is Distrohop?"},
+		},
+		{
+			name:  "admin",
+			query: "?lang=test",
+			render: func(w http.ResponseWriter, r *http.Request) error {
+				return executeTemplate(ns, w, r, "admin.html", map[string]any{"statuses": statuses})
+			},
+			// Messages missing from the catalog fall back to the default locale
+			want:     []string{"T-Admin", "T-Never", "T-Refresh now", "Last error"},
+			dontWant: []string{">Admin<", ">Never<"},
+		},
+		{
+			name: "default",
+			render: func(w http.ResponseWriter, r *http.Request) error {
+				return executeTemplate(ns, w, r, "admin.html", map[string]any{"statuses": statuses})
+			},
+			want:     []string{`lang="en"`, ">Admin<", "Refresh now"},
+			dontWant: []string{"T-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/"+tt.query, nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			if err := tt.render(rec, req); err != nil {
+				t.Fatal(err)
+			}
+
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected output to contain %q", want)
+				}
+			}
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(body, dontWant) {
+					t.Errorf("expected output not to contain %q", dontWant)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteTemplateTheme(t *testing.T) {
+	ns, err := newNamespace(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"no cookie", "", "dark"},
+		{"light", "light", "light"},
+		{"dark", "dark", "dark"},
+		{"invalid", "neon", "dark"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/about", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "theme", Value: tt.cookie})
+			}
+
+			vars := map[string]any{}
+			if err := executeTemplate(ns, rec, req, "about.html", vars); err != nil {
+				t.Fatal(err)
+			}
+
+			if vars["theme"] != tt.want {
+				t.Errorf("got theme %v in the template context, want %q", vars["theme"], tt.want)
+			}
+			if want := `data-theme="` + tt.want + `"`; !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("expected output to contain %q", want)
+			}
+		})
+	}
+}
+
+func TestWriteOpenSearch(t *testing.T) {
+	cfg := &config.Config{Repos: []config.Repo{{Name: "debian-sid", DisplayName: "Debian Sid"}}}
+	ns, err := newNamespace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/opensearch.xml?repo=debian-sid", nil)
+	req.Host = "distrohop.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	if err := writeOpenSearch(ns, rec, req, "/dh", "debian-sid"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/opensearchdescription+xml" {
+		t.Errorf("got content type %q, want application/opensearchdescription+xml", ct)
+	}
+
+	var doc struct {
+		XMLName   xml.Name `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+		ShortName string   `xml:"ShortName"`
+		URLs      []struct {
+			Type     string `xml:"type,attr"`
+			Rel      string `xml:"rel,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Url"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, rec.Body)
+	}
+
+	if want := "Distrohop (Debian Sid)"; doc.ShortName != want {
+		t.Errorf("got short name %q, want %q", doc.ShortName, want)
+	}
+
+	want := map[string]string{
+		"text/html":                             "https://distrohop.example.com/dh/search?in=debian-sid&q={searchTerms}",
+		"application/x-suggestions+json":        "https://distrohop.example.com/dh/suggestions?format=opensearch&repo=debian-sid&input={searchTerms}",
+		"application/opensearchdescription+xml": "https://distrohop.example.com/dh/opensearch.xml?repo=debian-sid",
+	}
+	if len(doc.URLs) != len(want) {
+		t.Errorf("got %d URLs, want %d", len(doc.URLs), len(want))
+	}
+	for _, u := range doc.URLs {
+		if u.Template != want[u.Type] {
+			t.Errorf("%s: got template %q, want %q", u.Type, u.Template, want[u.Type])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"go.elara.ws/distrohop/internal/pull"
+	"go.elara.ws/distrohop/internal/store"
+)
+
+// refreshJob represents the scheduled refresh job for a single repo index,
+// and keeps track of the outcome of its latest run.
+type refreshJob struct {
+	// Repo is the name of the configured repo that the index belongs to
+	Repo string
+	// Store is the store that contains the index
+	Store *store.Store
+	// Job is the scheduled job that refreshes the index
+	Job gocron.Job
+
+	mtx      sync.Mutex
+	lastPull time.Time
+	lastErr  error
+}
+
+// refreshStatus is a snapshot of the status of a [refreshJob]
+type refreshStatus struct {
+	Repo         string    `json:"repo"`
+	Index        string    `json:"index"`
+	LastPull     time.Time `json:"lastPull"`
+	NextRun      time.Time `json:"nextRun"`
+	PackageCount int       `json:"packageCount"`
+	Empty        bool      `json:"empty"`
+	LastError    string    `json:"lastError,omitempty"`
+	// RefreshQuery contains the query parameters that
+	// select this index in the refresh endpoint.
+	RefreshQuery string `json:"-"`
+}
+
+// setResult records the result of a pull. Pulls that found that
+// the index was already up to date count as successful.
+func (rj *refreshJob) setResult(err error) {
+	rj.mtx.Lock()
+	defer rj.mtx.Unlock()
+	if err == nil || errors.Is(err, pull.ErrUpToDate) {
+		rj.lastPull = time.Now()
+		rj.lastErr = nil
+	} else {
+		rj.lastErr = err
+	}
+}
+
+// status returns the current status of the refresh job
+func (rj *refreshJob) status() refreshStatus {
+	out := refreshStatus{
+		Repo:  rj.Repo,
+		Index: rj.Store.Name,
+		RefreshQuery: url.Values{
+			"repo":  {rj.Repo},
+			"index": {rj.Store.Name},
+		}.Encode(),
+	}
+
+	rj.mtx.Lock()
+	out.LastPull = rj.lastPull
+	if rj.lastErr != nil {
+		out.LastError = rj.lastErr.Error()
+	}
+	rj.mtx.Unlock()
+
+	if rj.Job != nil {
+		out.NextRun, _ = rj.Job.NextRun()
+	}
+	if meta, err := rj.Store.GetMeta(); err == nil {
+		out.PackageCount = meta.PackageCount
+	}
+	out.Empty, _ = rj.Store.Empty()
+	return out
+}
+
+// indexStats contains statistics about searches on a repo index
+type indexStats struct {
+	Repo    string            `json:"repo"`
+	Index   string            `json:"index"`
+	Filters store.FilterStats `json:"filters"`
+}
+
+// stats returns the search statistics for the refresh job's index
+func (rj *refreshJob) stats() indexStats {
+	return indexStats{
+		Repo:    rj.Repo,
+		Index:   rj.Store.Name,
+		Filters: rj.Store.FilterStats(),
+	}
+}
+
+// indexChange is a change to a package in a repo index
+type indexChange struct {
+	store.Change
+	Index string `json:"index"`
+}
+
+// changes returns the change history of the refresh job's index
+func (rj *refreshJob) changes() ([]indexChange, error) {
+	changes, err := rj.Store.GetChanges()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]indexChange, len(changes))
+	for i, change := range changes {
+		out[i] = indexChange{Change: change, Index: rj.Store.Name}
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"go.elara.ws/distrohop/internal/store"
+	"golang.org/x/sync/errgroup"
+)
+
+// suggestion represents a package name suggestion with extra metadata,
+// returned by the suggestions endpoint in detailed mode.
+type suggestion struct {
+	// The name of the suggested package
+	Name string `json:"name"`
+	// The repo containing the suggested package
+	Repo string `json:"repo"`
+	// The amount of tags associated with the package
+	TagCount int `json:"tag_count"`
+}
+
+// writeSuggestions writes up to 10 names of packages in s that start with the input
+// parameter of query to w. By default, they're written as an array of names. If the
+// detailed parameter is true, each suggestion includes the repo and tag count of the
+// package, and if the format parameter is opensearch, they're written in the OpenSearch
+// suggestions format.
+func writeSuggestions(w http.ResponseWriter, s store.ReadOnly, repo string, query url.Values) error {
+	format := query.Get("format")
+	if format != "" && format != "opensearch" {
+		return httpError{fmt.Errorf("invalid suggestions format: %q", format), http.StatusBadRequest}
+	}
+
+	input := query.Get("input")
+	pkgs, err := s.GetPkgNamesByPrefix(input, 10)
+	if err != nil {
+		return err
+	}
+
+	if format == "opensearch" {
+		// The OpenSearch suggestions format is an array containing
+		// the query followed by an array of completions.
+		if pkgs == nil {
+			pkgs = []string{}
+		}
+		w.Header().Set("Content-Type", "application/x-suggestions+json")
+		return json.NewEncoder(w).Encode([]any{input, pkgs})
+	}
+
+	if query.Get("detailed") != "true" {
+		return json.NewEncoder(w).Encode(pkgs)
+	}
+
+	out := make([]suggestion, 0, len(pkgs))
+	for _, name := range pkgs {
+		pkg, err := s.GetPkg(name)
+		if err != nil {
+			return err
+		}
+		out = append(out, suggestion{
+			Name:     name,
+			Repo:     repo,
+			TagCount: len(pkg.Tags),
+		})
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// globalSuggestion represents a package name suggested by the global
+// suggestions endpoint, along with the repos that contain it.
+type globalSuggestion struct {
+	Name  string   `json:"name"`
+	Repos []string `json:"repos"`
+}
+
+// globalSuggestions gets up to n package names starting with prefix from each
+// of the given repos, and merges them into a sorted list of up to n suggestions.
+// Each suggestion lists the repos containing it, in the order of repoNames.
+func globalSuggestions(stores map[string]store.ReadOnly, repoNames []string, prefix string, n int) ([]globalSuggestion, error) {
+	out := []globalSuggestion{}
+	if prefix == "" {
+		return out, nil
+	}
+
+	names := make([][]string, len(repoNames))
+	wg := &errgroup.Group{}
+	for i, repo := range repoNames {
+		wg.Go(func() (err error) {
+			names[i], err = stores[repo].GetPkgNamesByPrefix(prefix, n)
+			return err
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+
+	repos := map[string][]string{}
+	for i, repo := range repoNames {
+		for _, name := range names[i] {
+			// Combined stores may return the same name more than
+			// once if it's in more than one of the repo's indices.
+			if !slices.Contains(repos[name], repo) {
+				repos[name] = append(repos[name], repo)
+			}
+		}
+	}
+
+	for name, nameRepos := range repos {
+		out = append(out, globalSuggestion{Name: name, Repos: nameRepos})
+	}
+	slices.SortFunc(out, func(a, b globalSuggestion) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
@@ -0,0 +1,199 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/combined"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestWriteSuggestions(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim", "bin=vimdiff")
+	ms.Add("vim-tiny", "bin=vi")
+	ms.Add("nano", "bin=nano")
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "plain",
+			query:      url.Values{"input": {"vim"}},
+			wantStatus: http.StatusOK,
+			want:       `["vim","vim-tiny"]`,
+		},
+		{
+			name:       "detailed",
+			query:      url.Values{"input": {"vim"}, "detailed": {"true"}},
+			wantStatus: http.StatusOK,
+			want:       `[{"name":"vim","repo":"debian","tag_count":2},{"name":"vim-tiny","repo":"debian","tag_count":1}]`,
+		},
+		{
+			name:       "detailed without matches",
+			query:      url.Values{"input": {"emacs"}, "detailed": {"true"}},
+			wantStatus: http.StatusOK,
+			want:       `[]`,
+		},
+		{
+			name:       "opensearch",
+			query:      url.Values{"input": {"vim"}, "format": {"opensearch"}},
+			wantStatus: http.StatusOK,
+			want:       `["vim",["vim","vim-tiny"]]`,
+		},
+		{
+			name:       "invalid format",
+			query:      url.Values{"input": {"vim"}, "format": {"xml"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+				return writeSuggestions(w, ms, "debian", r.URL.Query())
+			})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/suggestions?"+tt.query.Encode(), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			} else if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSuggestionsOpenSearch(t *testing.T) {
+	ms := mem.New()
+	ms.Add("vim", "bin=vim")
+	ms.Add("vim-tiny", "bin=vi")
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"vim", []string{"vim", "vim-tiny"}},
+		{"vim-", []string{"vim-tiny"}},
+		{"emacs", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			query := url.Values{"input": {tt.input}, "format": {"opensearch"}}
+			rec := httptest.NewRecorder()
+			if err := writeSuggestions(rec, ms, "debian", query); err != nil {
+				t.Fatal(err)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/x-suggestions+json" {
+				t.Errorf("got content type %q, want application/x-suggestions+json", ct)
+			}
+
+			// The response must be an array containing the query
+			// string followed by an array of completions.
+			var out []json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if len(out) != 2 {
+				t.Fatalf("got %d elements, want 2: %s", len(out), rec.Body)
+			}
+			var gotInput string
+			if err := json.Unmarshal(out[0], &gotInput); err != nil || gotInput != tt.input {
+				t.Errorf("got query %s, want %q", out[0], tt.input)
+			}
+			var completions []string
+			if err := json.Unmarshal(out[1], &completions); err != nil || completions == nil {
+				t.Fatalf("got completions %s, want an array of strings", out[1])
+			}
+			if !slices.Equal(completions, tt.want) {
+				t.Errorf("got completions %q, want %q", completions, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobalSuggestions(t *testing.T) {
+	debian := mem.New()
+	debian.Add("vim", "bin=vim")
+	debian.Add("vim-tiny", "bin=vi")
+	debian.Add("nano", "bin=nano")
+
+	// The same package is in two of Fedora's indices, but
+	// it should only be listed once in the suggestions.
+	x86 := mem.New()
+	x86.Add("vim-enhanced", "bin=vim")
+	x86.Add("vim", "bin=vi")
+	aarch64 := mem.New()
+	aarch64.Add("vim-enhanced", "bin=vim")
+	fedora := combined.New()
+	fedora.AddArch(x86, "x86_64")
+	fedora.AddArch(aarch64, "aarch64")
+
+	stores := map[string]store.ReadOnly{"debian": debian, "fedora": fedora}
+
+	tests := []struct {
+		name   string
+		repos  []string
+		prefix string
+		n      int
+		want   string
+	}{
+		{"all repos", []string{"debian", "fedora"}, "vim", 10, `[{"name":"vim","repos":["debian","fedora"]},{"name":"vim-enhanced","repos":["fedora"]},{"name":"vim-tiny","repos":["debian"]}]`},
+		{"repo order", []string{"fedora", "debian"}, "vim", 10, `[{"name":"vim","repos":["fedora","debian"]},{"name":"vim-enhanced","repos":["fedora"]},{"name":"vim-tiny","repos":["debian"]}]`},
+		{"one repo", []string{"debian"}, "vim", 10, `[{"name":"vim","repos":["debian"]},{"name":"vim-tiny","repos":["debian"]}]`},
+		{"limit", []string{"debian", "fedora"}, "vim", 2, `[{"name":"vim","repos":["debian","fedora"]},{"name":"vim-enhanced","repos":["fedora"]}]`},
+		{"no matches", []string{"debian", "fedora"}, "emacs", 10, `[]`},
+		{"empty prefix", []string{"debian", "fedora"}, "", 10, `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := globalSuggestions(stores, tt.repos, tt.prefix, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.elara.ws/distrohop/internal/config"
+	"go.elara.ws/distrohop/internal/index"
+	"go.elara.ws/distrohop/internal/pull"
+)
+
+// watchDebounce is how long the index files of a watched repo have to stay
+// unchanged before it's refreshed, so that a mirror sync that writes the files
+// in several steps only causes a single refresh.
+const watchDebounce = 5 * time.Second
+
+// watchIndex watches the local index files of a repo with a file:// base URL,
+// and runs rj's refresh job whenever one of them changes. The directories that
+// contain the files are watched rather than the files themselves, since mirror
+// sync tools usually replace files by renaming new ones over them.
+func watchIndex(log *slog.Logger, fetcher index.Fetcher, rj *refreshJob, repo config.Repo, repoName, arch, tempDir string) error {
+	importer, err := repoImporter(repo)
+	if err != nil {
+		return err
+	}
+	opts := pullOptions(log, fetcher, repo, repoName, arch, tempDir)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	files, err := watchIndexFiles(watcher, opts, importer)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		timer := time.NewTimer(watchDebounce)
+		timer.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[event.Name] && event.Has(fsnotify.Create|fsnotify.Write) {
+					timer.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Error watching index files", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+			case <-timer.C:
+				// The names of some index files, such as RPM filelists, change
+				// along with the manifest they're listed in, so they're resolved
+				// again before refreshing.
+				if newFiles, err := watchIndexFiles(watcher, opts, importer); err == nil {
+					files = newFiles
+				} else {
+					log.Warn("Error resolving index files", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+				}
+
+				log.Info("Index files changed; refreshing", slog.String("repo", repo.Name), slog.String("component", repoName), slog.String("arch", arch))
+				if err := rj.Job.RunNow(); err != nil {
+					log.Warn("Error executing repo refresh task", slog.String("repo", repo.Name), slog.String("component", repoName), slog.Any("error", err))
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchIndexFiles resolves the paths of the local index files of importer,
+// along with the manifest files they're listed in, if it has any, and makes
+// sure watcher watches the directories that contain them. Directories that
+// no longer contain any of the files stop being watched. It returns the set
+// of file paths.
+func watchIndexFiles(watcher *fsnotify.Watcher, opts pull.Options, importer index.Importer) (map[string]bool, error) {
+	indexURLs, err := pull.IndexURLs(opts, importer)
+	if err != nil {
+		return nil, err
+	}
+	manifestURLs, err := pull.ManifestURLs(opts, importer)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]bool{}
+	dirs := map[string]bool{}
+	var errs []error
+	for _, fileURL := range slices.Concat(indexURLs, manifestURLs) {
+		u, err := url.Parse(fileURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		path := filepath.Clean(filepath.FromSlash(u.Path))
+		files[path] = true
+
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		// Only some of the possible index files may exist,
+		// so the errors only matter if none of them do.
+		if err := watcher.Add(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		dirs[dir] = true
+	}
+	if len(dirs) == 0 {
+		return nil, errors.Join(append(errs, errors.New("no index directories to watch"))...)
+	}
+
+	for _, dir := range watcher.WatchList() {
+		if !dirs[dir] {
+			watcher.Remove(dir)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,178 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"go.elara.ws/distrohop/internal/config"
+)
+
+// writeRepomd writes a repomd.xml file listing the given
+// filelists index to the repodata directory in dir
+func writeRepomd(t *testing.T, dir, filelists string) {
+	t.Helper()
+	repomd := `<repomd><data type="filelists"><location href="repodata/` + filelists + `"/></data></repomd>`
+	if err := os.MkdirAll(filepath.Join(dir, "repodata"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "repodata", "repomd.xml"), []byte(repomd), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resolveWatchedFiles resolves the index files of repo using
+// watcher, and returns them relative to dir
+func resolveWatchedFiles(t *testing.T, watcher *fsnotify.Watcher, repo config.Repo, dir string) ([]string, error) {
+	t.Helper()
+	importer, err := repoImporter(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := newFetcher(&config.Config{Repos: []config.Repo{repo}})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	files, err := watchIndexFiles(watcher, pullOptions(log, fetcher, repo, "main", "x86_64", t.TempDir()), importer)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, filepath.ToSlash(rel))
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func TestWatchIndexFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoType string
+		setup    func(t *testing.T, dir string)
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "apt",
+			repoType: "apt",
+			setup: func(t *testing.T, dir string) {
+				if err := os.MkdirAll(filepath.Join(dir, "dists/stable/main"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"dists/stable/main/Contents-x86_64.gz"},
+		},
+		{
+			name:     "dnf",
+			repoType: "dnf",
+			setup: func(t *testing.T, dir string) {
+				writeRepomd(t, filepath.Join(dir, "main"), "abc-filelists.xml.gz")
+			},
+			want: []string{"main/repodata/abc-filelists.xml.gz", "main/repodata/repomd.xml"},
+		},
+		{
+			name:     "missing directories",
+			repoType: "apt",
+			setup:    func(t *testing.T, dir string) {},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			repo := config.Repo{
+				Name:    "test",
+				Type:    tt.repoType,
+				BaseURL: "file://" + filepath.ToSlash(dir),
+				Version: "stable",
+			}
+			if tt.repoType == "dnf" {
+				repo.IndexPathTemplate = "{repo}"
+			}
+
+			watcher, err := fsnotify.NewWatcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer watcher.Close()
+
+			files, err := resolveWatchedFiles(t, watcher, repo, dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !slices.Contains(files, want) {
+					t.Errorf("%s isn't watched; watched files: %v", want, files)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchIndexFilesRepomdChanged(t *testing.T) {
+	dir := t.TempDir()
+	repo := config.Repo{
+		Name:              "test",
+		Type:              "dnf",
+		BaseURL:           "file://" + filepath.ToSlash(dir),
+		IndexPathTemplate: "{repo}",
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	writeRepomd(t, filepath.Join(dir, "main"), "abc-filelists.xml.gz")
+	if _, err := resolveWatchedFiles(t, watcher, repo, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Regenerating the repo changes the name of the filelists index
+	writeRepomd(t, filepath.Join(dir, "main"), "def-filelists.xml.gz")
+	files, err := resolveWatchedFiles(t, watcher, repo, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"main/repodata/def-filelists.xml.gz", "main/repodata/repomd.xml"}
+	if !slices.Equal(files, want) {
+		t.Errorf("got watched files %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/tags"
+)
+
+// whatProvides writes the packages in s that provide the file at the path in the
+// path parameter of query to w as JSON. The first tag returned by [tags.Generate]
+// is always the most specific one, so only packages containing it provide the path.
+// The search uses all of the path's tags so that the providers are ranked by how
+// closely they match it, but the other results are removed before sc.MaxResults
+// is applied, so that partial matches can't push the providers out of the results.
+func whatProvides(w http.ResponseWriter, s store.ReadOnly, query url.Values, sc searchConfig) error {
+	fpath := query.Get("path")
+	if fpath == "" {
+		return httpError{errors.New("no path provided"), http.StatusBadRequest}
+	} else if fpath[0] != '/' {
+		fpath = "/" + fpath
+	}
+
+	pathTags := tags.Generate(fpath)
+	if len(pathTags) == 0 {
+		return httpError{errors.New("the path doesn't have any tags"), http.StatusBadRequest}
+	}
+
+	maxResults := sc.MaxResults
+	sc.MaxResults = 0
+	results, _, err := searchQuery(s, pathTags, query, sc)
+	if errors.Is(err, store.ErrPartial) {
+		w.Header().Set(partialHeader, "true")
+	} else if errors.Is(err, store.ErrInvalidTag) {
+		return httpError{err, http.StatusBadRequest}
+	} else if err != nil {
+		return err
+	}
+
+	out := make([]store.TagResult, 0, len(results))
+	for _, result := range results {
+		if slices.Contains(result.Package.Tags, pathTags[0]) {
+			out = append(out, result)
+		}
+	}
+	if maxResults > 0 && len(out) > maxResults {
+		out = out[:maxResults]
+	}
+
+	return json.NewEncoder(w).Encode(roundConfidences(out, sc.Precision))
+}
@@ -0,0 +1,93 @@
+/*
+ * distrohop - A utility for correlating and identifying equivalent software
+ * packages across different Linux distributions
+ *
+ * Copyright (C) 2025 Elara Ivy <elara@elara.ws>
+ *
+ * This file is part of distrohop.
+ *
+ * distrohop is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * distrohop is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with distrohop.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"go.elara.ws/distrohop/internal/store"
+	"go.elara.ws/distrohop/internal/store/mem"
+)
+
+func TestWhatProvides(t *testing.T) {
+	ms := mem.New()
+	// The provider has many other tags, so it has a lower confidence
+	// than packages that only contain the less specific tags of the path.
+	ms.Add("libfoo1", "lib=libfoo.so.1", "bin=foo-a", "bin=foo-b", "bin=foo-c", "bin=foo-d", "bin=foo-e", "bin=foo-f")
+	ms.Add("libfoo-dev", "lib=libfoo.so", "lib=foo")
+	ms.Add("foo-static", "lib=foo")
+	ms.Add("bar", "bin=bar")
+
+	tests := []struct {
+		name       string
+		path       string
+		maxResults int
+		wantStatus int
+		want       []string
+	}{
+		{name: "provider", path: "/usr/lib/libfoo.so.1", wantStatus: http.StatusOK, want: []string{"libfoo1"}},
+		{name: "relative path", path: "usr/lib/libfoo.so.1", wantStatus: http.StatusOK, want: []string{"libfoo1"}},
+		{name: "partial matches are removed before the limit", path: "/usr/lib/libfoo.so.1", maxResults: 1, wantStatus: http.StatusOK, want: []string{"libfoo1"}},
+		{name: "no provider", path: "/usr/bin/baz", wantStatus: http.StatusOK, want: []string{}},
+		{name: "no path", path: "", wantStatus: http.StatusBadRequest},
+		{name: "invalid tag", path: "/usr/bin/", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := searchConfig{
+				Thresholds: store.CategoryThresholds{Strong: 0.75, Partial: 0.4},
+				Tiebreak:   store.Tiebreak{Mode: store.TiebreakName},
+				Precision:  -1,
+				MaxResults: tt.maxResults,
+			}
+			handler := handleErrJSON(func(w http.ResponseWriter, r *http.Request) error {
+				return whatProvides(w, ms, r.URL.Query(), sc)
+			})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/api/whatprovides?"+url.Values{"path": {tt.path}}.Encode(), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			} else if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var results []store.TagResult
+			if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, res := range results {
+				got = append(got, res.Package.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}